@@ -29,12 +29,14 @@ import (
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/console"
 	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
 	"github.com/EDXFund/MasterChain/core/state"
 	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/eth/downloader"
 	"github.com/EDXFund/MasterChain/ethdb"
 	"github.com/EDXFund/MasterChain/event"
 	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/node"
 	"github.com/EDXFund/MasterChain/trie"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
@@ -67,8 +69,10 @@ It expects the genesis file as argument.`,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.ShardPruneFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.ShardFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -76,7 +80,10 @@ The import command imports blocks from an RLP-encoded form. The form can be one
 with several RLP-encoded blocks, or several files can be used.
 
 If only one file is used, import error will result in failure. If several files are used,
-processing will proceed even if an individual RLP-file import failure occurs.`,
+processing will proceed even if an individual RLP-file import failure occurs.
+
+With --shard the files hold the blocks of a single shard chain, which a master node
+stores along the blocks of the other shards it tracks.`,
 	}
 	exportCommand = cli.Command{
 		Action:    utils.MigrateFlags(exportChain),
@@ -87,6 +94,7 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 			utils.DataDirFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
+			utils.ShardFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -94,7 +102,10 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
-be gzipped.`,
+be gzipped.
+
+With --shard the blocks of a single shard chain are written, a
+master node exports those referenced by its canonical chain.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -210,7 +221,7 @@ func importChain(ctx *cli.Context) error {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	chain, chainDb := utils.MakeChain(ctx, stack)
+	chain, chainDb, shardId := makeShardChain(ctx, stack)
 	defer chainDb.Close()
 
 	// Start periodically gathering memory profiles
@@ -231,13 +242,19 @@ func importChain(ctx *cli.Context) error {
 	// Import the chain
 	start := time.Now()
 
+	importFile := func(fn string) error {
+		if shardId == types.ShardMaster {
+			return utils.ImportChain(chain, fn)
+		}
+		return utils.ImportShardChain(chain, shardId, fn)
+	}
 	if len(ctx.Args()) == 1 {
-		if err := utils.ImportChain(chain, ctx.Args().First()); err != nil {
+		if err := importFile(ctx.Args().First()); err != nil {
 			log.Error("Import error", "err", err)
 		}
 	} else {
 		for _, arg := range ctx.Args() {
-			if err := utils.ImportChain(chain, arg); err != nil {
+			if err := importFile(arg); err != nil {
 				log.Error("Import error", "file", arg, "err", err)
 			}
 		}
@@ -304,13 +321,17 @@ func exportChain(ctx *cli.Context) error {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	chain, _ := utils.MakeChain(ctx, stack)
+	chain, _, shardId := makeShardChain(ctx, stack)
 	start := time.Now()
 
 	var err error
 	fp := ctx.Args().First()
 	if len(ctx.Args()) < 3 {
-		err = utils.ExportChain(chain, fp)
+		if shardId == types.ShardMaster {
+			err = utils.ExportChain(chain, fp)
+		} else {
+			err = utils.ExportShardChain(chain, shardId, fp)
+		}
 	} else {
 		// This can be improved to allow for numbers larger than 9223372036854775807
 		first, ferr := strconv.ParseInt(ctx.Args().Get(1), 10, 64)
@@ -321,7 +342,11 @@ func exportChain(ctx *cli.Context) error {
 		if first < 0 || last < 0 {
 			utils.Fatalf("Export error: block number must be greater than 0\n")
 		}
-		err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+		if shardId == types.ShardMaster {
+			err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+		} else {
+			err = utils.ExportAppendShardChain(chain, shardId, fp, uint64(first), uint64(last))
+		}
 	}
 
 	if err != nil {
@@ -331,6 +356,25 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// makeShardChain opens the chain holding the blocks of the shard selected by the
+// --shard flag: the chain of the shard itself on its own nodes, the master chain
+// on master nodes, as those keep the blocks of every shard they track. Datadirs
+// holding neither chain are refused rather than silently opened as master.
+func makeShardChain(ctx *cli.Context, stack *node.Node) (*core.BlockChain, ethdb.Database, uint16) {
+	shardId := uint16(ctx.GlobalInt(utils.ShardFlag.Name))
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+
+	owner := shardId
+	if shardId != types.ShardMaster && rawdb.ReadCanonicalHash(chainDb, shardId, 0) == (common.Hash{}) {
+		if rawdb.ReadCanonicalHash(chainDb, types.ShardMaster, 0) == (common.Hash{}) {
+			utils.Fatalf("No chain of shard %d in datadir, initialise it with `geth --shard %d init` first", shardId, shardId)
+		}
+		log.Info("Using master chain for shard blocks", "shard", shardId)
+		owner = types.ShardMaster
+	}
+	return utils.MakeShardChain(ctx, stack, chainDb, owner), chainDb, shardId
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -30,6 +30,7 @@ import (
 	"github.com/EDXFund/MasterChain/cmd/utils"
 	"github.com/EDXFund/MasterChain/dashboard"
 	"github.com/EDXFund/MasterChain/eth"
+	"github.com/EDXFund/MasterChain/mdc"
 	"github.com/EDXFund/MasterChain/node"
 	"github.com/EDXFund/MasterChain/params"
 	whisper "github.com/EDXFund/MasterChain/whisper/whisperv6"
@@ -80,6 +81,7 @@ type gethConfig struct {
 	Node      node.Config
 	Ethstats  ethstatsConfig
 	Dashboard dashboard.Config
+	Mdc       mdc.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -114,6 +116,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		Shh:       whisper.DefaultConfig,
 		Node:      defaultNodeConfig(),
 		Dashboard: dashboard.DefaultConfig,
+		Mdc:       mdc.DefaultConfig,
 	}
 
 	// Load config file.
@@ -136,6 +139,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 
 	utils.SetShhConfig(ctx, stack, &cfg.Shh)
 	utils.SetDashboardConfig(ctx, &cfg.Dashboard)
+	utils.SetMdcConfig(ctx, &cfg.Mdc)
 
 	return stack, cfg
 }
@@ -174,6 +178,11 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 		utils.RegisterShhService(stack, &cfg.Shh)
 	}
 
+	// Add the data custody service if a provider is configured.
+	if cfg.Mdc.Provider != "" {
+		utils.RegisterMdcService(stack, &cfg.Mdc)
+	}
+
 	// Add the Ethereum Stats daemon if requested.
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, cfg.Ethstats.URL)
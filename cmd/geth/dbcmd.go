@@ -0,0 +1,73 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/EDXFund/MasterChain/cmd/utils"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "migrate",
+				Usage:     "Check whether the chain database can be upgraded in place",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(migrateDB),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.SyncModeFlag,
+				},
+				Description: `
+    geth db migrate
+
+checks whether a chain database may be upgraded in place to the current version.
+Databases keyed by the legacy RLP encoded shard ids store shard headers without
+master reference and can't, they need a resync.`,
+			},
+		},
+	}
+)
+
+func migrateDB(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack).(*ethdb.LDBDatabase)
+	defer db.Close()
+
+	switch version := rawdb.ReadDatabaseVersion(db); version {
+	case 0, core.BlockChainVersion:
+		log.Info("Database is up to date, nothing to migrate", "version", version)
+	case core.LegacyShardKeyVersion:
+		// The shard keys could be rewritten in place, but the shard headers stored
+		// reference no master block, which changes their hashes
+		utils.Fatalf("Database version %d stores shard headers without master reference, remove it and resync", version)
+	default:
+		utils.Fatalf("Unsupported database version %d, cannot migrate to %d", version, core.BlockChainVersion)
+	}
+	return nil
+}
@@ -76,6 +76,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RinkebyFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.ShardPruneFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
@@ -234,6 +235,10 @@ var AppHelpFlagGroups = []flagGroup{
 		Name:  "WHISPER (EXPERIMENTAL)",
 		Flags: whisperFlags,
 	},
+	{
+		Name:  "DATA CUSTODY (EXPERIMENTAL)",
+		Flags: mdcFlags,
+	},
 	{
 		Name: "DEPRECATED",
 		Flags: []cli.Flag{
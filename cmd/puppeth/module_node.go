@@ -40,15 +40,15 @@ ADD genesis.json /genesis.json
 	ADD signer.pass /signer.pass
 {{end}}
 RUN \
-  echo 'geth --cache 512 init /genesis.json' > geth.sh && \{{if .Unlock}}
+  echo 'geth {{.ShardFlag}} --cache 512 init /genesis.json' > geth.sh && \{{if .Unlock}}
 	echo 'mkdir -p /root/.ethereum/keystore/ && cp /signer.json /root/.ethereum/keystore/' >> geth.sh && \{{end}}
-	echo $'exec geth --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --nat extip:{{.IP}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--miner.etherbase {{.Etherbase}} --mine --miner.threads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --miner.gastarget {{.GasTarget}} --miner.gaslimit {{.GasLimit}} --miner.gasprice {{.GasPrice}}' >> geth.sh
+	echo $'exec geth {{.ShardFlag}} --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --nat extip:{{.IP}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--miner.etherbase {{.Etherbase}} --mine --miner.threads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --miner.gastarget {{.GasTarget}} --miner.gaslimit {{.GasLimit}} --miner.gasprice {{.GasPrice}}' >> geth.sh
 
 ENTRYPOINT ["/bin/sh", "geth.sh"]
 `
 
 // nodeComposefile is the docker-compose.yml file required to deploy and maintain
-// an Ethereum node (bootnode or miner for now).
+// an Ethereum node (bootnode, miner or shard node for now).
 var nodeComposefile = `
 version: '2'
 services:
@@ -62,7 +62,8 @@ services:
       - {{.Datadir}}:/root/.ethereum{{if .Ethashdir}}
       - {{.Ethashdir}}:/root/.ethash{{end}}
     environment:
-      - PORT={{.Port}}/tcp
+      - PORT={{.Port}}/tcp{{if .Shard}}
+      - SHARD_ID={{.ShardId}}{{end}}
       - TOTAL_PEERS={{.TotalPeers}}
       - LIGHT_PEERS={{.LightPeers}}
       - STATS_NAME={{.Ethstats}}
@@ -83,7 +84,9 @@ services:
 // already exists there, it will be overwritten!
 func deployNode(client *sshClient, network string, bootnodes []string, config *nodeInfos, nocache bool) ([]byte, error) {
 	kind := "sealnode"
-	if config.keyJSON == "" && config.etherbase == "" {
+	if config.shard {
+		kind = shardNodeKind(config.shardId, config.replica)
+	} else if config.keyJSON == "" && config.etherbase == "" {
 		kind = "bootnode"
 		bootnodes = make([]string, 0)
 	}
@@ -95,6 +98,10 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 	if config.peersLight > 0 {
 		lightFlag = fmt.Sprintf("--lightpeers=%d --lightserv=50", config.peersLight)
 	}
+	shardFlag := ""
+	if config.shard {
+		shardFlag = fmt.Sprintf("--shard %d", config.shardId)
+	}
 	dockerfile := new(bytes.Buffer)
 	template.Must(template.New("").Parse(nodeDockerfile)).Execute(dockerfile, map[string]interface{}{
 		"NetworkID": config.network,
@@ -102,6 +109,7 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"IP":        client.address,
 		"Peers":     config.peersTotal,
 		"LightFlag": lightFlag,
+		"ShardFlag": shardFlag,
 		"Bootnodes": strings.Join(bootnodes, ","),
 		"Ethstats":  config.ethstats,
 		"Etherbase": config.etherbase,
@@ -119,6 +127,8 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"Ethashdir":  config.ethashdir,
 		"Network":    network,
 		"Port":       config.port,
+		"Shard":      config.shard,
+		"ShardId":    config.shardId,
 		"TotalPeers": config.peersTotal,
 		"Light":      config.peersLight > 0,
 		"LightPeers": config.peersLight,
@@ -148,10 +158,38 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 	return nil, client.Stream(fmt.Sprintf("cd %s && docker-compose -p %s up -d --build --force-recreate --timeout 60", workdir, network))
 }
 
-// nodeInfos is returned from a boot or seal node status check to allow reporting
-// various configuration parameters.
+// shardNodeKind returns the service name of a node verifying a shard chain, the
+// replica index telling apart the nodes of the same shard.
+func shardNodeKind(shardId uint16, replica int) string {
+	return fmt.Sprintf("shard%dnode%d", shardId, replica)
+}
+
+// shardNodes lists the services of the shard nodes deployed to a server, whether
+// running or not.
+func shardNodes(client *sshClient, network string) []string {
+	out, err := client.Run(fmt.Sprintf("docker ps -a --filter name=%s_shard --format '{{.Names}}'", network))
+	if err != nil {
+		return nil
+	}
+	var kinds []string
+	for _, name := range strings.Fields(string(out)) {
+		kind := strings.TrimSuffix(strings.TrimPrefix(name, network+"_"), "_1")
+
+		var shardId, replica int
+		if n, _ := fmt.Sscanf(kind, "shard%dnode%d", &shardId, &replica); n == 2 && kind == shardNodeKind(uint16(shardId), replica) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// nodeInfos is returned from a boot, seal or shard node status check to allow
+// reporting various configuration parameters.
 type nodeInfos struct {
 	genesis    []byte
+	shard      bool   // Whether the node verifies a shard chain instead of the master chain
+	shardId    uint16 // Shard chain verified by a shard node
+	replica    int    // Index of a shard node among the nodes of its shard
 	network    int64
 	datadir    string
 	ethashdir  string
@@ -178,6 +216,9 @@ func (info *nodeInfos) Report() map[string]string {
 		"Peer count (light nodes)": strconv.Itoa(info.peersLight),
 		"Ethstats username":        info.ethstats,
 	}
+	if info.shard {
+		report["Shard chain"] = strconv.Itoa(int(info.shardId))
+	}
 	if info.gasTarget > 0 {
 		// Miner or signer node
 		report["Gas price (minimum accepted)"] = fmt.Sprintf("%0.3f GWei", info.gasPrice)
@@ -211,6 +252,17 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	if !boot {
 		kind = "sealnode"
 	}
+	return checkNodeKind(client, network, kind)
+}
+
+// checkShardNode does a health-check against a node verifying a shard chain.
+func checkShardNode(client *sshClient, network string, shardId uint16, replica int) (*nodeInfos, error) {
+	return checkNodeKind(client, network, shardNodeKind(shardId, replica))
+}
+
+// checkNodeKind does a health-check against the node container running as the
+// given service.
+func checkNodeKind(client *sshClient, network string, kind string) (*nodeInfos, error) {
 	// Inspect a possible bootnode container on the host
 	infos, err := inspectContainer(client, fmt.Sprintf("%s_%s_1", network, kind))
 	if err != nil {
@@ -225,6 +277,7 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	gasTarget, _ := strconv.ParseFloat(infos.envvars["GAS_TARGET"], 64)
 	gasLimit, _ := strconv.ParseFloat(infos.envvars["GAS_LIMIT"], 64)
 	gasPrice, _ := strconv.ParseFloat(infos.envvars["GAS_PRICE"], 64)
+	shardId, shardErr := strconv.ParseUint(infos.envvars["SHARD_ID"], 10, 16)
 
 	// Container available, retrieve its node ID and its genesis json
 	var out []byte
@@ -267,6 +320,10 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 		gasPrice:   gasPrice,
 	}
 	stats.enode = string(enode)
+	if shardErr == nil {
+		stats.shard, stats.shardId = true, uint16(shardId)
+		fmt.Sscanf(kind, "shard%dnode%d", new(int), &stats.replica)
+	}
 
 	return stats, nil
 }
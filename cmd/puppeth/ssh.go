@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strings"
@@ -33,6 +34,10 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// localServer is the server name selecting the docker daemon of the local machine
+// as deployment target, reached without SSH.
+const localServer = "local"
+
 // sshClient is a small wrapper around Go's SSH client with a few utility methods
 // implemented on top.
 type sshClient struct {
@@ -41,12 +46,17 @@ type sshClient struct {
 	pubkey  []byte // RSA public key to authenticate the server
 	client  *ssh.Client
 	logger  log.Logger
+
+	local string // Working directory of commands run on the local machine (no SSH)
 }
 
 // dial establishes an SSH connection to a remote node using the current user and
 // the user's configured private RSA key. If that fails, password authentication
 // is fallen back to. server can be a string like user:identity@server:port.
 func dial(server string, pubkey []byte) (*sshClient, error) {
+	if server == localServer {
+		return dialLocal()
+	}
 	// Figure out username, identity, hostname and port
 	hostname := ""
 	hostport := server
@@ -166,6 +176,39 @@ func dial(server string, pubkey []byte) (*sshClient, error) {
 	return c, nil
 }
 
+// dialLocal creates a client running all commands on the local machine, so that
+// a network can be deployed to the local docker daemon without an SSH server.
+func dialLocal() (*sshClient, error) {
+	user, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	workdir := filepath.Join(user.HomeDir, ".puppeth", "local")
+	if err := os.MkdirAll(workdir, 0755); err != nil {
+		return nil, err
+	}
+	// Containers reach each other through the host, so advertise a routable address
+	address := "127.0.0.1"
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				address = ipnet.IP.String()
+				break
+			}
+		}
+	}
+	c := &sshClient{
+		server:  "localhost",
+		address: address,
+		logger:  log.New("server", localServer),
+		local:   workdir,
+	}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // init runs some initialization commands on the remote server to ensure it's
 // capable of acting as puppeth target.
 func (client *sshClient) init() error {
@@ -188,12 +231,19 @@ func (client *sshClient) init() error {
 
 // Close terminates the connection to an SSH server.
 func (client *sshClient) Close() error {
+	if client.client == nil {
+		return nil
+	}
 	return client.client.Close()
 }
 
 // Run executes a command on the remote server and returns the combined output
 // along with any error status.
 func (client *sshClient) Run(cmd string) ([]byte, error) {
+	if client.client == nil {
+		client.logger.Trace("Running command on local machine", "cmd", cmd)
+		return client.command(cmd).CombinedOutput()
+	}
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
@@ -209,6 +259,14 @@ func (client *sshClient) Run(cmd string) ([]byte, error) {
 // Stream executes a command on the remote server and streams all outputs into
 // the local stdout and stderr streams.
 func (client *sshClient) Stream(cmd string) error {
+	if client.client == nil {
+		command := client.command(cmd)
+		command.Stdout = os.Stdout
+		command.Stderr = os.Stderr
+
+		client.logger.Trace("Streaming command on local machine", "cmd", cmd)
+		return command.Run()
+	}
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
@@ -227,6 +285,20 @@ func (client *sshClient) Stream(cmd string) error {
 // Upload copies the set of files to a remote server via SCP, creating any non-
 // existing folders in the mean time.
 func (client *sshClient) Upload(files map[string][]byte) ([]byte, error) {
+	if client.client == nil {
+		for file, content := range files {
+			client.logger.Trace("Copying file to local workdir", "file", file, "bytes", len(content))
+
+			path := filepath.Join(client.local, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
@@ -251,3 +323,11 @@ func (client *sshClient) Upload(files map[string][]byte) ([]byte, error) {
 	}()
 	return session.CombinedOutput("/usr/bin/scp -v -tr ./")
 }
+
+// command creates a shell command executed in the working directory of a local
+// client.
+func (client *sshClient) command(cmd string) *exec.Cmd {
+	command := exec.Command("/bin/sh", "-c", cmd)
+	command.Dir = client.local
+	return command
+}
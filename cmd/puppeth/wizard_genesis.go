@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/big"
+	"math/bits"
 	"math/rand"
 	"time"
 
@@ -123,6 +124,26 @@ func (w *wizard) makeGenesis() {
 	fmt.Println("Specify your chain/network ID if you want an explicit one (default = random)")
 	genesis.Config.ChainID = new(big.Int).SetUint64(uint64(w.readDefaultInt(rand.Intn(65536))))
 
+	// Figure out how many shard chains the master chain should start with
+	fmt.Println()
+	fmt.Println("How many shards should the network start with? (default = 1)")
+	for {
+		shards := w.readDefaultInt(1)
+		if shards < 1 || shards > 1<<params.MaxShardExp {
+			log.Error("Invalid shard count", "min", 1, "max", 1<<params.MaxShardExp)
+			continue
+		}
+		genesis.ShardExp = uint16(bits.Len(uint(shards - 1)))
+		if shards > 1 {
+			enabled := true
+			genesis.Shards = make(map[uint16]*core.GenesisShard)
+			for i := 1; i < shards; i++ {
+				genesis.Shards[uint16(i)] = &core.GenesisShard{Enabled: &enabled}
+			}
+		}
+		break
+	}
+
 	// All done, store the genesis and flush to disk
 	log.Info("Configured new genesis block")
 
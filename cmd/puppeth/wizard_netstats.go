@@ -133,6 +133,14 @@ func (w *wizard) gatherStats(server string, pubkey []byte, client *sshClient) *s
 		stat.services["sealnode"] = infos.Report()
 		genesis = string(infos.genesis)
 	}
+	logger.Debug("Checking for shard node availability")
+	for _, kind := range shardNodes(client, w.network) {
+		if infos, err := checkNodeKind(client, w.network, kind); err != nil {
+			stat.services[kind] = map[string]string{"offline": err.Error()}
+		} else {
+			stat.services[kind] = infos.Report()
+		}
+	}
 	logger.Debug("Checking for explorer availability")
 	if infos, err := checkExplorer(client, w.network); err != nil {
 		if err != ErrServiceUnknown {
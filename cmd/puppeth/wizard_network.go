@@ -69,7 +69,7 @@ func (w *wizard) manageServers() {
 // If connection succeeds, the server is added to the wizards configs!
 func (w *wizard) makeServer() string {
 	fmt.Println()
-	fmt.Println("What is the remote server's address ([username[:identity]@]hostname[:port])?")
+	fmt.Printf("What is the remote server's address ([username[:identity]@]hostname[:port], or '%s' for the local docker)?\n", localServer)
 
 	// Read and dial the server to ensure docker is present
 	input := w.readString()
@@ -178,6 +178,7 @@ func (w *wizard) deployComponent() {
 	fmt.Println(" 5. Wallet    - Browser wallet for quick sends")
 	fmt.Println(" 6. Faucet    - Crypto faucet to give away funds")
 	fmt.Println(" 7. Dashboard - Website listing above web-services")
+	fmt.Println(" 8. Shards    - Nodes verifying every shard chain")
 
 	switch w.read() {
 	case "1":
@@ -194,6 +195,8 @@ func (w *wizard) deployComponent() {
 		w.deployFaucet()
 	case "7":
 		w.deployDashboard()
+	case "8":
+		w.deployShards()
 	default:
 		log.Error("That's not something I can do")
 	}
@@ -42,6 +42,12 @@ func (w *wizard) deployNode(boot bool) {
 	if server == "" {
 		return
 	}
+	w.deployNodeTo(server, boot)
+}
+
+// deployNodeTo creates a new node configuration on the given server based on
+// some user input.
+func (w *wizard) deployNodeTo(server string, boot bool) {
 	client := w.servers[server]
 
 	// Retrieve any active node configurations from the server
@@ -0,0 +1,158 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/EDXFund/MasterChain/log"
+)
+
+// deployShards deploys the nodes verifying the shard chains of the network to a
+// server, next to the master node sealing on the same server. The master node is
+// deployed first if it's not running yet, and the shard nodes boot from it.
+func (w *wizard) deployShards() {
+	// Do some sanity check before the user wastes time on input
+	if w.conf.Genesis == nil {
+		log.Error("No genesis block configured")
+		return
+	}
+	if w.conf.ethstats == "" {
+		log.Error("No ethstats server configured")
+		return
+	}
+	shards := w.conf.Genesis.EnabledShards()
+
+	// Select the server to interact with and ensure the master node is running
+	server := w.selectServer()
+	if server == "" {
+		return
+	}
+	client := w.servers[server]
+
+	master, err := checkNode(client, w.network, false)
+	if err == ErrServiceUnknown {
+		log.Info("No master node on the server, deploying it first")
+		w.deployNodeTo(server, false)
+
+		for i := 0; i < 10 && err != nil; i++ {
+			time.Sleep(3 * time.Second)
+			master, err = checkNode(client, w.network, false)
+		}
+	}
+	if err != nil {
+		log.Error("Master node not available", "err", err)
+		return
+	}
+	existing := shardNodes(client, w.network)
+
+	// Figure out how many nodes to run per shard and where to put them
+	replicas := 1
+	for contains(existing, shardNodeKind(0, replicas)) {
+		replicas++
+	}
+	fmt.Println()
+	fmt.Printf("How many nodes should verify each of the %d shards? (default = %d)\n", len(shards), replicas)
+	for {
+		if replicas = w.readDefaultInt(replicas); replicas > 0 {
+			break
+		}
+		log.Error("At least one node per shard is needed")
+		replicas = 1
+	}
+	fmt.Println()
+	fmt.Printf("Which TCP/UDP port should the first shard node listen on? (default = %d)\n", master.port+1)
+	port := w.readDefaultInt(master.port + 1)
+
+	fmt.Println()
+	fmt.Printf("Where should shard data be stored on the remote machine? (default = %s-shards)\n", master.datadir)
+	datadir := w.readDefaultString(master.datadir + "-shards")
+
+	fmt.Println()
+	fmt.Printf("How many peers to allow connecting to a shard node? (default = %d)\n", 50)
+	peers := w.readDefaultInt(50)
+
+	// Deploy the shard nodes, reusing the settings of the master. Only the first
+	// node of each shard seals with the credentials of the master, the others just
+	// verify the shard chain so that no two nodes sign with the same key.
+	bootnodes := append(append([]string{}, w.conf.bootnodes...), master.enode)
+	genesis, _ := json.MarshalIndent(w.conf.Genesis, "", "  ")
+
+	deployed := make(map[string]bool)
+	for _, shardId := range shards {
+		for replica := 0; replica < replicas; replica++ {
+			kind := shardNodeKind(shardId, replica)
+			infos := &nodeInfos{
+				genesis:    genesis,
+				network:    w.conf.Genesis.Config.ChainID.Int64(),
+				shard:      true,
+				shardId:    shardId,
+				replica:    replica,
+				datadir:    path.Join(datadir, kind),
+				ethashdir:  master.ethashdir,
+				ethstats:   fmt.Sprintf("%s-%s:%s", master.ethstats, kind, w.conf.ethstats),
+				port:       port + len(deployed),
+				peersTotal: peers,
+				gasTarget:  master.gasTarget,
+				gasLimit:   master.gasLimit,
+				gasPrice:   master.gasPrice,
+			}
+			if replica == 0 {
+				infos.etherbase, infos.keyJSON, infos.keyPass = master.etherbase, master.keyJSON, master.keyPass
+			}
+			log.Info("Deploying shard node", "shard", shardId, "replica", replica, "port", infos.port)
+			if out, err := deployNode(client, w.network, bootnodes, infos, false); err != nil {
+				log.Error("Failed to deploy shard node container", "shard", shardId, "replica", replica, "err", err)
+				if len(out) > 0 {
+					fmt.Printf("%s\n", out)
+				}
+				return
+			}
+			deployed[kind] = true
+		}
+	}
+	// Tear down the nodes of disabled shards and surplus replicas
+	for _, kind := range existing {
+		if deployed[kind] {
+			continue
+		}
+		if out, err := tearDown(client, w.network, kind, true); err != nil {
+			log.Error("Failed to tear down stale shard node", "service", kind, "err", err)
+			if len(out) > 0 {
+				fmt.Printf("%s\n", out)
+			}
+		}
+	}
+	// All ok, run a network scan to pick any changes up
+	log.Info("Waiting for shard nodes to finish booting")
+	time.Sleep(3 * time.Second)
+
+	w.networkStats()
+}
+
+// contains reports whether a service name is among the given ones.
+func contains(services []string, service string) bool {
+	for _, s := range services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
@@ -127,7 +127,12 @@ func main() {
 		})
 
 		stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-			return dashboard.New(&cfg.Dashboard, strconv.Itoa(int(cfg.Eth.ShardId)), ctx.ResolvePath("logs")), nil
+			var backend dashboard.ShardBackend
+			var ethServ *eth.Ethereum
+			if ctx.Service(&ethServ) == nil {
+				backend = ethServ
+			}
+			return dashboard.New(&cfg.Dashboard, strconv.Itoa(int(cfg.Eth.ShardId)), ctx.ResolvePath("logs"), backend), nil
 		})
 
 		if err != nil {
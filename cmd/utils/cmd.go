@@ -86,6 +86,40 @@ func StartNode(stack *node.Node) {
 }
 
 func ImportChain(chain *core.BlockChain, fn string) error {
+	decode := func(stream *rlp.Stream) (types.BlockIntf, error) {
+		var b types.Block
+		if err := stream.Decode(&b); err != nil {
+			return nil, err
+		}
+		return &b, nil
+	}
+	return importBlocks(chain, fn, decode, missingBlocks)
+}
+
+// ImportShardChain imports the chain of a single shard from an RLP stream of its
+// blocks. A master node stores them as blocks of a tracked shard, a shard node
+// inserts them into its own chain.
+func ImportShardChain(chain *core.BlockChain, shardId uint16, fn string) error {
+	decode := func(stream *rlp.Stream) (types.BlockIntf, error) {
+		var b types.SBlock
+		if err := stream.Decode(&b); err != nil {
+			return nil, err
+		}
+		if b.ShardId() != shardId {
+			return nil, fmt.Errorf("block of shard %d in the chain of shard %d", b.ShardId(), shardId)
+		}
+		return &b, nil
+	}
+	missing := missingBlocks
+	if shardId != chain.ShardId() {
+		missing = missingShardBlocks
+	}
+	return importBlocks(chain, fn, decode, missing)
+}
+
+// importBlocks inserts the blocks decoded from an RLP stream into the chain in
+// batches, starting each batch from the first block filter reports missing.
+func importBlocks(chain *core.BlockChain, fn string, decode func(*rlp.Stream) (types.BlockIntf, error), filter func(*core.BlockChain, []types.BlockIntf) []types.BlockIntf) error {
 	// Watch for Ctrl-C while the import is running.
 	// If a signal is received, the import will stop at the next batch.
 	interrupt := make(chan os.Signal, 1)
@@ -135,8 +169,8 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		}
 		i := 0
 		for ; i < importBatchSize; i++ {
-			var b types.Block
-			if err := stream.Decode(&b); err == io.EOF {
+			b, err := decode(stream)
+			if err == io.EOF {
 				break
 			} else if err != nil {
 				return fmt.Errorf("at block %d: %v", n, err)
@@ -146,7 +180,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 				i--
 				continue
 			}
-			blocks[i] = &b
+			blocks[i] = b
 			n++
 		}
 		if i == 0 {
@@ -156,7 +190,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		if checkInterrupt() {
 			return fmt.Errorf("interrupted")
 		}
-		missing := missingBlocks(chain, blocks[:i])
+		missing := filter(chain, blocks[:i])
 		if len(missing) == 0 {
 			log.Info("Skipping batch as all blocks present", "batch", batch, "first", blocks[0].Hash(), "last", blocks[i-1].Hash())
 			continue
@@ -186,6 +220,17 @@ func missingBlocks(chain *core.BlockChain, blocks []types.BlockIntf) []types.Blo
 	return nil
 }
 
+// missingShardBlocks returns the blocks of a tracked shard, starting with the
+// first one the chain doesn't store yet.
+func missingShardBlocks(chain *core.BlockChain, blocks []types.BlockIntf) []types.BlockIntf {
+	for i, block := range blocks {
+		if !chain.HasBlock(block.Hash(), block.NumberU64()) {
+			return blocks[i:]
+		}
+	}
+	return nil
+}
+
 // ExportChain exports a blockchain into the specified file, truncating any data
 // already present in the file.
 func ExportChain(blockchain *core.BlockChain, fn string) error {
@@ -237,6 +282,53 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+// ExportShardChain exports the chain of a single shard into the specified file,
+// truncating any data already present in the file.
+func ExportShardChain(blockchain *core.BlockChain, shardId uint16, fn string) error {
+	log.Info("Exporting shard chain", "shard", shardId, "file", fn)
+
+	err := exportFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, func(writer io.Writer) error {
+		return blockchain.ExportShard(writer, shardId)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Exported shard chain", "shard", shardId, "file", fn)
+	return nil
+}
+
+// ExportAppendShardChain exports a range of the chain of a single shard into the
+// specified file, appending to the file if data already exists in it.
+func ExportAppendShardChain(blockchain *core.BlockChain, shardId uint16, fn string, first uint64, last uint64) error {
+	log.Info("Exporting shard chain", "shard", shardId, "file", fn)
+
+	err := exportFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, func(writer io.Writer) error {
+		return blockchain.ExportShardN(writer, shardId, first, last)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Exported shard chain to", "shard", shardId, "file", fn)
+	return nil
+}
+
+// exportFile opens the specified file with the given flags, potentially wrapped
+// with a gzip stream, and writes into it.
+func exportFile(fn string, flag int, write func(io.Writer) error) error {
+	fh, err := os.OpenFile(fn, flag, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	return write(writer)
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
 func ImportPreimages(db *ethdb.LDBDatabase, fn string) error {
 	log.Info("Importing preimages", "file", fn)
@@ -46,6 +46,7 @@ import (
 	"github.com/EDXFund/MasterChain/ethdb"
 	"github.com/EDXFund/MasterChain/ethstats"
 	"github.com/EDXFund/MasterChain/les"
+	"github.com/EDXFund/MasterChain/mdc"
 	"github.com/EDXFund/MasterChain/log"
 	"github.com/EDXFund/MasterChain/metrics"
 	"github.com/EDXFund/MasterChain/metrics/influxdb"
@@ -173,6 +174,10 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	ShardPruneFlag = cli.Uint64Flag{
+		Name:  "shard.prune",
+		Usage: fmt.Sprintf("Number of confirmations after which a master node prunes shard block bodies (0 = keep all, at least %d otherwise)", core.MinShardPruneDepth),
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -577,6 +582,17 @@ var (
 		Usage: "Restrict connection between two whisper light clients",
 	}
 
+	// Data custody settings
+	MdcProviderFlag = cli.StringFlag{
+		Name:  "mdc.provider",
+		Usage: `Enables the data custody service on the given provider ("memory", "leveldb" or "swarm")`,
+	}
+	MdcFeeFlag = BigFlag{
+		Name:  "mdc.fee",
+		Usage: "Fee charged by the data custody service per access",
+		Value: mdc.DefaultConfig.Fee,
+	}
+
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
 		Name:  metrics.MetricsEnabledFlag,
@@ -821,6 +837,16 @@ func setIPC(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// makeShardPruneDepth returns the shard prune depth requested by the user, making
+// sure it leaves enough confirmed shard bodies around for fraud proofs.
+func makeShardPruneDepth(ctx *cli.Context) uint64 {
+	depth := ctx.GlobalUint64(ShardPruneFlag.Name)
+	if depth > 0 && depth < core.MinShardPruneDepth {
+		Fatalf("--%s must be either 0 or at least %d", ShardPruneFlag.Name, core.MinShardPruneDepth)
+	}
+	return depth
+}
+
 // makeDatabaseHandles raises out the number of allowed file handles per process
 // for Geth and returns half of the allowance to assign to the database.
 func makeDatabaseHandles() int {
@@ -1165,6 +1191,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	if ctx.GlobalIsSet(ShardPruneFlag.Name) {
+		cfg.ShardPruneDepth = makeShardPruneDepth(ctx)
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -1260,6 +1289,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	}
 }
 
+// SetMdcConfig applies data custody related command line flags to the config.
+func SetMdcConfig(ctx *cli.Context, cfg *mdc.Config) {
+	if ctx.GlobalIsSet(MdcProviderFlag.Name) {
+		cfg.Provider = ctx.GlobalString(MdcProviderFlag.Name)
+	}
+	if ctx.GlobalIsSet(MdcFeeFlag.Name) {
+		cfg.Fee = GlobalBig(ctx, MdcFeeFlag.Name)
+	}
+}
+
 // SetDashboardConfig applies dashboard related command line flags to the config.
 func SetDashboardConfig(ctx *cli.Context, cfg *dashboard.Config) {
 	cfg.Host = ctx.GlobalString(DashboardAddrFlag.Name)
@@ -1292,7 +1331,12 @@ func RegisterEthService(stack *node.Node, cfg *eth.Config) {
 // RegisterDashboardService adds a dashboard to the stack.
 func RegisterDashboardService(stack *node.Node, cfg *dashboard.Config, commit string) {
 	stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-		return dashboard.New(cfg, commit, ctx.ResolvePath("logs")), nil
+		var backend dashboard.ShardBackend
+		var ethServ *eth.Ethereum
+		if ctx.Service(&ethServ) == nil {
+			backend = ethServ
+		}
+		return dashboard.New(cfg, commit, ctx.ResolvePath("logs"), backend), nil
 	})
 }
 
@@ -1305,6 +1349,22 @@ func RegisterShhService(stack *node.Node, cfg *whisper.Config) {
 	}
 }
 
+// RegisterMdcService adds a data custody service to the stack, paid to the
+// etherbase unless a payee is configured.
+func RegisterMdcService(stack *node.Node, cfg *mdc.Config) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		if cfg.Payee == (common.Address{}) {
+			var ethServ *eth.Ethereum
+			if ctx.Service(&ethServ) == nil {
+				cfg.Payee, _ = ethServ.Etherbase()
+			}
+		}
+		return mdc.New(ctx, ctx.AccountManager, cfg)
+	}); err != nil {
+		Fatalf("Failed to register the data custody service: %v", err)
+	}
+}
+
 // RegisterEthStatsService configures the Ethereum Stats daemon and adds it to
 // the given node.
 func RegisterEthStatsService(stack *node.Node, url string) {
@@ -1375,10 +1435,14 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 
 // MakeChain creates a chain manager from set command line flags.
 func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chainDb ethdb.Database) {
-	var err error
 	chainDb = MakeChainDatabase(ctx, stack)
 
-	 shardId := uint16(ctx.GlobalInt64(ShardFlag.Name))
+	return MakeShardChain(ctx, stack, chainDb, uint16(ctx.GlobalInt64(ShardFlag.Name))), chainDb
+}
+
+// MakeShardChain creates a chain manager of the given shard on top of chainDb
+// from set command line flags.
+func MakeShardChain(ctx *cli.Context, stack *node.Node, chainDb ethdb.Database, shardId uint16) (chain *core.BlockChain) {
 	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx),shardId)
 	if err != nil {
 		Fatalf("%v", err)
@@ -1403,9 +1467,10 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cache := &core.CacheConfig{
-		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
-		TrieNodeLimit: eth.DefaultConfig.TrieCache,
-		TrieTimeLimit: eth.DefaultConfig.TrieTimeout,
+		Disabled:        ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieNodeLimit:   eth.DefaultConfig.TrieCache,
+		TrieTimeLimit:   eth.DefaultConfig.TrieTimeout,
+		ShardPruneDepth: makeShardPruneDepth(ctx),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -1416,7 +1481,7 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
-	return chain, chainDb
+	return chain
 }
 
 // MakeConsolePreloads retrieves the absolute paths for the console JavaScript
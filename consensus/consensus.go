@@ -53,6 +53,14 @@ type ChainReader interface {
 	SetCacheHeader(header types.HeaderIntf)
 }
 
+// ShardSlasher is implemented by master chains knowing about shards proven to
+// have produced invalid blocks, which forfeit their reward remains.
+type ShardSlasher interface {
+	// SlashedShards retrieves the shards whose reward remains are to be
+	// forfeited by the child of the given master block.
+	SlashedShards(parent common.Hash) []uint16
+}
+
 // Engine is an algorithm agnostic consensus engine.
 type Engine interface {
 	// Author retrieves the Ethereum address of the account that minted the given
@@ -605,7 +605,11 @@ func (ethash *Ethash) finalizeShard(chain consensus.ChainReader, header types.He
 func (ethash *Ethash) finalizeMaster(chain consensus.ChainReader, header types.HeaderIntf, state *state.StateDB, blks []*types.ShardBlockInfo, receipts []*types.Receipt) (types.BlockIntf, error) {
 	// Accumulate any block and uncle rewards and commit the final state root
 	parent := chain.GetHeader(header.ParentHash(), header.NumberU64()-1)
-	accumulateRewards(chain.Config(), state, parent, header, blks)
+	var slashed []uint16
+	if slasher, ok := chain.(consensus.ShardSlasher); ok {
+		slashed = slasher.SlashedShards(header.ParentHash())
+	}
+	accumulateRewards(chain.Config(), state, parent, header, blks, slashed)
 	header.SetRoot(state.IntermediateRoot(chain.Config().IsEIP158(header.Number())))
 
 	// Header seems complete, assemble into a block and return
@@ -672,8 +676,9 @@ var rewardBaseUint = new(big.Int).Mul(big.NewInt(1e10), big.NewInt(3125))
 // AccumulateRewards credits the coinbase of the given block with the mining
 // reward. The total reward consists of the static block reward and rewards for
 // included uncles. The coinbase of each uncle block is also rewarded.
-// the more shard included the more main block can be rewarded
-func accumulateRewards(config *params.ChainConfig, state *state.StateDB, parent types.HeaderIntf, header types.HeaderIntf, blks []*types.ShardBlockInfo) {
+// the more shard included the more main block can be rewarded. Shards proven to
+// have produced an invalid block are slashed, forfeiting their reward remains.
+func accumulateRewards(config *params.ChainConfig, state *state.StateDB, parent types.HeaderIntf, header types.HeaderIntf, blks []*types.ShardBlockInfo, slashed []uint16) {
 	// Select the correct block reward based on chain progression
 
 	blockRewardBase := new(big.Int).Mul(big.NewInt(1e14), big.NewInt(3125))
@@ -723,6 +728,12 @@ func accumulateRewards(config *params.ChainConfig, state *state.StateDB, parent
 	for _, shardState := range rewardInHeader {
 		rewardRemains[shardState.ShardId] = &shardState
 	}
+	for _, shardId := range slashed {
+		if ss, ok := rewardRemains[shardId]; ok {
+			log.Debug("Slashing shard reward remains", "shard", shardId, "remains", ss.RewardRemains)
+			ss.RewardRemains = 0
+		}
+	}
 	for seg, enabled := range shardEnabled {
 		for i := 0; i < 8; i++ {
 			if (enabled & bitMask[i]) != 0 {
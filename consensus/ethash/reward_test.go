@@ -0,0 +1,62 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that a slashed shard forfeits the reward remains accumulated so far,
+// while the other shards keep theirs.
+func TestSlashedShardRewards(t *testing.T) {
+	var enabled [32]byte
+	enabled[0] = 0x03
+
+	parent := new(types.Header)
+	parent.FillBy(&types.HeaderStruct{Number: big.NewInt(1), ShardEnabled: enabled})
+	parent.SetShardState([]types.ShardState{{ShardId: 0, RewardRemains: 50000}, {ShardId: 1, RewardRemains: 50000}})
+
+	remains := func(slashed []uint16) map[uint16]uint32 {
+		header := new(types.Header)
+		header.FillBy(&types.HeaderStruct{ParentHash: parent.Hash(), Number: big.NewInt(2), ShardEnabled: enabled})
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+		accumulateRewards(params.TestChainConfig, statedb, parent, header, nil, slashed)
+
+		result := make(map[uint16]uint32)
+		for _, ss := range header.ShardState() {
+			result[ss.ShardId] = ss.RewardRemains
+		}
+		return result
+	}
+	kept := remains(nil)
+	slashed := remains([]uint16{1})
+
+	if slashed[0] != kept[0] {
+		t.Errorf("unslashed shard remains mismatch: have %d, want %d", slashed[0], kept[0])
+	}
+	if want := kept[1] - 50000; slashed[1] != want {
+		t.Errorf("slashed shard remains mismatch: have %d, want %d", slashed[1], want)
+	}
+}
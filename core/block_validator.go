@@ -18,6 +18,8 @@ package core
 
 import (
 	"fmt"
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
 	"github.com/EDXFund/MasterChain/crypto"
 	"github.com/EDXFund/MasterChain/rlp"
 
@@ -79,6 +81,22 @@ func (v *BlockValidator) validateSBody(block *types.SBlock) error {
 	if hash := types.DeriveSha(types.ContractResults(block.Results())); hash != header.ReceiptHash() {
 		return fmt.Errorf("1transaction root hash mismatch: have %x, want %x", hash, header.TxHash())
 	}
+	if rawdb.ReadInvalidShardBlock(v.bc.db, block.Hash()) != (common.Hash{}) {
+		return ErrInvalidShardBlock
+	}
+	// The referenced master block routes the transactions, it must be known and
+	// may not go back behind the parent's
+	sheader := block.Header().ToSHeader()
+	if sheader.MasterHash() == (common.Hash{}) && sheader.MasterNumber() != 0 {
+		return ErrMasterReference
+	}
+	parent := v.bc.GetHeader(block.ParentHash(), block.NumberU64()-1).ToSHeader()
+	if sheader.MasterNumber() < parent.MasterNumber() {
+		return ErrMasterReference
+	}
+	if v.bc.routingHeader(sheader) == nil {
+		return ErrUnknownMasterBlock
+	}
 	return nil
 }
 // ValidateBody validates the given block's uncles and verifies the block
@@ -107,6 +125,21 @@ func (v *BlockValidator) validateBody(block *types.Block) error {
 	if hash := types.DeriveSha(types.ShardBlockInfos(block.ShardBlocks())); hash != header.ShardTxsHash() {
 		return fmt.Errorf("2transaction root hash mismatch: have %x, want %x", hash, header.TxHash())
 	}
+	// The shard layout may only change at epoch boundaries, as the load requires
+	parent := v.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if err := v.bc.verifyShardLayout(parent, header); err != nil {
+		return err
+	}
+	layouts := AcceptedLayouts(v.bc, header)
+	for _, info := range block.ShardBlocks() {
+		if !layouts.IsEnabled(info.ShardId) {
+			return ErrShardDisabled
+		}
+		// Shard blocks proven invalid must not be included
+		if rawdb.ReadInvalidShardBlock(v.bc.db, info.Hash) != (common.Hash{}) {
+			return ErrInvalidShardBlock
+		}
+	}
 	return nil
 }
 func (v *BlockValidator) ValidateState(block, parent types.BlockIntf, statedb *state.StateDB, receipts types.Receipts, usedGas uint64) error {
@@ -117,22 +150,38 @@ func (v *BlockValidator) ValidateState(block, parent types.BlockIntf, statedb *s
 		return v.validateShardState(block.ToSBlock(),parent.ToSBlock(),statedb,usedGas)
 	}
 }
+// validateRejected validates the rejected transactions bloom of a master block
+// against the transactions its processing rejected.
+func validateRejected(block types.BlockIntf, rejected []*types.RejectedTx) error {
+	if block.ShardId() != types.ShardMaster {
+		return nil
+	}
+	if rbloom := types.CreateRejectBloom(rejected); rbloom != block.BloomRejected() {
+		return fmt.Errorf("invalid rejected bloom (remote: %x  local: %x)", block.BloomRejected(), rbloom)
+	}
+	return nil
+}
+
 // ValidateState validates the various changes that happen after a state
 // transition, such as amount of used gas, the receipt roots and the state root
 // itself. ValidateState returns a database batch if the validation was a success
 // otherwise nil and an error is returned.
 func (v *BlockValidator) validateShardState(block, parent *types.SBlock, statedb *state.StateDB, usedGas uint64) error {
 	header := block.Header()
-	/*if block.GasUsed() != usedGas {
+	if block.GasUsed() != usedGas {
 		return fmt.Errorf("invalid gas used (remote: %d local: %d)", block.GasUsed(), usedGas)
-	}*/
+	}
 
 	// Tre receipt Trie's root (R = (Tr [[H1, R1], ... [Hn, R1]]))
 	receiptSha := types.DeriveSha(types.ContractResults(block.Results()))
 	if receiptSha != header.ReceiptHash() {
 		return fmt.Errorf("invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash(), receiptSha)
 	}
-
+	// Validate the state root against the received state root and throw
+	// an error if they don't match.
+	if root := statedb.IntermediateRoot(v.config.IsEIP158(header.Number())); header.Root() != root {
+		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root(), root)
+	}
 	return nil
 }
 
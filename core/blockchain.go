@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	mrand "math/rand"
 	. "os"
@@ -70,10 +71,26 @@ const (
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
+	layoutCacheLimit    = 16
 	triesInMemory       = 128
 
+	// shardTxFetchTimeout is the time allowed to a peer of a shard to deliver the
+	// transactions of a shard block missing locally, before another one is asked.
+	shardTxFetchTimeout = 5 * time.Second
+
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
-	BlockChainVersion = 3
+	BlockChainVersion = 5
+
+	// LegacyShardKeyVersion is the last database version keying shard data by RLP
+	// encoded shard ids. Its shard headers reference no master block either, so
+	// such databases can't be upgraded in place and need a resync.
+	LegacyShardKeyVersion = 3
+
+	// MinShardPruneDepth is the least number of confirmations after which shard
+	// block bodies may be pruned. The shard layout of an epoch boundary is computed
+	// from the bodies of the whole epoch before it, and fraud proofs re-execute
+	// them, so they are kept for an epoch and its transition period.
+	MinShardPruneDepth = params.ShardEpochLength + params.ShardTransitionLength
 )
 
 type qChain interface {
@@ -86,6 +103,8 @@ type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+
+	ShardPruneDepth uint64 // Number of confirmations after which a master node prunes shard block bodies (0 = keep all)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -124,6 +143,7 @@ type BlockChain struct {
 	chainHeadFeed  event.Feed
 	logsFeed       event.Feed
 	chainErrorFeed event.Feed
+	fraudProofFeed event.Feed
 	scope          event.SubscriptionScope
 	genesisBlock   types.BlockIntf
 
@@ -142,6 +162,7 @@ type BlockChain struct {
 	receiptsCache *lru.Cache     // Cache for the most recent receipts per block
 	blockCache    *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
+	layoutCache   *lru.Cache     // Shard layouts of the first blocks of recent epochs, keyed by parent hash
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -154,6 +175,8 @@ type BlockChain struct {
 	validator    Validator // block and state validator interface
 	vmConfig     vm.Config
 	latestShards map[uint16]*types.ShardBlockInfo
+	shardPolicy  atomic.Value // Policy routing transactions to shards (ShardPolicy)
+	txFetcher    atomic.Value // Retriever of shard block transactions missing locally (ShardTxFetcher)
 	//当这个是子链时，会有与主链同步的信息
 	master_head    *HeaderChain
 	genesis        *Genesis
@@ -171,12 +194,19 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			TrieTimeLimit: 5 * time.Minute,
 		}
 	}
+	if depth := cacheConfig.ShardPruneDepth; depth > 0 && depth < MinShardPruneDepth {
+		log.Warn("Shard prune depth too low, raising", "provided", depth, "updated", MinShardPruneDepth)
+		config := *cacheConfig
+		config.ShardPruneDepth = MinShardPruneDepth
+		cacheConfig = &config
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	receiptsCache, _ := lru.New(receiptsCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
+	layoutCache, _ := lru.New(layoutCacheLimit)
 
 	bc := &BlockChain{
 		chainConfig:    chainConfig,
@@ -192,15 +222,15 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		receiptsCache:  receiptsCache,
 		blockCache:     blockCache,
 		futureBlocks:   futureBlocks,
+		layoutCache:    layoutCache,
 		engine:         engine,
 		vmConfig:       vmConfig,
 		badBlocks:      badBlocks,
 	}
 
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
-	if shardId != types.ShardMaster {
-		bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine, nil))
-	}
+	// The master processor needs no pool, shard chains set up theirs with one
+	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine, nil))
 
 	var err error
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.getProcInterrupt, shardId)
@@ -211,7 +241,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 
 	} else {
 		bc.master_head, err = NewHeaderChain(db, chainConfig, engine, bc.getProcInterrupt, types.ShardMaster)
-
+		if err != nil {
+			return nil, err
+		}
 	}
 	bc.genesisBlock = bc.GetBlockByNumber(0)
 	if bc.genesisBlock == nil || reflect.ValueOf(bc.genesisBlock).IsNil() {
@@ -247,10 +279,10 @@ func (bc *BlockChain) getProcInterrupt() bool {
 }
 
 func (bc *BlockChain) getShardExp() uint16 {
-	return bc.CurrentHeader().ToHeader().ShardExp()
+	return bc.masterHeader().ShardExp()
 }
 func (bc *BlockChain) getShardEnabledState() [32]byte {
-	return bc.CurrentHeader().ToHeader().ShardEnabled()
+	return bc.masterHeader().ShardEnabled()
 }
 func (bc *BlockChain) GetLatestShards() map[uint16]*types.ShardBlockInfo {
 	return bc.latestShards
@@ -284,20 +316,203 @@ func (bc *BlockChain) GetLatestShard(shardId uint16) *types.ShardBlockInfo {
 /*func (bc *BlockChain) GetLatestHash() common.Hash{
 	return types.rlpHash(bc.latestShards)
 }*/
-var maskBits = [16]uint16{0x00, 0x01, 0x03, 0x07, 0xF, 0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF, 0x3FFF, 0x7FFF}
-
-func (bc *BlockChain) TxShardByHash(txHash common.Hash) uint16 {
-	hashBytes := txHash.Bytes()
-	targetShard := uint16(hashBytes[0]) + (uint16(hashBytes[1]) << 8)
-	shardIndex := bc.getShardExp()
-	targetShard = (targetShard & maskBits[shardIndex])
-	shardState := bc.CurrentHeader().ToHeader().ShardEnabled()
-	seg := shardState[int(targetShard>>3)]
-	if (seg & (1 << (targetShard & 0x7))) != 0 {
-		return targetShard
+
+// masterHeader returns the head header of the master chain, which carries the
+// shard layout (ShardExp and ShardEnabled) of the whole network.
+func (bc *BlockChain) masterHeader() *types.Header {
+	if bc.shardId == types.ShardMaster {
+		return bc.CurrentHeader().ToHeader()
+	}
+	return bc.master_head.CurrentHeader().ToHeader()
+}
+
+// masterHeaderByNumber returns the canonical master header of the given
+// number, or nil if it is unknown.
+func (bc *BlockChain) masterHeaderByNumber(number uint64) types.HeaderIntf {
+	var header types.HeaderIntf
+	if bc.shardId == types.ShardMaster {
+		header = bc.GetHeaderByNumber(number)
 	} else {
-		return 0
+		header = bc.master_head.GetHeaderByNumber(number)
+	}
+	if header == nil || reflect.ValueOf(header).IsNil() {
+		return nil
+	}
+	return header
+}
+
+// SetShardPolicy replaces the policy used to route transactions to shards.
+func (bc *BlockChain) SetShardPolicy(policy ShardPolicy) {
+	bc.shardPolicy.Store(policy)
+}
+
+// ShardPolicy returns the policy used to route transactions to shards.
+func (bc *BlockChain) ShardPolicy() ShardPolicy {
+	if policy := bc.shardPolicy.Load(); policy != nil {
+		return policy.(ShardPolicy)
+	}
+	return DefaultShardPolicy
+}
+
+// SetShardTxFetcher sets the retriever used to fetch the transactions of shard
+// blocks missing from the local pool.
+func (bc *BlockChain) SetShardTxFetcher(fetcher ShardTxFetcher) {
+	bc.txFetcher.Store(fetcher)
+}
+
+// prefetchShardTxs retrieves the transactions of the shard blocks a chain
+// segment processes which are missing locally from the peers of their shards,
+// storing the delivered ones for the processor to find. It must be called
+// without holding the chain lock, as it waits for the network.
+func (bc *BlockChain) prefetchShardTxs(chain types.BlockIntfs) {
+	fetcher, ok := bc.txFetcher.Load().(ShardTxFetcher)
+	if !ok {
+		return
+	}
+	processor, ok := bc.Processor().(*StateProcessor)
+	if !ok {
+		return
+	}
+	missing := make(map[uint16][]common.Hash)
+	for _, block := range chain {
+		if block.ShardId() != types.ShardMaster {
+			missing[block.ShardId()] = append(missing[block.ShardId()], processor.missingShardTxs(block)...)
+			continue
+		}
+		for _, info := range block.ShardBlocks() {
+			if shardBlock := rawdb.ReadBlock(bc.db, info.Hash, info.BlockNumber); shardBlock != nil && !reflect.ValueOf(shardBlock).IsNil() {
+				missing[info.ShardId] = append(missing[info.ShardId], processor.missingShardTxs(shardBlock)...)
+			}
+		}
+	}
+	for shardId, hashes := range missing {
+		if len(hashes) == 0 {
+			continue
+		}
+		log.Debug("Fetching missing shard transactions", "shard", shardId, "count", len(hashes))
+		wanted := make(map[common.Hash]bool, len(hashes))
+		for _, hash := range hashes {
+			wanted[hash] = true
+		}
+		for _, tx := range fetcher.FetchShardTxs(shardId, hashes, shardTxFetchTimeout) {
+			if hash := tx.Hash(); wanted[hash] {
+				rawdb.WriteRawTransaction(bc.db, hash, tx)
+			}
+		}
+	}
+}
+
+// CurrentMasterHeader returns the head header of the master chain, carrying the
+// shard layout the network currently runs with. On a shard chain it is the head
+// of the master header chain the shard follows.
+func (bc *BlockChain) CurrentMasterHeader() types.HeaderIntf {
+	return bc.masterHeader()
+}
+
+// masterReader returns the reader of the master headers: the chain itself on the
+// master chain, the followed master header chain on a shard chain.
+func (bc *BlockChain) masterReader() consensus.ChainReader {
+	if bc.shardId == types.ShardMaster {
+		return bc
+	}
+	return bc.master_head
+}
+
+// txShardKey returns the routing key of a transaction under the shard policy.
+func (bc *BlockChain) txShardKey(master types.HeaderIntf, tx *types.Transaction) (uint16, error) {
+	from, err := types.Sender(types.MakeSigner(bc.chainConfig, master.Number()), tx)
+	if err != nil {
+		return 0, err
 	}
+	return bc.ShardPolicy().ShardKey(from, tx.To()), nil
+}
+
+// TxShard returns the shard owning the transaction according to the shard
+// policy of the chain and the shard layout of the given master header.
+func (bc *BlockChain) TxShard(master types.HeaderIntf, tx *types.Transaction) (uint16, error) {
+	key, err := bc.txShardKey(master, tx)
+	if err != nil {
+		return 0, err
+	}
+	return LayoutOf(master).Shard(key), nil
+}
+
+// TxShards returns the shards accepting the transaction at the given master
+// header: its shard under the layout of the header and, during the transition
+// period following a layout change, its shard under the previous one. The
+// previous layout is looked up through the ancestry of the header, never
+// through the canonical chain.
+func (bc *BlockChain) TxShards(master types.HeaderIntf, tx *types.Transaction) ([]uint16, error) {
+	key, err := bc.txShardKey(master, tx)
+	if err != nil {
+		return nil, err
+	}
+	var shards []uint16
+	for _, layout := range AcceptedLayouts(bc.masterReader(), master) {
+		if shardId := layout.Shard(key); len(shards) == 0 || shardId != shards[0] {
+			shards = append(shards, shardId)
+		}
+	}
+	return shards, nil
+}
+
+// AccountShard returns the shard owning the given account under the layout of
+// the given master header, when it sends a transaction to itself. This is the
+// shard of its nonce space under the default policy.
+func (bc *BlockChain) AccountShard(master types.HeaderIntf, addr common.Address) uint16 {
+	key := bc.ShardPolicy().ShardKey(addr, &addr)
+	return LayoutOf(master).Shard(key)
+}
+
+// ShardBlockConfirmed returns whether a shard block is included by a block of
+// the canonical master chain.
+func (bc *BlockChain) ShardBlockConfirmed(hash common.Hash) bool {
+	shardId, masterHash, number, _ := rawdb.ReadTxLookupEntry(bc.db, hash)
+	if shardId != types.ShardMaster || masterHash == (common.Hash{}) {
+		return false
+	}
+	return rawdb.ReadCanonicalHash(bc.db, types.ShardMaster, number) == masterHash
+}
+
+// CrossShardRejected returns whether the master block including a shard block
+// may have rejected one of its transactions, as told by its rejected bloom. The
+// bloom is part of the master header, so shard nodes decide alike: a false
+// positive refuses a valid claim on the shard state, but a transaction whose
+// value never went into escrow is never credited. Shard blocks not included
+// by a known master block count as rejected.
+func (bc *BlockChain) CrossShardRejected(blockHash, txHash common.Hash) bool {
+	_, masterHash, number, _ := rawdb.ReadTxLookupEntry(bc.db, blockHash)
+	if masterHash == (common.Hash{}) {
+		return true
+	}
+	header := bc.masterReader().GetHeader(masterHash, number)
+	if header == nil || reflect.ValueOf(header).IsNil() {
+		return true
+	}
+	return types.BloomLookup(header.ToHeader().BloomRejected(), txHash)
+}
+
+// routingHeader returns the master header whose shard layouts apply to the
+// transactions of a shard block: the master block referenced by its header, or
+// the master genesis for headers referencing none. As the reference is part of
+// the block, replaying it is independent of the local master head. It returns
+// nil if the referenced master block is not known locally.
+func (bc *BlockChain) routingHeader(header types.HeaderIntf) types.HeaderIntf {
+	sheader := header.ToSHeader()
+	if sheader.MasterHash() == (common.Hash{}) {
+		return bc.masterHeaderByNumber(0)
+	}
+	master := bc.masterReader().GetHeader(sheader.MasterHash(), sheader.MasterNumber())
+	if master == nil || reflect.ValueOf(master).IsNil() {
+		return nil
+	}
+	return master
+}
+
+// RoutingHeader returns the master header referenced by a shard header, or nil
+// if it is not known locally.
+func (bc *BlockChain) RoutingHeader(header types.HeaderIntf) types.HeaderIntf {
+	return bc.routingHeader(header)
 }
 
 /*
@@ -701,6 +916,69 @@ func (bc *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
 	return nil
 }
 
+// ExportShard writes the chain of a single shard to the given writer.
+func (bc *BlockChain) ExportShard(w io.Writer, shardId uint16) error {
+	if shardId == bc.shardId {
+		return bc.Export(w)
+	}
+	return bc.ExportShardN(w, shardId, 0, math.MaxUint64)
+}
+
+// ExportShardN writes a subset of the chain of a single shard to the given
+// writer. A master node exports the shard blocks referenced by its canonical
+// chain, a shard node only its own chain.
+func (bc *BlockChain) ExportShardN(w io.Writer, shardId uint16, first uint64, last uint64) error {
+	if shardId == bc.shardId {
+		return bc.ExportN(w, first, last)
+	}
+	if bc.shardId != types.ShardMaster {
+		return fmt.Errorf("export failed: shard %d is not tracked by shard %d", shardId, bc.shardId)
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	log.Info("Exporting shard blocks", "shard", shardId, "first", first, "last", last)
+
+	start, reported := time.Now(), time.Now()
+	exported := uint64(0)
+	if first == 0 {
+		if err := bc.GenesisOfShard(shardId).EncodeRLP(w); err != nil {
+			return err
+		}
+		exported++
+	}
+	for nr := uint64(1); nr <= bc.CurrentBlock().NumberU64(); nr++ {
+		master := bc.GetBlockByNumber(nr)
+		if master == nil || reflect.ValueOf(master).IsNil() {
+			return fmt.Errorf("export failed on master #%d: not found", nr)
+		}
+		for _, info := range master.ShardBlocks() {
+			if info.ShardId != shardId || info.BlockNumber < first {
+				continue
+			}
+			if info.BlockNumber > last {
+				return nil
+			}
+			block := bc.GetShardBlock(shardId, info.Hash, info.BlockNumber)
+			if block == nil || reflect.ValueOf(block).IsNil() {
+				return fmt.Errorf("export failed on shard %d #%d: not found or pruned", shardId, info.BlockNumber)
+			}
+			if err := block.EncodeRLP(w); err != nil {
+				return err
+			}
+			exported++
+		}
+		if time.Since(reported) >= statsReportLimit {
+			log.Info("Exporting shard blocks", "shard", shardId, "exported", exported, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	return nil
+}
+
 // insert injects a new head block into the current block chain. This method
 // assumes that the block is indeed a true head. It will also reset the head
 // header and the head fast sync block to this very same block if they are older
@@ -724,6 +1002,34 @@ func (bc *BlockChain) insert(block types.BlockIntf) {
 
 		bc.currentFastBlock.Store(block)
 	}
+	bc.pruneShardBodies(block.NumberU64())
+}
+
+// pruneShardBodies drops the bodies of the shard blocks referenced by the master
+// block which the new head at number confirms ShardPruneDepth times, keeping
+// their headers and the references of the master chain for verification. Once
+// pruned, the master chain can't be reorganised past that block anymore.
+//
+// Note, this function assumes that the `mu` mutex is held!
+func (bc *BlockChain) pruneShardBodies(number uint64) {
+	depth := bc.cacheConfig.ShardPruneDepth
+	if bc.shardId != types.ShardMaster || depth == 0 || number <= depth {
+		return
+	}
+	number -= depth
+	body := rawdb.ReadBody(bc.db, rawdb.ReadCanonicalHash(bc.db, bc.shardId, number), number)
+	if body == nil {
+		return
+	}
+	for _, info := range body.ShardBlocks {
+		rawdb.PruneBody(bc.db, info.Hash, info.BlockNumber)
+		bc.blockCache.Remove(info.Hash)
+		bc.bodyCache.Remove(info.Hash)
+		bc.bodyRLPCache.Remove(info.Hash)
+	}
+	if len(body.ShardBlocks) > 0 {
+		log.Debug("Pruned shard block bodies", "master", number, "blocks", len(body.ShardBlocks))
+	}
 }
 
 // Genesis retrieves the chain's genesis block.
@@ -973,7 +1279,7 @@ func (bc *BlockChain) procFutureBlocks() {
 	blocks := make([]types.BlockIntf, 0, bc.futureBlocks.Len())
 	for _, hash := range bc.futureBlocks.Keys() {
 		if block, exist := bc.futureBlocks.Peek(hash); exist {
-			blocks = append(blocks, block.(*types.Block))
+			blocks = append(blocks, block.(types.BlockIntf))
 		}
 	}
 	if len(blocks) > 0 {
@@ -1107,8 +1413,10 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.BlockIntfs, receiptCha
 		rawdb.WriteReceipts(batch, bc.ShardId(), block.Hash(), block.NumberU64(), receipts)
 		if bc.shardId == types.ShardMaster {
 			rawdb.WriteShardBlockEntries(batch, block)
+			bc.writeShardTxLookupEntries(batch, block)
 		} else {
 			rawdb.WriteTxLookupEntries(batch, block, receipts)
+			rawdb.WriteShardTxLookupEntries(batch, block)
 		}
 
 		stats.processed++
@@ -1170,8 +1478,9 @@ func (bc *BlockChain) WriteBlockWithoutState(block types.BlockIntf, td *big.Int)
 	return nil
 }
 
-// WriteBlockWithState writes the block and all associated state to the database.
-func (bc *BlockChain) WriteBlockWithState(block types.BlockIntf, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
+// WriteBlockWithState writes the block and all associated state to the database,
+// along with the transactions its processing rejected for master blocks.
+func (bc *BlockChain) WriteBlockWithState(block types.BlockIntf, receipts []*types.Receipt, rejected []*types.RejectedTx, state *state.StateDB) (status WriteStatus, err error) {
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
@@ -1198,53 +1507,51 @@ func (bc *BlockChain) WriteBlockWithState(block types.BlockIntf, receipts []*typ
 	if err != nil {
 		return NonStatTy, err
 	}
-	if bc.shardId == types.ShardMaster {
-		triedb := bc.stateCache.TrieDB()
+	triedb := bc.stateCache.TrieDB()
 
-		// If we're running an archive node, always flush
-		if bc.cacheConfig.Disabled {
-			if err := triedb.Commit(root, false); err != nil {
-				return NonStatTy, err
+	// If we're running an archive node, always flush
+	if bc.cacheConfig.Disabled {
+		if err := triedb.Commit(root, false); err != nil {
+			return NonStatTy, err
+		}
+	} else {
+		// Full but not archive node, do proper garbage collection
+		triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
+		bc.triegc.Push(root, -int64(block.NumberU64()))
+
+		if current := block.NumberU64(); current > triesInMemory {
+			// If we exceeded our memory allowance, flush matured singleton nodes to disk
+			var (
+				nodes, imgs = triedb.Size()
+				limit       = common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
+			)
+			if nodes > limit || imgs > 4*1024*1024 {
+				triedb.Cap(limit - ethdb.IdealBatchSize)
 			}
-		} else {
-			// Full but not archive node, do proper garbage collection
-			triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
-			bc.triegc.Push(root, -int64(block.NumberU64()))
-
-			if current := block.NumberU64(); current > triesInMemory {
-				// If we exceeded our memory allowance, flush matured singleton nodes to disk
-				var (
-					nodes, imgs = triedb.Size()
-					limit       = common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
-				)
-				if nodes > limit || imgs > 4*1024*1024 {
-					triedb.Cap(limit - ethdb.IdealBatchSize)
-				}
-				// Find the next state trie we need to commit
-				header := bc.GetHeaderByNumber(current - triesInMemory)
-				chosen := header.NumberU64()
-
-				// If we exceeded out time allowance, flush an entire trie to disk
-				if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
-					// If we're exceeding limits but haven't reached a large enough memory gap,
-					// warn the user that the system is becoming unstable.
-					if chosen < lastWrite+triesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
-						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
-					}
-					// Flush an entire trie and restart the counters
-					triedb.Commit(header.Root(), true)
-					lastWrite = chosen
-					bc.gcproc = 0
+			// Find the next state trie we need to commit
+			header := bc.GetHeaderByNumber(current - triesInMemory)
+			chosen := header.NumberU64()
+
+			// If we exceeded out time allowance, flush an entire trie to disk
+			if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+				// If we're exceeding limits but haven't reached a large enough memory gap,
+				// warn the user that the system is becoming unstable.
+				if chosen < lastWrite+triesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
+					log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
 				}
-				// Garbage collect anything below our required write retention
-				for !bc.triegc.Empty() {
-					root, number := bc.triegc.Pop()
-					if uint64(-number) > chosen {
-						bc.triegc.Push(root, number)
-						break
-					}
-					triedb.Dereference(root.(common.Hash))
+				// Flush an entire trie and restart the counters
+				triedb.Commit(header.Root(), true)
+				lastWrite = chosen
+				bc.gcproc = 0
+			}
+			// Garbage collect anything below our required write retention
+			for !bc.triegc.Empty() {
+				root, number := bc.triegc.Pop()
+				if uint64(-number) > chosen {
+					bc.triegc.Push(root, number)
+					break
 				}
+				triedb.Dereference(root.(common.Hash))
 			}
 		}
 	}
@@ -1252,6 +1559,7 @@ func (bc *BlockChain) WriteBlockWithState(block types.BlockIntf, receipts []*typ
 	// Write other block data using a batch.
 	batch := bc.db.NewBatch()
 	rawdb.WriteReceipts(batch, block.ShardId(), block.Hash(), block.NumberU64(), receipts)
+	rawdb.WriteRejectedTxs(batch, block.Hash(), block.NumberU64(), rejected)
 
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
@@ -1283,9 +1591,11 @@ func (bc *BlockChain) WriteBlockWithState(block types.BlockIntf, receipts []*typ
 
 			rawdb.WriteShardBlockEntries(batch, block)
 			rawdb.WriteTxLookupEntries(batch, block, receipts)
+			rawdb.WriteRejectedLookupEntries(batch, block.Hash(), block.NumberU64(), rejected)
+			bc.writeShardTxLookupEntries(batch, block)
+			bc.writeCrossShardLookupEntries(batch, block, rejected)
 		} else {
-			////MUST TODO  write TX lookup entries for all shard blocks
-
+			rawdb.WriteShardTxLookupEntries(batch, block)
 		}
 
 		rawdb.WritePreimages(batch, block.ShardId(), block.NumberU64(), state.Preimages())
@@ -1385,6 +1695,10 @@ func (bc *BlockChain) shardProcMasterBlock(chain types.BlockIntfs) (int, error)
 	//更新跟踪的主链区块头,是否需要同步本子链的
 	cnt, err := bc.master_head.InsertHeaderChain(headers, whFunc, time.Now())
 	if err == nil {
+		// Index the shard blocks the master committed, claims are checked against them
+		for _, block := range chain {
+			rawdb.WriteShardBlockEntries(bc.db, block)
+		}
 		var targetShardInfo *types.ShardBlockInfo
 		for _, block := range chain {
 			shardInfos := block.ShardBlocks()
@@ -1433,6 +1747,10 @@ func (bc *BlockChain) insertChain(chain types.BlockIntfs) (int, []interface{}, [
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
+	// Retrieve the shard transactions the blocks lack before locking the chain,
+	// the processor never waits for the network
+	bc.prefetchShardTxs(chain)
+
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
@@ -1511,6 +1829,14 @@ func (bc *BlockChain) insertChain(chain types.BlockIntfs) (int, []interface{}, [
 			stats.queued++
 			continue
 
+		case err == ErrUnknownMasterBlock:
+			// Not processable until the master block routing it is known, retry
+			// the block along with the future ones
+			log.Debug("Queued block referencing unknown master block", "shard", block.ShardId(), "number", block.Number(), "hash", block.Hash())
+			bc.futureBlocks.Add(block.Hash(), block)
+			stats.queued++
+			continue
+
 		case err == consensus.ErrUnknownAncestor && bc.futureBlocks.Contains(block.ParentHash()):
 			fmt.Println("32")
 			bc.futureBlocks.Add(block.Hash(), block)
@@ -1587,13 +1913,28 @@ func (bc *BlockChain) insertChain(chain types.BlockIntfs) (int, []interface{}, [
 			f.WriteString(str + "\r\n")
 			fmt.Println(" Process :", "duration ", time.Now().Sub(curTime))
 		}
+		if err == ErrMissingShardTx {
+			// Not processable until the shard delivers the transactions, retry
+			// the block along with the future ones
+			log.Debug("Queued block missing shard transactions", "shard", block.ShardId(), "number", block.Number(), "hash", block.Hash())
+			bc.futureBlocks.Add(block.Hash(), block)
+			stats.queued++
+			continue
+		}
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
+			bc.proveFraud(block)
 			return i, events, coalescedLogs, err
 		}
 		// Validate the state using the default validator
 		err = bc.Validator().ValidateState(block, parent, state, receipts, usedGas)
 		if err != nil {
+			bc.reportBlock(block, receipts, err)
+			bc.proveFraud(block)
+			return i, events, coalescedLogs, err
+		}
+		rejected := rejectedTxs(shardTxs)
+		if err := validateRejected(block, rejected); err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
@@ -1601,11 +1942,12 @@ func (bc *BlockChain) insertChain(chain types.BlockIntfs) (int, []interface{}, [
 
 		// Write the block to the chain and get the status.
 
-		status, err := bc.WriteBlockWithState(block, receipts, state)
+		status, err := bc.WriteBlockWithState(block, receipts, rejected, state)
 
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+
 		switch status {
 		case CanonStatTy:
 			log.Debug("Inserted new block", "number", block.Number(), "shardId ", block.ShardId(), "hash", block.Hash(), "shards", len(block.ShardBlocks()),
@@ -1784,6 +2126,8 @@ func (bc *BlockChain) reorg(oldBlock, newBlock types.BlockIntf) error {
 	}
 	if bc.ShardId() == types.ShardMaster {
 		bc.reorgShardInfos(newChain, deletedShardInfos)
+		bc.reorgRejectedTxs(oldChain, newChain)
+		bc.reorgCrossShardTxs(oldChain, newChain)
 	} else {
 		bc.reorgTxs(newChain, deletedTxs)
 	}
@@ -1804,7 +2148,7 @@ func (bc *BlockChain) reorgTxs(newChain types.BlockIntfs, deletedTxs types.Trans
 		bc.insert(newChain[i])
 		// write lookup entries for hash based transaction/receipt searches
 		fmt.Println(" Hash:", newChain[i].Hash(), " newHash:", newChain[i].ToSBlock().Hash())
-		//	rawdb.WriteTxLookupEntries(bc.db, newChain[i],receiptsCacheLimit)
+		rawdb.WriteShardTxLookupEntries(bc.db, newChain[i])
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
 	}
 	// calculate the difference between deleted and added transactions
@@ -1814,6 +2158,7 @@ func (bc *BlockChain) reorgTxs(newChain types.BlockIntfs, deletedTxs types.Trans
 	batch := bc.db.NewBatch()
 	for _, tx := range diff {
 		rawdb.DeleteTxLookupEntry(batch, tx.Hash())
+		rawdb.DeleteShardTxLookupEntry(batch, tx.Hash())
 	}
 	batch.Write()
 }
@@ -1825,6 +2170,7 @@ func (bc *BlockChain) reorgShardInfos(newChain types.BlockIntfs, deletedShardBlo
 		bc.insert(newChain[i])
 		// write lookup entries for hash based transaction/receipt searches
 		rawdb.WriteShardBlockEntries(bc.db, newChain[i].ToBlock())
+		bc.writeShardTxLookupEntries(bc.db, newChain[i])
 		addedSfs = append(addedSfs, newChain[i].ShardBlocks()...)
 	}
 	// calculate the difference between deleted and added transactions
@@ -1838,6 +2184,159 @@ func (bc *BlockChain) reorgShardInfos(newChain types.BlockIntfs, deletedShardBlo
 	batch.Write()
 }
 
+// reorgRejectedTxs moves the lookup entries of rejected transactions from the
+// dropped master blocks to the ones which became canonical.
+func (bc *BlockChain) reorgRejectedTxs(oldChain, newChain types.BlockIntfs) {
+	added := make(map[common.Hash]bool)
+	for _, block := range newChain {
+		rejected := rawdb.ReadRejectedTxs(bc.db, block.Hash(), block.NumberU64())
+		rawdb.WriteRejectedLookupEntries(bc.db, block.Hash(), block.NumberU64(), rejected)
+		for _, tx := range rejected {
+			added[tx.TxHash] = true
+		}
+	}
+	batch := bc.db.NewBatch()
+	for _, block := range oldChain {
+		for _, tx := range rawdb.ReadRejectedTxs(bc.db, block.Hash(), block.NumberU64()) {
+			if !added[tx.TxHash] {
+				rawdb.DeleteRejectedLookupEntry(batch, tx.TxHash)
+			}
+		}
+	}
+	batch.Write()
+}
+
+// reorgCrossShardTxs moves the lookup entries of outgoing cross shard receipts
+// from the dropped master blocks to the ones which became canonical.
+func (bc *BlockChain) reorgCrossShardTxs(oldChain, newChain types.BlockIntfs) {
+	added := make(map[common.Hash]bool)
+	for _, block := range newChain {
+		rejected := rawdb.ReadRejectedTxs(bc.db, block.Hash(), block.NumberU64())
+		for _, hash := range bc.writeCrossShardLookupEntries(bc.db, block, rejected) {
+			added[hash] = true
+		}
+	}
+	batch := bc.db.NewBatch()
+	for _, block := range oldChain {
+		for _, info := range block.ShardBlocks() {
+			shardBlock := bc.GetShardBlock(info.ShardId, info.Hash, info.BlockNumber)
+			if shardBlock == nil {
+				continue
+			}
+			for _, result := range shardBlock.Results() {
+				if result.TxType == TT_XSHARD_OUT && !added[result.TxHash] {
+					rawdb.DeleteCrossShardLookupEntry(batch, result.TxHash)
+				}
+			}
+		}
+	}
+	batch.Write()
+}
+
+// writeCrossShardLookupEntries indexes the outgoing cross shard receipts of the
+// shard blocks a master block references, as far as their bodies are known to
+// the node. Receipts of transactions the master block rejected were never moved
+// into escrow and are left out. It returns the hashes of the indexed transactions.
+func (bc *BlockChain) writeCrossShardLookupEntries(db rawdb.DatabaseWriter, block types.BlockIntf, rejected []*types.RejectedTx) []common.Hash {
+	skip := make(map[common.Hash]bool)
+	for _, tx := range rejected {
+		skip[tx.TxHash] = true
+	}
+	var hashes []common.Hash
+	for _, info := range block.ShardBlocks() {
+		shardBlock := bc.GetShardBlock(info.ShardId, info.Hash, info.BlockNumber)
+		if shardBlock == nil {
+			continue
+		}
+		for i, result := range shardBlock.Results() {
+			if result.TxType != TT_XSHARD_OUT || skip[result.TxHash] {
+				continue
+			}
+			rawdb.WriteCrossShardLookupEntry(db, result.TxHash, shardBlock.ShardId(), shardBlock.Hash(), shardBlock.NumberU64(), uint64(i))
+			hashes = append(hashes, result.TxHash)
+		}
+	}
+	return hashes
+}
+
+// writeShardTxLookupEntries indexes the transactions of the shard blocks a master
+// block references, as far as their bodies are known to the node.
+func (bc *BlockChain) writeShardTxLookupEntries(db rawdb.DatabaseWriter, block types.BlockIntf) {
+	for _, info := range block.ShardBlocks() {
+		if shardBlock := bc.GetShardBlock(info.ShardId, info.Hash, info.BlockNumber); shardBlock != nil {
+			rawdb.WriteShardTxLookupEntries(db, shardBlock)
+		}
+	}
+}
+
+// ShardTxStatus looks up how far a transaction progressed through the chains:
+// the shard block including it, the canonical master block referencing that
+// shard block, and whether the latter is buried deep enough to be final. Nil is
+// returned if the transaction is not included in any known shard block.
+//
+// Note, nodes of a shard only keep the headers of the master chain, so they can
+// not tell which master block references a shard block.
+func (bc *BlockChain) ShardTxStatus(hash common.Hash) *ShardTxStatus {
+	shardId, blockHash, number, index := rawdb.ReadShardTxLookupEntry(bc.db, hash)
+	if blockHash == (common.Hash{}) {
+		return nil
+	}
+	// Transactions of a shard block dropped by a reorg are not included anymore
+	if shardId == bc.shardId && rawdb.ReadCanonicalHash(bc.db, shardId, number) != blockHash {
+		return nil
+	}
+	status := &ShardTxStatus{
+		Status:      TxStatusIncluded,
+		ShardId:     shardId,
+		BlockHash:   blockHash,
+		BlockNumber: number,
+		Index:       index,
+	}
+	_, masterHash, masterNumber, _ := rawdb.ReadTxLookupEntry(bc.db, blockHash)
+	if masterHash == (common.Hash{}) {
+		return status
+	}
+	if header := bc.masterHeaderByNumber(masterNumber); header == nil || header.Hash() != masterHash {
+		return status
+	}
+	status.Status = TxStatusReferenced
+	status.MasterHash = masterHash
+	status.MasterNumber = masterNumber
+
+	if rejected, rejectedHash, _ := rawdb.ReadRejectedTx(bc.db, hash); rejected != nil && rejectedHash == masterHash {
+		status.Status = TxStatusRejected
+		return status
+	}
+	if bc.masterHeader().NumberU64() >= masterNumber+params.ShardTxConfirmations {
+		status.Status = TxStatusFinal
+	}
+	return status
+}
+
+// GetRejectedTx retrieves a transaction refused by a canonical master block,
+// along with the hash and number of that block. Nil is returned if the
+// transaction was not rejected.
+func (bc *BlockChain) GetRejectedTx(hash common.Hash) (*types.RejectedTx, common.Hash, uint64) {
+	rejected, blockHash, number := rawdb.ReadRejectedTx(bc.db, hash)
+	if rejected == nil {
+		return nil, common.Hash{}, 0
+	}
+	if header := bc.masterHeaderByNumber(number); header == nil || header.Hash() != blockHash {
+		return nil, common.Hash{}, 0
+	}
+	return rejected, blockHash, number
+}
+
+// rejectedTxs gathers the transactions rejected while processing the shard
+// blocks of a master block.
+func rejectedTxs(stats []ShardTxsStat) []*types.RejectedTx {
+	var rejected []*types.RejectedTx
+	for _, stat := range stats {
+		rejected = append(rejected, stat.Rejected...)
+	}
+	return rejected
+}
+
 // PostChainEvents iterates over the events generated by a chain insertion and
 // posts them into the event feed.
 // TODO: Should not expose PostChainEvents. The chain events should be posted in WriteBlock.
@@ -2050,6 +2549,11 @@ func (bc *BlockChain) SubscribeChainShardsEvent(ch chan<- *ChainsShardEvent) eve
 	return bc.scope.Track(bc.chainShardFeed.Subscribe(ch))
 }
 
+// SubscribeFraudProofEvent registers a subscription of FraudProofEvent.
+func (bc *BlockChain) SubscribeFraudProofEvent(ch chan<- FraudProofEvent) event.Subscription {
+	return bc.scope.Track(bc.fraudProofFeed.Subscribe(ch))
+}
+
 // SubscribeLogsEvent registers a subscription of []*types.Log.
 func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
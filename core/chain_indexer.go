@@ -208,7 +208,9 @@ func (c *ChainIndexer) eventLoop(currentHeader types.HeaderIntf, events chan Cha
 	for {
 		select {
 		case errc := <-c.quit:
-			// Chain indexer terminating, report no failure and abort
+			// Chain indexer terminating, stop following the chain before reporting
+			// no failure, so that Close returns with the subscription torn down
+			sub.Unsubscribe()
 			errc <- nil
 			return
 
@@ -216,6 +218,7 @@ func (c *ChainIndexer) eventLoop(currentHeader types.HeaderIntf, events chan Cha
 			// Received a new event, ensure it's not nil (closing) and update
 			if !ok {
 				errc := <-c.quit
+				sub.Unsubscribe()
 				errc <- nil
 				return
 			}
@@ -24,6 +24,7 @@ import (
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/consensus"
 	"github.com/EDXFund/MasterChain/consensus/misc"
+	"github.com/EDXFund/MasterChain/core/rawdb"
 	"github.com/EDXFund/MasterChain/core/state"
 	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/core/vm"
@@ -100,6 +101,16 @@ func (b *BlockGen) AddTxWithChain(bc *BlockChain, tx *types.Transaction) {
 		b.SetCoinbase(common.Address{})
 	}
 	b.statedb.Prepare(tx.Hash(), common.Hash{}, len(b.txs))
+	if b.header.ShardId() != types.ShardMaster {
+		// Shard blocks carry the results of their transactions
+		result, err := ApplyToInstruction(b.config, bc, nil, nil, b.statedb, b.header, tx, b.gasPool, b.header.GasUsedPtr(), vm.Config{})
+		if err != nil {
+			panic(err)
+		}
+		b.txs = append(b.txs, tx)
+		b.results = append(b.results, result)
+		return
+	}
 	//coinBase := b.header.Coinbase()
 	//gasUsed := b.header.GasUsed()
 	receipt, _, err := ApplyTransaction(b.config, bc, b.header.CoinbasePtr(), b.gasPool, nil, b.statedb, b.header, tx, b.header.GasUsedPtr(), vm.Config{})
@@ -212,7 +223,13 @@ func GenerateChain(config *params.ChainConfig, parent types.BlockIntf, engine co
 		if b.engine != nil {
 			// Finalize and seal the block
 			block, err := b.engine.Finalize(b.chainReader, b.header, statedb, b.blocks, b.results, b.txs, b.receipts)
-
+			// Shard blocks only carry results, keep their transactions around
+			// as the shard pool of the sealing node would
+			if b.header.ShardId() != types.ShardMaster {
+				for _, tx := range b.txs {
+					rawdb.WriteRawTransaction(db, tx.Hash(), tx)
+				}
+			}
 
 			// Write state changes to db
 			root, err := statedb.Commit(config.IsEIP158(b.header.Number()))
@@ -263,11 +280,13 @@ func makeHeader(chain consensus.ChainReader, parent types.BlockIntf, state *stat
 			UncleHash:  parent.UncleHash(),
 		})
 		shardState := types.ShardState{0,0,uint32(10000*(parent.NumberU64()))}
+		layout := CalcShardLayout(chain, parent.Header())
 		result.FillBy(
 			&types.HeaderStruct{
 				ParentHash: parent.Hash(),
 				Root:       state.IntermediateRoot(chain.Config().IsEIP158(parent.Number())),
-				ShardEnabled:[32]byte{0x01},
+				ShardMaskEp:  layout.Exp,
+				ShardEnabled: layout.Enabled,
 				Coinbase:     parent.Coinbase(),
 				Difficulty:   engine.CalcDifficulty(chain, time.Uint64(), inner_parent),
 				GasLimit:     CalcGasLimit(parent, parent.GasLimit(), parent.GasLimit()),
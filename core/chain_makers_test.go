@@ -29,8 +29,8 @@ import (
 )
 
 func ExampleGenerateChain()   { exampleGenerateChain(types.ShardMaster) }
-func ExampleGenerateChain0()  { exampleGenerateChain(0) }
-func ExampleGenerateChain10() { exampleGenerateChain(10) }
+func ExampleGenerateChain_shard0()  { exampleGenerateChain(0) }
+func ExampleGenerateChain_shard10() { exampleGenerateChain(10) }
 func exampleGenerateChain(shardId uint16) {
 	var (
 		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
@@ -0,0 +1,202 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Contract transactions are executed by the shard including them instead of the
+// master. The shard runs the EVM against its own state and records the state
+// diff of the execution in the PostState of the result, along with the gas
+// used. Depending on the outcome the result is one of
+//
+//   - TT_CONTRACT_TEMP: a contract creation, deploying a template
+//   - TT_CONTRACT_INST: a call into a template creating new contract instances
+//   - TT_CONTRACT_CALL: any other call into a contract
+//
+// The master replays the diff on its state rather than running the EVM again.
+// Should the diff conflict with the master state, e.g. because another shard
+// modified one of the written accounts in between, the master falls back to
+// executing the transaction itself.
+
+// ErrInvalidContractResult is returned if the post state or data of a contract
+// result can't be decoded or doesn't belong to its transaction.
+var ErrInvalidContractResult = errors.New("invalid contract result")
+
+// contractInstruction executes tx against the shard state if it creates or
+// calls a contract. It returns nil if tx isn't a contract transaction or if the
+// shard state can't execute it, leaving it to the master as TT_COMMON.
+func contractInstruction(config *params.ChainConfig, bc ChainContext, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, gp *GasPool, usedGas *uint64, cfg vm.Config) (*types.ContractResult, error) {
+	if statedb == nil {
+		return nil, nil
+	}
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	if msg.To() != nil && statedb.GetCodeSize(*msg.To()) == 0 {
+		return nil, nil
+	}
+	var (
+		snap     = statedb.Snapshot()
+		gas      = *gp
+		coinbase = header.Coinbase()
+	)
+	// The header is not sealed yet, so pass the author explicitly
+	vmenv := vm.NewEVM(NewEVMContext(msg, header, bc, &coinbase), statedb, config, cfg)
+	ret, used, failed, err := ApplyMessage(vmenv, msg, gp, nil)
+	if err != nil {
+		statedb.RevertToSnapshot(snap)
+		*gp = gas
+		if err == ErrGasLimitReached {
+			return nil, err
+		}
+		log.Debug("Leaving contract transaction to master", "hash", tx.Hash(), "err", err)
+		return nil, nil
+	}
+	diff := statedb.JournalDiff()
+	statedb.Finalise(true)
+
+	postState, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return nil, err
+	}
+	*usedGas += used
+
+	result := &types.ContractResult{TxHash: tx.Hash(), GasUsed: used, PostState: postState}
+	var instruct interface{}
+	if msg.To() == nil {
+		template := crypto.CreateAddress(msg.From(), tx.Nonce())
+		result.TxType = TT_CONTRACT_TEMP
+		instruct = &InstructContractCreate{SrcAccount: msg.From(), Template: template, CodeHash: statedb.GetCodeHash(template), Failed: failed}
+	} else if instances := createdContracts(diff); len(instances) > 0 {
+		result.TxType = TT_CONTRACT_INST
+		instruct = &InstructContractInstance{SrcAccount: msg.From(), Template: *msg.To(), Instances: instances}
+	} else {
+		result.TxType = TT_CONTRACT_CALL
+		instruct = &InstructContractCall{TxHash: tx.Hash(), SrcAccount: msg.From(), Contract: *msg.To(), GasUsed: used, DataResult: ret, Failed: failed}
+	}
+	if result.Data, err = rlp.EncodeToBytes(instruct); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// createdContracts returns the accounts a diff deploys code to.
+func createdContracts(diff *state.StateDiff) []common.Address {
+	var created []common.Address
+	for _, acc := range diff.Accounts {
+		if acc.Created && acc.CodeHash != acc.PrevCodeHash {
+			created = append(created, acc.Address)
+		}
+	}
+	return created
+}
+
+// decodeContractResult decodes the post state of a contract result and checks
+// it against the transaction: the sender must be charged exactly one nonce.
+// It also returns whether the execution failed.
+func decodeContractResult(msg types.Message, result *types.ContractResult) (*state.StateDiff, bool, error) {
+	var failed bool
+	switch result.TxType {
+	case TT_CONTRACT_TEMP:
+		instruct := new(InstructContractCreate)
+		if err := rlp.DecodeBytes(result.Data, instruct); err != nil || msg.To() != nil {
+			return nil, false, ErrInvalidContractResult
+		}
+		failed = instruct.Failed
+	case TT_CONTRACT_INST:
+		instruct := new(InstructContractInstance)
+		if err := rlp.DecodeBytes(result.Data, instruct); err != nil || msg.To() == nil {
+			return nil, false, ErrInvalidContractResult
+		}
+	case TT_CONTRACT_CALL:
+		instruct := new(InstructContractCall)
+		if err := rlp.DecodeBytes(result.Data, instruct); err != nil || msg.To() == nil {
+			return nil, false, ErrInvalidContractResult
+		}
+		failed = instruct.Failed
+	default:
+		return nil, false, ErrInvalidContractResult
+	}
+	diff := new(state.StateDiff)
+	if err := rlp.DecodeBytes(result.PostState, diff); err != nil || !diff.Sorted() {
+		return nil, false, ErrInvalidContractResult
+	}
+	for _, acc := range diff.Accounts {
+		if acc.Address == msg.From() {
+			if acc.PrevNonce != msg.Nonce() || acc.Nonce != msg.Nonce()+1 {
+				return nil, false, ErrInvalidContractResult
+			}
+			return diff, failed, nil
+		}
+	}
+	return nil, false, ErrInvalidContractResult
+}
+
+// applyContractResult applies a contract result of a shard block to the master
+// state by replaying its state diff. If the diff can't be applied, the
+// transaction is executed as an ordinary one.
+func (p *StateProcessor) applyContractResult(gp *GasPool, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, result *types.ContractResult, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(p.config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	diff, failed, err := decodeContractResult(msg, result)
+	if err == nil {
+		if err := gp.SubGas(result.GasUsed); err != nil {
+			return nil, err
+		}
+		if err = statedb.ApplyDiff(diff); err != nil {
+			gp.AddGas(result.GasUsed)
+		}
+	}
+	if err != nil {
+		log.Debug("Re-executing contract transaction", "hash", tx.Hash(), "err", err)
+		receipt, _, err := ApplyTransaction(p.config, p.bc, nil, gp, nil, statedb, header, tx, usedGas, cfg)
+		return receipt, err
+	}
+	// Update the state with pending changes
+	var root []byte
+	if p.config.IsByzantium(header.Number()) {
+		statedb.Finalise(true)
+	} else {
+		root = statedb.IntermediateRoot(p.config.IsEIP158(header.Number())).Bytes()
+	}
+	*usedGas += result.GasUsed
+
+	receipt := types.NewReceipt(root, failed, *usedGas)
+	receipt.TxHash = tx.Hash()
+	receipt.GasUsed = result.GasUsed
+	if msg.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
+	}
+	receipt.Logs = statedb.GetLogs(tx.Hash())
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+	return receipt, nil
+}
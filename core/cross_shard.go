@@ -0,0 +1,342 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+	"github.com/EDXFund/MasterChain/trie"
+)
+
+// A cross shard transfer is completed in two phases. The source shard includes
+// the transfer as a TT_XSHARD_OUT result; when the master applies it, the value
+// is moved from the sender into escrow and the receipt is marked as issued. The
+// recipient then sends a claim transaction to the escrow on its own shard,
+// carrying the source shard header and a merkle proof of the receipt. Its
+// TT_XSHARD_IN result makes the master verify the proof and the receipt state,
+// release the value to the recipient and mark the receipt as claimed.
+var (
+	// CrossShardEscrowAddress holds the value of cross shard transfers between
+	// the debit on the source shard and the claim on the destination shard.
+	// Its storage maps receipt hashes to their state.
+	CrossShardEscrowAddress = common.BytesToAddress([]byte("edx-xshard-escrow"))
+
+	xshardIssued  = common.BigToHash(common.Big1)
+	xshardClaimed = common.BigToHash(common.Big2)
+)
+
+var (
+	// ErrInvalidCrossShardReceipt is returned if a TT_XSHARD_OUT result does not
+	// describe the transaction it references.
+	ErrInvalidCrossShardReceipt = errors.New("invalid cross shard receipt")
+
+	// ErrInvalidCrossShardClaim is returned if a claim is malformed, its proof
+	// does not verify or it is not addressed to the claiming account.
+	ErrInvalidCrossShardClaim = errors.New("invalid cross shard claim")
+
+	// ErrCrossShardNotIssued is returned if a claimed receipt has never been
+	// committed by the master chain.
+	ErrCrossShardNotIssued = errors.New("cross shard receipt not issued")
+
+	// ErrCrossShardClaimed is returned if a receipt has already been claimed.
+	ErrCrossShardClaimed = errors.New("cross shard receipt already claimed")
+
+	// ErrCrossShardNotConfirmed is returned if the source shard block of a claim
+	// isn't included by the canonical master chain.
+	ErrCrossShardNotConfirmed = errors.New("cross shard source block not confirmed")
+
+	// ErrCrossShardNotFound is returned if no outgoing receipt is known for a
+	// transaction hash.
+	ErrCrossShardNotFound = errors.New("cross shard receipt not found")
+)
+
+// crossShardInstruction returns the cross shard result of tx, or nil if tx is
+// an ordinary shard local transaction.
+func crossShardInstruction(config *params.ChainConfig, router ShardRouter, master types.HeaderIntf, header types.HeaderIntf, tx *types.Transaction) (*types.ContractResult, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	to := msg.To()
+	if to == nil {
+		return nil, nil
+	}
+	if *to == CrossShardEscrowAddress {
+		if msg.Value().Sign() != 0 {
+			return nil, ErrInvalidCrossShardClaim
+		}
+		claim, err := decodeCrossShardClaim(msg.Data())
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyCrossShardClaim(router, claim, msg.From()); err != nil {
+			return nil, err
+		}
+		// the escrow holds no code, so the claim only burns its intrinsic gas
+		gas, err := IntrinsicGas(msg.Data(), false, config.IsHomestead(header.Number()))
+		if err != nil {
+			return nil, err
+		}
+		return &types.ContractResult{TxType: TT_XSHARD_IN, TxHash: tx.Hash(), GasUsed: gas, Data: claim.Receipt.Hash().Bytes()}, nil
+	}
+	// only plain value transfers may leave the shard, calls stay local
+	if router == nil || len(msg.Data()) > 0 {
+		return nil, nil
+	}
+	dstShard := router.AccountShard(master, *to)
+	if dstShard == header.ShardId() {
+		return nil, nil
+	}
+	receipt := &types.CrossShardReceipt{
+		SrcShard: header.ShardId(),
+		DstShard: dstShard,
+		TxHash:   tx.Hash(),
+		From:     msg.From(),
+		To:       *to,
+		TokenId:  msg.TokenId(),
+		Amount:   msg.Value(),
+	}
+	data, err := rlp.EncodeToBytes(receipt)
+	if err != nil {
+		return nil, err
+	}
+	// the value is moved into escrow by a plain transfer
+	return &types.ContractResult{TxType: TT_XSHARD_OUT, TxHash: tx.Hash(), GasUsed: params.TxGas, Data: data}, nil
+}
+
+// applyCrossShardOut executes the source phase of a cross shard transfer: the
+// sender pays gas as usual but the value is moved into escrow instead of the
+// recipient, and the receipt is marked as issued.
+func applyCrossShardOut(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, result *types.ContractResult, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	xreceipt := new(types.CrossShardReceipt)
+	if err := rlp.DecodeBytes(result.Data, xreceipt); err != nil {
+		return nil, ErrInvalidCrossShardReceipt
+	}
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	if msg.To() == nil || xreceipt.TxHash != tx.Hash() || xreceipt.From != msg.From() || xreceipt.To != *msg.To() ||
+		xreceipt.TokenId != msg.TokenId() || xreceipt.Amount == nil || xreceipt.Amount.Cmp(msg.Value()) != 0 ||
+		xreceipt.SrcShard != header.ShardId() {
+		return nil, ErrInvalidCrossShardReceipt
+	}
+	escrow := types.NewMessage(msg.From(), &CrossShardEscrowAddress, msg.Nonce(), msg.TokenId(), msg.Value(), msg.Gas(), msg.GasPrice(), nil, msg.CheckNonce())
+	receipt, _, err := applyMessage(config, bc, author, gp, nil, statedb, header, tx, escrow, usedGas, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		// the escrow may be drained to a zero balance, its nonce keeps the
+		// issued receipt marks from being cleared with it
+		if statedb.GetNonce(CrossShardEscrowAddress) == 0 {
+			statedb.SetNonce(CrossShardEscrowAddress, 1)
+		}
+		statedb.SetState(CrossShardEscrowAddress, xreceipt.Hash(), xshardIssued)
+	}
+	return receipt, nil
+}
+
+// applyCrossShardIn executes the destination phase of a cross shard transfer.
+// The claim transaction itself is applied as an ordinary call to the escrow,
+// after which the escrowed value is released to the recipient if the claim is
+// valid. Invalid or replayed claims only burn gas and yield a failed receipt.
+//
+// Only the master state holds the escrow of every shard. On the state of the
+// destination shard, escrowed is false and the claim is credited without the
+// issued check and the escrow debit, which both happened on the master. The
+// claim is then backed by the source block being confirmed by the master chain,
+// which verifyCrossShardClaim requires in either case, and by the master block
+// including it not having rejected the source transaction.
+func applyCrossShardIn(config *params.ChainConfig, bc ChainContext, router ShardRouter, author *common.Address, gp *GasPool, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, usedGas *uint64, cfg vm.Config, escrowed bool) (*types.Receipt, error) {
+	receipt, _, err := ApplyTransaction(config, bc, author, gp, nil, statedb, header, tx, usedGas, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, nil
+	}
+	if err := creditCrossShardClaim(config, router, statedb, header, tx, escrowed); err != nil {
+		log.Debug("Rejected cross shard claim", "hash", tx.Hash(), "err", err)
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	return receipt, nil
+}
+
+// creditCrossShardClaim releases the escrowed value of a claimed receipt, in
+// whichever token it was sent. Unless escrowed is set, the value is credited
+// without a matching escrow entry, as long as the source block of the receipt
+// is confirmed by the master chain, the master didn't reject the source
+// transaction and the receipt wasn't claimed before.
+func creditCrossShardClaim(config *params.ChainConfig, router ShardRouter, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, escrowed bool) error {
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return err
+	}
+	claim, err := decodeCrossShardClaim(msg.Data())
+	if err != nil {
+		return err
+	}
+	if err := verifyCrossShardClaim(router, claim, msg.From()); err != nil {
+		return err
+	}
+	key := claim.Receipt.Hash()
+	switch statedb.GetState(CrossShardEscrowAddress, key) {
+	case xshardIssued:
+	case xshardClaimed:
+		return ErrCrossShardClaimed
+	default:
+		// The escrow of a shard state never holds foreign receipts, the claim is
+		// backed by the confirmation checked above, unless the master refused to
+		// move the value into escrow in the first place
+		if escrowed || router.CrossShardRejected(claim.BlockHash(), claim.Receipt.TxHash) {
+			return ErrCrossShardNotIssued
+		}
+	}
+	statedb.SetState(CrossShardEscrowAddress, key, xshardClaimed)
+	if escrowed {
+		statedb.SubTokenBalance(CrossShardEscrowAddress, claim.Receipt.TokenId, claim.Receipt.Amount)
+	}
+	statedb.AddTokenBalance(claim.Receipt.To, claim.Receipt.TokenId, claim.Receipt.Amount)
+	return nil
+}
+
+// decodeCrossShardClaim decodes the payload of a claim transaction.
+func decodeCrossShardClaim(data []byte) (*types.CrossShardClaim, error) {
+	claim := new(types.CrossShardClaim)
+	if err := rlp.DecodeBytes(data, claim); err != nil {
+		return nil, ErrInvalidCrossShardClaim
+	}
+	if claim.Header == nil || claim.Receipt == nil || claim.Receipt.Amount == nil {
+		return nil, ErrInvalidCrossShardClaim
+	}
+	return claim, nil
+}
+
+// verifyCrossShardClaim checks a claim against the master chain: the receipt
+// must be addressed to the claiming account, the source shard block must be
+// included by the canonical master chain, and the proof must show the receipt
+// is part of the results of that block. The claiming shard is not checked
+// against DstShard, since the shard layout may have changed in between and the
+// escrow state already protects against replays.
+func verifyCrossShardClaim(router ShardRouter, claim *types.CrossShardClaim, claimer common.Address) error {
+	receipt := claim.Receipt
+	if receipt.To != claimer || receipt.SrcShard != claim.Header.ShardId {
+		return ErrInvalidCrossShardClaim
+	}
+	if router == nil || !router.ShardBlockConfirmed(claim.BlockHash()) {
+		return ErrCrossShardNotConfirmed
+	}
+	result, err := VerifyShardResult(claim.Header.ReceiptHash, claim.Index, claim.Proof)
+	if err != nil {
+		return err
+	}
+	data, err := rlp.EncodeToBytes(receipt)
+	if err != nil {
+		return err
+	}
+	if result.TxType != TT_XSHARD_OUT || result.TxHash != receipt.TxHash || !bytes.Equal(result.Data, data) {
+		return ErrInvalidCrossShardClaim
+	}
+	return nil
+}
+
+// ProveShardResult creates a merkle proof for results[index] against the
+// result root (DeriveSha) of a shard block.
+func ProveShardResult(results types.ContractResults, index uint64) ([][]byte, error) {
+	if index >= uint64(len(results)) {
+		return nil, ErrCrossShardNotFound
+	}
+	tr := new(trie.Trie)
+	for i := 0; i < results.Len(); i++ {
+		key, _ := rlp.EncodeToBytes(uint(i))
+		tr.Update(key, results.GetRlp(i))
+	}
+	key, _ := rlp.EncodeToBytes(uint(index))
+	proofDb := ethdb.NewMemDatabase()
+	if err := tr.Prove(key, 0, proofDb); err != nil {
+		return nil, err
+	}
+	proof := make([][]byte, 0, len(proofDb.Keys()))
+	for _, k := range proofDb.Keys() {
+		node, _ := proofDb.Get(k)
+		proof = append(proof, node)
+	}
+	return proof, nil
+}
+
+// VerifyShardResult checks a merkle proof created by ProveShardResult and
+// returns the proven result.
+func VerifyShardResult(root common.Hash, index uint64, proof [][]byte) (*types.ContractResult, error) {
+	proofDb := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		proofDb.Put(crypto.Keccak256(node), node)
+	}
+	key, _ := rlp.EncodeToBytes(uint(index))
+	value, _, err := trie.VerifyProof(root, key, proofDb)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ErrInvalidCrossShardClaim
+	}
+	result := new(types.ContractResult)
+	if err := rlp.DecodeBytes(value, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CrossShardClaim assembles the claim of the outgoing cross shard receipt of the
+// given transaction. The transaction must have been committed by the master
+// chain, the claim can then be sent to the escrow by the recipient.
+func (bc *BlockChain) CrossShardClaim(txHash common.Hash) (*types.CrossShardClaim, error) {
+	_, blockHash, number, index := rawdb.ReadCrossShardLookupEntry(bc.db, txHash)
+	if blockHash == (common.Hash{}) {
+		return nil, ErrCrossShardNotFound
+	}
+	block := rawdb.ReadBlock(bc.db, blockHash, number)
+	if block == nil || block.ToSBlock() == nil {
+		return nil, ErrCrossShardNotFound
+	}
+	results := types.ContractResults(block.Results())
+	proof, err := ProveShardResult(results, index)
+	if err != nil {
+		return nil, err
+	}
+	receipt := new(types.CrossShardReceipt)
+	if err := rlp.DecodeBytes(results[index].Data, receipt); err != nil {
+		return nil, err
+	}
+	return &types.CrossShardClaim{
+		Header:  block.Header().ToSHeader().ToStruct(),
+		Index:   index,
+		Receipt: receipt,
+		Proof:   proof,
+	}, nil
+}
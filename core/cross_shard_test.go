@@ -0,0 +1,302 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// confirmedRouter is a shard router confirming a fixed set of shard blocks.
+type confirmedRouter map[common.Hash]bool
+
+func (r confirmedRouter) TxShard(master types.HeaderIntf, tx *types.Transaction) (uint16, error) {
+	return 0, nil
+}
+
+func (r confirmedRouter) TxShards(master types.HeaderIntf, tx *types.Transaction) ([]uint16, error) {
+	return []uint16{0}, nil
+}
+
+func (r confirmedRouter) AccountShard(master types.HeaderIntf, addr common.Address) uint16 {
+	return 0
+}
+
+func (r confirmedRouter) ShardBlockConfirmed(hash common.Hash) bool {
+	return r[hash]
+}
+
+func (r confirmedRouter) CrossShardRejected(blockHash, txHash common.Hash) bool {
+	return false
+}
+
+// rejectingRouter is a shard router whose master blocks rejected a fixed set of
+// transactions.
+type rejectingRouter struct {
+	confirmedRouter
+	rejected map[common.Hash]bool
+}
+
+func (r rejectingRouter) CrossShardRejected(blockHash, txHash common.Hash) bool {
+	return r.rejected[txHash]
+}
+
+// makeCrossShardClaim creates a shard block carrying an outgoing receipt to the
+// given recipient, and the claim of that receipt.
+func makeCrossShardClaim(t *testing.T, to common.Address) *types.CrossShardClaim {
+	receipt := &types.CrossShardReceipt{SrcShard: 1, DstShard: 0, TxHash: common.Hash{1}, To: to, Amount: big.NewInt(1000)}
+	data, err := rlp.EncodeToBytes(receipt)
+	if err != nil {
+		t.Fatalf("failed to encode receipt: %v", err)
+	}
+	results := types.ContractResults{
+		{TxType: TT_COMMON, TxHash: common.Hash{2}},
+		{TxType: TT_XSHARD_OUT, TxHash: receipt.TxHash, GasUsed: 21000, Data: data},
+	}
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: 1, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10)})
+	block := types.NewSBlock(header, results)
+
+	proof, err := ProveShardResult(results, 1)
+	if err != nil {
+		t.Fatalf("failed to prove receipt: %v", err)
+	}
+	return &types.CrossShardClaim{Header: block.Header().ToSHeader().ToStruct(), Index: 1, Receipt: receipt, Proof: proof}
+}
+
+// Tests that claims are only accepted from source shard blocks the master chain
+// committed, even if their proof is valid against the header they carry.
+func TestCrossShardClaimConfirmation(t *testing.T) {
+	to := common.Address{0xaa}
+	claim := makeCrossShardClaim(t, to)
+
+	if err := verifyCrossShardClaim(confirmedRouter{}, claim, to); err != ErrCrossShardNotConfirmed {
+		t.Fatalf("unconfirmed claim error mismatch: have %v, want %v", err, ErrCrossShardNotConfirmed)
+	}
+	if err := verifyCrossShardClaim(nil, claim, to); err != ErrCrossShardNotConfirmed {
+		t.Fatalf("routerless claim error mismatch: have %v, want %v", err, ErrCrossShardNotConfirmed)
+	}
+	router := confirmedRouter{claim.BlockHash(): true}
+	if err := verifyCrossShardClaim(router, claim, to); err != nil {
+		t.Fatalf("confirmed claim rejected: %v", err)
+	}
+	if err := verifyCrossShardClaim(router, claim, common.Address{0xbb}); err != ErrInvalidCrossShardClaim {
+		t.Fatalf("foreign claim error mismatch: have %v, want %v", err, ErrInvalidCrossShardClaim)
+	}
+	// A forged header with the proof of another receipt must not be confirmed
+	forged := makeCrossShardClaim(t, to)
+	forged.Receipt.Amount = big.NewInt(1000000)
+	data, _ := rlp.EncodeToBytes(forged.Receipt)
+	results := types.ContractResults{{TxType: TT_XSHARD_OUT, TxHash: forged.Receipt.TxHash, Data: data}}
+	forged.Header.ReceiptHash = types.DeriveSha(results)
+	forged.Index = 0
+	forged.Proof, _ = ProveShardResult(results, 0)
+
+	if err := verifyCrossShardClaim(router, forged, to); err != ErrCrossShardNotConfirmed {
+		t.Fatalf("forged claim error mismatch: have %v, want %v", err, ErrCrossShardNotConfirmed)
+	}
+}
+
+// Tests that the state of a destination shard, which holds no escrow entry for
+// foreign receipts, only credits claims of confirmed source blocks, and only once.
+func TestShardCrossShardCredit(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	to := crypto.PubkeyToAddress(key.PublicKey)
+	claim := makeCrossShardClaim(t, to)
+
+	data, err := rlp.EncodeToBytes(claim)
+	if err != nil {
+		t.Fatalf("failed to encode claim: %v", err)
+	}
+	tx, err := types.SignTx(types.NewTransaction(0, CrossShardEscrowAddress, new(big.Int), 100000, big.NewInt(1), data, types.NativeTokenId), types.NewEIP155Signer(params.TestChainConfig.ChainID), key)
+	if err != nil {
+		t.Fatalf("failed to sign claim: %v", err)
+	}
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: 0, Number: big.NewInt(1)})
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	if err := creditCrossShardClaim(params.TestChainConfig, confirmedRouter{}, statedb, header, tx, false); err != ErrCrossShardNotConfirmed {
+		t.Fatalf("unconfirmed credit error mismatch: have %v, want %v", err, ErrCrossShardNotConfirmed)
+	}
+	if balance := statedb.GetBalance(to); balance.Sign() != 0 {
+		t.Fatalf("unconfirmed claim credited: balance %v", balance)
+	}
+	router := confirmedRouter{claim.BlockHash(): true}
+	if err := creditCrossShardClaim(params.TestChainConfig, router, statedb, header, tx, false); err != nil {
+		t.Fatalf("confirmed claim rejected: %v", err)
+	}
+	if balance := statedb.GetBalance(to); balance.Cmp(claim.Receipt.Amount) != 0 {
+		t.Fatalf("credited balance mismatch: have %v, want %v", balance, claim.Receipt.Amount)
+	}
+	if err := creditCrossShardClaim(params.TestChainConfig, router, statedb, header, tx, false); err != ErrCrossShardClaimed {
+		t.Fatalf("replayed credit error mismatch: have %v, want %v", err, ErrCrossShardClaimed)
+	}
+	// Receipts the master rejected never went into escrow and aren't credited
+	shard, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	rejecting := rejectingRouter{router, map[common.Hash]bool{claim.Receipt.TxHash: true}}
+	if err := creditCrossShardClaim(params.TestChainConfig, rejecting, shard, header, tx, false); err != ErrCrossShardNotIssued {
+		t.Fatalf("rejected credit error mismatch: have %v, want %v", err, ErrCrossShardNotIssued)
+	}
+	if balance := shard.GetBalance(to); balance.Sign() != 0 {
+		t.Fatalf("rejected claim credited: balance %v", balance)
+	}
+	// The master only releases receipts it issued into escrow
+	master, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	if err := creditCrossShardClaim(params.TestChainConfig, router, master, header, tx, true); err != ErrCrossShardNotIssued {
+		t.Fatalf("unissued escrow credit error mismatch: have %v, want %v", err, ErrCrossShardNotIssued)
+	}
+}
+
+// Tests that outgoing cross shard receipts are only indexed once a canonical
+// master block includes their source block without rejecting them, and that
+// the entries follow the canonical chain on reorgs.
+func TestCrossShardTxLookups(t *testing.T) {
+	var (
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		db      = ethdb.NewMemDatabase()
+		genesis = gspec.MustCommit(db, types.ShardMaster)
+		engine  = ethash.NewFaker()
+	)
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	canon, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, nil)
+	fork, _ := GenerateChain(gspec.Config, canon[0], engine, db, 2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := chain.InsertChain(canon[:1]); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	// Source shard blocks issuing receipts, included by either branch
+	shardBlock := func(hashes ...common.Hash) types.BlockIntf {
+		header := new(types.SHeader)
+		header.FillBy(&types.SHeaderStruct{ShardId: 1, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10), Extra: hashes[0].Bytes()})
+		var results types.ContractResults
+		for _, hash := range hashes {
+			results = append(results, &types.ContractResult{TxType: TT_XSHARD_OUT, TxHash: hash})
+		}
+		block := types.NewSBlock(header, results)
+		rawdb.WriteBlock(db, block)
+		return block
+	}
+	var (
+		canonTx    = common.Hash{0x01}
+		rejectedTx = common.Hash{0x02}
+		forkTx     = common.Hash{0x03}
+		canonSrc   = shardBlock(canonTx, rejectedTx)
+		forkSrc    = shardBlock(forkTx)
+	)
+	include := func(header types.HeaderIntf, parent common.Hash, src types.BlockIntf) types.BlockIntf {
+		header = types.CopyHeaderIntf(header)
+		header.SetParentHash(parent)
+		if src == nil {
+			return types.NewBlock(header, nil, nil, nil)
+		}
+		return types.NewBlock(header, []*types.ShardBlockInfo{{ShardId: 1, BlockNumber: 1, Hash: src.Hash()}}, nil, nil)
+	}
+	write := func(block types.BlockIntf, parent types.BlockIntf, rejected []*types.RejectedTx) WriteStatus {
+		statedb, err := state.New(parent.Root(), chain.stateCache)
+		if err != nil {
+			t.Fatalf("failed to open state: %v", err)
+		}
+		status, err := chain.WriteBlockWithState(block, nil, rejected, statedb)
+		if err != nil {
+			t.Fatalf("failed to write block: %v", err)
+		}
+		return status
+	}
+	canon1 := include(canon[1].Header(), canon[0].Hash(), canonSrc)
+
+	// Keep the local head on ties, so that the first fork block is a side block
+	chain.shouldPreserve = func(block types.BlockIntf) bool { return block.Hash() == canon1.Hash() }
+	if status := write(canon1, canon[0], []*types.RejectedTx{{TxHash: rejectedTx}}); status != CanonStatTy {
+		t.Fatalf("canonical block status mismatch: have %v, want %v", status, CanonStatTy)
+	}
+	fork0 := include(fork[0].Header(), canon[0].Hash(), forkSrc)
+	if status := write(fork0, canon[0], nil); status != SideStatTy {
+		t.Fatalf("side block status mismatch: have %v, want %v", status, SideStatTy)
+	}
+	if _, hash, _, index := rawdb.ReadCrossShardLookupEntry(db, canonTx); hash != canonSrc.Hash() || index != 0 {
+		t.Errorf("canonical receipt entry mismatch: have %x/%d, want %x/0", hash, index, canonSrc.Hash())
+	}
+	if _, hash, _, _ := rawdb.ReadCrossShardLookupEntry(db, rejectedTx); hash != (common.Hash{}) {
+		t.Errorf("rejected receipt indexed in %x", hash)
+	}
+	if _, hash, _, _ := rawdb.ReadCrossShardLookupEntry(db, forkTx); hash != (common.Hash{}) {
+		t.Errorf("side block receipt indexed in %x", hash)
+	}
+	// Extend the fork past the canonical chain and check the entries moved along
+	fork1 := include(fork[1].Header(), fork0.Hash(), nil)
+	if status := write(fork1, fork0, nil); status != CanonStatTy {
+		t.Fatalf("reorg block status mismatch: have %v, want %v", status, CanonStatTy)
+	}
+	if _, hash, _, _ := rawdb.ReadCrossShardLookupEntry(db, canonTx); hash != (common.Hash{}) {
+		t.Errorf("dropped receipt still indexed in %x", hash)
+	}
+	if _, hash, _, _ := rawdb.ReadCrossShardLookupEntry(db, forkTx); hash != forkSrc.Hash() {
+		t.Errorf("reorged receipt entry mismatch: have %x, want %x", hash, forkSrc.Hash())
+	}
+}
+
+// Tests that the transactions of a shard block count as rejected as told by the
+// rejected bloom of the master block including it, and all of them if none does.
+func TestCrossShardRejected(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	(&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	var (
+		rejected = common.Hash{0x01}
+		applied  = common.Hash{0x02}
+		included = common.Hash{0xaa}
+	)
+	header := layoutHeader(common.Hash{}, 1, ShardLayout{})
+	header.SetBloomRejected(types.CreateRejectBloom([]*types.RejectedTx{{TxHash: rejected}}))
+	master := types.NewBlock(header, []*types.ShardBlockInfo{{ShardId: 1, BlockNumber: 1, Hash: included}}, nil, nil)
+	rawdb.WriteHeader(db, master.Header())
+	rawdb.WriteShardBlockEntries(db, master)
+
+	if !chain.CrossShardRejected(included, rejected) {
+		t.Errorf("rejected transaction not reported")
+	}
+	if chain.CrossShardRejected(included, applied) {
+		t.Errorf("applied transaction reported rejected")
+	}
+	if !chain.CrossShardRejected(common.Hash{0xbb}, applied) {
+		t.Errorf("transaction of unincluded block not reported rejected")
+	}
+}
@@ -36,4 +36,16 @@ var (
 	// ErrNonceTooHigh is returned if the nonce of a transaction is higher than the
 	// next one expected based on the local chain.
 	ErrAccountNonceExists = errors.New("account nonce exists")
+
+	// ErrMissingShardTx is returned if a transaction of a shard block result is
+	// not known locally yet. The block is queued until it is fetched.
+	ErrMissingShardTx = errors.New("missing shard block transaction")
+
+	// ErrUnknownMasterBlock is returned if the master block referenced by a
+	// shard header is not known locally yet. The block is queued until it is.
+	ErrUnknownMasterBlock = errors.New("unknown master block")
+
+	// ErrMasterReference is returned if a shard header references a master
+	// block older than the one referenced by its parent.
+	ErrMasterReference = errors.New("master reference behind parent")
 )
@@ -51,4 +51,8 @@ type ChainsShardEvent struct {
 	Block types.BlockIntfs
 }
 type ChainHeadEvent struct{ Block types.BlockIntf }
+
+// FraudProofEvent is posted when a fraud proof for a shard block was built or
+// accepted.
+type FraudProofEvent struct{ Proof *types.FraudProof }
 type ShardChainHeadEvent struct {Block *types.SBlock}
@@ -0,0 +1,322 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/trie"
+)
+
+// The master doesn't execute shard blocks, it only applies their results. A
+// shard node importing a block whose results, gas used or state root don't
+// match its own execution builds a FraudProof for it, which any node can check
+// without the state of the shard. Once the master accepts a proof, the block
+// and its descendants are marked invalid: they are dropped from the shard pool
+// and master blocks including them are rejected, so they never earn a share of
+// the reward remains of their shard. If a canonical master block included one,
+// it is rewound and its replacement slashes the shard, zeroing its remains.
+
+var (
+	// ErrInvalidFraudProof is returned if a fraud proof is malformed or doesn't
+	// match the block it disputes.
+	ErrInvalidFraudProof = errors.New("invalid fraud proof")
+
+	// ErrIncompleteWitness is returned if the witness of a fraud proof lacks
+	// some of the state needed to execute the disputed block.
+	ErrIncompleteWitness = errors.New("incomplete fraud proof witness")
+
+	// ErrNoFraud is returned if the block disputed by a fraud proof is valid.
+	ErrNoFraud = errors.New("shard block is valid")
+
+	// ErrUnverifiableFraud is returned if the block disputed by a fraud proof
+	// fails on chain data missing locally, e.g. the source block of a cross
+	// shard claim not confirmed yet, which doesn't prove the block invalid.
+	ErrUnverifiableFraud = errors.New("fraud proof not verifiable locally")
+
+	// ErrKnownFraud is returned if the block disputed by a fraud proof is
+	// already known to be invalid.
+	ErrKnownFraud = errors.New("shard block already proven invalid")
+
+	// ErrInvalidShardBlock is returned if a block is, or a master block
+	// includes, a shard block proven invalid.
+	ErrInvalidShardBlock = errors.New("shard block proven invalid")
+)
+
+// witnessRecorder serves the state of a chain, recording every trie node and
+// contract code read through it.
+type witnessRecorder struct {
+	ethdb.Database
+	triedb *trie.Database
+
+	lock    sync.Mutex
+	witness map[common.Hash][]byte
+}
+
+func newWitnessRecorder(db ethdb.Database, triedb *trie.Database) *witnessRecorder {
+	return &witnessRecorder{
+		Database: db,
+		triedb:   triedb,
+		witness:  make(map[common.Hash][]byte),
+	}
+}
+
+// Get retrieves a trie node or contract code by hash, including trie nodes not
+// yet flushed to disk.
+func (w *witnessRecorder) Get(key []byte) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return w.Database.Get(key)
+	}
+	blob, err := w.triedb.Node(common.BytesToHash(key))
+	if err != nil {
+		return nil, err
+	}
+	w.lock.Lock()
+	w.witness[common.BytesToHash(key)] = blob
+	w.lock.Unlock()
+	return blob, nil
+}
+
+// Witness returns the recorded items in a deterministic order.
+func (w *witnessRecorder) Witness() [][]byte {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	hashes := make([]common.Hash, 0, len(w.witness))
+	for hash := range w.witness {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	witness := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		witness[i] = w.witness[hash]
+	}
+	return witness
+}
+
+// checkShardBlock executes a shard block on the state of its parent and
+// compares the outcome with the header. It returns nil if the block is valid.
+func checkShardBlock(config *params.ChainConfig, bc ChainContext, router ShardRouter, master types.HeaderIntf, statedb *state.StateDB, block types.BlockIntf, txs []*types.Transaction) error {
+	_, usedGas, err := replayShardResults(config, bc, router, master, statedb, block, txs, vm.Config{})
+	if err != nil {
+		return err
+	}
+	if block.GasUsed() != usedGas {
+		return fmt.Errorf("invalid gas used (remote: %d local: %d)", block.GasUsed(), usedGas)
+	}
+	if root := statedb.IntermediateRoot(config.IsEIP158(block.Number())); block.Root() != root {
+		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", block.Root(), root)
+	}
+	return nil
+}
+
+// localViewError reports whether a shard block failed on the local view of the
+// chains rather than on its own contents. Every other error of a replay follows
+// from the block, its parent state and the master block it references alone.
+func localViewError(err error) bool {
+	switch err {
+	case ErrCrossShardNotConfirmed, ErrUnknownMasterBlock, ErrMissingShardTx, consensus.ErrUnknownAncestor:
+		return true
+	}
+	return false
+}
+
+// ProveFraud builds a fraud proof for a shard block of the local chain. It
+// returns ErrNoFraud if the block is valid.
+func (p *StateProcessor) ProveFraud(block types.BlockIntf) (*types.FraudProof, error) {
+	if block.ShardId() == types.ShardMaster {
+		return nil, ErrInvalidBlocks
+	}
+	parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	txs, err := p.shardTxs(block)
+	if err != nil {
+		return nil, err
+	}
+	recorder := newWitnessRecorder(p.bc.db, p.bc.stateCache.TrieDB())
+	statedb, err := state.New(parent.Root(), state.NewDatabase(recorder))
+	if err != nil {
+		return nil, err
+	}
+	master := p.bc.routingHeader(block.Header())
+	if master == nil {
+		return nil, ErrUnknownMasterBlock
+	}
+	err = checkShardBlock(p.config, p.bc, p.bc, master, statedb, block, txs)
+	if statedb.Error() != nil {
+		return nil, statedb.Error()
+	}
+	if err == nil {
+		return nil, ErrNoFraud
+	}
+	if localViewError(err) {
+		return nil, ErrUnverifiableFraud
+	}
+	log.Debug("Proving invalid shard block", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+
+	return &types.FraudProof{
+		Parent:  parent.ToSHeader().ToStruct(),
+		Block:   block.ToSBlock(),
+		Txs:     txs,
+		Witness: recorder.Witness(),
+	}, nil
+}
+
+// VerifyFraudProof executes the block disputed by a fraud proof on the witness
+// of its parent state. It returns nil if the proof holds, i.e. the results,
+// gas used or state root of the block don't match the execution. Failures on
+// chain data missing locally yield ErrUnverifiableFraud instead, since another
+// node may well execute the block.
+//
+// Transactions are routed by the shard layouts in force at master, the master
+// header referenced by the disputed block, so a transaction included by the
+// wrong shard is proof of fraud as well.
+func VerifyFraudProof(config *params.ChainConfig, bc ChainContext, router ShardRouter, master types.HeaderIntf, proof *types.FraudProof) error {
+	if proof.Parent == nil || proof.Block == nil {
+		return ErrInvalidFraudProof
+	}
+	var (
+		parent = new(types.SHeader)
+		block  = proof.Block
+	)
+	parent.FillBy(proof.Parent)
+	if block.ShardId() == types.ShardMaster || parent.ShardId() != block.ShardId() ||
+		parent.Hash() != block.ParentHash() || parent.NumberU64()+1 != block.NumberU64() {
+		return ErrInvalidFraudProof
+	}
+	results := block.Results()
+	if types.DeriveSha(types.ContractResults(results)) != block.ReceiptHash() || len(proof.Txs) != len(results) {
+		return ErrInvalidFraudProof
+	}
+	for i, tx := range proof.Txs {
+		if tx.Hash() != results[i].TxHash {
+			return ErrInvalidFraudProof
+		}
+	}
+	// Rebuild the parent state from the witness, keyed by hash
+	db := ethdb.NewMemDatabase()
+	for _, item := range proof.Witness {
+		db.Put(crypto.Keccak256(item), item)
+	}
+	statedb, err := state.New(parent.Root(), state.NewDatabase(db))
+	if err != nil {
+		return ErrIncompleteWitness
+	}
+	err = checkShardBlock(config, bc, router, master, statedb, block, proof.Txs)
+	if statedb.Error() != nil {
+		return ErrIncompleteWitness
+	}
+	if err == nil {
+		return ErrNoFraud
+	}
+	if localViewError(err) {
+		log.Debug("Unverifiable fraud proof", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		return ErrUnverifiableFraud
+	}
+	log.Debug("Verified fraud proof", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+	return nil
+}
+
+// ReportFraud checks a fraud proof and, if it holds, marks the disputed shard
+// block as invalid. On the master chain, a canonical master block including
+// the invalid block is rewound as well. Accepted proofs are announced on the
+// fraud proof feed.
+func (bc *BlockChain) ReportFraud(proof *types.FraudProof) error {
+	if proof.Block == nil {
+		return ErrInvalidFraudProof
+	}
+	hash := proof.Hash()
+	if rawdb.ReadInvalidShardBlock(bc.db, hash) != (common.Hash{}) {
+		return ErrKnownFraud
+	}
+	master := bc.routingHeader(proof.Block.Header())
+	if master == nil {
+		return ErrUnknownMasterBlock
+	}
+	if err := VerifyFraudProof(bc.chainConfig, bc, bc, master, proof); err != nil {
+		return err
+	}
+	log.Warn("Shard block proven invalid", "shard", proof.Block.ShardId(), "number", proof.Block.NumberU64(), "hash", hash)
+	rawdb.WriteInvalidShardBlock(bc.db, hash, hash)
+
+	if bc.shardId == types.ShardMaster {
+		_, masterHash, number, _ := rawdb.ReadTxLookupEntry(bc.db, hash)
+		if masterHash != (common.Hash{}) && number > 0 && rawdb.ReadCanonicalHash(bc.db, types.ShardMaster, number) == masterHash {
+			log.Warn("Rewinding master block including invalid shard block", "number", number, "hash", masterHash)
+			if header := bc.GetHeader(masterHash, number); header != nil && !reflect.ValueOf(header).IsNil() {
+				bc.slashShard(header.ParentHash(), proof.Block.ShardId())
+			}
+			if err := bc.SetHead(number - 1); err != nil {
+				return err
+			}
+		}
+	}
+	bc.fraudProofFeed.Send(FraudProofEvent{Proof: proof})
+	return nil
+}
+
+// slashShard records that the master block following parent forfeits the reward
+// remains of a shard, which produced a block proven invalid.
+func (bc *BlockChain) slashShard(parent common.Hash, shardId uint16) {
+	shards := rawdb.ReadShardSlashes(bc.db, parent)
+	for _, shard := range shards {
+		if shard == shardId {
+			return
+		}
+	}
+	rawdb.WriteShardSlashes(bc.db, parent, append(shards, shardId))
+}
+
+// SlashedShards retrieves the shards whose reward remains are forfeited by the
+// master block following parent, implementing consensus.ShardSlasher.
+func (bc *BlockChain) SlashedShards(parent common.Hash) []uint16 {
+	return rawdb.ReadShardSlashes(bc.db, parent)
+}
+
+// proveFraud is called on a shard chain for a block failing to import, and
+// announces a fraud proof for it if the failure is provable.
+func (bc *BlockChain) proveFraud(block types.BlockIntf) {
+	processor, ok := bc.processor.(*StateProcessor)
+	if !ok || bc.shardId == types.ShardMaster {
+		return
+	}
+	proof, err := processor.ProveFraud(block)
+	if err != nil {
+		log.Debug("Failed to prove invalid shard block", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		return
+	}
+	rawdb.WriteInvalidShardBlock(bc.db, block.Hash(), block.Hash())
+	bc.fraudProofFeed.Send(FraudProofEvent{Proof: proof})
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Tests that a block failing on a cross shard claim whose source block isn't
+// confirmed locally is not taken as proven invalid, while the same block is once
+// the source is confirmed.
+func TestVerifyFraudProofLocalView(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	claim := makeCrossShardClaim(t, crypto.PubkeyToAddress(key.PublicKey))
+
+	data, err := rlp.EncodeToBytes(claim)
+	if err != nil {
+		t.Fatalf("failed to encode claim: %v", err)
+	}
+	tx, err := types.SignTx(types.NewTransaction(0, CrossShardEscrowAddress, new(big.Int), 100000, big.NewInt(1), data, types.NativeTokenId), types.NewEIP155Signer(params.TestChainConfig.ChainID), key)
+	if err != nil {
+		t.Fatalf("failed to sign claim: %v", err)
+	}
+	parent := new(types.SHeader)
+	parent.FillBy(&types.SHeaderStruct{Root: types.EmptyRootHash, Number: big.NewInt(0), Difficulty: big.NewInt(1), Time: big.NewInt(0)})
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ParentHash: parent.Hash(), Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10), GasLimit: params.GenesisGasLimit})
+
+	results := types.ContractResults{{TxType: TT_XSHARD_IN, TxHash: tx.Hash(), GasUsed: 1, Data: claim.Receipt.Hash().Bytes()}}
+	proof := &types.FraudProof{
+		Parent: parent.ToStruct(),
+		Block:  types.NewSBlock(header, results).ToSBlock(),
+		Txs:    types.Transactions{tx},
+	}
+	db := ethdb.NewMemDatabase()
+	(&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if err := VerifyFraudProof(params.TestChainConfig, chain, confirmedRouter{}, chain.CurrentMasterHeader(), proof); err != ErrUnverifiableFraud {
+		t.Fatalf("unconfirmed source error mismatch: have %v, want %v", err, ErrUnverifiableFraud)
+	}
+	router := confirmedRouter{claim.BlockHash(): true}
+	if err := VerifyFraudProof(params.TestChainConfig, chain, router, chain.CurrentMasterHeader(), proof); err != nil {
+		t.Fatalf("confirmed source fraud proof rejected: %v", err)
+	}
+}
@@ -17,18 +17,21 @@ var _ = (*genesisSpecMarshaling)(nil)
 
 func (g Genesis) MarshalJSON() ([]byte, error) {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      math.HexOrDecimal64                         `json:"nonce"`
-		Timestamp  math.HexOrDecimal64                         `json:"timestamp"`
-		ExtraData  hexutil.Bytes                               `json:"extraData"`
-		GasLimit   math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    common.Hash                                 `json:"mixHash"`
-		Coinbase   common.Address                              `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     math.HexOrDecimal64                         `json:"number"`
-		GasUsed    math.HexOrDecimal64                         `json:"gasUsed"`
-		ParentHash common.Hash                                 `json:"parentHash"`
+		Config       *params.ChainConfig                         `json:"config"`
+		Nonce        math.HexOrDecimal64                         `json:"nonce"`
+		Timestamp    math.HexOrDecimal64                         `json:"timestamp"`
+		ExtraData    hexutil.Bytes                               `json:"extraData"`
+		GasLimit     math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
+		Difficulty   *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
+		Mixhash      common.Hash                                 `json:"mixHash"`
+		Coinbase     common.Address                              `json:"coinbase"`
+		Alloc        map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
+		Number       math.HexOrDecimal64                         `json:"number"`
+		GasUsed      math.HexOrDecimal64                         `json:"gasUsed"`
+		ParentHash   common.Hash                                 `json:"parentHash"`
+		ShardExp     uint16                                      `json:"shardExp"`
+		ShardEnabled [32]byte                                    `json:"shardEnabled"`
+		Shards       map[uint16]*GenesisShard                    `json:"shards,omitempty"`
 	}
 	var enc Genesis
 	enc.Config = g.Config
@@ -48,23 +51,29 @@ func (g Genesis) MarshalJSON() ([]byte, error) {
 	enc.Number = math.HexOrDecimal64(g.Number)
 	enc.GasUsed = math.HexOrDecimal64(g.GasUsed)
 	enc.ParentHash = g.ParentHash
+	enc.ShardExp = g.ShardExp
+	enc.ShardEnabled = g.ShardEnabled
+	enc.Shards = g.Shards
 	return json.Marshal(&enc)
 }
 
 func (g *Genesis) UnmarshalJSON(input []byte) error {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      *math.HexOrDecimal64                        `json:"nonce"`
-		Timestamp  *math.HexOrDecimal64                        `json:"timestamp"`
-		ExtraData  *hexutil.Bytes                              `json:"extraData"`
-		GasLimit   *math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    *common.Hash                                `json:"mixHash"`
-		Coinbase   *common.Address                             `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     *math.HexOrDecimal64                        `json:"number"`
-		GasUsed    *math.HexOrDecimal64                        `json:"gasUsed"`
-		ParentHash *common.Hash                                `json:"parentHash"`
+		Config       *params.ChainConfig                         `json:"config"`
+		Nonce        *math.HexOrDecimal64                        `json:"nonce"`
+		Timestamp    *math.HexOrDecimal64                        `json:"timestamp"`
+		ExtraData    *hexutil.Bytes                              `json:"extraData"`
+		GasLimit     *math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
+		Difficulty   *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
+		Mixhash      *common.Hash                                `json:"mixHash"`
+		Coinbase     *common.Address                             `json:"coinbase"`
+		Alloc        map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
+		Number       *math.HexOrDecimal64                        `json:"number"`
+		GasUsed      *math.HexOrDecimal64                        `json:"gasUsed"`
+		ParentHash   *common.Hash                                `json:"parentHash"`
+		ShardExp     *uint16                                     `json:"shardExp"`
+		ShardEnabled *[32]byte                                   `json:"shardEnabled"`
+		Shards       map[uint16]*GenesisShard                    `json:"shards,omitempty"`
 	}
 	var dec Genesis
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -112,5 +121,14 @@ func (g *Genesis) UnmarshalJSON(input []byte) error {
 	if dec.ParentHash != nil {
 		g.ParentHash = *dec.ParentHash
 	}
+	if dec.ShardExp != nil {
+		g.ShardExp = *dec.ShardExp
+	}
+	if dec.ShardEnabled != nil {
+		g.ShardEnabled = *dec.ShardEnabled
+	}
+	if dec.Shards != nil {
+		g.Shards = dec.Shards
+	}
 	return nil
 }
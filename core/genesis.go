@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"math/bits"
 	"strings"
 
 	"github.com/EDXFund/MasterChain/common"
@@ -39,8 +40,12 @@ import (
 
 //go:generate gencodec -type Genesis -field-override genesisSpecMarshaling -out gen_genesis.go
 //go:generate gencodec -type GenesisAccount -field-override genesisAccountMarshaling -out gen_genesis_account.go
+//go:generate gencodec -type GenesisShard -field-override genesisShardMarshaling -out gen_genesis_shard.go
 
-var errGenesisNoConfig = errors.New("genesis has no chain configuration")
+var (
+	errGenesisNoConfig     = errors.New("genesis has no chain configuration")
+	errGenesisInvalidShard = errors.New("genesis configures a shard beyond the maximum shard id")
+)
 
 // Genesis specifies the header fields, state of a genesis block. It also defines hard
 // fork switch-over blocks through the chain configuration.
@@ -62,6 +67,18 @@ type Genesis struct {
 	ParentHash   common.Hash `json:"parentHash"`
 	ShardExp     uint16      `json:"shardExp"`
 	ShardEnabled [32]byte    `json:"shardEnabled"`
+
+	// Shards overrides the genesis specification of individual shard chains.
+	Shards map[uint16]*GenesisShard `json:"shards,omitempty"`
+}
+
+// GenesisShard specifies the genesis block of a single shard chain. Zero fields
+// fall back to the values of the enclosing genesis specification.
+type GenesisShard struct {
+	Enabled    *bool        `json:"enabled,omitempty"` // Overrides ShardEnabled if set
+	GasLimit   uint64       `json:"gasLimit,omitempty"`
+	Difficulty *big.Int     `json:"difficulty,omitempty"`
+	Alloc      GenesisAlloc `json:"alloc,omitempty"` // Accounts of the shard, added to the common ones
 }
 
 // GenesisAlloc specifies the initial state that is part of the genesis block.
@@ -100,6 +117,12 @@ type genesisSpecMarshaling struct {
 	Alloc      map[common.UnprefixedAddress]GenesisAccount
 }
 
+type genesisShardMarshaling struct {
+	GasLimit   math.HexOrDecimal64
+	Difficulty *math.HexOrDecimal256
+	Alloc      map[common.UnprefixedAddress]GenesisAccount
+}
+
 type genesisAccountMarshaling struct {
 	Code       hexutil.Bytes
 	Balance    *math.HexOrDecimal256
@@ -156,6 +179,9 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis, shardId uint16) (*pa
 	if genesis != nil && genesis.Config == nil {
 		return params.AllEthashProtocolChanges, common.Hash{}, errGenesisNoConfig
 	}
+	if genesis != nil && !genesis.validShards() {
+		return genesis.Config, common.Hash{}, errGenesisInvalidShard
+	}
 
 	// Just commit the new block if there is no stored genesis block.
 	stored := rawdb.ReadCanonicalHash(db, shardId, 0)
@@ -171,11 +197,6 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis, shardId uint16) (*pa
 		db.Put([]byte("genesis"), data)
 
 		block, err := genesis.Commit(db, shardId)
-
-		if shardId != types.ShardMaster {
-			genesis.Commit(db, types.ShardMaster)
-		}
-
 		return genesis.Config, block.Hash(), err
 	}
 
@@ -218,10 +239,67 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis, shardId uint16) (*pa
 	if compatErr != nil && *height != 0 && compatErr.RewindTo != 0 {
 		return newcfg, stored, compatErr
 	}
+	// The shard chains of a master node follow the genesis specification too
+	if shardId == types.ShardMaster && genesis != nil {
+		if shardErr := checkShardGenesis(db, genesis, *height); shardErr != nil {
+			return newcfg, stored, shardErr
+		}
+		data, _ := json.Marshal(genesis)
+		db.Put([]byte("genesis"), data)
+	}
 	rawdb.WriteChainConfig(db, stored, newcfg)
 	return newcfg, stored, nil
 }
 
+// checkShardGenesis replaces the genesis blocks of the shard chains committed to
+// the database on a master node if the genesis specification changed them. Once
+// the master chain included blocks of a changed shard, it has to be rewound to
+// before the first of them, which the returned error requests without touching
+// the database, unless the master chain is at its genesis block.
+func checkShardGenesis(db ethdb.Database, genesis *Genesis, height uint64) *params.ConfigCompatError {
+	shards := rawdb.ReadHeaderForestShards(db)
+	for shardId := range genesis.Shards {
+		shards = append(shards, shardId)
+	}
+	var (
+		compatErr *params.ConfigCompatError
+		changed   = make(map[uint16]common.Hash)
+	)
+	for _, shardId := range shards {
+		stored := rawdb.ReadCanonicalHash(db, shardId, 0)
+		if stored == (common.Hash{}) {
+			continue
+		}
+		if _, ok := changed[shardId]; ok || genesis.ToSBlock(nil, shardId).Hash() == stored {
+			continue
+		}
+		changed[shardId] = stored
+
+		if first := rawdb.ReadCanonicalHash(db, shardId, 1); first != (common.Hash{}) {
+			if _, master, number, _ := rawdb.ReadTxLookupEntry(db, first); master != (common.Hash{}) {
+				if err := params.NewShardCompatError(shardId, number); compatErr == nil || err.RewindTo < compatErr.RewindTo {
+					compatErr = err
+				}
+			}
+		}
+	}
+	if compatErr != nil && height != 0 {
+		return compatErr
+	}
+	for shardId, stored := range changed {
+		for n := uint64(1); rawdb.ReadCanonicalHash(db, shardId, n) != (common.Hash{}); n++ {
+			rawdb.DeleteCanonicalHash(db, shardId, n)
+		}
+		block, err := genesis.Commit(db, shardId)
+		if err != nil {
+			log.Error("Failed to update shard genesis", "shard", shardId, "err", err)
+			continue
+		}
+		log.Warn("Updated shard genesis block", "shard", shardId, "stored", stored, "new", block.Hash())
+	}
+	return nil
+}
+
 func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 	switch {
 	case g != nil:
@@ -260,6 +338,7 @@ func (g *Genesis) ToBlock(db ethdb.Database) types.BlockIntf {
 		}
 	}
 	root := statedb.IntermediateRoot(false)
+	layout := g.shardLayout()
 	head := new(types.Header)
 	head_ := &types.HeaderStruct{
 		Number:       new(big.Int).SetUint64(g.Number),
@@ -273,8 +352,8 @@ func (g *Genesis) ToBlock(db ethdb.Database) types.BlockIntf {
 		MixDigest:    g.Mixhash,
 		Coinbase:     g.Coinbase,
 		Root:         root,
-		ShardMaskEp:  g.ShardExp,
-		ShardEnabled: g.ShardEnabled,
+		ShardMaskEp:  layout.Exp,
+		ShardEnabled: layout.Enabled,
 	}
 	head.FillBy(head_)
 
@@ -293,12 +372,79 @@ func (g *Genesis) ToBlock(db ethdb.Database) types.BlockIntf {
 	return types.NewBlock(head, nil, nil, nil)
 }
 
-// ToBlock creates the genesis block and writes state of a genesis specification
-// to the given database (or discards it if nil).
+// validShards reports whether all shards configured by the shards section exist.
+func (g *Genesis) validShards() bool {
+	for shardId := range g.Shards {
+		if shardId >= 1<<params.MaxShardExp {
+			return false
+		}
+	}
+	return true
+}
+
+// shardLayout returns the shard layout of the genesis block: ShardExp and
+// ShardEnabled, updated with the shards enabled or disabled by the shards section.
+func (g *Genesis) shardLayout() ShardLayout {
+	layout := ShardLayout{Exp: g.ShardExp, Enabled: g.ShardEnabled}
+	for shardId, spec := range g.Shards {
+		if shardId == 0 || shardId >= 1<<params.MaxShardExp || spec == nil || spec.Enabled == nil {
+			continue
+		}
+		layout.setEnabled(shardId, *spec.Enabled)
+		if exp := uint16(bits.Len16(shardId)); *spec.Enabled && exp > layout.Exp {
+			layout.Exp = exp
+		}
+	}
+	return layout
+}
+
+// EnabledShards returns the ids of the shard chains running from the genesis
+// block on, in ascending order.
+func (g *Genesis) EnabledShards() []uint16 {
+	layout := g.shardLayout()
+
+	var shards []uint16
+	for shardId := 0; shardId < 1<<params.MaxShardExp && shardId < 1<<layout.Exp; shardId++ {
+		if layout.IsEnabled(uint16(shardId)) {
+			shards = append(shards, uint16(shardId))
+		}
+	}
+	return shards
+}
+
+// forShard returns the genesis specification of a shard chain, with the settings
+// of its entry in the shards section applied.
+func (g *Genesis) forShard(shardId uint16) *Genesis {
+	spec, ok := g.Shards[shardId]
+	if !ok || spec == nil {
+		return g
+	}
+	sg := *g
+	if spec.GasLimit != 0 {
+		sg.GasLimit = spec.GasLimit
+	}
+	if spec.Difficulty != nil {
+		sg.Difficulty = spec.Difficulty
+	}
+	if len(spec.Alloc) > 0 {
+		sg.Alloc = make(GenesisAlloc, len(g.Alloc)+len(spec.Alloc))
+		for addr, account := range g.Alloc {
+			sg.Alloc[addr] = account
+		}
+		for addr, account := range spec.Alloc {
+			sg.Alloc[addr] = account
+		}
+	}
+	return &sg
+}
+
+// ToSBlock creates the genesis block of a shard chain and writes its state to the
+// given database (or discards it if nil).
 func (g *Genesis) ToSBlock(db ethdb.Database, shardId uint16) types.BlockIntf {
 	if db == nil {
 		db = ethdb.NewMemDatabase()
 	}
+	g = g.forShard(shardId)
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 	for addr, account := range g.Alloc {
 		statedb.AddBalance(addr, account.Balance)
@@ -341,6 +487,9 @@ func (g *Genesis) ToSBlock(db ethdb.Database, shardId uint16) types.BlockIntf {
 // Commit writes the block and state of a genesis specification to the database.
 // The block is committed as the canonical head block.
 func (g *Genesis) Commit(db ethdb.Database, shardId uint16) (types.BlockIntf, error) {
+	if !g.validShards() {
+		return nil, errGenesisInvalidShard
+	}
 	var block types.BlockIntf
 	if shardId == types.ShardMaster {
 		block = g.ToBlock(db)
@@ -351,7 +500,7 @@ func (g *Genesis) Commit(db ethdb.Database, shardId uint16) (types.BlockIntf, er
 	if block.Number().Sign() != 0 {
 		return nil, fmt.Errorf("can't commit genesis block with number > 0")
 	}
-	rawdb.WriteTd(db, block.ShardId(), block.Hash(), block.NumberU64(), g.Difficulty)
+	rawdb.WriteTd(db, block.ShardId(), block.Hash(), block.NumberU64(), block.Difficulty())
 	//fmt.Printf("number: %v,\t td:%v, hash:%v",block.NumberU64(),g.Difficulty, block.Hash())
 	rawdb.WriteBlock(db, block)
 	rawdb.WriteReceipts(db, block.ShardId(), block.Hash(), block.NumberU64(), nil)
@@ -364,6 +513,13 @@ func (g *Genesis) Commit(db ethdb.Database, shardId uint16) (types.BlockIntf, er
 		config = params.AllEthashProtocolChanges
 	}
 	rawdb.WriteChainConfig(db, block.Hash(), config)
+
+	// Shard chains route their blocks by the master chain, which thus needs a genesis too
+	if shardId != types.ShardMaster && rawdb.ReadCanonicalHash(db, types.ShardMaster, 0) == (common.Hash{}) {
+		if _, err := g.Commit(db, types.ShardMaster); err != nil {
+			return nil, err
+		}
+	}
 	return block, nil
 }
 
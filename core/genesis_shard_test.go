@@ -0,0 +1,154 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that the shards section only changes the enabled shards it sets the
+// enabled flag of, leaving the others as ShardEnabled has them.
+func TestGenesisShardLayout(t *testing.T) {
+	var spec Genesis
+	if err := json.Unmarshal([]byte(`{
+		"gasLimit": "0x1000",
+		"difficulty": "0x1",
+		"alloc": {},
+		"shardExp": 2,
+		"shards": {
+			"1": {"gasLimit": "0x10"},
+			"2": {"enabled": false},
+			"5": {"enabled": true}
+		}
+	}`), &spec); err != nil {
+		t.Fatalf("failed to decode genesis: %v", err)
+	}
+	if spec.Shards[1].Enabled != nil {
+		t.Errorf("shard 1: unset enabled flag decoded as %v", *spec.Shards[1].Enabled)
+	}
+	if spec.Shards[2].Enabled == nil || *spec.Shards[2].Enabled {
+		t.Errorf("shard 2: disabled flag not decoded")
+	}
+	// Enable the first three shards the legacy way, shard 2 is disabled again
+	var layout ShardLayout
+	for _, shardId := range []uint16{0, 1, 2} {
+		layout.setEnabled(shardId, true)
+	}
+	spec.ShardEnabled = layout.Enabled
+
+	shards := spec.EnabledShards()
+	if want := []uint16{0, 1, 5}; len(shards) != len(want) || shards[0] != want[0] || shards[1] != want[1] || shards[2] != want[2] {
+		t.Errorf("enabled shards mismatch: have %v, want %v", shards, want)
+	}
+	if exp := spec.shardLayout().Exp; exp != 3 {
+		t.Errorf("shard exponent mismatch: have %d, want 3", exp)
+	}
+	// Unset flags must not show up when encoding the genesis again
+	enc, err := json.Marshal(spec.Shards[1])
+	if err != nil {
+		t.Fatalf("failed to encode shard genesis: %v", err)
+	}
+	if bytes.Contains(enc, []byte("enabled")) {
+		t.Errorf("unset enabled flag encoded: %s", enc)
+	}
+}
+
+// Tests that changing the genesis of a shard whose blocks the master chain
+// already included is refused without modifying the database, while it is
+// applied on a master chain at its genesis.
+func TestShardGenesisCompat(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		genesis = &Genesis{
+			Config: params.TestChainConfig,
+			Shards: map[uint16]*GenesisShard{1: {GasLimit: 1000}, 2: {GasLimit: 1000}},
+		}
+		master = genesis.MustCommit(db, types.ShardMaster)
+		first  = genesis.MustCommit(db, 1)
+	)
+	genesis.MustCommit(db, 2)
+
+	stored, _ := json.Marshal(genesis)
+	db.Put([]byte("genesis"), stored)
+
+	// Include block 1 of shard 1 into master block 3, the master head being 5
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: 1, ParentHash: first.Hash(), Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10)})
+	rawdb.WriteHeader(db, header)
+	rawdb.WriteCanonicalHash(db, 1, header.Hash(), 1)
+
+	infos := []*types.ShardBlockInfo{{ShardId: 1, BlockNumber: 1, Hash: header.Hash()}}
+	rawdb.WriteShardBlockEntries(db, types.NewBlock(layoutHeader(common.Hash{}, 3, ShardLayout{}), infos, nil, nil))
+
+	head := layoutHeader(common.Hash{}, 5, ShardLayout{})
+	rawdb.WriteHeader(db, head)
+	rawdb.WriteHeadHeaderHash(db, types.ShardMaster, head.Hash())
+
+	// Changing both shards must be refused as shard 1 was included already
+	changed := *genesis
+	changed.Shards = map[uint16]*GenesisShard{1: {GasLimit: 2000}, 2: {GasLimit: 2000}}
+
+	_, _, err := SetupGenesisBlock(db, &changed, types.ShardMaster)
+	if compatErr, ok := err.(*params.ConfigCompatError); !ok || compatErr.RewindTo != 2 {
+		t.Fatalf("compatibility error mismatch: have %v, want rewind to 2", err)
+	}
+	for _, shardId := range []uint16{1, 2} {
+		if hash := rawdb.ReadCanonicalHash(db, shardId, 0); hash != genesis.ToSBlock(nil, shardId).Hash() {
+			t.Errorf("shard %d: genesis replaced despite the error: %x", shardId, hash)
+		}
+	}
+	if hash := rawdb.ReadCanonicalHash(db, 1, 1); hash != header.Hash() {
+		t.Errorf("included shard block dropped despite the error: %x", hash)
+	}
+	if data, _ := db.Get([]byte("genesis")); !bytes.Equal(data, stored) {
+		t.Errorf("stored genesis specification replaced despite the error")
+	}
+	// Changing shard 2 only is fine, as none of its blocks were included
+	changed.Shards = map[uint16]*GenesisShard{1: {GasLimit: 1000}, 2: {GasLimit: 2000}}
+
+	if _, _, err := SetupGenesisBlock(db, &changed, types.ShardMaster); err != nil {
+		t.Fatalf("failed to change unreferenced shard genesis: %v", err)
+	}
+	if hash := rawdb.ReadCanonicalHash(db, 2, 0); hash != changed.ToSBlock(nil, 2).Hash() {
+		t.Errorf("shard 2: genesis not replaced: have %x, want %x", hash, changed.ToSBlock(nil, 2).Hash())
+	}
+	// Back at the master genesis, shard 1 can be changed too
+	rawdb.WriteHeadHeaderHash(db, types.ShardMaster, master.Hash())
+	changed.Shards = map[uint16]*GenesisShard{1: {GasLimit: 2000}, 2: {GasLimit: 2000}}
+
+	if _, _, err := SetupGenesisBlock(db, &changed, types.ShardMaster); err != nil {
+		t.Fatalf("failed to change shard genesis at the master genesis: %v", err)
+	}
+	if hash := rawdb.ReadCanonicalHash(db, 1, 0); hash != changed.ToSBlock(nil, 1).Hash() {
+		t.Errorf("shard 1: genesis not replaced: have %x, want %x", hash, changed.ToSBlock(nil, 1).Hash())
+	}
+	if hash := rawdb.ReadCanonicalHash(db, 1, 1); hash != (common.Hash{}) {
+		t.Errorf("shard block of the replaced genesis left canonical: %x", hash)
+	}
+	if data, _ := db.Get([]byte("genesis")); bytes.Equal(data, stored) {
+		t.Errorf("stored genesis specification not replaced")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Storage nodes of the metered data custody service are paid per access by
+// redeeming the access receipts signed by their readers. A storage node sends
+// a transaction with zero value to the receipt registry, whose payload is the
+// rlp encoded list of receipts naming it as provider. The shard turns it into
+// a TT_MDC_RECEIPT result, and the master moves the fee of every access not
+// redeemed before from the reader to the provider. The registry storage keeps
+// the number of accesses redeemed per reader, provider and session.
+var (
+	// MdcRegistryAddress keeps the redeemed access count of every session in
+	// its storage, see mdcRedeemedKey.
+	MdcRegistryAddress = common.BytesToAddress([]byte("edx-mdc-registry"))
+)
+
+var (
+	// ErrInvalidAccessReceipt is returned if a receipt redemption is malformed,
+	// carries a receipt with an invalid signature or one naming another
+	// provider than the sender.
+	ErrInvalidAccessReceipt = errors.New("invalid access receipt")
+
+	// ErrAccessRedeemed is returned if the accesses of a receipt have already
+	// been redeemed.
+	ErrAccessRedeemed = errors.New("access receipt already redeemed")
+
+	// ErrInsufficientAccessFunds is returned if the reader of a receipt can't
+	// pay for the accesses it acknowledged.
+	ErrInsufficientAccessFunds = errors.New("insufficient funds for access fee")
+)
+
+// mdcRedeemedKey returns the registry storage slot of the redeemed access
+// count of a session.
+func mdcRedeemedKey(reader, provider common.Address, nonce uint64) common.Hash {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], nonce)
+	return crypto.Keccak256Hash(reader[:], provider[:], buf[:])
+}
+
+// ReadRedeemedAccesses returns the number of accesses of a session which have
+// been paid for.
+func ReadRedeemedAccesses(statedb vm.StateDB, reader, provider common.Address, nonce uint64) uint16 {
+	return uint16(statedb.GetState(MdcRegistryAddress, mdcRedeemedKey(reader, provider, nonce)).Big().Uint64())
+}
+
+// EncodeAccessReceipts encodes receipts as the payload of a redemption.
+func EncodeAccessReceipts(receipts []*types.AccessReceipt) ([]byte, error) {
+	return rlp.EncodeToBytes(receipts)
+}
+
+// decodeAccessReceipts decodes the payload of a redemption sent by provider,
+// checking every receipt is signed and names it.
+func decodeAccessReceipts(data []byte, provider common.Address) ([]*types.AccessReceipt, error) {
+	var receipts []*types.AccessReceipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil || len(receipts) == 0 {
+		return nil, ErrInvalidAccessReceipt
+	}
+	for _, receipt := range receipts {
+		if receipt.Provider != provider || receipt.Fee == nil || receipt.Fee.Sign() < 0 {
+			return nil, ErrInvalidAccessReceipt
+		}
+		if _, err := receipt.Reader(); err != nil {
+			return nil, ErrInvalidAccessReceipt
+		}
+	}
+	return receipts, nil
+}
+
+// mdcInstruction returns the TT_MDC_RECEIPT result of tx, or nil if tx is not
+// addressed to the receipt registry.
+func mdcInstruction(config *params.ChainConfig, header types.HeaderIntf, tx *types.Transaction) (*types.ContractResult, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	if msg.To() == nil || *msg.To() != MdcRegistryAddress {
+		return nil, nil
+	}
+	if msg.Value().Sign() != 0 || msg.TokenId() != types.NativeTokenId {
+		return nil, ErrInvalidAccessReceipt
+	}
+	if _, err := decodeAccessReceipts(msg.Data(), msg.From()); err != nil {
+		return nil, err
+	}
+	// the registry holds no code, the redemption is charged at the intrinsic gas
+	gas, err := IntrinsicGas(msg.Data(), false, config.IsHomestead(header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	return &types.ContractResult{TxType: TT_MDC_RECEIPT, TxHash: tx.Hash(), GasUsed: gas, Data: msg.Data()}, nil
+}
+
+// applyAccessReceipts executes a TT_MDC_RECEIPT result. The transaction itself
+// is applied as an ordinary call to the registry, after which the receipts are
+// redeemed. Receipts are redeemed all or none, a rejected redemption only burns
+// gas and yields a failed receipt.
+func applyAccessReceipts(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, result *types.ContractResult, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	receipt, _, err := ApplyTransaction(config, bc, author, gp, nil, statedb, header, tx, usedGas, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, nil
+	}
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	snap := statedb.Snapshot()
+	receipts, err := decodeAccessReceipts(result.Data, msg.From())
+	for i := 0; err == nil && i < len(receipts); i++ {
+		err = redeemAccessReceipt(statedb, receipts[i])
+	}
+	if err != nil {
+		log.Debug("Rejected access receipts", "hash", tx.Hash(), "err", err)
+		statedb.RevertToSnapshot(snap)
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	return receipt, nil
+}
+
+// redeemAccessReceipt pays the provider of a receipt for the accesses of its
+// session not redeemed yet.
+func redeemAccessReceipt(statedb *state.StateDB, receipt *types.AccessReceipt) error {
+	reader, err := receipt.Reader()
+	if err != nil {
+		return err
+	}
+	redeemed := ReadRedeemedAccesses(statedb, reader, receipt.Provider, receipt.Nonce)
+	if receipt.Mask <= redeemed {
+		return ErrAccessRedeemed
+	}
+	fee := new(big.Int).Mul(receipt.Fee, big.NewInt(int64(receipt.Mask-redeemed)))
+	if statedb.GetBalance(reader).Cmp(fee) < 0 {
+		return ErrInsufficientAccessFunds
+	}
+	// the redeemed marks live in the registry storage, which EIP-158 state
+	// clearing would sweep along with the empty account
+	if statedb.GetNonce(MdcRegistryAddress) == 0 {
+		statedb.SetNonce(MdcRegistryAddress, 1)
+	}
+	statedb.SetState(MdcRegistryAddress, mdcRedeemedKey(reader, receipt.Provider, receipt.Nonce), common.BigToHash(new(big.Int).SetUint64(uint64(receipt.Mask))))
+	statedb.SubBalance(reader, fee)
+	statedb.AddBalance(receipt.Provider, fee)
+	return nil
+}
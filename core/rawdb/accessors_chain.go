@@ -300,6 +300,14 @@ func DeleteBody(db DatabaseDeleter,shardId uint16, hash common.Hash, number uint
 	}
 }
 
+// PruneBody removes the body of a block, leaving its header, total difficulty
+// and receipts in place.
+func PruneBody(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(blockBodyKey(types.ShardMaster, number, hash)); err != nil {
+		log.Crit("Failed to delete block body", "err", err)
+	}
+}
+
 // ReadTd retrieves a block's total difficulty corresponding to the hash.
 func ReadTd(db DatabaseReader, shardId uint16,hash common.Hash, number uint64) *big.Int {
 	data, _ := db.Get(headerTDKey(number, shardId,hash))
@@ -462,41 +470,144 @@ func FindCommonAncestor(db DatabaseReader, a, b types.HeaderIntf) types.HeaderIn
 	return a
 }
 
-type ShardStoreInfo struct {
-	confirmedHash common.Hash
-	confirmedNumber uint64
-	maxTdHash    common.Hash
-	maxTdNumber     uint64
+// HeaderForest is the persisted state of the forest of unconfirmed header trees
+// of a shard. The nodes of the forest are stored by number, each number holding
+// the hashes of the nodes at that height, so that changes only rewrite the
+// heights they touch. The parent of a node is found through its header.
+type HeaderForest struct {
+	Root      common.Hash // Root of the tree holding the confirmed shard chain
+	Confirmed common.Hash // Last shard block confirmed by the master chain
+	Low       uint64      // Lowest height holding nodes
+	High      uint64      // Highest height holding nodes
 }
-// WriteLatestShardInfo stores a block header into the database and also stores the hash-
-// to-number mapping.
-func WriteLatestShardInfo(db DatabaseWriter, shardConfirmed types.HeaderIntf, shardMax types.HeaderIntf) {
-	// Write the hash -> number mapping
-	info := &ShardStoreInfo{shardConfirmed.Hash(),shardConfirmed.NumberU64(),shardMax.Hash(),shardMax.NumberU64()}
-	result,err := rlp.EncodeToBytes(info)
+
+// ReadHeaderForest retrieves the header forest of a shard, or nil if none was
+// stored.
+func ReadHeaderForest(db DatabaseReader, shardId uint16) *HeaderForest {
+	data, _ := db.Get(latestShardsKey(shardId))
+	if len(data) == 0 {
+		return nil
+	}
+	forest := new(HeaderForest)
+	if err := rlp.DecodeBytes(data, forest); err != nil {
+		log.Error("Invalid header forest RLP", "shard", shardId, "err", err)
+		return nil
+	}
+	return forest
+}
+
+// WriteHeaderForest stores the header forest of a shard.
+func WriteHeaderForest(db DatabaseWriter, shardId uint16, forest *HeaderForest) {
+	data, err := rlp.EncodeToBytes(forest)
 	if err != nil {
-		log.Crit("write shard Info error ","error:",err)
-	}else {
-		db.Put(latestShardsKey(shardMax.ShardId()),result)
+		log.Crit("Failed to RLP encode header forest", "err", err)
 	}
+	if err := db.Put(latestShardsKey(shardId), data); err != nil {
+		log.Crit("Failed to store header forest", "err", err)
+	}
+}
 
+// ReadHeaderForestNodes retrieves the hashes of the header forest nodes of a
+// shard at the given height.
+func ReadHeaderForestNodes(db DatabaseReader, shardId uint16, number uint64) []common.Hash {
+	data, _ := db.Get(headerForestKey(shardId, number))
+	if len(data) == 0 {
+		return nil
+	}
+	var hashes []common.Hash
+	if err := rlp.DecodeBytes(data, &hashes); err != nil {
+		log.Error("Invalid header forest nodes RLP", "shard", shardId, "number", number, "err", err)
+		return nil
+	}
+	return hashes
 }
-// Get latest informations of specified shard
-// returns: result.confirmedHash,result.confirmedNumber,result.maxTdHash,result.maxTdNumber
-func ReadLatestShardInfo(db DatabaseReader,shardId uint16) (common.Hash,uint64,common.Hash,uint64){
-	data,err := db.Get(latestShardsKey(shardId))
+
+// WriteHeaderForestNodes stores the hashes of the header forest nodes of a shard
+// at the given height.
+func WriteHeaderForestNodes(db DatabaseWriter, shardId uint16, number uint64, hashes []common.Hash) {
+	data, err := rlp.EncodeToBytes(hashes)
 	if err != nil {
+		log.Crit("Failed to RLP encode header forest nodes", "err", err)
+	}
+	if err := db.Put(headerForestKey(shardId, number), data); err != nil {
+		log.Crit("Failed to store header forest nodes", "err", err)
+	}
+}
 
-		return common.Hash{},0,common.Hash{},0
-	}else {
-		result := ShardStoreInfo{}
-		err = rlp.DecodeBytes(data,result)
-		if err != nil {
-			log.Crit("write shard Info error ","error:",err)
-			return common.Hash{},0,common.Hash{},0
-		}else {
-			return result.confirmedHash,result.confirmedNumber,result.maxTdHash,result.maxTdNumber
-		}
+// DeleteHeaderForestNodes removes the header forest nodes of a shard at the
+// given height.
+func DeleteHeaderForestNodes(db DatabaseDeleter, shardId uint16, number uint64) {
+	if err := db.Delete(headerForestKey(shardId, number)); err != nil {
+		log.Crit("Failed to delete header forest nodes", "err", err)
 	}
 }
 
+// ReadHeaderForestShards retrieves the shards whose header forests are stored.
+func ReadHeaderForestShards(db DatabaseReader) []uint16 {
+	data, _ := db.Get(headerForestShardsKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var shards []uint16
+	if err := rlp.DecodeBytes(data, &shards); err != nil {
+		log.Error("Invalid header forest shards RLP", "err", err)
+		return nil
+	}
+	return shards
+}
+
+// WriteHeaderForestShards stores the shards whose header forests are stored.
+func WriteHeaderForestShards(db DatabaseWriter, shards []uint16) {
+	data, err := rlp.EncodeToBytes(shards)
+	if err != nil {
+		log.Crit("Failed to RLP encode header forest shards", "err", err)
+	}
+	if err := db.Put(headerForestShardsKey, data); err != nil {
+		log.Crit("Failed to store header forest shards", "err", err)
+	}
+}
+
+// WriteInvalidShardBlock marks a shard block as invalid, because a fraud proof
+// was accepted for the block cause, which is either the block itself or one of
+// its ancestors.
+func WriteInvalidShardBlock(db DatabaseWriter, hash common.Hash, cause common.Hash) {
+	if err := db.Put(invalidShardKey(hash), cause.Bytes()); err != nil {
+		log.Crit("Failed to store invalid shard block", "err", err)
+	}
+}
+
+// ReadInvalidShardBlock retrieves the fraudulent block which invalidated a shard
+// block, or the zero hash if the shard block is not known to be invalid.
+func ReadInvalidShardBlock(db DatabaseReader, hash common.Hash) common.Hash {
+	data, _ := db.Get(invalidShardKey(hash))
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// ReadShardSlashes retrieves the shards slashed by the child of a master block,
+// because they produced blocks proven invalid which the master chain included.
+func ReadShardSlashes(db DatabaseReader, hash common.Hash) []uint16 {
+	data, _ := db.Get(shardSlashKey(hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var shards []uint16
+	if err := rlp.DecodeBytes(data, &shards); err != nil {
+		log.Error("Invalid shard slash RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return shards
+}
+
+// WriteShardSlashes stores the shards slashed by the child of a master block.
+func WriteShardSlashes(db DatabaseWriter, hash common.Hash, shards []uint16) {
+	data, err := rlp.EncodeToBytes(shards)
+	if err != nil {
+		log.Crit("Failed to RLP encode shard slashes", "err", err)
+	}
+	if err := db.Put(shardSlashKey(hash), data); err != nil {
+		log.Crit("Failed to store shard slashes", "err", err)
+	}
+}
@@ -29,6 +29,20 @@ import (
 	"github.com/EDXFund/MasterChain/rlp"
 )
 
+// testHeader creates a master header from its fields.
+func testHeader(fields *types.HeaderStruct) *types.Header {
+	header := new(types.Header)
+	header.FillBy(fields)
+	return header
+}
+
+// equalBodies reports whether two block bodies have the same encoding.
+func equalBodies(a, b *types.SuperBody) bool {
+	encA, _ := rlp.EncodeToBytes(a)
+	encB, _ := rlp.EncodeToBytes(b)
+	return bytes.Equal(encA, encB)
+}
+
 // Tests block header storage and retrieval operations.
 func TestHeaderStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
@@ -50,15 +64,19 @@ func TestHeaderStorage(t *testing.T) {
 	if entry := ReadHeaderRLP(db, header.Hash(), header.NumberU64()); entry == nil {
 		t.Fatalf("Stored header RLP not found")
 	} else {
+		var enc types.HeadEncode
+		if err := rlp.DecodeBytes(entry, &enc); err != nil || enc.ShardId != types.ShardMaster {
+			t.Fatalf("Retrieved RLP header envelope invalid: shard %d, err %v", enc.ShardId, err)
+		}
 		hasher := sha3.NewKeccak256()
-		hasher.Write(entry)
+		hasher.Write(enc.Header)
 
 		if hash := common.BytesToHash(hasher.Sum(nil)); hash != header.Hash() {
 			t.Fatalf("Retrieved RLP header mismatch: have %v, want %v", entry, header)
 		}
 	}
 	// Delete the header and verify the execution
-	DeleteHeader(db, header.Hash(), header.NumberU64())
+	DeleteHeader(db, types.ShardMaster, header.Hash(), header.NumberU64())
 	if entry := ReadHeader(db, header.Hash(), header.NumberU64()); entry != nil {
 		t.Fatalf("Deleted header returned: %v", entry)
 	}
@@ -69,7 +87,9 @@ func TestBodyStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 
 	// Create a test body to move around the database and make sure it's really new
-	body := &types.Body{Uncles: []*types.Header{{Extra: []byte("test header")}}}
+	uncle := new(types.Header)
+	uncle.FillBy(&types.HeaderStruct{Extra: []byte("test header")})
+	body := &types.SuperBody{Uncles: []*types.Header{uncle}}
 
 	hasher := sha3.NewKeccak256()
 	rlp.Encode(hasher, body)
@@ -79,24 +99,28 @@ func TestBodyStorage(t *testing.T) {
 		t.Fatalf("Non existent body returned: %v", entry)
 	}
 	// Write and verify the body in the database
-	WriteBody(db, hash, 0, body)
+	WriteBody(db, hash, types.ShardMaster, 0, body)
 	if entry := ReadBody(db, hash, 0); entry == nil  || reflect.ValueOf(entry).IsNil()  {
 		t.Fatalf("Stored body not found")
-	} else if types.DeriveSha(types.Transactions(entry.Transactions)) != types.DeriveSha(types.Transactions(body.Transactions)) || types.CalcUncleHash(entry.Uncles) != types.CalcUncleHash(body.Uncles) {
+	} else if !equalBodies(entry, body) {
 		t.Fatalf("Retrieved body mismatch: have %v, want %v", entry, body)
 	}
 	if entry := ReadBodyRLP(db, hash, 0);reflect.ValueOf(entry).IsNil()  {
 		t.Fatalf("Stored body RLP not found")
 	} else {
+		var enc types.BodyEncode
+		if err := rlp.DecodeBytes(entry, &enc); err != nil || enc.ShardId != types.ShardMaster {
+			t.Fatalf("Retrieved RLP body envelope invalid: shard %d, err %v", enc.ShardId, err)
+		}
 		hasher := sha3.NewKeccak256()
-		hasher.Write(entry)
+		hasher.Write(enc.Body)
 
 		if calc := common.BytesToHash(hasher.Sum(nil)); calc != hash {
 			t.Fatalf("Retrieved RLP body mismatch: have %v, want %v", entry, body)
 		}
 	}
 	// Delete the body and verify the execution
-	DeleteBody(db, hash, 0)
+	DeleteBody(db, types.ShardMaster, hash, 0)
 	if entry := ReadBody(db, hash, 0); entry != nil {
 		t.Fatalf("Deleted body returned: %v", entry)
 	}
@@ -107,12 +131,12 @@ func TestBlockStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 
 	// Create a test block to move around the database and make sure it's really new
-	block := types.NewBlockWithHeader(&types.Header{
-		Extra:       []byte("test block"),
-		UncleHash:   types.EmptyUncleHash,
-		TxHash:      types.EmptyRootHash,
-		ReceiptHash: types.EmptyRootHash,
-	})
+	block := types.NewBlockWithHeader(testHeader(&types.HeaderStruct{
+		Extra:        []byte("test block"),
+		UncleHash:    types.EmptyUncleHash,
+		ShardTxsHash: types.EmptyRootHash,
+		ReceiptHash:  types.EmptyRootHash,
+	}))
 	if entry := ReadBlock(db, block.Hash(), block.NumberU64()); entry != nil {
 		t.Fatalf("Non existent block returned: %v", entry)
 	}
@@ -136,11 +160,11 @@ func TestBlockStorage(t *testing.T) {
 	}
 	if entry := ReadBody(db, block.Hash(), block.NumberU64()); entry == nil {
 		t.Fatalf("Stored body not found")
-	} else if types.DeriveSha(types.Transactions(entry.Transactions)) != types.DeriveSha(block.Transactions()) || types.CalcUncleHash(entry.Uncles) != types.CalcUncleHash(block.Uncles()) {
+	} else if !equalBodies(entry, block.Body()) {
 		t.Fatalf("Retrieved body mismatch: have %v, want %v", entry, block.Body())
 	}
 	// Delete the block and verify the execution
-	DeleteBlock(db, block.Hash(), block.NumberU64())
+	DeleteBlock(db, types.ShardMaster, block.Hash(), block.NumberU64())
 	if entry := ReadBlock(db, block.Hash(), block.NumberU64()); entry != nil {
 		t.Fatalf("Deleted block returned: %v", entry)
 	}
@@ -155,29 +179,29 @@ func TestBlockStorage(t *testing.T) {
 // Tests that partial block contents don't get reassembled into full blocks.
 func TestPartialBlockStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
-	block := types.NewBlockWithHeader(&types.Header{
-		Extra:       []byte("test block"),
-		UncleHash:   types.EmptyUncleHash,
-		TxHash:      types.EmptyRootHash,
-		ReceiptHash: types.EmptyRootHash,
-	})
+	block := types.NewBlockWithHeader(testHeader(&types.HeaderStruct{
+		Extra:        []byte("test block"),
+		UncleHash:    types.EmptyUncleHash,
+		ShardTxsHash: types.EmptyRootHash,
+		ReceiptHash:  types.EmptyRootHash,
+	}))
 	// Store a header and check that it's not recognized as a block
 	WriteHeader(db, block.Header())
 	if entry := ReadBlock(db, block.Hash(), block.NumberU64()); entry != nil {
 		t.Fatalf("Non existent block returned: %v", entry)
 	}
-	DeleteHeader(db, block.Hash(), block.NumberU64())
+	DeleteHeader(db, types.ShardMaster, block.Hash(), block.NumberU64())
 
 	// Store a body and check that it's not recognized as a block
-	WriteBody(db, block.Hash(), block.NumberU64(), block.Body())
+	WriteBody(db, block.Hash(), types.ShardMaster, block.NumberU64(), block.Body())
 	if entry := ReadBlock(db, block.Hash(), block.NumberU64()); entry != nil {
 		t.Fatalf("Non existent block returned: %v", entry)
 	}
-	DeleteBody(db, block.Hash(), block.NumberU64())
+	DeleteBody(db, types.ShardMaster, block.Hash(), block.NumberU64())
 
 	// Store a header and a body separately and check reassembly
 	WriteHeader(db, block.Header())
-	WriteBody(db, block.Hash(), block.NumberU64(), block.Body())
+	WriteBody(db, block.Hash(), types.ShardMaster, block.NumberU64(), block.Body())
 
 	if entry := ReadBlock(db, block.Hash(), block.NumberU64()); reflect.ValueOf(entry).IsNil() {
 		t.Fatalf("Stored block not found")
@@ -192,19 +216,19 @@ func TestTdStorage(t *testing.T) {
 
 	// Create a test TD to move around the database and make sure it's really new
 	hash, td := common.Hash{}, big.NewInt(314)
-	if entry := ReadTd(db, hash, 0); entry != nil {
+	if entry := ReadTd(db, types.ShardMaster, hash, 0); entry != nil {
 		t.Fatalf("Non existent TD returned: %v", entry)
 	}
 	// Write and verify the TD in the database
-	WriteTd(db, hash, 0, td)
-	if entry := ReadTd(db, hash, 0); entry == nil {
+	WriteTd(db, types.ShardMaster, hash, 0, td)
+	if entry := ReadTd(db, types.ShardMaster, hash, 0); entry == nil {
 		t.Fatalf("Stored TD not found")
 	} else if entry.Cmp(td) != 0 {
 		t.Fatalf("Retrieved TD mismatch: have %v, want %v", entry, td)
 	}
 	// Delete the TD and verify the execution
-	DeleteTd(db, hash, 0)
-	if entry := ReadTd(db, hash, 0); entry != nil {
+	DeleteTd(db, types.ShardMaster, hash, 0)
+	if entry := ReadTd(db, types.ShardMaster, hash, 0); entry != nil {
 		t.Fatalf("Deleted TD returned: %v", entry)
 	}
 }
@@ -215,19 +239,19 @@ func TestCanonicalMappingStorage(t *testing.T) {
 
 	// Create a test canonical number and assinged hash to move around
 	hash, number := common.Hash{0: 0xff}, uint64(314)
-	if entry := ReadCanonicalHash(db, number); entry != (common.Hash{}) {
+	if entry := ReadCanonicalHash(db, types.ShardMaster, number); entry != (common.Hash{}) {
 		t.Fatalf("Non existent canonical mapping returned: %v", entry)
 	}
 	// Write and verify the TD in the database
-	WriteCanonicalHash(db, hash, number)
-	if entry := ReadCanonicalHash(db, number); entry == (common.Hash{}) {
+	WriteCanonicalHash(db, types.ShardMaster, hash, number)
+	if entry := ReadCanonicalHash(db, types.ShardMaster, number); entry == (common.Hash{}) {
 		t.Fatalf("Stored canonical mapping not found")
 	} else if entry != hash {
 		t.Fatalf("Retrieved canonical mapping mismatch: have %v, want %v", entry, hash)
 	}
 	// Delete the TD and verify the execution
-	DeleteCanonicalHash(db, number)
-	if entry := ReadCanonicalHash(db, number); entry != (common.Hash{}) {
+	DeleteCanonicalHash(db, types.ShardMaster, number)
+	if entry := ReadCanonicalHash(db, types.ShardMaster, number); entry != (common.Hash{}) {
 		t.Fatalf("Deleted canonical mapping returned: %v", entry)
 	}
 }
@@ -236,33 +260,33 @@ func TestCanonicalMappingStorage(t *testing.T) {
 func TestHeadStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 
-	blockHead := types.NewBlockWithHeader(&types.Header{Extra: []byte("test block header")})
-	blockFull := types.NewBlockWithHeader(&types.Header{Extra: []byte("test block full")})
-	blockFast := types.NewBlockWithHeader(&types.Header{Extra: []byte("test block fast")})
+	blockHead := types.NewBlockWithHeader(testHeader(&types.HeaderStruct{Extra: []byte("test block header")}))
+	blockFull := types.NewBlockWithHeader(testHeader(&types.HeaderStruct{Extra: []byte("test block full")}))
+	blockFast := types.NewBlockWithHeader(testHeader(&types.HeaderStruct{Extra: []byte("test block fast")}))
 
 	// Check that no head entries are in a pristine database
-	if entry := ReadHeadHeaderHash(db); entry != (common.Hash{}) {
+	if entry := ReadHeadHeaderHash(db, types.ShardMaster); entry != (common.Hash{}) {
 		t.Fatalf("Non head header entry returned: %v", entry)
 	}
-	if entry := ReadHeadBlockHash(db); entry != (common.Hash{}) {
+	if entry := ReadHeadBlockHash(db, types.ShardMaster); entry != (common.Hash{}) {
 		t.Fatalf("Non head block entry returned: %v", entry)
 	}
-	if entry := ReadHeadFastBlockHash(db); entry != (common.Hash{}) {
+	if entry := ReadHeadFastBlockHash(db, types.ShardMaster); entry != (common.Hash{}) {
 		t.Fatalf("Non fast head block entry returned: %v", entry)
 	}
 	// Assign separate entries for the head header and block
-	WriteHeadHeaderHash(db, blockHead.Hash())
-	WriteHeadBlockHash(db, blockFull.Hash())
-	WriteHeadFastBlockHash(db, blockFast.Hash())
+	WriteHeadHeaderHash(db, types.ShardMaster, blockHead.Hash())
+	WriteHeadBlockHash(db, types.ShardMaster, blockFull.Hash())
+	WriteHeadFastBlockHash(db, types.ShardMaster, blockFast.Hash())
 
 	// Check that both heads are present, and different (i.e. two heads maintained)
-	if entry := ReadHeadHeaderHash(db); entry != blockHead.Hash() {
+	if entry := ReadHeadHeaderHash(db, types.ShardMaster); entry != blockHead.Hash() {
 		t.Fatalf("Head header hash mismatch: have %v, want %v", entry, blockHead.Hash())
 	}
-	if entry := ReadHeadBlockHash(db); entry != blockFull.Hash() {
+	if entry := ReadHeadBlockHash(db, types.ShardMaster); entry != blockFull.Hash() {
 		t.Fatalf("Head block hash mismatch: have %v, want %v", entry, blockFull.Hash())
 	}
-	if entry := ReadHeadFastBlockHash(db); entry != blockFast.Hash() {
+	if entry := ReadHeadFastBlockHash(db, types.ShardMaster); entry != blockFast.Hash() {
 		t.Fatalf("Fast head block hash mismatch: have %v, want %v", entry, blockFast.Hash())
 	}
 }
@@ -301,7 +325,7 @@ func TestBlockReceiptStorage(t *testing.T) {
 		t.Fatalf("non existent receipts returned: %v", rs)
 	}
 	// Insert the receipt slice into the database and check presence
-	WriteReceipts(db, hash, 0, receipts)
+	WriteReceipts(db, types.ShardMaster, hash, 0, receipts)
 	if rs := ReadReceipts(db, hash, 0); len(rs) == 0 {
 		t.Fatalf("no receipts returned")
 	} else {
@@ -315,7 +339,7 @@ func TestBlockReceiptStorage(t *testing.T) {
 		}
 	}
 	// Delete the receipt slice and check purge
-	DeleteReceipts(db, hash, 0)
+	DeleteReceipts(db, types.ShardMaster, hash, 0)
 	if rs := ReadReceipts(db, hash, 0); len(rs) != 0 {
 		t.Fatalf("deleted receipts returned: %v", rs)
 	}
@@ -17,7 +17,6 @@
 package rawdb
 
 import (
-	"fmt"
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/log"
@@ -56,7 +55,6 @@ func DeleteShardBlockEntry(db DatabaseDeleter, hash common.Hash) {
 // ReadTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func ReadTxLookupEntry(db DatabaseReader, hash common.Hash) (uint16, common.Hash, uint64, uint64) {
-	fmt.Println("read tx:", txLookupKey(hash))
 	data, _ := db.Get(txLookupKey(hash))
 	if len(data) == 0 {
 		return 0, common.Hash{}, 0, 0
@@ -97,54 +95,176 @@ func WriteTxLookupEntries(db DatabaseWriter, block types.BlockIntf, receipts typ
 func DeleteTxLookupEntry(db DatabaseDeleter, hash common.Hash) {
 	db.Delete(txLookupKey(hash))
 }
-func GetTxOfAccountNonce(db DatabaseReader, account common.Address, nonce uint64) (common.Hash, bool) {
-	data, _ := db.Get(txAccountNonceKey(account, nonce))
+
+// WriteCrossShardLookupEntry stores the position of the outgoing cross shard
+// receipt of a transaction within the results of its source shard block.
+func WriteCrossShardLookupEntry(db DatabaseWriter, txHash common.Hash, shardId uint16, blockHash common.Hash, number uint64, index uint64) {
+	entry := TxLookupEntry{
+		ShardId:    shardId,
+		BlockHash:  blockHash,
+		BlockIndex: number,
+		Index:      index,
+	}
+	data, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		log.Crit("Failed to encode cross shard lookup entry", "err", err)
+	}
+	if err := db.Put(xshardLookupKey(txHash), data); err != nil {
+		log.Crit("Failed to store cross shard lookup entry", "err", err)
+	}
+}
+
+// DeleteCrossShardLookupEntry removes the position of the outgoing cross shard
+// receipt of a transaction.
+func DeleteCrossShardLookupEntry(db DatabaseDeleter, txHash common.Hash) {
+	db.Delete(xshardLookupKey(txHash))
+}
+
+// ReadCrossShardLookupEntry retrieves the position of the outgoing cross shard
+// receipt of a transaction: source shard, block hash, block number and index.
+func ReadCrossShardLookupEntry(db DatabaseReader, txHash common.Hash) (uint16, common.Hash, uint64, uint64) {
+	data, _ := db.Get(xshardLookupKey(txHash))
 	if len(data) == 0 {
-		return common.Hash{}, false
-	} else {
-		var txHash common.Hash
-		rlp.DecodeBytes(data, txHash)
-		return txHash, true
+		return 0, common.Hash{}, 0, 0
+	}
+	var entry TxLookupEntry
+	if err := rlp.DecodeBytes(data, &entry); err != nil {
+		log.Error("Invalid cross shard lookup entry RLP", "hash", txHash, "err", err)
+		return 0, common.Hash{}, 0, 0
+	}
+	return entry.ShardId, entry.BlockHash, entry.BlockIndex, entry.Index
+}
+
+// WriteShardTxLookupEntries stores the position of every transaction of a shard
+// block within its results, enabling hash based lookups of the shard block a
+// transaction was included in.
+func WriteShardTxLookupEntries(db DatabaseWriter, block types.BlockIntf) {
+	for i, result := range block.Results() {
+		entry := TxLookupEntry{
+			ShardId:    block.ShardId(),
+			BlockHash:  block.Hash(),
+			BlockIndex: block.NumberU64(),
+			Index:      uint64(i),
+		}
+		data, err := rlp.EncodeToBytes(entry)
+		if err != nil {
+			log.Crit("Failed to encode shard transaction lookup entry", "err", err)
+		}
+		if err := db.Put(shardTxLookupKey(result.TxHash), data); err != nil {
+			log.Crit("Failed to store shard transaction lookup entry", "err", err)
+		}
 	}
 }
-func WriteTxOfAccountNonce(db DatabaseWriter, account common.Address, nonce uint64, hash common.Hash) error {
-	err := db.Put(txAccountNonceKey(account, nonce), hash.Bytes())
+
+// ReadShardTxLookupEntry retrieves the position of a transaction within the
+// shard block including it: shard, block hash, block number and index.
+func ReadShardTxLookupEntry(db DatabaseReader, hash common.Hash) (uint16, common.Hash, uint64, uint64) {
+	data, _ := db.Get(shardTxLookupKey(hash))
+	if len(data) == 0 {
+		return 0, common.Hash{}, 0, 0
+	}
+	var entry TxLookupEntry
+	if err := rlp.DecodeBytes(data, &entry); err != nil {
+		log.Error("Invalid shard transaction lookup entry RLP", "hash", hash, "err", err)
+		return 0, common.Hash{}, 0, 0
+	}
+	return entry.ShardId, entry.BlockHash, entry.BlockIndex, entry.Index
+}
+
+// DeleteShardTxLookupEntry removes the shard block position of a transaction.
+func DeleteShardTxLookupEntry(db DatabaseDeleter, hash common.Hash) {
+	db.Delete(shardTxLookupKey(hash))
+}
+
+// WriteRejectedTxs stores the transactions rejected by a master block.
+func WriteRejectedTxs(db DatabaseWriter, hash common.Hash, number uint64, rejected []*types.RejectedTx) {
+	if len(rejected) == 0 {
+		return
+	}
+	data, err := rlp.EncodeToBytes(rejected)
 	if err != nil {
-		log.Crit("error in put txHash", err)
+		log.Crit("Failed to encode rejected transactions", "err", err)
+	}
+	if err := db.Put(rejectedTxsKey(number, hash), data); err != nil {
+		log.Crit("Failed to store rejected transactions", "err", err)
 	}
-	return err
 }
-func WritePendingTransactions(db DatabaseWriter, txHashes []*common.Hash) error {
-	if len(txHashes) > 0 {
-		data, err := rlp.EncodeToBytes(txHashes)
-		if err != nil {
-			log.Error("error in writing pending transactions:", "err is :", err)
-			return err
+
+// WriteRejectedLookupEntries stores a lookup entry for every transaction rejected
+// by a canonical master block.
+func WriteRejectedLookupEntries(db DatabaseWriter, hash common.Hash, number uint64, rejected []*types.RejectedTx) {
+	for i, tx := range rejected {
+		entry := TxLookupEntry{
+			ShardId:    types.ShardMaster,
+			BlockHash:  hash,
+			BlockIndex: number,
+			Index:      uint64(i),
 		}
-		db.Put(txPendingPrefix, data)
+		data, err := rlp.EncodeToBytes(entry)
 		if err != nil {
-			log.Error("error in saving pending transactions:", "err is :", err)
-
+			log.Crit("Failed to encode rejected transaction lookup entry", "err", err)
 		}
-		return err
-	} else {
+		if err := db.Put(rejectedLookupKey(tx.TxHash), data); err != nil {
+			log.Crit("Failed to store rejected transaction lookup entry", "err", err)
+		}
+	}
+}
+
+// DeleteRejectedLookupEntry removes the lookup entry of a rejected transaction.
+func DeleteRejectedLookupEntry(db DatabaseDeleter, hash common.Hash) {
+	db.Delete(rejectedLookupKey(hash))
+}
+
+// ReadRejectedTxs retrieves the transactions rejected by a master block.
+func ReadRejectedTxs(db DatabaseReader, hash common.Hash, number uint64) []*types.RejectedTx {
+	data, _ := db.Get(rejectedTxsKey(number, hash))
+	if len(data) == 0 {
 		return nil
 	}
+	var rejected []*types.RejectedTx
+	if err := rlp.DecodeBytes(data, &rejected); err != nil {
+		log.Error("Invalid rejected transactions RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return rejected
+}
 
+// ReadRejectedTx retrieves a rejected transaction along with the hash and number
+// of the master block which rejected it.
+func ReadRejectedTx(db DatabaseReader, hash common.Hash) (*types.RejectedTx, common.Hash, uint64) {
+	data, _ := db.Get(rejectedLookupKey(hash))
+	if len(data) == 0 {
+		return nil, common.Hash{}, 0
+	}
+	var entry TxLookupEntry
+	if err := rlp.DecodeBytes(data, &entry); err != nil {
+		log.Error("Invalid rejected transaction lookup entry RLP", "hash", hash, "err", err)
+		return nil, common.Hash{}, 0
+	}
+	rejected := ReadRejectedTxs(db, entry.BlockHash, entry.BlockIndex)
+	if uint64(len(rejected)) <= entry.Index || rejected[entry.Index].TxHash != hash {
+		log.Error("Rejected transaction referenced missing", "number", entry.BlockIndex, "hash", entry.BlockHash, "index", entry.Index)
+		return nil, common.Hash{}, 0
+	}
+	return rejected[entry.Index], entry.BlockHash, entry.BlockIndex
 }
-func ReadPendingTransactions(db DatabaseReader) ([]*common.Hash, error) {
-	data, err := db.Get(txPendingPrefix)
-	if err != nil {
-		//	log.Error("error in reading pending transactions:","err is :",err)
-		return nil, err
+
+func GetTxOfAccountNonce(db DatabaseReader, account common.Address, nonce uint64) (common.Hash, bool) {
+	data, _ := db.Get(txAccountNonceKey(account, nonce))
+	if len(data) == 0 {
+		return common.Hash{}, false
+	} else {
+		var txHash common.Hash
+		rlp.DecodeBytes(data, txHash)
+		return txHash, true
 	}
-	hashes := []*common.Hash{}
-	err = rlp.DecodeBytes(data, hashes)
+}
+func WriteTxOfAccountNonce(db DatabaseWriter, account common.Address, nonce uint64, hash common.Hash) error {
+	err := db.Put(txAccountNonceKey(account, nonce), hash.Bytes())
 	if err != nil {
-		log.Error("error in saving pending transactions:", "err is :", err)
-
+		log.Crit("error in put txHash", err)
 	}
-	return hashes, err
+	return err
 }
 func WriteRawTransaction(db DatabaseWriter, hash common.Hash, tx *types.Transaction) error {
 	data, err := rlp.EncodeToBytes(tx)
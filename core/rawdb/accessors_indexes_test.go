@@ -29,14 +29,18 @@ import (
 func TestLookupStorage(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 
-	tx1 := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), []byte{0x11, 0x11, 0x11})
-	tx2 := types.NewTransaction(2, common.BytesToAddress([]byte{0x22}), big.NewInt(222), 2222, big.NewInt(22222), []byte{0x22, 0x22, 0x22})
-	tx3 := types.NewTransaction(3, common.BytesToAddress([]byte{0x33}), big.NewInt(333), 3333, big.NewInt(33333), []byte{0x33, 0x33, 0x33})
+	tx1 := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), []byte{0x11, 0x11, 0x11}, 0)
+	tx2 := types.NewTransaction(2, common.BytesToAddress([]byte{0x22}), big.NewInt(222), 2222, big.NewInt(22222), []byte{0x22, 0x22, 0x22}, 0)
+	tx3 := types.NewTransaction(3, common.BytesToAddress([]byte{0x33}), big.NewInt(333), 3333, big.NewInt(33333), []byte{0x33, 0x33, 0x33}, 0)
 	txs := []*types.Transaction{tx1, tx2, tx3}
 	hs := &types.SHeaderStruct{Number: big.NewInt(314)}
 	header := &types.SHeader{}
 	header.FillBy(hs)
-	block := types.NewSBlock(header, txs, nil)
+	block := types.NewSBlockWithHeader(header).WithBody(nil, nil, txs, nil)
+	receipts := make(types.Receipts, len(txs))
+	for i, tx := range txs {
+		receipts[i] = &types.Receipt{TxHash: tx.Hash()}
+	}
 
 	// Check that no transactions entries are in a pristine database
 	for i, tx := range txs {
@@ -46,7 +50,7 @@ func TestLookupStorage(t *testing.T) {
 	}
 	// Insert all the transactions into the database, and verify contents
 	WriteBlock(db, block)
-	WriteTxLookupEntries(db, block.ToSBlock())
+	WriteTxLookupEntries(db, block, receipts)
 
 	for i, tx := range txs {
 		if txn, hash, number, index := ReadTransaction(db, tx.Hash()); txn == nil {
@@ -25,19 +25,27 @@ import (
 	"github.com/EDXFund/MasterChain/rlp"
 )
 
+// unencodedDatabaseVersion is the version reported for databases stamped with an
+// empty version record, which releases storing the version as a (non RLP
+// serializable) int wrote. The only version such releases stamped was 3.
+const unencodedDatabaseVersion = 3
+
 // ReadDatabaseVersion retrieves the version number of the database.
 func ReadDatabaseVersion(db DatabaseReader) int {
-	var version int
+	var version uint64
 
-	enc, _ := db.Get(databaseVerisionKey)
+	enc, err := db.Get(databaseVerisionKey)
+	if err == nil && len(enc) == 0 {
+		return unencodedDatabaseVersion
+	}
 	rlp.DecodeBytes(enc, &version)
 
-	return version
+	return int(version)
 }
 
 // WriteDatabaseVersion stores the version number of the database
 func WriteDatabaseVersion(db DatabaseWriter, version int) {
-	enc, _ := rlp.EncodeToBytes(version)
+	enc, _ := rlp.EncodeToBytes(uint64(version))
 	if err := db.Put(databaseVerisionKey, enc); err != nil {
 		log.Crit("Failed to store the database version", "err", err)
 	}
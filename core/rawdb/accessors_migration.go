@@ -0,0 +1,207 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Stages of the shard key migration, as tracked by shardKeyMigrationKey.
+const (
+	migrationStaging   = uint8(1) // Legacy keys are being moved under the migration prefix
+	migrationUnstaging = uint8(2) // Migrated keys are being moved out of the migration prefix
+)
+
+// legacyShardKeyRanges are the key ranges holding RLP encoded shard ids in the
+// legacy schema, along with the conversion of their keys into the current one.
+var legacyShardKeyRanges = []struct {
+	prefix  []byte
+	convert func(key []byte) []byte
+}{
+	{_headHeaderKey, convertLegacyHeadKey(_headHeaderKey)},
+	{_headBlockKey, convertLegacyHeadKey(_headBlockKey)},
+	{_headFastBlockKey, convertLegacyHeadKey(_headFastBlockKey)},
+	{headerPrefix, convertLegacyChainKey},
+	{blockBodyPrefix, convertLegacyChainKey},
+	{blockReceiptsPrefix, convertLegacyChainKey},
+	{headerNumberPrefix, convertLegacyHashKey(headerNumberPrefix)},
+	{preimagePrefix, convertLegacyHashKey(preimagePrefix)},
+}
+
+// splitLegacyShardId splits the RLP encoded shard id off the head of b.
+func splitLegacyShardId(b []byte) (uint16, []byte, bool) {
+	_, rest, err := rlp.SplitString(b)
+	if err != nil {
+		return 0, nil, false
+	}
+	var shardId uint16
+	if err := rlp.DecodeBytes(b[:len(b)-len(rest)], &shardId); err != nil {
+		return 0, nil, false
+	}
+	return shardId, rest, true
+}
+
+// convertLegacyHeadKey converts the legacy prefix + shard head keys.
+func convertLegacyHeadKey(prefix []byte) func([]byte) []byte {
+	return func(key []byte) []byte {
+		shardId, rest, ok := splitLegacyShardId(key[len(prefix):])
+		if !ok || len(rest) != 0 {
+			return nil
+		}
+		return append(common.CopyBytes(prefix), encodeShardId(shardId)...)
+	}
+}
+
+// convertLegacyChainKey converts the legacy prefix + num + shard + rest keys of
+// headers, bodies and receipts into prefix + shard + num + rest, returning nil
+// for the keys of any other layout sharing the prefix (e.g. trie nodes).
+func convertLegacyChainKey(key []byte) []byte {
+	if len(key) < 1+8+1 {
+		return nil
+	}
+	shardId, rest, ok := splitLegacyShardId(key[9:])
+	if !ok {
+		return nil
+	}
+	switch {
+	case len(rest) == common.HashLength:
+	case key[0] == headerPrefix[0] && len(rest) == common.HashLength+len(headerTDSuffix) && bytes.HasSuffix(rest, headerTDSuffix):
+	case key[0] == headerPrefix[0] && bytes.Equal(rest, headerHashSuffix):
+	default:
+		return nil
+	}
+	return append(append(append([]byte{key[0]}, encodeShardId(shardId)...), key[1:9]...), rest...)
+}
+
+// convertLegacyHashKey converts the legacy prefix + shard + hash keys. The latest
+// shard records, which the legacy schema kept as bare preimage prefix + shard
+// keys, are moved under their own prefix.
+func convertLegacyHashKey(prefix []byte) func([]byte) []byte {
+	return func(key []byte) []byte {
+		shardId, rest, ok := splitLegacyShardId(key[len(prefix):])
+		switch {
+		case !ok:
+			return nil
+		case len(rest) == common.HashLength:
+			return append(append(common.CopyBytes(prefix), encodeShardId(shardId)...), rest...)
+		case len(rest) == 0 && bytes.Equal(prefix, preimagePrefix):
+			return latestShardsKey(shardId)
+		}
+		return nil
+	}
+}
+
+// MigrateShardKeys rewrites in place a database keyed by the legacy RLP encoded
+// shard ids into the fixed width, shard prefixed schema, stamping it with the
+// given version once done.
+//
+// Legacy keys are first moved under the migration prefix, then out of it into
+// their final place, so that legacy and migrated keys never share a key range
+// and an interrupted migration resumes from the stage it reached.
+func MigrateShardKeys(db *ethdb.LDBDatabase, version int) error {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		moved  uint64
+	)
+	progress := func(stage string) {
+		moved++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Migrating shard keys", "stage", stage, "keys", moved, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	stage, _ := db.Get(shardKeyMigrationKey)
+	if len(stage) == 0 {
+		stage = []byte{migrationStaging}
+		if err := db.Put(shardKeyMigrationKey, stage); err != nil {
+			return err
+		}
+	} else {
+		log.Info("Resuming shard key migration", "stage", stage[0])
+	}
+	if stage[0] == migrationStaging {
+		for _, keys := range legacyShardKeyRanges {
+			convert := keys.convert
+			staged := func(key []byte) []byte {
+				if key = convert(key); key != nil {
+					return append(common.CopyBytes(migrationPrefix), key...)
+				}
+				return nil
+			}
+			if err := moveKeys(db, keys.prefix, staged, func() { progress("staging") }); err != nil {
+				return err
+			}
+		}
+		if err := db.Put(shardKeyMigrationKey, []byte{migrationUnstaging}); err != nil {
+			return err
+		}
+	}
+	unstaged := func(key []byte) []byte {
+		// Skip any trie node whose hash happens to share the migration prefix
+		if len(key) == common.HashLength {
+			return nil
+		}
+		return common.CopyBytes(key[len(migrationPrefix):])
+	}
+	if err := moveKeys(db, migrationPrefix, unstaged, func() { progress("unstaging") }); err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	WriteDatabaseVersion(batch, version)
+	batch.Delete(shardKeyMigrationKey)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Migrated shard keys", "keys", moved, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// moveKeys moves the values of the keys in the prefix range to the keys convert
+// maps them onto, leaving the keys it maps onto nil untouched.
+func moveKeys(db *ethdb.LDBDatabase, prefix []byte, convert func([]byte) []byte, progress func()) error {
+	it := db.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		key := convert(it.Key())
+		if key == nil {
+			continue
+		}
+		batch.Put(key, it.Value())
+		batch.Delete(it.Key())
+		progress()
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
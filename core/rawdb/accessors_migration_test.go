@@ -0,0 +1,254 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// legacyShardId encodes a shard id the way the legacy key schema did.
+func legacyShardId(shardId uint16) []byte {
+	enc, _ := rlp.EncodeToBytes(shardId)
+	return enc
+}
+
+// legacyChainKey builds a legacy prefix + num + shard + suffix key.
+func legacyChainKey(prefix []byte, number uint64, shardId uint16, suffix []byte) []byte {
+	key := append(common.CopyBytes(prefix), encodeBlockNumber(number)...)
+	return append(append(key, legacyShardId(shardId)...), suffix...)
+}
+
+// legacyShardKey builds a legacy prefix + shard + suffix key.
+func legacyShardKey(prefix []byte, shardId uint16, suffix []byte) []byte {
+	return append(append(common.CopyBytes(prefix), legacyShardId(shardId)...), suffix...)
+}
+
+// legacyKeyPair is a key of the legacy schema along with the key the migration
+// should move its value to, nil if it must be left in place.
+type legacyKeyPair struct {
+	legacy  []byte
+	current []byte
+}
+
+// legacyKeyPairs returns the legacy keys of every converted range for a shard,
+// along with their current counterparts.
+func legacyKeyPairs(shardId uint16) []legacyKeyPair {
+	var (
+		hash   = common.Hash{0x01, 0x02, byte(shardId)}
+		number = uint64(0x010203)
+	)
+	return []legacyKeyPair{
+		{legacyShardKey(_headHeaderKey, shardId, nil), headHeaderKey(shardId)},
+		{legacyShardKey(_headBlockKey, shardId, nil), headBlockKey(shardId)},
+		{legacyShardKey(_headFastBlockKey, shardId, nil), headFastBlockKey(shardId)},
+		{legacyChainKey(headerPrefix, number, shardId, hash.Bytes()), headerKey(number, shardId, hash)},
+		{legacyChainKey(headerPrefix, number, shardId, append(hash.Bytes(), headerTDSuffix...)), headerTDKey(number, shardId, hash)},
+		{legacyChainKey(headerPrefix, number, shardId, headerHashSuffix), headerHashKey(shardId, number)},
+		{legacyChainKey(blockBodyPrefix, number, shardId, hash.Bytes()), blockBodyKey(shardId, number, hash)},
+		{legacyChainKey(blockReceiptsPrefix, number, shardId, hash.Bytes()), blockReceiptsKey(shardId, number, hash)},
+		{legacyShardKey(headerNumberPrefix, shardId, hash.Bytes()), headerNumberKey(shardId, hash)},
+		{legacyShardKey(preimagePrefix, shardId, hash.Bytes()), preimageKey(shardId, hash)},
+		{legacyShardKey(preimagePrefix, shardId, nil), latestShardsKey(shardId)},
+	}
+}
+
+// unrelatedKeys are keys sharing the prefix of a converted range without being
+// keyed by shard, which the migration must leave untouched.
+var unrelatedKeys = [][]byte{
+	append([]byte("h"), bytes.Repeat([]byte{0x42}, common.HashLength-1)...), // trie node
+	append([]byte("b"), bytes.Repeat([]byte{0x80}, common.HashLength-1)...), // trie node
+	append([]byte("migrate-"), bytes.Repeat([]byte{0x01}, common.HashLength-8)...),
+	[]byte("LastBlockchain"),
+}
+
+// testShardIds covers every length of RLP encoded shard ids.
+var testShardIds = []uint16{0, 1, 127, 128, 1024, 0xFFFF}
+
+// newMigrationDB creates a temporary leveldb database.
+func newMigrationDB(t *testing.T) (*ethdb.LDBDatabase, func()) {
+	dir, err := ioutil.TempDir("", "shard-migration-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// fillLegacyDB stores a value under every legacy and unrelated key, returning
+// the key pairs it stored.
+func fillLegacyDB(t *testing.T, db ethdb.Database) []legacyKeyPair {
+	var pairs []legacyKeyPair
+	for _, shardId := range testShardIds {
+		pairs = append(pairs, legacyKeyPairs(shardId)...)
+	}
+	for _, pair := range pairs {
+		if err := db.Put(pair.legacy, pair.current); err != nil {
+			t.Fatalf("failed to store legacy key: %v", err)
+		}
+	}
+	for _, key := range unrelatedKeys {
+		if err := db.Put(key, key); err != nil {
+			t.Fatalf("failed to store unrelated key: %v", err)
+		}
+	}
+	return pairs
+}
+
+// checkMigratedDB checks that every legacy value was moved to its current key,
+// and that the unrelated keys were left alone.
+func checkMigratedDB(t *testing.T, db ethdb.Database, pairs []legacyKeyPair) {
+	for _, pair := range pairs {
+		if value, err := db.Get(pair.current); err != nil || !bytes.Equal(value, pair.current) {
+			t.Errorf("migrated key %x: value mismatch: have %x, %v", pair.current, value, err)
+		}
+		if has, _ := db.Has(pair.legacy); has && !bytes.Equal(pair.legacy, pair.current) {
+			t.Errorf("legacy key %x left behind", pair.legacy)
+		}
+		if has, _ := db.Has(append(common.CopyBytes(migrationPrefix), pair.current...)); has {
+			t.Errorf("staged key %x left behind", pair.current)
+		}
+	}
+	for _, key := range unrelatedKeys {
+		if value, err := db.Get(key); err != nil || !bytes.Equal(value, key) {
+			t.Errorf("unrelated key %x modified: have %x, %v", key, value, err)
+		}
+	}
+	if has, _ := db.Has(shardKeyMigrationKey); has {
+		t.Errorf("migration stage left behind")
+	}
+}
+
+// Tests that every legacy key is converted into the key the current schema reads,
+// and that keys of other layouts sharing a prefix are not.
+func TestLegacyShardKeyConversion(t *testing.T) {
+	for _, shardId := range testShardIds {
+		for i, pair := range legacyKeyPairs(shardId) {
+			var converted []byte
+			for _, keys := range legacyShardKeyRanges {
+				if bytes.HasPrefix(pair.legacy, keys.prefix) {
+					if converted = keys.convert(pair.legacy); converted != nil {
+						break
+					}
+				}
+			}
+			if !bytes.Equal(converted, pair.current) {
+				t.Errorf("shard %d, key %d: conversion mismatch: have %x, want %x", shardId, i, converted, pair.current)
+			}
+		}
+	}
+	for _, key := range unrelatedKeys {
+		for _, keys := range legacyShardKeyRanges {
+			if bytes.HasPrefix(key, keys.prefix) {
+				if converted := keys.convert(key); converted != nil {
+					t.Errorf("unrelated key %x converted to %x", key, converted)
+				}
+			}
+		}
+	}
+}
+
+// Tests that a legacy version 3 database, including one stamped with an empty
+// version record, is migrated to version 4 with all its keys in place.
+func TestMigrateShardKeys(t *testing.T) {
+	for _, empty := range []bool{false, true} {
+		db, cleanup := newMigrationDB(t)
+
+		if empty {
+			db.Put(databaseVerisionKey, nil)
+		} else {
+			WriteDatabaseVersion(db, 3)
+		}
+		if version := ReadDatabaseVersion(db); version != 3 {
+			t.Fatalf("empty %v: legacy version mismatch: have %d, want 3", empty, version)
+		}
+		pairs := fillLegacyDB(t, db)
+		if err := MigrateShardKeys(db, 4); err != nil {
+			t.Fatalf("empty %v: migration failed: %v", empty, err)
+		}
+		checkMigratedDB(t, db, pairs)
+		if version := ReadDatabaseVersion(db); version != 4 {
+			t.Errorf("empty %v: migrated version mismatch: have %d, want 4", empty, version)
+		}
+		cleanup()
+	}
+}
+
+// Tests that a migration interrupted in either stage resumes without losing or
+// double converting any key.
+func TestMigrateShardKeysInterrupted(t *testing.T) {
+	// Interrupt the staging after the first half of the ranges was staged
+	db, cleanup := newMigrationDB(t)
+	defer cleanup()
+
+	WriteDatabaseVersion(db, 3)
+	pairs := fillLegacyDB(t, db)
+
+	db.Put(shardKeyMigrationKey, []byte{migrationStaging})
+	for _, keys := range legacyShardKeyRanges[:len(legacyShardKeyRanges)/2] {
+		convert := keys.convert
+		staged := func(key []byte) []byte {
+			if key = convert(key); key != nil {
+				return append(common.CopyBytes(migrationPrefix), key...)
+			}
+			return nil
+		}
+		if err := moveKeys(db, keys.prefix, staged, func() {}); err != nil {
+			t.Fatalf("failed to stage keys: %v", err)
+		}
+	}
+	if err := MigrateShardKeys(db, 4); err != nil {
+		t.Fatalf("resumed staging failed: %v", err)
+	}
+	checkMigratedDB(t, db, pairs)
+
+	// Interrupt the unstaging after some keys were already moved in place
+	db2, cleanup2 := newMigrationDB(t)
+	defer cleanup2()
+
+	WriteDatabaseVersion(db2, 3)
+	db2.Put(shardKeyMigrationKey, []byte{migrationUnstaging})
+	for _, key := range unrelatedKeys {
+		db2.Put(key, key)
+	}
+	for i, pair := range pairs {
+		if i%2 == 0 {
+			db2.Put(pair.current, pair.current)
+		} else {
+			db2.Put(append(common.CopyBytes(migrationPrefix), pair.current...), pair.current)
+		}
+	}
+	if err := MigrateShardKeys(db2, 4); err != nil {
+		t.Fatalf("resumed unstaging failed: %v", err)
+	}
+	checkMigratedDB(t, db2, pairs)
+	if version := ReadDatabaseVersion(db2); version != 4 {
+		t.Errorf("migrated version mismatch: have %d, want 4", version)
+	}
+}
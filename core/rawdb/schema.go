@@ -22,6 +22,7 @@ import (
 	"github.com/EDXFund/MasterChain/rlp"
 
 	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/metrics"
 )
 
@@ -43,26 +44,42 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// shardKeyMigrationKey tracks the stage of an interrupted shard key migration.
+	shardKeyMigrationKey = []byte("ShardKeyMigration")
+
+	// headerForestShardsKey tracks the shards whose unconfirmed header trees are stored.
+	headerForestShardsKey = []byte("HeaderForestShards")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
-	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
-	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
-	headerHashSuffix   = []byte("n") // headerPrefix + num (uint64 big endian) + headerHashSuffix -> hash
-	headerNumberPrefix = []byte("H") // headerNumberPrefix + hash -> num (uint64 big endian)
+	// Shard scoped items lead with the shard (uint16 big endian) so every shard is
+	// a contiguous, uniformly sortable key range.
+	headerPrefix       = []byte("h") // headerPrefix + shard + num (uint64 big endian) + hash -> header
+	headerTDSuffix     = []byte("t") // headerPrefix + shard + num (uint64 big endian) + hash + headerTDSuffix -> td
+	headerHashSuffix   = []byte("n") // headerPrefix + shard + num (uint64 big endian) + headerHashSuffix -> hash
+	headerNumberPrefix = []byte("H") // headerNumberPrefix + shard + hash -> num (uint64 big endian)
 
 
 
-	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
-	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+	blockBodyPrefix     = []byte("b") // blockBodyPrefix + shard + num (uint64 big endian) + hash -> block body
+	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + shard + num (uint64 big endian) + hash -> block receipts
 
 	txAccountNoncePrefix  = []byte("an") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	txTransactionPrefix  = []byte("at") // txLookupPrefix + hash -> transaction/receipt lookup metadata
-	txPendingPrefix  = []byte("at-Pending") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 
 	txLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
+	xshardLookupPrefix = []byte("x") // xshardLookupPrefix + hash -> cross shard receipt lookup metadata
+	shardTxLookupPrefix = []byte("S") // shardTxLookupPrefix + hash -> shard block lookup metadata
+	invalidShardPrefix = []byte("F") // invalidShardPrefix + hash -> hash of the fraudulent shard block invalidating it
+	shardSlashPrefix = []byte("f") // shardSlashPrefix + hash -> shards slashed by the child of the master block
+	rejectedTxsPrefix = []byte("j") // rejectedTxsPrefix + num (uint64 big endian) + hash -> transactions rejected by the master block
+	rejectedLookupPrefix = []byte("J") // rejectedLookupPrefix + hash -> rejected transaction lookup metadata
 	bloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 
-	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
+	preimagePrefix = []byte("secure-key-")      // preimagePrefix + shard (uint16 big endian) + hash -> preimage
+	latestShardsPrefix = []byte("LatestShard")  // latestShardsPrefix + shard (uint16 big endian) -> header forest of the shard
+	headerForestPrefix = []byte("q")            // headerForestPrefix + shard (uint16 big endian) + num (uint64 big endian) -> header forest nodes at num
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
+	migrationPrefix = []byte("migrate-")        // migrationPrefix + key -> value moved under key once the migration completes
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
@@ -86,51 +103,72 @@ func encodeBlockNumber(number uint64) []byte {
 	binary.BigEndian.PutUint64(enc, number)
 	return enc
 }
-func headHeaderKey (shardId uint16)  []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(_headHeaderKey,val...)
+// encodeShardId encodes a shard id as big endian uint16, giving every shard a
+// fixed width key prefix.
+func encodeShardId(shardId uint16) []byte {
+	enc := make([]byte, 2)
+	binary.BigEndian.PutUint16(enc, shardId)
+	return enc
+}
+
+// ShardIndexPrefix returns the table prefix under which a chain indexer of the
+// given shard tracks its progress, keeping the indexers of several shards on one
+// node apart. The master chain keeps the plain prefix.
+func ShardIndexPrefix(prefix string, shardId uint16) string {
+	if shardId == types.ShardMaster {
+		return prefix
+	}
+	return prefix + string(encodeShardId(shardId)) + "-"
+}
+
+// headHeaderKey = headHeaderKey + shard (uint16 big endian)
+func headHeaderKey(shardId uint16) []byte {
+	return append(_headHeaderKey, encodeShardId(shardId)...)
+}
+
+// headBlockKey = headBlockKey + shard (uint16 big endian)
+func headBlockKey(shardId uint16) []byte {
+	return append(_headBlockKey, encodeShardId(shardId)...)
 }
-func headBlockKey (shardId uint16)  []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(_headBlockKey,val...)
+
+// headFastBlockKey = headFastBlockKey + shard (uint16 big endian)
+func headFastBlockKey(shardId uint16) []byte {
+	return append(_headFastBlockKey, encodeShardId(shardId)...)
 }
-func  headFastBlockKey(shardId uint16)  []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(_headFastBlockKey,val...)
+
+// headerKeyPrefix = headerPrefix + shard (uint16 big endian) + num (uint64 big endian)
+func headerKeyPrefix(shardId uint16, number uint64) []byte {
+	return append(append(headerPrefix, encodeShardId(shardId)...), encodeBlockNumber(number)...)
 }
-// headerKey = headerPrefix + num (uint64 big endian) + hash
+
+// headerKey = headerPrefix + shard (uint16 big endian) + num (uint64 big endian) + hash
 func headerKey(number uint64, shardId uint16, hash common.Hash) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(append(headerPrefix, encodeBlockNumber(number)...), append(val,hash.Bytes()...)...)
+	return append(headerKeyPrefix(shardId, number), hash.Bytes()...)
 }
 
-// headerTDKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
-func headerTDKey(number uint64,shardId uint16,  hash common.Hash) []byte {
-	return append(headerKey(number,shardId, hash), headerTDSuffix...)
+// headerTDKey = headerPrefix + shard (uint16 big endian) + num (uint64 big endian) + hash + headerTDSuffix
+func headerTDKey(number uint64, shardId uint16, hash common.Hash) []byte {
+	return append(headerKey(number, shardId, hash), headerTDSuffix...)
 }
 
-// headerHashKey = headerPrefix + num (uint64 big endian) + headerHashSuffix
-func headerHashKey(shardId uint16,number uint64) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(append(headerPrefix, encodeBlockNumber(number)...),append(val, headerHashSuffix...)...)
+// headerHashKey = headerPrefix + shard (uint16 big endian) + num (uint64 big endian) + headerHashSuffix
+func headerHashKey(shardId uint16, number uint64) []byte {
+	return append(headerKeyPrefix(shardId, number), headerHashSuffix...)
 }
 
-// headerNumberKey = headerNumberPrefix + hash
+// headerNumberKey = headerNumberPrefix + shard (uint16 big endian) + hash
 func headerNumberKey(shardId uint16, hash common.Hash) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(headerNumberPrefix, append(val, hash.Bytes()...)...)
+	return append(append(headerNumberPrefix, encodeShardId(shardId)...), hash.Bytes()...)
 }
 
-// blockBodyKey = blockBodyPrefix + num (uint64 big endian) + hash
+// blockBodyKey = blockBodyPrefix + shard (uint16 big endian) + num (uint64 big endian) + hash
 func blockBodyKey(shardId uint16, number uint64, hash common.Hash) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(append(blockBodyPrefix, encodeBlockNumber(number)...), append(val, hash.Bytes()...)...)
+	return append(append(append(blockBodyPrefix, encodeShardId(shardId)...), encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
-// blockReceiptsKey = blockReceiptsPrefix + num (uint64 big endian) + hash
+// blockReceiptsKey = blockReceiptsPrefix + shard (uint16 big endian) + num (uint64 big endian) + hash
 func blockReceiptsKey(shardId uint16, number uint64, hash common.Hash) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), append(val, hash.Bytes()...)...)
+	return append(append(append(blockReceiptsPrefix, encodeShardId(shardId)...), encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
 // txLookupKey = txLookupPrefix + hash
@@ -138,6 +176,36 @@ func txLookupKey(hash common.Hash) []byte {
 	//val,_ :=  rlp.EncodeToBytes(shardId)
 	return append(txLookupPrefix,hash.Bytes()...)//append(val, hash.Bytes()...)...)
 }
+// xshardLookupKey = xshardLookupPrefix + hash
+func xshardLookupKey(hash common.Hash) []byte {
+	return append(xshardLookupPrefix, hash.Bytes()...)
+}
+
+// shardTxLookupKey = shardTxLookupPrefix + hash
+func shardTxLookupKey(hash common.Hash) []byte {
+	return append(shardTxLookupPrefix, hash.Bytes()...)
+}
+
+// rejectedTxsKey = rejectedTxsPrefix + num (uint64 big endian) + hash
+func rejectedTxsKey(number uint64, hash common.Hash) []byte {
+	return append(append(rejectedTxsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// rejectedLookupKey = rejectedLookupPrefix + hash
+func rejectedLookupKey(hash common.Hash) []byte {
+	return append(rejectedLookupPrefix, hash.Bytes()...)
+}
+
+// invalidShardKey = invalidShardPrefix + hash
+func invalidShardKey(hash common.Hash) []byte {
+	return append(invalidShardPrefix, hash.Bytes()...)
+}
+
+// shardSlashKey = shardSlashPrefix + hash
+func shardSlashKey(hash common.Hash) []byte {
+	return append(shardSlashPrefix, hash.Bytes()...)
+}
+
 // txAccountNonceKey = txAccountNoncePrefix + address + nonce
 func txAccountNonceKey(account common.Address,nonce uint64) []byte {
 	val,_ :=  rlp.EncodeToBytes(nonce)
@@ -159,10 +227,9 @@ func bloomBitsKey(bit uint, section uint64,  hash common.Hash) []byte {
 	return key
 }
 
-// preimageKey = preimagePrefix + hash
+// preimageKey = preimagePrefix + shard (uint16 big endian) + hash
 func preimageKey(shardId uint16, hash common.Hash) []byte {
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(preimagePrefix, append(val, hash.Bytes()...)...)
+	return append(append(preimagePrefix, encodeShardId(shardId)...), hash.Bytes()...)
 }
 
 // configKey = configPrefix + hash
@@ -171,10 +238,13 @@ func configKey(hash common.Hash) []byte {
 	return append(configPrefix,hash.Bytes()...)// append(val, hash.Bytes()...)...)
 }
 
-// configKey = configPrefix + hash
-func latestShardsKey(shardId uint16) []byte {
+// headerForestKey = headerForestPrefix + shard (uint16 big endian) + num (uint64 big endian)
+func headerForestKey(shardId uint16, number uint64) []byte {
+	return append(append(headerForestPrefix, encodeShardId(shardId)...), encodeBlockNumber(number)...)
+}
 
-	val,_ :=  rlp.EncodeToBytes(shardId)
-	return append(preimagePrefix, val...)
+// latestShardsKey = latestShardsPrefix + shard (uint16 big endian)
+func latestShardsKey(shardId uint16) []byte {
+	return append(latestShardsPrefix, encodeShardId(shardId)...)
 }
 
@@ -0,0 +1,128 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that the rejected bloom of a master block covers the hash and the sender
+// of every rejected transaction, and that blocks are validated against it.
+func TestRejectedBloom(t *testing.T) {
+	rejected := []*types.RejectedTx{
+		{TxHash: common.Hash{0x01}, From: common.Address{0xaa}},
+		{TxHash: common.Hash{0x02}},
+	}
+	bloom := types.CreateRejectBloom(rejected)
+	if !types.BloomLookup(bloom, rejected[0].TxHash) || !types.BloomLookup(bloom, rejected[1].TxHash) {
+		t.Errorf("bloom missing rejected transaction hash")
+	}
+	if !types.BloomLookup(bloom, rejected[0].From) {
+		t.Errorf("bloom missing rejected transaction sender")
+	}
+	if types.BloomLookup(bloom, common.Address{}) {
+		t.Errorf("bloom contains the zero sender")
+	}
+	if bloom := types.CreateRejectBloom(nil); bloom != (types.Bloom{}) {
+		t.Errorf("empty bloom mismatch: have %x", bloom)
+	}
+	header := layoutHeader(common.Hash{}, 1, ShardLayout{})
+	header.SetBloomRejected(bloom)
+	block := types.NewBlockWithHeader(header)
+
+	if err := validateRejected(block, rejected); err != nil {
+		t.Errorf("matching bloom rejected: %v", err)
+	}
+	if err := validateRejected(block, rejected[:1]); err == nil {
+		t.Errorf("mismatching bloom accepted")
+	}
+}
+
+// Tests that the lookup entries of rejected transactions are only written for
+// canonical master blocks, and that they follow the canonical chain on reorgs.
+func TestRejectedTxLookups(t *testing.T) {
+	var (
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		db      = ethdb.NewMemDatabase()
+		genesis = gspec.MustCommit(db, types.ShardMaster)
+		engine  = ethash.NewFaker()
+	)
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	canon, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, nil)
+	fork, _ := GenerateChain(gspec.Config, canon[0], engine, db, 2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := chain.InsertChain(canon[:1]); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	// Keep the local head on ties, so that the first fork block is a side block
+	chain.shouldPreserve = func(block types.BlockIntf) bool { return block.Hash() == canon[1].Hash() }
+
+	write := func(block types.BlockIntf, parent types.BlockIntf, rejected []*types.RejectedTx) WriteStatus {
+		statedb, err := state.New(parent.Root(), chain.stateCache)
+		if err != nil {
+			t.Fatalf("failed to open state: %v", err)
+		}
+		status, err := chain.WriteBlockWithState(block, nil, rejected, statedb)
+		if err != nil {
+			t.Fatalf("failed to write block: %v", err)
+		}
+		return status
+	}
+	canonTx := &types.RejectedTx{TxHash: common.Hash{0x01}, Reason: "canon"}
+	forkTx := &types.RejectedTx{TxHash: common.Hash{0x02}, Reason: "fork"}
+
+	if status := write(canon[1], canon[0], []*types.RejectedTx{canonTx}); status != CanonStatTy {
+		t.Fatalf("canonical block status mismatch: have %v, want %v", status, CanonStatTy)
+	}
+	if status := write(fork[0], canon[0], []*types.RejectedTx{forkTx}); status != SideStatTy {
+		t.Fatalf("side block status mismatch: have %v, want %v", status, SideStatTy)
+	}
+	if tx, hash, _ := chain.GetRejectedTx(canonTx.TxHash); tx == nil || hash != canon[1].Hash() {
+		t.Errorf("canonical rejected transaction mismatch: have %v in %x", tx, hash)
+	}
+	if tx, _, _ := rawdb.ReadRejectedTx(db, forkTx.TxHash); tx != nil {
+		t.Errorf("side block rejected transaction indexed: %v", tx)
+	}
+	if rejected := rawdb.ReadRejectedTxs(db, fork[0].Hash(), fork[0].NumberU64()); len(rejected) != 1 {
+		t.Errorf("side block rejected transactions mismatch: have %d, want 1", len(rejected))
+	}
+	// Extend the fork past the canonical chain and check the entries moved along
+	if status := write(fork[1], fork[0], nil); status != CanonStatTy {
+		t.Fatalf("reorg block status mismatch: have %v, want %v", status, CanonStatTy)
+	}
+	if tx, _, _ := rawdb.ReadRejectedTx(db, canonTx.TxHash); tx != nil {
+		t.Errorf("dropped rejected transaction still indexed: %v", tx)
+	}
+	if tx, hash, _ := chain.GetRejectedTx(forkTx.TxHash); tx == nil || hash != fork[0].Hash() {
+		t.Errorf("reorged rejected transaction mismatch: have %v in %x", tx, hash)
+	}
+}
@@ -96,7 +96,9 @@ func (v *ShardBlockValidator) ValidateState(block, parent *types.Block, statedb
 	}
 	// Validate the state root against the received state root and throw
 	// an error if they don't match.
-
+	if root := statedb.IntermediateRoot(v.config.IsEIP158(header.Number())); header.Root() != root {
+		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root(), root)
+	}
 	return nil
 }
 
@@ -0,0 +1,335 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/bits"
+	"reflect"
+
+	"github.com/EDXFund/MasterChain/consensus"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// The shard layout of the network is carried by the master headers. ShardExp
+// is the number of low bits of a routing key taken into account and
+// ShardEnabled the set of running shards. A key belongs to the shard given by
+// its masked bits or, while that shard is disabled, to its parent: the same id
+// with the highest bit cleared. The shards thus form a binary tree rooted at
+// shard 0, in which every enabled shard owns the keys of its disabled
+// descendants.
+//
+// The layout only changes on the first master block of an epoch, following the
+// load the shards reported during the epoch before. An overloaded shard is
+// split by enabling its next child, which takes over half of its keys, and an
+// idle leaf shard is merged back into its parent. For ShardTransitionLength
+// blocks after a change, a transaction is accepted both by its shard under the
+// old layout and under the new one, so that the transactions pending on a
+// shard losing accounts can still drain.
+
+var (
+	// ErrInvalidShardLayout is returned if the shard layout of a master header
+	// doesn't follow from the load of the previous epoch.
+	ErrInvalidShardLayout = errors.New("invalid shard layout")
+
+	// ErrShardDisabled is returned if a master block includes a block of a
+	// shard which is not enabled.
+	ErrShardDisabled = errors.New("shard not enabled")
+)
+
+// ShardLayout is the set of shards enabled on the network.
+type ShardLayout struct {
+	Exp     uint16
+	Enabled [32]byte
+}
+
+// LayoutOf returns the shard layout carried by a master header.
+func LayoutOf(header types.HeaderIntf) ShardLayout {
+	master := header.ToHeader()
+	return ShardLayout{Exp: master.ShardExp(), Enabled: master.ShardEnabled()}
+}
+
+// IsEnabled returns whether the given shard is running. Shard 0 always is.
+func (l ShardLayout) IsEnabled(shardId uint16) bool {
+	if shardId == 0 {
+		return true
+	}
+	if int(shardId>>3) >= len(l.Enabled) {
+		return false
+	}
+	return l.Enabled[shardId>>3]&(1<<(shardId&0x7)) != 0
+}
+
+func (l *ShardLayout) setEnabled(shardId uint16, enabled bool) {
+	if enabled {
+		l.Enabled[shardId>>3] |= 1 << (shardId & 0x7)
+	} else {
+		l.Enabled[shardId>>3] &^= 1 << (shardId & 0x7)
+	}
+}
+
+// Shard returns the shard owning a routing key.
+func (l ShardLayout) Shard(key uint16) uint16 {
+	exp := l.Exp
+	if exp > params.MaxShardExp {
+		exp = params.MaxShardExp
+	}
+	shardId := key & (1<<exp - 1)
+	for !l.IsEnabled(shardId) {
+		shardId = shardParent(shardId)
+	}
+	return shardId
+}
+
+// shardParent returns the shard owning the keys of a disabled shard.
+func shardParent(shardId uint16) uint16 {
+	return shardId &^ (1 << uint(bits.Len16(shardId)-1))
+}
+
+// nextChild returns the disabled child of a shard which takes over half of its
+// keys when it is split.
+func (l ShardLayout) nextChild(shardId uint16) (uint16, bool) {
+	for k := uint16(bits.Len16(shardId)); k < params.MaxShardExp; k++ {
+		if child := shardId | 1<<k; !l.IsEnabled(child) {
+			return child, true
+		}
+	}
+	return 0, false
+}
+
+// isLeaf returns whether a shard has no enabled child.
+func (l ShardLayout) isLeaf(shardId uint16) bool {
+	for k := uint16(bits.Len16(shardId)); k < params.MaxShardExp; k++ {
+		if l.IsEnabled(shardId | 1<<k) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize sets the exponent to the number of key bits the enabled shards
+// need.
+func (l *ShardLayout) normalize() {
+	l.Exp = 0
+	for id := 1; id < 1<<params.MaxShardExp; id++ {
+		if l.IsEnabled(uint16(id)) {
+			l.Exp = uint16(bits.Len16(uint16(id)))
+		}
+	}
+}
+
+// NewShardTxsStat summarizes the load of a shard block.
+func NewShardTxsStat(block types.BlockIntf) ShardTxsStat {
+	return ShardTxsStat{
+		ShardId:    block.ShardId(),
+		BlkNo:      block.NumberU64(),
+		Difficulty: block.Difficulty().Uint64(),
+		TxCounts:   uint64(len(block.Results())),
+		GasUsed:    block.GasUsed(),
+		GasLimit:   block.GasLimit(),
+	}
+}
+
+// epochShardLoad returns the load of every shard over the epoch ending with
+// the given master header, in percent of the gas limit of its blocks. Every
+// included transaction counts for at least the intrinsic gas of a transfer,
+// so that the volume of transactions is accounted for even if the shard
+// executes none of them. The load is incomplete if some of the blocks of the
+// epoch are missing.
+func epochShardLoad(chain consensus.ChainReader, header types.HeaderIntf) (map[uint16]uint64, bool) {
+	var (
+		used     = make(map[uint16]uint64)
+		limits   = make(map[uint16]uint64)
+		complete = true
+	)
+	start := header.NumberU64() - header.NumberU64()%params.ShardEpochLength
+	for header != nil && !reflect.ValueOf(header).IsNil() {
+		block := chain.GetBlock(header.Hash(), header.NumberU64())
+		if block == nil || reflect.ValueOf(block).IsNil() {
+			log.Warn("Missing master block for shard load", "number", header.NumberU64(), "hash", header.Hash())
+			complete = false
+			break
+		}
+		for _, info := range block.ShardBlocks() {
+			shardBlock := chain.GetBlock(info.Hash, info.BlockNumber)
+			if shardBlock == nil || reflect.ValueOf(shardBlock).IsNil() {
+				complete = false
+				continue
+			}
+			stat := NewShardTxsStat(shardBlock)
+			gas := stat.GasUsed
+			if volume := stat.TxCounts * params.TxGas; volume > gas {
+				gas = volume
+			}
+			used[stat.ShardId] += gas
+			limits[stat.ShardId] += stat.GasLimit
+		}
+		if header.NumberU64() <= start {
+			break
+		}
+		header = chain.GetHeader(header.ParentHash(), header.NumberU64()-1)
+	}
+	if header == nil || reflect.ValueOf(header).IsNil() {
+		complete = false
+	}
+	load := make(map[uint16]uint64)
+	for shardId, limit := range limits {
+		if limit > 0 {
+			load[shardId] = used[shardId] * 100 / limit
+		}
+	}
+	return load, complete
+}
+
+// CalcShardLayout computes the shard layout of the master block following
+// parent. It only differs from the layout of the parent on the first block of
+// an epoch.
+func CalcShardLayout(chain consensus.ChainReader, parent types.HeaderIntf) ShardLayout {
+	layout, _ := calcShardLayout(chain, parent)
+	return layout
+}
+
+// calcShardLayout computes the shard layout of the master block following
+// parent, and whether all the blocks of the epoch it depends on were available.
+func calcShardLayout(chain consensus.ChainReader, parent types.HeaderIntf) (ShardLayout, bool) {
+	layout := LayoutOf(parent)
+	if (parent.NumberU64()+1)%params.ShardEpochLength != 0 {
+		return layout, true
+	}
+	var (
+		load, complete = epochShardLoad(chain, parent)
+		next           = layout
+	)
+	for id := 0; id < 1<<params.MaxShardExp; id++ {
+		shardId := uint16(id)
+		if !layout.IsEnabled(shardId) {
+			continue
+		}
+		// Split overloaded shards, halving their keys
+		if load[shardId] >= params.ShardSplitLoad {
+			if child, ok := layout.nextChild(shardId); ok {
+				log.Info("Splitting overloaded shard", "shard", shardId, "load", load[shardId], "child", child)
+				next.setEnabled(child, true)
+			}
+			continue
+		}
+		// Merge idle leaves back into their parent. A shard below the merge load
+		// is never split, so the parent keeps its children this epoch.
+		if shardId == 0 || !layout.isLeaf(shardId) {
+			continue
+		}
+		parentId := shardParent(shardId)
+		for !layout.IsEnabled(parentId) {
+			parentId = shardParent(parentId)
+		}
+		if load[shardId]+load[parentId] < params.ShardMergeLoad {
+			log.Info("Merging idle shard", "shard", shardId, "load", load[shardId], "parent", parentId, "parentLoad", load[parentId])
+			next.setEnabled(shardId, false)
+		}
+	}
+	next.normalize()
+	return next, complete
+}
+
+// ShardLayout returns the shard layout of the master block following parent,
+// as computed by CalcShardLayout. The layout of the first block of an epoch
+// only depends on the ancestry of its parent, so it is cached by parent hash
+// once the whole epoch was available to compute it.
+func (bc *BlockChain) ShardLayout(parent types.HeaderIntf) ShardLayout {
+	layout, _ := bc.shardLayout(parent)
+	return layout
+}
+
+// shardLayout returns the shard layout of the master block following parent,
+// and whether all the blocks of the epoch it depends on were available.
+func (bc *BlockChain) shardLayout(parent types.HeaderIntf) (ShardLayout, bool) {
+	if (parent.NumberU64()+1)%params.ShardEpochLength != 0 {
+		return LayoutOf(parent), true
+	}
+	if cached, ok := bc.layoutCache.Get(parent.Hash()); ok {
+		return cached.(ShardLayout), true
+	}
+	layout, complete := calcShardLayout(bc, parent)
+	if complete {
+		bc.layoutCache.Add(parent.Hash(), layout)
+	}
+	return layout, complete
+}
+
+// verifyShardLayout checks that the shard layout of a master header is the one
+// following its parent. A layout change at an epoch boundary can't be checked
+// if some blocks of the epoch before are missing locally, as after a light or
+// fast sync or once shard bodies were pruned: the header is trusted then, as
+// rejecting it would fork the node off the network.
+func (bc *BlockChain) verifyShardLayout(parent, header types.HeaderIntf) error {
+	layout, complete := bc.shardLayout(parent)
+	if !complete {
+		log.Debug("Skipping shard layout check of incomplete epoch", "number", header.NumberU64(), "hash", header.Hash())
+		return nil
+	}
+	if layout != LayoutOf(header) {
+		return ErrInvalidShardLayout
+	}
+	return nil
+}
+
+// layoutTransition returns the number of the last master block of the epoch
+// before the given one, if the block falls in the transition period after a
+// possible layout change.
+func layoutTransition(number uint64) (uint64, bool) {
+	start := number - number%params.ShardEpochLength
+	if start == 0 || number-start >= params.ShardTransitionLength {
+		return 0, false
+	}
+	return start - 1, true
+}
+
+// ShardLayouts is a set of shard layouts in force at the same time.
+type ShardLayouts []ShardLayout
+
+// IsEnabled returns whether a shard is enabled in any of the layouts.
+func (ls ShardLayouts) IsEnabled(shardId uint16) bool {
+	for _, layout := range ls {
+		if layout.IsEnabled(shardId) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptedLayouts returns the layouts under which shards accept transactions
+// and blocks at the given master header: its own and, during a transition,
+// the previous one. The header itself needn't be part of the chain yet.
+func AcceptedLayouts(chain consensus.ChainReader, header types.HeaderIntf) ShardLayouts {
+	layouts := ShardLayouts{LayoutOf(header)}
+	number, ok := layoutTransition(header.NumberU64())
+	if !ok {
+		return layouts
+	}
+	for header != nil && !reflect.ValueOf(header).IsNil() && header.NumberU64() > number {
+		header = chain.GetHeader(header.ParentHash(), header.NumberU64()-1)
+	}
+	if header == nil || reflect.ValueOf(header).IsNil() {
+		return layouts
+	}
+	if prev := LayoutOf(header); prev != layouts[0] {
+		layouts = append(layouts, prev)
+	}
+	return layouts
+}
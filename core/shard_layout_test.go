@@ -0,0 +1,153 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// newLayoutChain creates a master chain whose first epoch runs the given layout
+// and includes a single block of the given shard, loaded to the given percent
+// of its gas limit. The shard block is only stored if store is set. It returns
+// the last master header of the epoch.
+func newLayoutChain(t *testing.T, layout ShardLayout, shardId uint16, load uint64, store bool) (*BlockChain, types.BlockIntf, types.HeaderIntf) {
+	db := ethdb.NewMemDatabase()
+	genesis := (&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: shardId, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10), GasLimit: 100, GasUsed: load})
+	shardBlock := types.NewSBlockWithHeader(header)
+	if store {
+		rawdb.WriteBlock(db, shardBlock)
+	}
+	var (
+		parent = genesis.Header()
+		infos  = []*types.ShardBlockInfo{{ShardId: shardId, BlockNumber: 1, Hash: shardBlock.Hash()}}
+	)
+	for number := uint64(1); number < params.ShardEpochLength; number++ {
+		block := types.NewBlock(layoutHeader(parent.Hash(), number, layout), infos, nil, nil)
+		rawdb.WriteBlock(db, block)
+		parent, infos = block.Header(), nil
+	}
+	return chain, shardBlock, parent
+}
+
+// Tests that the layout only changes on the first block of an epoch, splitting
+// overloaded shards and merging idle ones.
+func TestShardLayoutTransition(t *testing.T) {
+	var split, resplit ShardLayout
+	split.setEnabled(1, true)
+	split.normalize()
+	resplit.setEnabled(1, true)
+	resplit.setEnabled(3, true)
+	resplit.normalize()
+
+	tests := []struct {
+		layout ShardLayout
+		shard  uint16
+		load   uint64
+		want   ShardLayout
+	}{
+		{ShardLayout{}, 0, 90, split},         // overloaded shard 0 is split
+		{ShardLayout{}, 0, 50, ShardLayout{}}, // busy shard 0 is kept
+		{split, 1, 90, resplit},               // overloaded shard 1 is split into shard 3
+		{split, 0, 10, ShardLayout{}},         // idle shard 1 is merged back
+	}
+	for i, tt := range tests {
+		chain, _, last := newLayoutChain(t, tt.layout, tt.shard, tt.load, true)
+
+		if layout := chain.ShardLayout(last); layout != tt.want {
+			t.Errorf("test %d: layout mismatch: have %+v, want %+v", i, layout, tt.want)
+		}
+		// Blocks within the epoch keep the layout of their parent
+		inner := chain.GetHeader(last.ParentHash(), last.NumberU64()-1)
+		if layout := chain.ShardLayout(inner); layout != tt.layout {
+			t.Errorf("test %d: inner layout mismatch: have %+v, want %+v", i, layout, tt.layout)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that epoch layouts are cached by parent, but only once all the blocks of
+// the epoch were available to compute them.
+func TestShardLayoutCache(t *testing.T) {
+	var split ShardLayout
+	split.setEnabled(1, true)
+	split.normalize()
+
+	chain, shardBlock, last := newLayoutChain(t, ShardLayout{}, 0, 90, false)
+	defer chain.Stop()
+
+	if layout := chain.ShardLayout(last); layout != (ShardLayout{}) {
+		t.Fatalf("layout without shard block mismatch: have %+v, want %+v", layout, ShardLayout{})
+	}
+	if chain.layoutCache.Contains(last.Hash()) {
+		t.Fatalf("layout of incomplete epoch cached")
+	}
+	rawdb.WriteBlock(chain.db, shardBlock)
+	if layout := chain.ShardLayout(last); layout != split {
+		t.Fatalf("layout with shard block mismatch: have %+v, want %+v", layout, split)
+	}
+	if cached, ok := chain.layoutCache.Get(last.Hash()); !ok || cached.(ShardLayout) != split {
+		t.Fatalf("cached layout mismatch: have %v, want %+v", cached, split)
+	}
+	if chain.layoutCache.Len() != 1 {
+		t.Fatalf("cached layout count mismatch: have %d, want 1", chain.layoutCache.Len())
+	}
+}
+
+// Tests that layout changes are only checked if the whole epoch before them is
+// available, so that nodes missing some of its blocks don't fork off.
+func TestVerifyShardLayout(t *testing.T) {
+	var split ShardLayout
+	split.setEnabled(1, true)
+	split.normalize()
+
+	chain, shardBlock, last := newLayoutChain(t, ShardLayout{}, 0, 90, false)
+	defer chain.Stop()
+
+	// Without the shard block the split can't be checked and is trusted
+	header := layoutHeader(last.Hash(), last.NumberU64()+1, split)
+	if err := chain.verifyShardLayout(last, header); err != nil {
+		t.Fatalf("layout of incomplete epoch rejected: %v", err)
+	}
+	// With it, only the split layout is accepted
+	rawdb.WriteBlock(chain.db, shardBlock)
+	if err := chain.verifyShardLayout(last, header); err != nil {
+		t.Fatalf("valid layout rejected: %v", err)
+	}
+	if err := chain.verifyShardLayout(last, layoutHeader(last.Hash(), last.NumberU64()+1, ShardLayout{})); err != ErrInvalidShardLayout {
+		t.Fatalf("invalid layout error mismatch: have %v, want %v", err, ErrInvalidShardLayout)
+	}
+	// Within an epoch the layout can't change, whatever is missing
+	inner := chain.GetHeader(last.ParentHash(), last.NumberU64()-1)
+	if err := chain.verifyShardLayout(inner, layoutHeader(inner.Hash(), last.NumberU64(), split)); err != ErrInvalidShardLayout {
+		t.Fatalf("inner layout change error mismatch: have %v, want %v", err, ErrInvalidShardLayout)
+	}
+}
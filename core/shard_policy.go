@@ -0,0 +1,100 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+)
+
+var (
+	// ErrWrongShard is returned if a transaction is handed to a shard which
+	// does not own the sending account.
+	ErrWrongShard = errors.New("transaction belongs to another shard")
+)
+
+// ShardPolicy decides which shard owns a transaction. The policy must be the
+// same on every node of the network, otherwise shards would disagree about
+// which of them is allowed to include a given transaction.
+type ShardPolicy interface {
+	// ShardKey returns the unmasked routing key of a transaction sent by from
+	// to to (nil for contract creation). The chain masks the key with the
+	// current ShardExp of the master chain to get the shard id.
+	ShardKey(from common.Address, to *common.Address) uint16
+}
+
+// ShardRouter resolves the shard owning a transaction or an account. Routing
+// depends on the shard layouts in force at a master header, which is passed
+// explicitly so that validating or replaying a block doesn't depend on the
+// local head of the chain. It also tells which shard blocks the master chain
+// committed and which of their transactions it rejected, so that cross shard
+// transfers are only claimed from those it applied.
+type ShardRouter interface {
+	TxShard(master types.HeaderIntf, tx *types.Transaction) (uint16, error)
+	TxShards(master types.HeaderIntf, tx *types.Transaction) ([]uint16, error)
+	AccountShard(master types.HeaderIntf, addr common.Address) uint16
+	ShardBlockConfirmed(hash common.Hash) bool
+	CrossShardRejected(blockHash, txHash common.Hash) bool
+}
+
+// SenderShardPolicy routes every transaction to the shard of its sender, so a
+// single shard owns the whole nonce space of an account.
+type SenderShardPolicy struct{}
+
+// ShardKey implements ShardPolicy.
+func (SenderShardPolicy) ShardKey(from common.Address, to *common.Address) uint16 {
+	return addressShardKey(from)
+}
+
+// RecipientShardPolicy routes transactions to the shard of their recipient,
+// keeping all calls into a contract on the same shard. Contract creations are
+// routed by sender. Note nonce ordering of an account is only guaranteed if it
+// always sends to recipients of the same shard.
+type RecipientShardPolicy struct{}
+
+// ShardKey implements ShardPolicy.
+func (RecipientShardPolicy) ShardKey(from common.Address, to *common.Address) uint16 {
+	if to == nil {
+		return addressShardKey(from)
+	}
+	return addressShardKey(*to)
+}
+
+// DefaultShardPolicy is the policy used by chains which don't set one.
+var DefaultShardPolicy ShardPolicy = SenderShardPolicy{}
+
+// addressShardKey takes the first two bytes of an address as its shard key.
+func addressShardKey(addr common.Address) uint16 {
+	return uint16(addr[0]) + (uint16(addr[1]) << 8)
+}
+
+// checkTxShard returns ErrWrongShard unless the given shard accepts tx at the
+// given master header.
+func checkTxShard(router ShardRouter, master types.HeaderIntf, tx *types.Transaction, shardId uint16) error {
+	shards, err := router.TxShards(master, tx)
+	if err != nil {
+		return err
+	}
+	for _, id := range shards {
+		if id == shardId {
+			return nil
+		}
+	}
+	return ErrWrongShard
+}
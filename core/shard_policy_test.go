@@ -0,0 +1,160 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// layoutHeader creates a master header carrying the given shard layout.
+func layoutHeader(parent common.Hash, number uint64, layout ShardLayout) *types.Header {
+	header := new(types.Header)
+	header.FillBy(&types.HeaderStruct{
+		ParentHash:   parent,
+		ShardMaskEp:  layout.Exp,
+		ShardEnabled: layout.Enabled,
+		Difficulty:   big.NewInt(1),
+		Number:       new(big.Int).SetUint64(number),
+		Time:         new(big.Int).SetUint64(number * 10),
+	})
+	return header
+}
+
+// oddKey returns a key whose sender has an odd routing key, so that it moves from
+// shard 0 to shard 1 when the latter is enabled.
+func oddKey(t *testing.T) *ecdsa.PrivateKey {
+	for {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		if addressShardKey(crypto.PubkeyToAddress(key.PublicKey))&1 == 1 {
+			return key
+		}
+	}
+}
+
+// Tests that transactions are routed by the layouts of the master header they are
+// checked against, not by the head of the chain, across a layout change.
+func TestTxShardLayoutChange(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	(&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Store the last header of an epoch running shard 0 only, followed by the
+	// first one of an epoch which split off shard 1, without moving the head
+	var split ShardLayout
+	split.setEnabled(1, true)
+	split.normalize()
+
+	last := layoutHeader(common.Hash{}, params.ShardEpochLength-1, ShardLayout{})
+	first := layoutHeader(last.Hash(), params.ShardEpochLength, split)
+	settled := layoutHeader(common.Hash{}, params.ShardEpochLength+params.ShardTransitionLength, split)
+	rawdb.WriteHeader(db, last)
+	rawdb.WriteHeader(db, first)
+
+	key := oddKey(t)
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(1), nil, 0), types.NewEIP155Signer(params.TestChainConfig.ChainID), key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	tests := []struct {
+		master *types.Header
+		shard  uint16
+		shards []uint16
+	}{
+		{last, 0, []uint16{0}},
+		{first, 1, []uint16{1, 0}},
+		{settled, 1, []uint16{1}},
+	}
+	for i, tt := range tests {
+		shard, err := chain.TxShard(tt.master, tx)
+		if err != nil {
+			t.Fatalf("test %d: failed to route transaction: %v", i, err)
+		}
+		if shard != tt.shard {
+			t.Errorf("test %d: shard mismatch: have %d, want %d", i, shard, tt.shard)
+		}
+		shards, err := chain.TxShards(tt.master, tx)
+		if err != nil {
+			t.Fatalf("test %d: failed to route transaction: %v", i, err)
+		}
+		if !reflect.DeepEqual(shards, tt.shards) {
+			t.Errorf("test %d: accepting shards mismatch: have %v, want %v", i, shards, tt.shards)
+		}
+		if shard := chain.AccountShard(tt.master, crypto.PubkeyToAddress(key.PublicKey)); shard != tt.shard {
+			t.Errorf("test %d: account shard mismatch: have %d, want %d", i, shard, tt.shard)
+		}
+	}
+	// The head still runs shard 0 only, which must not affect routing
+	if shard, _ := chain.TxShard(chain.CurrentMasterHeader(), tx); shard != 0 {
+		t.Errorf("head shard mismatch: have %d, want 0", shard)
+	}
+}
+
+// Tests that a shard block is routed by the master block its header references,
+// independent of the head of the master chain.
+func TestRoutingHeaderOfReferencedBlock(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	genesis := (&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	var split ShardLayout
+	split.setEnabled(1, true)
+	split.normalize()
+
+	master := types.NewBlock(layoutHeader(common.Hash{}, params.ShardEpochLength, split), nil, nil, nil)
+	rawdb.WriteHeader(db, master.Header())
+
+	referencing := new(types.SHeader)
+	referencing.FillBy(&types.SHeaderStruct{Number: big.NewInt(1), MasterHash: master.Hash(), MasterNumber: master.NumberU64()})
+	if have := chain.routingHeader(referencing); have == nil || have.Hash() != master.Hash() {
+		t.Errorf("routing header of referencing block mismatch: have %v, want %x", have, master.Hash())
+	}
+	unreferencing := new(types.SHeader)
+	unreferencing.FillBy(&types.SHeaderStruct{Number: big.NewInt(1)})
+	if have := chain.routingHeader(unreferencing); have == nil || have.Hash() != genesis.Hash() {
+		t.Errorf("routing header of unreferencing block mismatch: have %v, want genesis %x", have, genesis.Hash())
+	}
+	unknown := new(types.SHeader)
+	unknown.FillBy(&types.SHeaderStruct{Number: big.NewInt(1), MasterHash: common.Hash{0x01}, MasterNumber: 1})
+	if have := chain.routingHeader(unknown); have != nil {
+		t.Errorf("routing header of unknown reference mismatch: have %x, want nil", have.Hash())
+	}
+}
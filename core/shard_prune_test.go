@@ -0,0 +1,77 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that prune depths shallower than the fraud proof window are raised, and
+// that shard bodies are only pruned once their master block is that deep.
+func TestShardPruneDepth(t *testing.T) {
+	for _, depth := range []uint64{0, 1, MinShardPruneDepth - 1, MinShardPruneDepth, 2 * MinShardPruneDepth} {
+		db := ethdb.NewMemDatabase()
+		(&Genesis{Config: params.TestChainConfig}).MustCommit(db, types.ShardMaster)
+
+		cacheConfig := &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, ShardPruneDepth: depth}
+		chain, err := NewBlockChain(db, cacheConfig, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, types.ShardMaster)
+		if err != nil {
+			t.Fatalf("depth %d: failed to create chain: %v", depth, err)
+		}
+		want := depth
+		if depth > 0 && depth < MinShardPruneDepth {
+			want = MinShardPruneDepth
+		}
+		if have := chain.cacheConfig.ShardPruneDepth; have != want {
+			t.Errorf("depth %d: effective depth mismatch: have %d, want %d", depth, have, want)
+		}
+		if cacheConfig.ShardPruneDepth != depth {
+			t.Errorf("depth %d: caller config modified to %d", depth, cacheConfig.ShardPruneDepth)
+		}
+		// Reference a stored shard block from a canonical master block
+		header := new(types.SHeader)
+		header.FillBy(&types.SHeaderStruct{ShardId: 0, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10)})
+		shardBlock := types.NewSBlockWithHeader(header)
+		rawdb.WriteBlock(db, shardBlock)
+
+		infos := []*types.ShardBlockInfo{{ShardId: 0, BlockNumber: 1, Hash: shardBlock.Hash()}}
+		master := types.NewBlock(layoutHeader(common.Hash{}, 1, ShardLayout{}), infos, nil, nil)
+		rawdb.WriteBlock(db, master)
+		rawdb.WriteCanonicalHash(db, types.ShardMaster, master.Hash(), 1)
+
+		if want > 0 {
+			chain.pruneShardBodies(want)
+			if !rawdb.HasBody(db, shardBlock.Hash(), 1) {
+				t.Errorf("depth %d: shard body pruned below the prune depth", depth)
+			}
+		}
+		chain.pruneShardBodies(want + 1)
+		if pruned := !rawdb.HasBody(db, shardBlock.Hash(), 1); pruned != (want > 0) {
+			t.Errorf("depth %d: shard body pruned mismatch: have %v, want %v", depth, pruned, want > 0)
+		}
+		chain.Stop()
+	}
+}
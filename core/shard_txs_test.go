@@ -0,0 +1,111 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// testShardTxFetcher serves transactions of a shard, recording whether it was
+// ever called while the chain was locked.
+type testShardTxFetcher struct {
+	chain  *BlockChain
+	txs    map[common.Hash]*types.Transaction
+	calls  int
+	locked bool
+}
+
+func (f *testShardTxFetcher) FetchShardTxs(shardId uint16, hashes []common.Hash, timeout time.Duration) []*types.Transaction {
+	f.calls++
+	if f.chain.chainmu.TryLock() {
+		f.chain.chainmu.Unlock()
+	} else {
+		f.locked = true
+	}
+	var txs []*types.Transaction
+	for _, hash := range hashes {
+		if tx, ok := f.txs[hash]; ok {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+// Tests that a shard block whose transactions are missing locally is queued
+// instead of rejected, and that they are fetched before the chain is locked.
+func TestShardTxsPrefetch(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}}}
+		gendb   = ethdb.NewMemDatabase()
+		genesis = gspec.MustCommit(gendb, 0)
+		tx, _   = types.SignTx(types.NewTransaction(0, common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil, 0), types.HomesteadSigner{}, key)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 1, func(i int, gen *BlockGen) {
+		gen.AddTx(tx)
+	})
+	if results := blocks[0].Results(); len(results) != 1 || results[0].TxHash != tx.Hash() {
+		t.Fatalf("generated block results mismatch: have %v", results)
+	}
+	// Import into a node which never saw the transaction
+	db := ethdb.NewMemDatabase()
+	gspec.MustCommit(db, types.ShardMaster)
+	gspec.MustCommit(db, 0)
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	fetcher := &testShardTxFetcher{chain: chain, txs: make(map[common.Hash]*types.Transaction)}
+	chain.SetShardTxFetcher(fetcher)
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block missing transactions rejected: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 0 {
+		t.Fatalf("block missing transactions imported: head %d", head)
+	}
+	if !chain.futureBlocks.Contains(blocks[0].Hash()) {
+		t.Fatalf("block missing transactions not queued")
+	}
+	// Deliver the transaction and retry
+	fetcher.txs[tx.Hash()] = tx
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 1 {
+		t.Fatalf("head mismatch: have %d, want 1", head)
+	}
+	if fetcher.calls != 2 {
+		t.Errorf("fetch count mismatch: have %d, want 2", fetcher.calls)
+	}
+	if fetcher.locked {
+		t.Errorf("transactions fetched while the chain was locked")
+	}
+}
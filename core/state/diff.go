@@ -0,0 +1,343 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+)
+
+var (
+	// ErrDiffConflict is returned by ApplyDiff if the state a diff was recorded
+	// against doesn't match the state it is applied to.
+	ErrDiffConflict = errors.New("state diff conflicts with current state")
+
+	// ErrDiffNotConserved is returned by ApplyDiff if a diff creates or destroys
+	// native value or tokens.
+	ErrDiffNotConserved = errors.New("state diff does not conserve value")
+
+	// ErrDiffUnsorted is returned by ApplyDiff if the accounts of a diff are not
+	// strictly sorted by address, listing an account more than once.
+	ErrDiffUnsorted = errors.New("state diff accounts not strictly sorted")
+)
+
+// StateDiff is the effect of executing a message, recorded from the journal of
+// the executing StateDB so it can be replayed on another one without running
+// the EVM again.
+type StateDiff struct {
+	Accounts []*AccountDiff // Modified accounts, strictly sorted by address
+	Logs     []*types.Log   // Logs emitted by the execution
+}
+
+// Sorted returns whether the accounts of the diff are strictly sorted by address,
+// so that no account is listed twice. Every check of an account diff is done
+// against the state before the diff, so a repeated account could pass them with
+// each of its entries and still be overdrawn by all of them together.
+func (diff *StateDiff) Sorted() bool {
+	for i := 1; i < len(diff.Accounts); i++ {
+		if bytes.Compare(diff.Accounts[i-1].Address[:], diff.Accounts[i].Address[:]) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AccountDiff holds the value of a modified account before and after the
+// execution. Balances are applied as deltas, all other fields require the
+// previous value to match.
+type AccountDiff struct {
+	Address      common.Address
+	Created      bool // Account was (re)created, clearing its storage
+	Suicided     bool
+	PrevNonce    uint64
+	Nonce        uint64
+	PrevBalance  *big.Int
+	Balance      *big.Int
+	PrevTokens   []TokenBalance
+	Tokens       []TokenBalance
+	PrevCodeHash common.Hash
+	CodeHash     common.Hash
+	Code         []byte // New code of the account, only set if CodeHash changed
+	Storage      []StorageDiff
+}
+
+// StorageDiff is a written storage slot of an account.
+type StorageDiff struct {
+	Key   common.Hash
+	Prev  common.Hash
+	Value common.Hash
+}
+
+// JournalDiff returns the changes recorded in the journal since the last call
+// to Finalise. It has to be called before the state is finalised.
+func (self *StateDB) JournalDiff() *StateDiff {
+	var (
+		accounts = make(map[common.Address]*AccountDiff)
+		tokens   = make(map[common.Address]map[uint64]*big.Int)
+		storage  = make(map[common.Address]map[common.Hash]common.Hash)
+	)
+	// Start out with the current values as both old and new ones
+	touch := func(addr common.Address) *AccountDiff {
+		if diff, ok := accounts[addr]; ok {
+			return diff
+		}
+		obj := self.stateObjects[addr]
+		if obj == nil {
+			return nil
+		}
+		diff := &AccountDiff{
+			Address:      addr,
+			Suicided:     obj.suicided,
+			PrevNonce:    obj.data.Nonce,
+			Nonce:        obj.data.Nonce,
+			PrevBalance:  obj.data.Balance,
+			Balance:      obj.data.Balance,
+			Tokens:       obj.data.Tokens,
+			PrevCodeHash: common.BytesToHash(obj.data.CodeHash),
+			CodeHash:     common.BytesToHash(obj.data.CodeHash),
+		}
+		accounts[addr] = diff
+		tokens[addr] = make(map[uint64]*big.Int)
+		for _, token := range obj.data.Tokens {
+			tokens[addr][token.Id] = token.Balance
+		}
+		storage[addr] = make(map[common.Hash]common.Hash)
+		return diff
+	}
+	// Walk the journal backwards, so that the first change of a field wins
+	for i := len(self.journal.entries) - 1; i >= 0; i-- {
+		switch ch := self.journal.entries[i].(type) {
+		case createObjectChange:
+			if diff := touch(*ch.account); diff != nil {
+				diff.Created = true
+				diff.PrevNonce, diff.PrevBalance, diff.PrevCodeHash = 0, common.Big0, common.BytesToHash(emptyCodeHash)
+				tokens[*ch.account] = make(map[uint64]*big.Int)
+			}
+		case resetObjectChange:
+			if diff := touch(ch.prev.address); diff != nil {
+				diff.Created = true
+				diff.PrevNonce, diff.PrevBalance, diff.PrevCodeHash = ch.prev.data.Nonce, ch.prev.data.Balance, common.BytesToHash(ch.prev.data.CodeHash)
+				tokens[ch.prev.address] = make(map[uint64]*big.Int)
+				for _, token := range ch.prev.data.Tokens {
+					tokens[ch.prev.address][token.Id] = token.Balance
+				}
+			}
+		case suicideChange:
+			if diff := touch(*ch.account); diff != nil {
+				diff.PrevBalance = ch.prevbalance
+			}
+		case balanceChange:
+			if diff := touch(*ch.account); diff != nil {
+				diff.PrevBalance = ch.prev
+			}
+		case tokenBalanceChange:
+			if diff := touch(*ch.account); diff != nil {
+				tokens[*ch.account][ch.token] = ch.prev
+			}
+		case nonceChange:
+			if diff := touch(*ch.account); diff != nil {
+				diff.PrevNonce = ch.prev
+			}
+		case storageChange:
+			if diff := touch(*ch.account); diff != nil {
+				storage[*ch.account][ch.key] = ch.prevalue
+			}
+		case codeChange:
+			if diff := touch(*ch.account); diff != nil {
+				diff.PrevCodeHash = common.BytesToHash(ch.prevhash)
+			}
+		default:
+			if addr := ch.dirtied(); addr != nil {
+				touch(*addr)
+			}
+		}
+	}
+	// Assemble the diffs in a deterministic order
+	result := &StateDiff{Logs: self.logs[self.thash]}
+	for addr, diff := range accounts {
+		obj := self.stateObjects[addr]
+		if diff.CodeHash != diff.PrevCodeHash {
+			diff.Code = common.CopyBytes(obj.Code(self.db))
+		}
+		for id, balance := range tokens[addr] {
+			diff.PrevTokens = append(diff.PrevTokens, TokenBalance{Id: id, Balance: balance})
+		}
+		sort.Slice(diff.PrevTokens, func(i, j int) bool { return diff.PrevTokens[i].Id < diff.PrevTokens[j].Id })
+
+		for key, prev := range storage[addr] {
+			diff.Storage = append(diff.Storage, StorageDiff{Key: key, Prev: prev, Value: obj.GetState(self.db, key)})
+		}
+		sort.Slice(diff.Storage, func(i, j int) bool { return bytes.Compare(diff.Storage[i].Key[:], diff.Storage[j].Key[:]) < 0 })
+
+		result.Accounts = append(result.Accounts, diff)
+	}
+	sort.Slice(result.Accounts, func(i, j int) bool {
+		return bytes.Compare(result.Accounts[i].Address[:], result.Accounts[j].Address[:]) < 0
+	})
+	return result
+}
+
+// ApplyDiff replays a diff recorded by JournalDiff on another state. Nonces,
+// code and written storage slots must still hold their previous values, while
+// balances are adjusted by the recorded delta. If any check fails, nothing is
+// applied and ErrDiffConflict is returned.
+//
+// Executing a message only moves value between accounts, the gas fee included,
+// which the sender pays to the coinbase within the same diff. A diff whose
+// balance or token deltas don't sum up to zero is rejected with
+// ErrDiffNotConserved, one listing an account more than once with
+// ErrDiffUnsorted. The logs of the diff are added to the transaction set with
+// Prepare.
+func (self *StateDB) ApplyDiff(diff *StateDiff) error {
+	if !diff.Sorted() {
+		return ErrDiffUnsorted
+	}
+	for _, acc := range diff.Accounts {
+		if err := self.checkAccountDiff(acc); err != nil {
+			return err
+		}
+	}
+	if !diffConserved(diff) {
+		return ErrDiffNotConserved
+	}
+	for _, acc := range diff.Accounts {
+		if acc.Created {
+			self.CreateAccount(acc.Address)
+		}
+		if acc.Nonce != acc.PrevNonce {
+			self.SetNonce(acc.Address, acc.Nonce)
+		}
+		// Touch the account even if its balance is unchanged, so empty accounts
+		// are cleared the same way as on the recording state
+		self.AddBalance(acc.Address, common.Big0)
+		if acc.Balance.Cmp(acc.PrevBalance) != 0 {
+			self.SetBalance(acc.Address, applyDelta(self.GetBalance(acc.Address), acc.PrevBalance, acc.Balance))
+		}
+		for id, delta := range tokenDeltas(acc) {
+			if delta[1].Cmp(delta[0]) != 0 {
+				self.SetTokenBalance(acc.Address, id, applyDelta(self.GetTokenBalance(acc.Address, id), delta[0], delta[1]))
+			}
+		}
+		if acc.CodeHash != acc.PrevCodeHash {
+			self.SetCode(acc.Address, acc.Code)
+		}
+		for _, slot := range acc.Storage {
+			self.SetState(acc.Address, slot.Key, slot.Value)
+		}
+		if acc.Suicided {
+			self.Suicide(acc.Address)
+		}
+	}
+	for _, log := range diff.Logs {
+		self.AddLog(&types.Log{Address: log.Address, Topics: log.Topics, Data: log.Data})
+	}
+	return nil
+}
+
+// checkAccountDiff verifies that a diff of an account can be applied.
+func (self *StateDB) checkAccountDiff(acc *AccountDiff) error {
+	if acc.PrevBalance == nil || acc.Balance == nil {
+		return ErrDiffConflict
+	}
+	codeHash := common.BytesToHash(emptyCodeHash)
+	if obj := self.getStateObject(acc.Address); obj != nil {
+		codeHash = common.BytesToHash(obj.CodeHash())
+	}
+	if (acc.Created || acc.Nonce != acc.PrevNonce) && self.GetNonce(acc.Address) != acc.PrevNonce {
+		return ErrDiffConflict
+	}
+	if (acc.Created || acc.CodeHash != acc.PrevCodeHash) && codeHash != acc.PrevCodeHash {
+		return ErrDiffConflict
+	}
+	if acc.CodeHash != acc.PrevCodeHash && crypto.Keccak256Hash(acc.Code) != acc.CodeHash {
+		return ErrDiffConflict
+	}
+	if !acc.Created {
+		for _, slot := range acc.Storage {
+			if self.GetState(acc.Address, slot.Key) != slot.Prev {
+				return ErrDiffConflict
+			}
+		}
+	}
+	if applyDelta(self.GetBalance(acc.Address), acc.PrevBalance, acc.Balance).Sign() < 0 {
+		return ErrDiffConflict
+	}
+	for id, delta := range tokenDeltas(acc) {
+		if delta[0] == nil || delta[1] == nil || applyDelta(self.GetTokenBalance(acc.Address, id), delta[0], delta[1]).Sign() < 0 {
+			return ErrDiffConflict
+		}
+	}
+	return nil
+}
+
+// diffConserved returns whether the balance and token deltas of all accounts of
+// a diff sum up to zero. The balances must have been checked for nil values.
+func diffConserved(diff *StateDiff) bool {
+	var (
+		balance = new(big.Int)
+		tokens  = make(map[uint64]*big.Int)
+	)
+	for _, acc := range diff.Accounts {
+		balance.Add(balance, acc.Balance)
+		balance.Sub(balance, acc.PrevBalance)
+
+		for id, delta := range tokenDeltas(acc) {
+			if tokens[id] == nil {
+				tokens[id] = new(big.Int)
+			}
+			tokens[id].Add(tokens[id], delta[1])
+			tokens[id].Sub(tokens[id], delta[0])
+		}
+	}
+	if balance.Sign() != 0 {
+		return false
+	}
+	for _, sum := range tokens {
+		if sum.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDelta returns balance + (post - prev).
+func applyDelta(balance, prev, post *big.Int) *big.Int {
+	delta := new(big.Int).Sub(post, prev)
+	return delta.Add(delta, balance)
+}
+
+// tokenDeltas pairs the previous and new balance of every token in a diff.
+func tokenDeltas(acc *AccountDiff) map[uint64][2]*big.Int {
+	deltas := make(map[uint64][2]*big.Int)
+	for _, token := range acc.PrevTokens {
+		deltas[token.Id] = [2]*big.Int{token.Balance, common.Big0}
+	}
+	for _, token := range acc.Tokens {
+		prev := common.Big0
+		if delta, ok := deltas[token.Id]; ok {
+			prev = delta[0]
+		}
+		deltas[token.Id] = [2]*big.Int{prev, token.Balance}
+	}
+	return deltas
+}
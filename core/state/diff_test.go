@@ -0,0 +1,177 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Tests that a diff recorded on one state reproduces the same changes on an
+// identical one, and that conflicting diffs are rejected as a whole.
+func TestJournalDiff(t *testing.T) {
+	var (
+		sender   = toAddr([]byte("sender"))
+		contract = toAddr([]byte("contract"))
+		created  = toAddr([]byte("created"))
+		slot     = common.HexToHash("01")
+	)
+	db := NewDatabase(ethdb.NewMemDatabase())
+	base, _ := New(common.Hash{}, db)
+	base.SetBalance(sender, big.NewInt(1000))
+	base.SetNonce(sender, 3)
+	base.AddTokenBalance(sender, 5, big.NewInt(50))
+	base.SetCode(contract, []byte{0x60, 0x00})
+	base.SetState(contract, slot, common.HexToHash("aa"))
+	root, _ := base.Commit(true)
+
+	// Record a set of changes on the shard state
+	shard, _ := New(root, db)
+	shard.Prepare(common.HexToHash("beef"), common.Hash{}, 0)
+	shard.SetNonce(sender, 4)
+	shard.SubBalance(sender, big.NewInt(100))
+	shard.AddBalance(contract, big.NewInt(100))
+	shard.SubTokenBalance(sender, 5, big.NewInt(20))
+	shard.AddTokenBalance(contract, 5, big.NewInt(20))
+	shard.SetState(contract, slot, common.HexToHash("bb"))
+	shard.CreateAccount(created)
+	shard.SetCode(created, []byte{0x60, 0x01})
+	shard.AddLog(&types.Log{Address: contract, Data: []byte{1}})
+
+	diff := shard.JournalDiff()
+	shard.Finalise(true)
+
+	enc, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		t.Fatalf("failed to encode diff: %v", err)
+	}
+	decoded := new(StateDiff)
+	if err := rlp.DecodeBytes(enc, decoded); err != nil {
+		t.Fatalf("failed to decode diff: %v", err)
+	}
+	// Replaying it on the master must yield the same state
+	master, _ := New(root, db)
+	master.Prepare(common.HexToHash("beef"), common.Hash{}, 0)
+	if err := master.ApplyDiff(decoded); err != nil {
+		t.Fatalf("failed to apply diff: %v", err)
+	}
+	master.Finalise(true)
+	if have, want := master.IntermediateRoot(true), shard.IntermediateRoot(true); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if logs := master.GetLogs(common.HexToHash("beef")); len(logs) != 1 || logs[0].Address != contract {
+		t.Fatalf("log mismatch: have %v", logs)
+	}
+	// Balances are applied as deltas on top of other changes
+	master, _ = New(root, db)
+	master.AddBalance(contract, big.NewInt(7))
+	if err := master.ApplyDiff(decoded); err != nil {
+		t.Fatalf("failed to apply diff after balance change: %v", err)
+	}
+	if balance := master.GetBalance(contract); balance.Cmp(big.NewInt(107)) != 0 {
+		t.Fatalf("balance mismatch: have %v, want 107", balance)
+	}
+	// Diffs creating value out of thin air must be rejected
+	master, _ = New(root, db)
+	for _, acc := range decoded.Accounts {
+		if acc.Address == contract {
+			acc.Balance = new(big.Int).Add(acc.Balance, big.NewInt(1))
+		}
+	}
+	if err := master.ApplyDiff(decoded); err != ErrDiffNotConserved {
+		t.Fatalf("minting diff error mismatch: have %v, want %v", err, ErrDiffNotConserved)
+	}
+	for _, acc := range decoded.Accounts {
+		if acc.Address == contract {
+			acc.Balance = new(big.Int).Sub(acc.Balance, big.NewInt(1))
+			acc.Tokens = append([]TokenBalance{}, acc.Tokens...)
+			for i := range acc.Tokens {
+				acc.Tokens[i].Balance = new(big.Int).Add(acc.Tokens[i].Balance, big.NewInt(1))
+			}
+		}
+	}
+	if err := master.ApplyDiff(decoded); err != ErrDiffNotConserved {
+		t.Fatalf("token minting diff error mismatch: have %v, want %v", err, ErrDiffNotConserved)
+	}
+	if balance := master.GetBalance(contract); balance.Sign() != 0 {
+		t.Fatalf("unbalanced diff partially applied, balance %v", balance)
+	}
+	decoded = new(StateDiff)
+	rlp.DecodeBytes(enc, decoded)
+
+	// Written storage must not have been changed
+	master, _ = New(root, db)
+	master.SetState(contract, slot, common.HexToHash("cc"))
+	if err := master.ApplyDiff(decoded); err != ErrDiffConflict {
+		t.Fatalf("conflicting diff applied: %v", err)
+	}
+	if nonce := master.GetNonce(sender); nonce != 3 {
+		t.Fatalf("conflicting diff partially applied, nonce %d", nonce)
+	}
+}
+
+// Tests that diffs listing an account twice are rejected, as every entry would
+// pass the checks against the state before the diff on its own.
+func TestApplyDiffDuplicateAccount(t *testing.T) {
+	var (
+		sender   = toAddr([]byte("sender"))
+		receiver = toAddr([]byte("receiver"))
+	)
+	db := NewDatabase(ethdb.NewMemDatabase())
+	base, _ := New(common.Hash{}, db)
+	base.SetBalance(sender, big.NewInt(6))
+	base.SetNonce(sender, 1)
+	root, _ := base.Commit(true)
+
+	// Both debits fit the balance of 6, together they overdraw it
+	debit := func(nonce uint64) *AccountDiff {
+		return &AccountDiff{Address: sender, PrevNonce: nonce, Nonce: nonce + 1, PrevBalance: big.NewInt(6), Balance: big.NewInt(1)}
+	}
+	credit := &AccountDiff{Address: receiver, PrevBalance: new(big.Int), Balance: big.NewInt(10)}
+
+	diff := &StateDiff{Accounts: []*AccountDiff{debit(1), debit(1), credit}}
+	if diff.Sorted() {
+		t.Errorf("diff with duplicate account reported sorted")
+	}
+	master, _ := New(root, db)
+	if err := master.ApplyDiff(diff); err != ErrDiffUnsorted {
+		t.Fatalf("duplicate account error mismatch: have %v, want %v", err, ErrDiffUnsorted)
+	}
+	if balance := master.GetBalance(sender); balance.Cmp(big.NewInt(6)) != 0 {
+		t.Fatalf("duplicate account diff partially applied, balance %v", balance)
+	}
+	// Neither can a second entry bump the nonce once more
+	diff = &StateDiff{Accounts: []*AccountDiff{debit(1), debit(2)}}
+	diff.Accounts[1].Balance = diff.Accounts[1].PrevBalance
+	if err := master.ApplyDiff(diff); err != ErrDiffUnsorted {
+		t.Fatalf("duplicate nonce bump error mismatch: have %v, want %v", err, ErrDiffUnsorted)
+	}
+	// Accounts out of order are rejected as well
+	diff = &StateDiff{Accounts: []*AccountDiff{credit, debit(1)}}
+	if bytes.Compare(receiver[:], sender[:]) < 0 {
+		diff.Accounts[0], diff.Accounts[1] = diff.Accounts[1], diff.Accounts[0]
+	}
+	if err := master.ApplyDiff(diff); err != ErrDiffUnsorted {
+		t.Fatalf("unsorted diff error mismatch: have %v, want %v", err, ErrDiffUnsorted)
+	}
+}
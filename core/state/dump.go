@@ -32,6 +32,7 @@ type DumpAccount struct {
 	CodeHash string            `json:"codeHash"`
 	Code     string            `json:"code"`
 	Storage  map[string]string `json:"storage"`
+	Tokens   map[uint64]string `json:"tokens,omitempty"`
 }
 
 type Dump struct {
@@ -62,6 +63,12 @@ func (self *StateDB) RawDump() Dump {
 			Code:     common.Bytes2Hex(obj.Code(self.db)),
 			Storage:  make(map[string]string),
 		}
+		for _, token := range data.Tokens {
+			if account.Tokens == nil {
+				account.Tokens = make(map[uint64]string)
+			}
+			account.Tokens[token.Id] = token.Balance.String()
+		}
 		storageIt := trie.NewIterator(obj.getTrie(self.db).NodeIterator(nil))
 		for storageIt.Next() {
 			account.Storage[common.Bytes2Hex(self.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(storageIt.Value)
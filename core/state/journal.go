@@ -103,6 +103,11 @@ type (
 		account *common.Address
 		prev    *big.Int
 	}
+	tokenBalanceChange struct {
+		account *common.Address
+		token   uint64
+		prev    *big.Int
+	}
 	nonceChange struct {
 		account *common.Address
 		prev    uint64
@@ -179,6 +184,14 @@ func (ch balanceChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch tokenBalanceChange) revert(s *StateDB) {
+	s.getStateObject(*ch.account).setTokenBalance(ch.token, ch.prev)
+}
+
+func (ch tokenBalanceChange) dirtied() *common.Address {
+	return ch.account
+}
+
 func (ch nonceChange) revert(s *StateDB) {
 	s.getStateObject(*ch.account).setNonce(ch.prev)
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"sort"
 
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/crypto"
@@ -90,7 +91,7 @@ type stateObject struct {
 
 // empty returns whether the account is considered empty.
 func (s *stateObject) empty() bool {
-	return s.data.Nonce == 0 && s.data.Balance.Sign() == 0 && bytes.Equal(s.data.CodeHash, emptyCodeHash)
+	return s.data.Nonce == 0 && s.data.Balance.Sign() == 0 && len(s.data.Tokens) == 0 && bytes.Equal(s.data.CodeHash, emptyCodeHash)
 }
 
 // Account is the Ethereum consensus representation of accounts.
@@ -100,6 +101,15 @@ type Account struct {
 	Balance  *big.Int
 	Root     common.Hash // merkle root of the storage trie
 	CodeHash []byte
+	Tokens   []TokenBalance `rlp:"tail"` // non native token balances, sorted by id
+}
+
+// TokenBalance is the balance of an account in a non native token. Zero
+// balances are never stored, so accounts without tokens keep the legacy
+// four field encoding.
+type TokenBalance struct {
+	Id      uint64
+	Balance *big.Int
 }
 
 // newObject creates a state object.
@@ -293,6 +303,72 @@ func (self *stateObject) setBalance(amount *big.Int) {
 	self.data.Balance = amount
 }
 
+// TokenBalance returns the balance of c in the non native token id.
+func (c *stateObject) TokenBalance(id uint64) *big.Int {
+	if i, ok := c.tokenIndex(id); ok {
+		return c.data.Tokens[i].Balance
+	}
+	return common.Big0
+}
+
+// AddTokenBalance adds amount to c's balance in the token id.
+func (c *stateObject) AddTokenBalance(id uint64, amount *big.Int) {
+	if amount.Sign() == 0 {
+		if c.empty() {
+			c.touch()
+		}
+		return
+	}
+	c.SetTokenBalance(id, new(big.Int).Add(c.TokenBalance(id), amount))
+}
+
+// SubTokenBalance removes amount from c's balance in the token id.
+func (c *stateObject) SubTokenBalance(id uint64, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	c.SetTokenBalance(id, new(big.Int).Sub(c.TokenBalance(id), amount))
+}
+
+func (self *stateObject) SetTokenBalance(id uint64, amount *big.Int) {
+	self.db.journal.append(tokenBalanceChange{
+		account: &self.address,
+		token:   id,
+		prev:    new(big.Int).Set(self.TokenBalance(id)),
+	})
+	self.setTokenBalance(id, amount)
+}
+
+// setTokenBalance replaces the token list instead of modifying it in place, as
+// copies of the state object share the underlying array.
+func (self *stateObject) setTokenBalance(id uint64, amount *big.Int) {
+	old := self.data.Tokens
+	i, found := self.tokenIndex(id)
+
+	tokens := make([]TokenBalance, 0, len(old)+1)
+	tokens = append(tokens, old[:i]...)
+	if amount.Sign() != 0 {
+		tokens = append(tokens, TokenBalance{Id: id, Balance: amount})
+	}
+	if found {
+		i++
+	}
+	tokens = append(tokens, old[i:]...)
+
+	if len(tokens) == 0 {
+		tokens = nil
+	}
+	self.data.Tokens = tokens
+}
+
+// tokenIndex returns the position of the token id in the sorted token list, or
+// the position it would be inserted at if the account doesn't hold it.
+func (c *stateObject) tokenIndex(id uint64) (int, bool) {
+	tokens := c.data.Tokens
+	i := sort.Search(len(tokens), func(i int) bool { return tokens[i].Id >= id })
+	return i, i < len(tokens) && tokens[i].Id == id
+}
+
 // Return the gas back to the origin. Used by the Virtual machine or Closures
 func (c *stateObject) ReturnGas(gas *big.Int) {}
 
@@ -24,6 +24,7 @@ import (
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/crypto"
 	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/rlp"
 	checker "gopkg.in/check.v1"
 )
 
@@ -196,6 +197,44 @@ func TestSnapshot2(t *testing.T) {
 	}
 }
 
+func TestTokenBalance(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(ethdb.NewMemDatabase()))
+	addr := toAddr([]byte("tokens"))
+
+	// token 0 is the native balance
+	state.AddTokenBalance(addr, 0, big.NewInt(10))
+	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(10)) != 0 {
+		t.Fatalf("native balance mismatch: have %v, want 10", balance)
+	}
+	state.AddTokenBalance(addr, 7, big.NewInt(70))
+	state.AddTokenBalance(addr, 3, big.NewInt(30))
+
+	snapshot := state.Snapshot()
+	state.SubTokenBalance(addr, 3, big.NewInt(30))
+	state.AddTokenBalance(addr, 5, big.NewInt(50))
+	if tokens := state.getStateObject(addr).data.Tokens; len(tokens) != 2 || tokens[0].Id != 5 || tokens[1].Id != 7 {
+		t.Fatalf("token list mismatch: have %v", tokens)
+	}
+	state.RevertToSnapshot(snapshot)
+
+	root, _ := state.Commit(false)
+	state, _ = New(root, state.db)
+	for token, want := range map[uint64]int64{0: 10, 3: 30, 5: 0, 7: 70} {
+		if balance := state.GetTokenBalance(addr, token); balance.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("token %d balance mismatch: have %v, want %d", token, balance, want)
+		}
+	}
+	// accounts without tokens keep the legacy encoding
+	state.SubTokenBalance(addr, 3, big.NewInt(30))
+	state.SubTokenBalance(addr, 7, big.NewInt(70))
+	obj := state.getStateObject(addr)
+	enc, _ := rlp.EncodeToBytes(obj)
+	legacy, _ := rlp.EncodeToBytes([]interface{}{obj.data.Nonce, obj.data.Balance, obj.data.Root, obj.data.CodeHash})
+	if !bytes.Equal(enc, legacy) {
+		t.Errorf("account encoding mismatch: have %x, want %x", enc, legacy)
+	}
+}
+
 func compareStateObjects(so0, so1 *stateObject, t *testing.T) {
 	if so0.Address() != so1.Address() {
 		t.Fatalf("Address mismatch: have %v, want %v", so0.address, so1.address)
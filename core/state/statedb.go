@@ -209,6 +209,19 @@ func (self *StateDB) GetBalance(addr common.Address) *big.Int {
 	return common.Big0
 }
 
+// GetTokenBalance retrieves the balance of addr in the given token. The native
+// token id maps to the EDX balance of the account.
+func (self *StateDB) GetTokenBalance(addr common.Address, token uint64) *big.Int {
+	if token == types.NativeTokenId {
+		return self.GetBalance(addr)
+	}
+	stateObject := self.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.TokenBalance(token)
+	}
+	return common.Big0
+}
+
 func (self *StateDB) GetNonce(addr common.Address) uint64 {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -336,6 +349,41 @@ func (self *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 	}
 }
 
+// AddTokenBalance adds amount to the balance of addr in the given token.
+func (self *StateDB) AddTokenBalance(addr common.Address, token uint64, amount *big.Int) {
+	if token == types.NativeTokenId {
+		self.AddBalance(addr, amount)
+		return
+	}
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.AddTokenBalance(token, amount)
+	}
+}
+
+// SubTokenBalance subtracts amount from the balance of addr in the given token.
+func (self *StateDB) SubTokenBalance(addr common.Address, token uint64, amount *big.Int) {
+	if token == types.NativeTokenId {
+		self.SubBalance(addr, amount)
+		return
+	}
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SubTokenBalance(token, amount)
+	}
+}
+
+func (self *StateDB) SetTokenBalance(addr common.Address, token uint64, amount *big.Int) {
+	if token == types.NativeTokenId {
+		self.SetBalance(addr, amount)
+		return
+	}
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetTokenBalance(token, amount)
+	}
+}
+
 func (self *StateDB) SetNonce(addr common.Address, nonce uint64) {
 	stateObject := self.GetOrNewStateObject(addr)
 	if stateObject != nil {
@@ -455,7 +503,7 @@ func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObjec
 }
 
 // CreateAccount explicitly creates a state object. If a state object with the address
-// already exists the balance is carried over to the new account.
+// already exists the native and token balances are carried over to the new account.
 //
 // CreateAccount is called during the EVM CREATE operation. The situation might arise that
 // a contract does the following:
@@ -468,6 +516,7 @@ func (self *StateDB) CreateAccount(addr common.Address) {
 	new, prev := self.createObject(addr)
 	if prev != nil {
 		new.setBalance(prev.data.Balance)
+		new.data.Tokens = prev.data.Tokens
 	}
 }
 
@@ -17,7 +17,10 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
+
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/consensus"
 	"github.com/EDXFund/MasterChain/consensus/misc"
@@ -28,6 +31,7 @@ import (
 	"github.com/EDXFund/MasterChain/crypto"
 	"github.com/EDXFund/MasterChain/log"
 	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
 )
 
 // StateProcessor is a basic Processor, which takes care of transitioning
@@ -42,12 +46,21 @@ type StateProcessor struct {
 }
 
 const  (
-	TT_COMMON    = byte(1)
+	TT_COMMON    = byte(iota + 1)
 	TT_TOKEN_C
 	TT_CONTRACT_TEMP
 	TT_CONTRACT_INST
 	TT_CONTRACT_CALL
 )
+
+// Instruction types of the two phases of a cross shard value transfer
+const (
+	TT_XSHARD_OUT = byte(0x10) // source shard debits the sender into escrow
+	TT_XSHARD_IN  = byte(0x11) // destination shard claims the escrowed value
+)
+
+// TT_MDC_RECEIPT redeems the access receipts of a data custody provider
+const TT_MDC_RECEIPT = byte(0x20)
 type Instruction struct {
 	TxType byte
 	TxHash common.Hash
@@ -65,27 +78,30 @@ type InstructTokenCreate struct {
 
 	SrcAccount common.Address
 	TokenId	   uint64
+	Supply     *big.Int // amount issued to SrcAccount
+	Cap        *big.Int // maximum supply, zero for a fixed supply
 	VerifyCode	   []byte
 }
 type InstructContractCreate struct {
 
 	SrcAccount common.Address
-	TemplateId	   uint64
-	ContractData	   []byte
+	Template   common.Address // address the template code was deployed at
+	CodeHash   common.Hash
+	Failed     bool
 }
 type InstructContractInstance struct {
 
 	SrcAccount common.Address
-	TemplateId	   uint64
-	ContractInst   uint64
+	Template   common.Address   // contract creating the instances
+	Instances  []common.Address // contracts created by the call
 }
 type InstructContractCall struct {
 	TxHash common.Hash
 	SrcAccount common.Address
-	TemplateId	   uint64
-	ContractInst   uint64
+	Contract   common.Address
 	GasUsed        uint64
 	DataResult	   []byte
+	Failed     bool
 }
 // NewStateProcessor initialises a new StateProcessor.
 func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consensus.Engine, txPool TxPoolIntf) *StateProcessor {
@@ -104,8 +120,8 @@ func (p *StateProcessor) Process(block types.BlockIntf, statedb *state.StateDB,
 	if p.bc.shardId == types.ShardMaster{
 		return p.MasterProcessMasterBlock(block,statedb,cfg)
 	}else {
-		return nil,nil,0,nil,nil
-		//return p.ShardProcessShardBlock(block,statedb,cfg)
+		logs, usedGas, err := p.ShardProcessShardBlock(block, statedb, cfg)
+		return nil, logs, usedGas, nil, err
 	}
 }
 // Process processes the state changes according to the Ethereum rules by running
@@ -115,9 +131,10 @@ func (p *StateProcessor) Process(block types.BlockIntf, statedb *state.StateDB,
 // Process returns the receipts and logs accumulated during the process and
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
-func (p *StateProcessor) MasterProcessShardBlock(block types.BlockIntf, statedb *state.StateDB, cfg vm.Config, gasLimited uint64,usedGas *uint64) (types.Receipts, []*types.Log, uint64, error) {
+func (p *StateProcessor) MasterProcessShardBlock(block types.BlockIntf, statedb *state.StateDB, cfg vm.Config, gasLimited uint64,usedGas *uint64) (types.Receipts, []*types.RejectedTx, []*types.Log, uint64, error) {
 	var (
 		receipts types.Receipts
+		rejected []*types.RejectedTx
 
 		header   = block.Header()
 		allLogs  []*types.Log
@@ -125,7 +142,7 @@ func (p *StateProcessor) MasterProcessShardBlock(block types.BlockIntf, statedb
 	)
 
 	if block.ShardId() == types.ShardMaster {
-		return nil,nil,0,ErrInvalidBlocks
+		return nil,nil,nil,0,ErrInvalidBlocks
 	}
 	/*str := fmt.Sprintln("proc instr: ","shardId:",block.ShardId(),"number:",block.NumberU64())
 	fname := "./state_proc.txt"
@@ -141,74 +158,190 @@ func (p *StateProcessor) MasterProcessShardBlock(block types.BlockIntf, statedb
 		misc.ApplyDAOHardFork(statedb)
 	}
 
-	if p.txPool == nil {
-		log.Crit("Master processor must set txPool")
-		return nil,nil,0,ErrNoTxPool
+	// Resolve the transactions of all results first, the ones the master never
+	// received are fetched from the shard
+	txs, err := p.shardTxs(block)
+	if err != nil {
+		return nil, nil, nil, 0, err
 	}
 	// Iterate over and process the individual transactions
 	for i, instruct := range block.Results() {
-		if instruct.TxType == TT_COMMON {
-			tx := p.txPool.Get(instruct.TxHash)
-			//get hash from pool
+		var (
+			receipt *types.Receipt
+			err     error
+			tx      = txs[i]
+			snap    = statedb.Snapshot()
+			gas     = gp.Gas()
+		)
+		switch instruct.TxType {
+		case TT_COMMON:
 			statedb.Prepare(tx.Hash(), block.Hash(), i)
-			receipt, _, err := ApplyTransaction(p.config, p.bc, nil, gp, nil,statedb, header, tx, usedGas, cfg)
+			receipt, _, err = ApplyTransaction(p.config, p.bc, nil, gp, nil,statedb, header, tx, usedGas, cfg)
 			/*str := fmt.Sprintf("%v,%v\r\n",tx.Hash(),*receipt)
 			f.WriteString(str)*/
-			if err != nil {
-				return nil, nil, 0, err
+		case TT_TOKEN_C:
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err = applyTokenCreate(p.config, p.bc, nil, gp, statedb, header, tx, instruct, usedGas, cfg)
+		case TT_MDC_RECEIPT:
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err = applyAccessReceipts(p.config, p.bc, nil, gp, statedb, header, tx, instruct, usedGas, cfg)
+		case TT_CONTRACT_TEMP, TT_CONTRACT_INST, TT_CONTRACT_CALL:
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err = p.applyContractResult(gp, statedb, header, tx, instruct, usedGas, cfg)
+		case TT_XSHARD_OUT:
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err = applyCrossShardOut(p.config, p.bc, nil, gp, statedb, header, tx, instruct, usedGas, cfg)
+		case TT_XSHARD_IN:
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err = applyCrossShardIn(p.config, p.bc, p.bc, nil, gp, statedb, header, tx, usedGas, cfg, true)
+		default:
+			continue
+		}
+		if err != nil {
+			if !isRejectable(err) {
+				return nil, nil, nil, 0, err
 			}
-			receipts = append(receipts, receipt)
-			allLogs = append(allLogs, receipt.Logs...)
+			// The shard included a transaction the master can't apply, record
+			// it as rejected instead of refusing the whole block
+			statedb.RevertToSnapshot(snap)
+			*gp = GasPool(gas)
+			rejected = append(rejected, p.newRejectedTx(block, tx, i, header, err))
+			continue
 		}
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	// The shard header is sealed already, its rewards are accumulated by the
+	// master block including it
+	return receipts, rejected, allLogs, *usedGas,nil
+}
 
+// isRejectable reports whether a transaction failing with err is rejected by the
+// master, as opposed to invalidating the shard block including it.
+func isRejectable(err error) bool {
+	switch err {
+	case types.ErrInvalidSig, ErrNonceTooHigh, ErrNonceTooLow, ErrAccountNonceExists,
+		ErrInsufficientFunds, errInsufficientBalanceForGas, vm.ErrInsufficientBalance:
+		return true
 	}
-	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	p.engine.Finalize(p.bc, header, statedb,block.ShardBlocks(),block.Results(), block.Transactions(),  receipts)
+	return false
+}
 
-	return receipts, allLogs, *usedGas,nil
+// newRejectedTx creates the record of the i'th transaction of a shard block,
+// which the master refused to apply with err.
+func (p *StateProcessor) newRejectedTx(block types.BlockIntf, tx *types.Transaction, i int, header types.HeaderIntf, err error) *types.RejectedTx {
+	from, _ := types.Sender(types.MakeSigner(p.config, header.Number()), tx)
+	return &types.RejectedTx{
+		TxHash:    tx.Hash(),
+		From:      from,
+		ShardId:   block.ShardId(),
+		BlockHash: block.Hash(),
+		Index:     uint64(i),
+		Reason:    err.Error(),
+	}
 }
-/*
-func (p *StateProcessor) ShardProcessShardBlock(block types.BlockIntf, statedb *state.StateDB, cfg vm.Config) (types.ContractResults, uint64, error) {
-	var (
-		results types.ContractResults
-		usedGas  = new(uint64)
-		header   = block.Header()
-		//allLogs  []*types.Log
-		//gp       = new(GasPool).AddGas(block.GasLimit())
-	)
 
+// ShardProcessShardBlock executes the transactions of a shard block against the
+// state of the shard, regenerating every result of the block from the shard
+// state and the transaction it belongs to. The block is invalid if any of the
+// regenerated results differs from the one it carries.
+//
+// The shard state only follows the transactions included by the shard itself,
+// so balances credited by other shards show up there no earlier than their
+// cross shard claim. It returns the logs and the amount of gas used.
+func (p *StateProcessor) ShardProcessShardBlock(block types.BlockIntf, statedb *state.StateDB, cfg vm.Config) ([]*types.Log, uint64, error) {
 	if block.ShardId() == types.ShardMaster {
-		return nil,0,ErrInvalidBlocks
+		return nil, 0, ErrInvalidBlocks
 	}
 	// Mutate the block and state according to any hard-fork specs
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	txs, err := p.shardTxs(block)
+	if err != nil {
+		return nil, 0, err
+	}
+	master := p.bc.routingHeader(block.Header())
+	if master == nil {
+		return nil, 0, ErrUnknownMasterBlock
+	}
+	logs, usedGas, err := replayShardResults(p.config, p.bc, p.bc, master, statedb, block, txs, cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	p.engine.Finalize(p.bc, types.CopySHeader(block.Header().ToSHeader()), statedb, nil, block.Results(), nil, nil)
 
-	if p.txPool == nil {
-		log.Crit("Master processor must set txPool")
-		return nil,0,ErrNoTxPool
+	return logs, usedGas, nil
+}
+
+// localShardTx retrieves a transaction of a shard block result from the pool,
+// if the processor has one, or from the database.
+func (p *StateProcessor) localShardTx(hash common.Hash) *types.Transaction {
+	if p.txPool != nil {
+		if tx := p.txPool.Get(hash); tx != nil {
+			return tx
+		}
 	}
-	// Iterate over and process the individual transactions
-	for i, instruct := range block.Results() {
-		if instruct.TxType == TT_COMMON {
-			tx := p.txPool.Get(instruct.TxHash)
-			//get hash from pool
-			statedb.Prepare(tx.Hash(), block.Hash(), i)
-			result, _, err := ApplyToInstruction(p.config,  header, tx)
-			if err != nil {
-				return nil, 0, err
-			}
-			results = append(results, result)
+	if tx, err := rawdb.ReadRawTransaction(p.bc.db, hash); err == nil {
+		return tx
+	}
+	return nil
+}
 
+// missingShardTxs returns the transactions of the results of a shard block which
+// are neither in the pool nor in the database.
+func (p *StateProcessor) missingShardTxs(block types.BlockIntf) []common.Hash {
+	var missing []common.Hash
+	for _, instruct := range block.Results() {
+		if p.localShardTx(instruct.TxHash) == nil {
+			missing = append(missing, instruct.TxHash)
 		}
+	}
+	return missing
+}
 
+// shardTxs retrieves the transactions of the results of a shard block. It never
+// waits for the network: transactions missing locally are fetched before the
+// chain is locked for processing, and a block still lacking some of them fails
+// with ErrMissingShardTx until they arrive.
+func (p *StateProcessor) shardTxs(block types.BlockIntf) ([]*types.Transaction, error) {
+	txs := make([]*types.Transaction, len(block.Results()))
+	for i, instruct := range block.Results() {
+		if txs[i] = p.localShardTx(instruct.TxHash); txs[i] == nil {
+			log.Debug("Missing shard transaction", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash(), "tx", instruct.TxHash, "index", i)
+			return nil, ErrMissingShardTx
+		}
 	}
-	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	p.engine.Finalize(p.bc, header, statedb,block.ShardBlocks(),block.Results(), block.Transactions(),  results)
+	return txs, nil
+}
 
-	return results, *usedGas, nil
-}*/
+// replayShardResults regenerates the results of a shard block from txs on the
+// state of its parent, routing transactions by the layouts in force at the given
+// master header, and fails if any of them differs from the block.
+func replayShardResults(config *params.ChainConfig, bc ChainContext, router ShardRouter, master types.HeaderIntf, statedb *state.StateDB, block types.BlockIntf, txs []*types.Transaction, cfg vm.Config) ([]*types.Log, uint64, error) {
+	var (
+		usedGas = new(uint64)
+		header  = block.Header()
+		allLogs []*types.Log
+		gp      = new(GasPool).AddGas(block.GasLimit())
+	)
+	for i, instruct := range block.Results() {
+		tx := txs[i]
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		result, err := ApplyToInstruction(config, bc, router, master, statedb, header, tx, gp, usedGas, cfg)
+		if err != nil {
+			return nil, 0, err
+		}
+		have, _ := rlp.EncodeToBytes(instruct)
+		want, _ := rlp.EncodeToBytes(result)
+		if !bytes.Equal(have, want) {
+			return nil, 0, fmt.Errorf("invalid result %d of transaction %x", i, instruct.TxHash)
+		}
+		allLogs = append(allLogs, statedb.GetLogs(tx.Hash())...)
+	}
+	return allLogs, *usedGas, nil
+}
 
 // Process processes the state changes according to the Ethereum rules by running
 // the transaction messages using the statedb and applying any rewards to both
@@ -243,14 +376,16 @@ func (p *StateProcessor) MasterProcessMasterBlock(block types.BlockIntf, statedb
 		if shardBlock != nil {
 			receiptCnt += len(shardBlock.Results())
 			//fmt.Println("receipt cnt:", len(shardBlock.Results()))
-			areceipts, aallLogs, ausedGas, aerr := p.MasterProcessShardBlock(shardBlock.ToSBlock(),statedb,cfg,block.GasLimit(),gasOfBlock)
+			areceipts, arejected, aallLogs, ausedGas, aerr := p.MasterProcessShardBlock(shardBlock.ToSBlock(),statedb,cfg,block.GasLimit(),gasOfBlock)
 			if aerr == nil {
 				receipts = append(receipts, areceipts...)
 				allLogs = append(allLogs, aallLogs...)
 				*usedGas += ausedGas
-				infos = append(infos, ShardTxsStat{shardBlock.ShardId(),shardBlock.NumberU64(),shardBlock.Difficulty().Uint64(),uint64(len(shardBlock.Results()))})
+				info := NewShardTxsStat(shardBlock)
+				info.Rejected = arejected
+				infos = append(infos, info)
 			}else {
-				fmt.Println("error occurs:","err:",aerr)
+				return nil, nil, 0, nil, aerr
 			}
 		}
 	}
@@ -272,6 +407,13 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 	if err != nil {
 		return nil, 0, err
 	}
+	return applyMessage(config, bc, author, gp, shardbase, statedb, header, tx, msg, usedGas, cfg)
+}
+
+// applyMessage applies the message derived from tx to the state database and
+// creates the receipt of tx. Callers may rewrite the message (e.g. to redirect
+// a cross shard transfer into escrow) before handing it over.
+func applyMessage(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, shardbase *common.Address, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, msg types.Message, usedGas *uint64, cfg vm.Config) (*types.Receipt, uint64, error) {
 	// Create a new context to be used in the EVM environment
 	context := NewEVMContext(msg, header, bc, author)
 	// Create a new environment which holds all relevant information
@@ -308,27 +450,87 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 	return receipt, gas, err
 }
 
-// ApplyTransaction attempts to apply a transaction to the given state database
-// and uses the input parameters for its environment. It returns the receipt
-// for the transaction, gas used and an error if the transaction failed,
-// indicating the block was invalid.
-func ApplyToInstruction(config *params.ChainConfig, header types.HeaderIntf, tx *types.Transaction,gasPool *GasPool,gasUsed *uint64) (*types.ContractResult, error) {
+// ApplyToInstruction turns a transaction into the result a shard block carries
+// for it. Contract transactions are executed against the shard state statedb
+// (which may be nil), all others are left for the master to apply. Transactions
+// are routed by the shard layouts in force at the master header.
+func ApplyToInstruction(config *params.ChainConfig, bc ChainContext, router ShardRouter, master types.HeaderIntf, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction,gasPool *GasPool,gasUsed *uint64, cfg vm.Config) (*types.ContractResult, error) {
 	//check signiture
 	_, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
 	if err != nil {
 		return nil,  err
 	}
-
-	/*result := InstructCommon{msg.From(),*msg.To(),msg.TokenId(),msg.Value().Uint64()}
-	data,err := rlp.EncodeToBytes(result)
+	//only the shard owning the sender may include the tx
+	if router != nil {
+		if err := checkTxShard(router, master, tx, header.ShardId()); err != nil {
+			return nil, err
+		}
+	}
+	//token creation is executed by the master against the token registry
+	result, err := tokenInstruction(config, header, tx)
+	if result == nil && err == nil {
+		//access receipts pay data custody providers from their readers
+		result, err = mdcInstruction(config, header, tx)
+	}
+	if result == nil && err == nil {
+		//cross shard transfers are split into a debit and a later claim
+		result, err = crossShardInstruction(config, router, master, header, tx)
+	}
+	if result == nil && err == nil {
+		//contracts are executed by the shard, the master replays their state diff
+		if result, err = contractInstruction(config, bc, statedb, header, tx, gasPool, gasUsed, cfg); result != nil || err != nil {
+			return result, err
+		}
+		//it only normal call now, contract data
+		result = &types.ContractResult{TT_COMMON,tx.Hash(),tx.GasPrice().Uint64(),nil,nil}
+	}
 	if err != nil {
-		return nil,  err
-	}*/
-	gasPool.SubGas( uint64(21000))
-	*gasUsed += uint64(21000)
-	//it only normal call now, contract data
-	return &types.ContractResult{TT_COMMON,tx.Hash(),tx.GasPrice().Uint64(),nil,nil},nil
+		return nil, err
+	}
+	if err := applyShardResult(config, bc, router, statedb, header, tx, result, gasPool, gasUsed, cfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
+// applyShardResult applies a result left for the master to the shard state as
+// well, so that the shard keeps its own account state. The transaction runs
+// within the block gas pool gp, which is charged the gas it actually used. On
+// failure the state, the pool and usedGas are left untouched.
+func applyShardResult(config *params.ChainConfig, bc ChainContext, router ShardRouter, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, result *types.ContractResult, gp *GasPool, usedGas *uint64, cfg vm.Config) error {
+	if statedb == nil {
+		// Without a state only the cost of a plain transfer is known
+		if err := gp.SubGas(params.TxGas); err != nil {
+			return err
+		}
+		*usedGas += params.TxGas
+		return nil
+	}
+	var (
+		snap     = statedb.Snapshot()
+		gas      = gp.Gas()
+		used     = *usedGas
+		coinbase = header.Coinbase()
+		err      error
+	)
+	// The header is not sealed yet while mining, so pass the author explicitly
+	switch result.TxType {
+	case TT_TOKEN_C:
+		_, err = applyTokenCreate(config, bc, &coinbase, gp, statedb, header, tx, result, usedGas, cfg)
+	case TT_MDC_RECEIPT:
+		_, err = applyAccessReceipts(config, bc, &coinbase, gp, statedb, header, tx, result, usedGas, cfg)
+	case TT_XSHARD_OUT:
+		_, err = applyCrossShardOut(config, bc, &coinbase, gp, statedb, header, tx, result, usedGas, cfg)
+	case TT_XSHARD_IN:
+		_, err = applyCrossShardIn(config, bc, router, &coinbase, gp, statedb, header, tx, usedGas, cfg, false)
+	default:
+		_, _, err = ApplyTransaction(config, bc, &coinbase, gp, nil, statedb, header, tx, usedGas, cfg)
+	}
+	if err != nil {
+		statedb.RevertToSnapshot(snap)
+		*gp, *usedGas = GasPool(gas), used
+	}
+	return err
 }
 
 
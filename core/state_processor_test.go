@@ -0,0 +1,80 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that the results of a shard block are charged the gas their execution
+// actually used against the block gas pool, and that a transaction exceeding
+// the pool leaves the pool, the gas used and the state untouched.
+func TestApplyToInstructionGas(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	statedb.AddBalance(from, big.NewInt(1000000000))
+
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10), GasLimit: params.GenesisGasLimit})
+
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainID)
+	sign := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, common.Address{0xaa}, big.NewInt(1), 100000, big.NewInt(1), data, types.NativeTokenId), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return tx
+	}
+	want, _ := IntrinsicGas(data, false, true)
+
+	var (
+		gp      = new(GasPool).AddGas(params.GenesisGasLimit)
+		usedGas = new(uint64)
+	)
+	if _, err := ApplyToInstruction(params.TestChainConfig, nil, nil, nil, statedb, header, sign(0), gp, usedGas, vm.Config{}); err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	if *usedGas != want {
+		t.Errorf("gas used mismatch: have %d, want %d", *usedGas, want)
+	}
+	if gp.Gas() != params.GenesisGasLimit-want {
+		t.Errorf("gas pool mismatch: have %d, want %d", gp.Gas(), params.GenesisGasLimit-want)
+	}
+	// Exhaust the pool below the gas of the next transaction
+	*gp = GasPool(params.TxGas)
+	if _, err := ApplyToInstruction(params.TestChainConfig, nil, nil, nil, statedb, header, sign(1), gp, usedGas, vm.Config{}); err != ErrGasLimitReached {
+		t.Fatalf("exceeding transaction error mismatch: have %v, want %v", err, ErrGasLimitReached)
+	}
+	if *usedGas != want || gp.Gas() != params.TxGas {
+		t.Errorf("failed transaction charged: gas used %d, pool %d", *usedGas, gp.Gas())
+	}
+	if nonce := statedb.GetNonce(from); nonce != 1 {
+		t.Errorf("sender nonce mismatch: have %d, want 1", nonce)
+	}
+}
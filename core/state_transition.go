@@ -22,6 +22,7 @@ import (
 	"math/big"
 
 	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/core/vm"
 	"github.com/EDXFund/MasterChain/log"
 	"github.com/EDXFund/MasterChain/params"
@@ -208,11 +209,18 @@ func (st *StateTransition) TransitionDb(address *common.Address) (ret []byte, us
 		vmerr error
 	)
 	if contractCreation {
+		if st.token != types.NativeTokenId {
+			return nil, 0, false, ErrTokenContractCreation
+		}
 		ret, _, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
 	} else {
 		// Increment the nonce for the next transaction
 		st.state.SetNonce(msg.From(), st.state.GetNonce(sender.Address())+1)
-		ret, st.gas, vmerr = evm.Call(sender, st.to(), st.data, st.gas, st.value)
+		if st.token == types.NativeTokenId {
+			ret, st.gas, vmerr = evm.Call(sender, st.to(), st.data, st.gas, st.value)
+		} else {
+			ret, st.gas, vmerr = st.tokenCall(sender)
+		}
 	}
 	if vmerr != nil {
 		log.Debug("VM returned with error", "err", vmerr)
@@ -237,6 +245,28 @@ func (st *StateTransition) TransitionDb(address *common.Address) (ret []byte, us
 	return ret, st.gasUsed(), vmerr != nil, err
 }
 
+// tokenCall moves the token value of the message to the recipient and calls it
+// without any native value. The transfer is undone if the call fails. Transfers
+// of an unknown token or exceeding the token balance of the sender fail before
+// the call, returning all of the gas, so the sender only pays the intrinsic gas.
+func (st *StateTransition) tokenCall(sender vm.AccountRef) (ret []byte, leftOverGas uint64, err error) {
+	if ReadTokenInfo(st.state, st.token) == nil {
+		return nil, st.gas, ErrUnknownToken
+	}
+	if st.state.GetTokenBalance(sender.Address(), st.token).Cmp(st.value) < 0 {
+		return nil, st.gas, ErrInsufficientTokenBalance
+	}
+	snapshot := st.state.Snapshot()
+	st.state.SubTokenBalance(sender.Address(), st.token, st.value)
+	st.state.AddTokenBalance(st.to(), st.token, st.value)
+
+	ret, leftOverGas, err = st.evm.Call(sender, st.to(), st.data, st.gas, new(big.Int))
+	if err != nil {
+		st.state.RevertToSnapshot(snapshot)
+	}
+	return ret, leftOverGas, err
+}
+
 func (st *StateTransition) refundGas() {
 	// Apply refund counter, capped to half of the used gas.
 	refund := st.gasUsed() / 2
@@ -0,0 +1,228 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/core/vm"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Tokens other than the native EDX are created by sending a transaction with
+// zero value to the token registry, whose payload is an rlp encoded
+// InstructTokenCreate. The shard turns it into a TT_TOKEN_C result, and the
+// master registers the token in the storage of the registry and credits the
+// initial supply to the issuer. Sending the same instruction again for a token
+// with a cap mints further supply, as long as the cap is not exceeded.
+var (
+	// TokenRegistryAddress keeps the issuance record of every token in its
+	// storage, see tokenFieldKey.
+	TokenRegistryAddress = common.BytesToAddress([]byte("edx-token-registry"))
+)
+
+var (
+	// ErrInvalidTokenCreate is returned if a token create instruction is
+	// malformed or not signed by the account it names as issuer.
+	ErrInvalidTokenCreate = errors.New("invalid token create instruction")
+
+	// ErrTokenNotIssuer is returned if an account other than the issuer tries
+	// to mint an existing token.
+	ErrTokenNotIssuer = errors.New("token minted by non issuer")
+
+	// ErrTokenSupplyCap is returned if minting would push the supply of a token
+	// over its cap, or if a token with fixed supply is minted again.
+	ErrTokenSupplyCap = errors.New("token supply exceeds cap")
+
+	// ErrUnknownToken is returned if a transaction transfers a token which has
+	// not been registered.
+	ErrUnknownToken = errors.New("unknown token")
+
+	// ErrInsufficientTokenBalance is returned if the sender of a token transfer
+	// holds less than the transferred amount. Unlike the native balance this is
+	// not a consensus error, the transaction fails and its gas is consumed.
+	ErrInsufficientTokenBalance = errors.New("insufficient token balance for transfer")
+
+	// ErrTokenContractCreation is returned if a contract creation carries a non
+	// native token id.
+	ErrTokenContractCreation = errors.New("contract creation with non native token")
+)
+
+// Fields of a token record in the registry storage.
+const (
+	tokenIssuerField byte = iota + 1
+	tokenCapField
+	tokenSupplyField
+	tokenCodeField
+)
+
+// TokenInfo is the issuance record of a registered token.
+type TokenInfo struct {
+	Issuer   common.Address
+	Cap      *big.Int    // Maximum supply, zero for a fixed supply token
+	Supply   *big.Int    // Amount issued so far
+	CodeHash common.Hash // Hash of the verify code deployed at TokenAddress
+}
+
+// tokenFieldKey returns the registry storage slot of a field of a token.
+func tokenFieldKey(token uint64, field byte) common.Hash {
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[:8], token)
+	buf[8] = field
+	return crypto.Keccak256Hash(buf[:])
+}
+
+// TokenAddress returns the address the verify code of a token is deployed at,
+// so that contracts and wallets can call it before accepting the token.
+func TokenAddress(token uint64) common.Address {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], token)
+	return common.BytesToAddress(crypto.Keccak256(TokenRegistryAddress[:], buf[:])[12:])
+}
+
+// ReadTokenInfo returns the registry record of a token, or nil if the token has
+// not been registered. The native token has no record.
+func ReadTokenInfo(statedb vm.StateDB, token uint64) *TokenInfo {
+	if token == types.NativeTokenId {
+		return nil
+	}
+	issuer := statedb.GetState(TokenRegistryAddress, tokenFieldKey(token, tokenIssuerField))
+	if issuer == (common.Hash{}) {
+		return nil
+	}
+	return &TokenInfo{
+		Issuer:   common.BytesToAddress(issuer[:]),
+		Cap:      statedb.GetState(TokenRegistryAddress, tokenFieldKey(token, tokenCapField)).Big(),
+		Supply:   statedb.GetState(TokenRegistryAddress, tokenFieldKey(token, tokenSupplyField)).Big(),
+		CodeHash: statedb.GetState(TokenRegistryAddress, tokenFieldKey(token, tokenCodeField)),
+	}
+}
+
+// decodeTokenCreate decodes the payload of a token create transaction.
+func decodeTokenCreate(data []byte) (*InstructTokenCreate, error) {
+	create := new(InstructTokenCreate)
+	if err := rlp.DecodeBytes(data, create); err != nil {
+		return nil, ErrInvalidTokenCreate
+	}
+	if create.TokenId == types.NativeTokenId || create.Supply == nil || create.Cap == nil ||
+		create.Supply.Sign() < 0 || create.Cap.Sign() < 0 || create.Supply.BitLen() > 256 || create.Cap.BitLen() > 256 {
+		return nil, ErrInvalidTokenCreate
+	}
+	return create, nil
+}
+
+// tokenInstruction returns the TT_TOKEN_C result of tx, or nil if tx is not
+// addressed to the token registry.
+func tokenInstruction(config *params.ChainConfig, header types.HeaderIntf, tx *types.Transaction) (*types.ContractResult, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	if msg.To() == nil || *msg.To() != TokenRegistryAddress {
+		return nil, nil
+	}
+	if msg.Value().Sign() != 0 || msg.TokenId() != types.NativeTokenId {
+		return nil, ErrInvalidTokenCreate
+	}
+	create, err := decodeTokenCreate(msg.Data())
+	if err != nil {
+		return nil, err
+	}
+	if create.SrcAccount != msg.From() {
+		return nil, ErrInvalidTokenCreate
+	}
+	// the registry holds no code, so the create only burns its intrinsic gas
+	gas, err := IntrinsicGas(msg.Data(), false, config.IsHomestead(header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	return &types.ContractResult{TxType: TT_TOKEN_C, TxHash: tx.Hash(), GasUsed: gas, Data: msg.Data()}, nil
+}
+
+// applyTokenCreate executes a TT_TOKEN_C result. The transaction itself is
+// applied as an ordinary call to the registry, after which the token is
+// registered or minted. Rejected instructions only burn gas and yield a failed
+// receipt.
+func applyTokenCreate(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header types.HeaderIntf, tx *types.Transaction, result *types.ContractResult, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	receipt, _, err := ApplyTransaction(config, bc, author, gp, nil, statedb, header, tx, usedGas, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, nil
+	}
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number()))
+	if err != nil {
+		return nil, err
+	}
+	create, err := decodeTokenCreate(result.Data)
+	if err == nil && create.SrcAccount != msg.From() {
+		err = ErrInvalidTokenCreate
+	}
+	if err == nil {
+		err = issueToken(statedb, create)
+	}
+	if err != nil {
+		log.Debug("Rejected token create", "hash", tx.Hash(), "err", err)
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	return receipt, nil
+}
+
+// issueToken registers the token of a create instruction, or mints more of it
+// if it already exists, and credits the issued supply to the issuer.
+func issueToken(statedb *state.StateDB, create *InstructTokenCreate) error {
+	var (
+		token  = create.TokenId
+		supply = create.Supply
+	)
+	if info := ReadTokenInfo(statedb, token); info != nil {
+		if info.Issuer != create.SrcAccount {
+			return ErrTokenNotIssuer
+		}
+		supply = new(big.Int).Add(info.Supply, create.Supply)
+		if info.Cap.Sign() == 0 || supply.Cmp(info.Cap) > 0 {
+			return ErrTokenSupplyCap
+		}
+	} else {
+		if create.Cap.Sign() > 0 && supply.Cmp(create.Cap) > 0 {
+			return ErrTokenSupplyCap
+		}
+		// a nonce makes the registry non-empty, so the token entries survive
+		// the deletion of empty accounts
+		if statedb.GetNonce(TokenRegistryAddress) == 0 {
+			statedb.SetNonce(TokenRegistryAddress, 1)
+		}
+		statedb.SetState(TokenRegistryAddress, tokenFieldKey(token, tokenIssuerField), create.SrcAccount.Hash())
+		statedb.SetState(TokenRegistryAddress, tokenFieldKey(token, tokenCapField), common.BigToHash(create.Cap))
+		if len(create.VerifyCode) > 0 {
+			statedb.SetCode(TokenAddress(token), create.VerifyCode)
+			statedb.SetState(TokenRegistryAddress, tokenFieldKey(token, tokenCodeField), crypto.Keccak256Hash(create.VerifyCode))
+		}
+	}
+	statedb.SetState(TokenRegistryAddress, tokenFieldKey(token, tokenSupplyField), common.BigToHash(supply))
+	statedb.AddTokenBalance(create.SrcAccount, token, create.Supply)
+	return nil
+}
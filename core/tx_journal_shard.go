@@ -0,0 +1,235 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// Operations recorded by the pending transaction journal of a shard.
+const (
+	journalInsert = uint8(iota) // Data is the RLP of a transaction entering the pool
+	journalDelete               // Data is the hash of a transaction leaving the pool
+)
+
+// journalCompactRatio is the number of stale records per live transaction the
+// pending journal tolerates before it is compacted.
+const journalCompactRatio = 2
+
+// journalEntry is a single record of the pending transaction journal.
+type journalEntry struct {
+	Op   uint8
+	Data []byte
+}
+
+// shardTxJournal is an append only log of the transactions entering and leaving
+// the pool of a shard, allowing its pending set to survive node restarts without
+// rewriting it on every insertion. Deletions are appended as tombstones, the log
+// is compacted once the stale records outweigh the live transactions.
+type shardTxJournal struct {
+	path   string         // Filesystem path to store the journal at
+	writer io.WriteCloser // Output stream to append new records into
+
+	live  int // Number of transactions alive in the journal
+	stale int // Number of records superseded by a later deletion
+}
+
+// shardJournalPath derives the path of the pending journal of a shard from the
+// path of the transaction journal, e.g. transactions.rlp -> transactions-shard3.rlp.
+func shardJournalPath(path string, shardId uint16) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-shard%d%s", strings.TrimSuffix(path, ext), shardId, ext)
+}
+
+// newShardTxJournal creates a new pending transaction journal at path.
+func newShardTxJournal(path string) *shardTxJournal {
+	return &shardTxJournal{
+		path: path,
+	}
+}
+
+// load replays the journal from disk, loading the transactions which entered
+// the pool but never left it into the specified pool. A record cut short by a
+// crash ends the replay, the transactions recovered up to it are still loaded.
+func (journal *shardTxJournal) load(add func([]*types.Transaction) []error) error {
+	// Skip the parsing if the journal file doesn't exist at all
+	if _, err := os.Stat(journal.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(journal.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Temporarily discard any journal additions (don't double add on load)
+	journal.writer = new(devNull)
+	defer func() { journal.writer = nil }()
+
+	var (
+		stream  = rlp.NewStream(input, 0)
+		pending = make(map[common.Hash]*types.Transaction)
+		order   []common.Hash
+		failure error
+		records int
+	)
+	for failure == nil {
+		var entry journalEntry
+		if err := stream.Decode(&entry); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		records++
+
+		switch entry.Op {
+		case journalInsert:
+			tx := new(types.Transaction)
+			if failure = rlp.DecodeBytes(entry.Data, tx); failure == nil {
+				if _, ok := pending[tx.Hash()]; !ok {
+					order = append(order, tx.Hash())
+				}
+				pending[tx.Hash()] = tx
+			}
+		case journalDelete:
+			delete(pending, common.BytesToHash(entry.Data))
+
+		default:
+			failure = fmt.Errorf("unknown journal operation %d", entry.Op)
+		}
+	}
+	// Inject the surviving transactions in their original order
+	txs := make(types.Transactions, 0, len(pending))
+	for _, hash := range order {
+		if tx, ok := pending[hash]; ok {
+			txs = append(txs, tx)
+			delete(pending, hash)
+		}
+	}
+	dropped := 0
+	for _, err := range add(txs) {
+		if err != nil {
+			log.Debug("Failed to add journaled transaction", "err", err)
+			dropped++
+		}
+	}
+	log.Info("Loaded pending transaction journal", "records", records, "transactions", len(txs), "dropped", dropped)
+
+	return failure
+}
+
+// insert appends a transaction entering the pool to the journal.
+func (journal *shardTxJournal) insert(tx *types.Transaction) error {
+	if journal.writer == nil {
+		return errNoActiveJournal
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	if err := rlp.Encode(journal.writer, &journalEntry{Op: journalInsert, Data: data}); err != nil {
+		return err
+	}
+	journal.live++
+	return nil
+}
+
+// delete appends a tombstone for a transaction leaving the pool to the journal.
+func (journal *shardTxJournal) delete(hash common.Hash) error {
+	if journal.writer == nil {
+		return errNoActiveJournal
+	}
+	if err := rlp.Encode(journal.writer, &journalEntry{Op: journalDelete, Data: hash.Bytes()}); err != nil {
+		return err
+	}
+	journal.live--
+	journal.stale += 2
+	return nil
+}
+
+// needsCompaction reports whether the stale records of the journal outweigh its
+// live transactions enough to warrant a rewrite.
+func (journal *shardTxJournal) needsCompaction() bool {
+	return journal.stale > journalCompactRatio*journal.live && journal.stale >= 1024
+}
+
+// rotate regenerates the journal from the transactions currently in the pool,
+// dropping all stale records.
+func (journal *shardTxJournal) rotate(all *txLookup) error {
+	// Close the current journal (if any is open)
+	if journal.writer != nil {
+		if err := journal.writer.Close(); err != nil {
+			return err
+		}
+		journal.writer = nil
+	}
+	// Generate a new journal with the contents of the current pool
+	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	journaled := 0
+	all.Range(func(hash common.Hash, tx *types.Transaction) bool {
+		var data []byte
+		if data, err = rlp.EncodeToBytes(tx); err != nil {
+			return false
+		}
+		if err = rlp.Encode(replacement, &journalEntry{Op: journalInsert, Data: data}); err != nil {
+			return false
+		}
+		journaled++
+		return true
+	})
+	replacement.Close()
+	if err != nil {
+		return err
+	}
+	// Replace the live journal with the newly generated one
+	if err = os.Rename(journal.path+".new", journal.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+	journal.writer = sink
+	journal.live, journal.stale = journaled, 0
+	log.Debug("Compacted pending transaction journal", "transactions", journaled)
+
+	return nil
+}
+
+// close flushes the journal contents to disk and closes the file.
+func (journal *shardTxJournal) close() error {
+	var err error
+
+	if journal.writer != nil {
+		err = journal.writer.Close()
+		journal.writer = nil
+	}
+	return err
+}
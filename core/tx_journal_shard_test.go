@@ -0,0 +1,216 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+)
+
+// newTestShardJournal creates an empty pending journal in a temporary directory,
+// opened for appending.
+func newTestShardJournal(t *testing.T) (*shardTxJournal, func()) {
+	dir, err := ioutil.TempDir("", "shard-journal-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	journal := newShardTxJournal(shardJournalPath(filepath.Join(dir, "transactions.rlp"), 3))
+	if err := journal.rotate(newTxLookup()); err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	return journal, func() {
+		journal.close()
+		os.RemoveAll(dir)
+	}
+}
+
+// loadJournal replays a journal, returning the transactions it recovered.
+func loadJournal(t *testing.T, path string) ([]*types.Transaction, error) {
+	var loaded []*types.Transaction
+	err := newShardTxJournal(path).load(func(txs []*types.Transaction) []error {
+		loaded = append(loaded, txs...)
+		return make([]error, len(txs))
+	})
+	return loaded, err
+}
+
+// checkJournalTxs checks that the recovered transactions match the wanted ones,
+// in order.
+func checkJournalTxs(t *testing.T, have, want []*types.Transaction) {
+	if len(have) != len(want) {
+		t.Fatalf("recovered transaction count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i].Hash() != want[i].Hash() {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, have[i].Hash(), want[i].Hash())
+		}
+	}
+}
+
+// Tests that a reloaded journal recovers the transactions which entered the
+// pool but never left it, in their original order.
+func TestShardJournalReload(t *testing.T) {
+	journal, cleanup := newTestShardJournal(t)
+	defer cleanup()
+
+	if path := journal.path; filepath.Base(path) != "transactions-shard3.rlp" {
+		t.Fatalf("journal path mismatch: have %s", path)
+	}
+	key, _ := crypto.GenerateKey()
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key), transaction(2, 100000, key)}
+	for _, tx := range txs {
+		if err := journal.insert(tx); err != nil {
+			t.Fatalf("failed to journal transaction: %v", err)
+		}
+	}
+	if err := journal.delete(txs[1].Hash()); err != nil {
+		t.Fatalf("failed to journal deletion: %v", err)
+	}
+	// Reinserting a dropped transaction keeps its original position
+	if err := journal.insert(txs[1]); err != nil {
+		t.Fatalf("failed to journal transaction: %v", err)
+	}
+	if err := journal.delete(txs[0].Hash()); err != nil {
+		t.Fatalf("failed to journal deletion: %v", err)
+	}
+	journal.close()
+
+	loaded, err := loadJournal(t, journal.path)
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	checkJournalTxs(t, loaded, []*types.Transaction{txs[1], txs[2]})
+
+	// Loading must not have written anything, so a second load recovers the same
+	loaded, err = loadJournal(t, journal.path)
+	if err != nil {
+		t.Fatalf("failed to reload journal: %v", err)
+	}
+	checkJournalTxs(t, loaded, []*types.Transaction{txs[1], txs[2]})
+
+	if err := journal.insert(txs[0]); err != errNoActiveJournal {
+		t.Errorf("closed journal insertion error mismatch: have %v, want %v", err, errNoActiveJournal)
+	}
+}
+
+// Tests that a journal whose last record was cut short by a crash still loads
+// the transactions recorded before it.
+func TestShardJournalTruncated(t *testing.T) {
+	journal, cleanup := newTestShardJournal(t)
+	defer cleanup()
+
+	key, _ := crypto.GenerateKey()
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key)}
+	for _, tx := range txs {
+		if err := journal.insert(tx); err != nil {
+			t.Fatalf("failed to journal transaction: %v", err)
+		}
+	}
+	journal.close()
+
+	stat, err := os.Stat(journal.path)
+	if err != nil {
+		t.Fatalf("failed to stat journal: %v", err)
+	}
+	if err := os.Truncate(journal.path, stat.Size()-10); err != nil {
+		t.Fatalf("failed to truncate journal: %v", err)
+	}
+	loaded, err := loadJournal(t, journal.path)
+	if err == nil {
+		t.Errorf("truncated journal loaded without error")
+	}
+	checkJournalTxs(t, loaded, txs[:1])
+}
+
+// Tests that the journal is only compacted once enough of its records are stale,
+// and that compaction keeps exactly the transactions of the pool.
+func TestShardJournalCompaction(t *testing.T) {
+	journal, cleanup := newTestShardJournal(t)
+	defer cleanup()
+
+	key, _ := crypto.GenerateKey()
+	var (
+		pool = newTxLookup()
+		txs  = make([]*types.Transaction, 600)
+	)
+	for i := range txs {
+		txs[i] = transaction(uint64(i), 100000, key)
+		if err := journal.insert(txs[i]); err != nil {
+			t.Fatalf("failed to journal transaction: %v", err)
+		}
+		pool.Add(txs[i])
+	}
+	// Drop transactions until the stale records outweigh the live ones
+	dropped := 0
+	for ; !journal.needsCompaction(); dropped++ {
+		if dropped == len(txs) {
+			t.Fatalf("journal never requested compaction")
+		}
+		if err := journal.delete(txs[dropped].Hash()); err != nil {
+			t.Fatalf("failed to journal deletion: %v", err)
+		}
+		pool.Remove(txs[dropped].Hash())
+	}
+	if journal.stale < 1024 || journal.stale <= journalCompactRatio*journal.live {
+		t.Fatalf("compaction requested too early: live %d, stale %d", journal.live, journal.stale)
+	}
+	before, _ := os.Stat(journal.path)
+	if err := journal.rotate(pool); err != nil {
+		t.Fatalf("failed to compact journal: %v", err)
+	}
+	after, _ := os.Stat(journal.path)
+	if after.Size() >= before.Size() {
+		t.Errorf("journal not shrunk: have %d bytes, had %d", after.Size(), before.Size())
+	}
+	if journal.live != len(txs)-dropped || journal.stale != 0 || journal.needsCompaction() {
+		t.Errorf("compacted counters mismatch: live %d, stale %d", journal.live, journal.stale)
+	}
+	// The compacted journal stays appendable and reloads the pool contents
+	extra := transaction(uint64(len(txs)), 100000, key)
+	if err := journal.insert(extra); err != nil {
+		t.Fatalf("failed to journal transaction: %v", err)
+	}
+	journal.close()
+
+	loaded, err := loadJournal(t, journal.path)
+	if err != nil {
+		t.Fatalf("failed to load compacted journal: %v", err)
+	}
+	want := make(map[common.Hash]bool)
+	for _, tx := range txs[dropped:] {
+		want[tx.Hash()] = true
+	}
+	want[extra.Hash()] = true
+
+	if len(loaded) != len(want) {
+		t.Fatalf("recovered transaction count mismatch: have %d, want %d", len(loaded), len(want))
+	}
+	for _, tx := range loaded {
+		if !want[tx.Hash()] {
+			t.Errorf("unexpected transaction recovered: %x", tx.Hash())
+		}
+	}
+	if loaded[len(loaded)-1].Hash() != extra.Hash() {
+		t.Errorf("appended transaction not last: have %x, want %x", loaded[len(loaded)-1].Hash(), extra.Hash())
+	}
+}
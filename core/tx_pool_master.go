@@ -74,6 +74,10 @@ var (
 	// with a different one without the required price bump.
 	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
 
+	// ErrAccountLimit is returned if the sender of a transaction already has the
+	// maximum number of transactions permitted per account in the pool.
+	ErrAccountLimit = errors.New("account transaction limit reached")
+
 	// ErrInsufficientFunds is returned if the total cost of executing a transaction
 	// is higher than the balance of the user's account.
 	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
@@ -126,9 +130,46 @@ const (
 	TxStatusUnknown TxStatus = iota
 	TxStatusQueued
 	TxStatusPending
-	TxStatusIncluded
+	TxStatusIncluded   // Included in a shard block
+	TxStatusReferenced // Included in a shard block referenced by a canonical master block
+	TxStatusFinal      // Referenced by a master block with ShardTxConfirmations on top
+	TxStatusRejected   // Included in a shard block, but refused by the canonical master block referencing it
 )
 
+// String implements fmt.Stringer.
+func (s TxStatus) String() string {
+	switch s {
+	case TxStatusQueued:
+		return "queued"
+	case TxStatusPending:
+		return "pending"
+	case TxStatusIncluded:
+		return "included"
+	case TxStatusReferenced:
+		return "referenced"
+	case TxStatusFinal:
+		return "final"
+	case TxStatusRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// ShardTxStatus is the position of a transaction in its lifecycle, from the pool
+// of the shard it is routed to up to a final master block.
+type ShardTxStatus struct {
+	Status  TxStatus
+	ShardId uint16 // Shard the transaction is routed to
+
+	BlockHash   common.Hash // Shard block including the transaction
+	BlockNumber uint64
+	Index       uint64 // Index of the transaction within the shard block results
+
+	MasterHash   common.Hash // Master block referencing the shard block
+	MasterNumber uint64
+}
+
 // blockChain provides the state of blockchain and current gas limit to do
 // some pre checks in tx pool and event subscribers.
 type blockChain interface {
@@ -138,7 +179,10 @@ type blockChain interface {
 
 	SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription
 	GetShardBlock(shardId uint16, hash common.Hash, number uint64) types.BlockIntf
+	ShardTxStatus(hash common.Hash) *ShardTxStatus
 	DB() ethdb.Database
+	CurrentMasterHeader() types.HeaderIntf
+	ShardRouter
 }
 
 // TxPoolConfig are the configuration parameters of the transaction pool.
@@ -1113,6 +1157,29 @@ func (pool *TxPool) Status(hashes []common.Hash) []TxStatus {
 	return status
 }
 
+// ShardStatus returns the lifecycle position of a batch of transactions
+// identified by their hashes, nil for unknown ones. Transactions in the pool
+// report the shard they are routed to, the others are looked up in the chain.
+func (pool *TxPool) ShardStatus(hashes []common.Hash) []*ShardTxStatus {
+	status := make([]*ShardTxStatus, len(hashes))
+	for i, txStatus := range pool.Status(hashes) {
+		if txStatus == TxStatusUnknown {
+			status[i] = pool.chain.ShardTxStatus(hashes[i])
+			continue
+		}
+		tx := pool.all.Get(hashes[i])
+		if tx == nil {
+			continue // dropped in the meantime
+		}
+		shardId, err := pool.chain.TxShard(pool.chain.CurrentMasterHeader(), tx)
+		if err != nil {
+			continue
+		}
+		status[i] = &ShardTxStatus{Status: txStatus, ShardId: shardId}
+	}
+	return status
+}
+
 // Get returns a transaction if it is contained in the pool
 // and nil otherwise.
 func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
@@ -31,10 +31,12 @@
 package core
 
 import (
+	"fmt"
 	"github.com/EDXFund/MasterChain/core/rawdb"
 	"math"
 	"math/big"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -59,6 +61,7 @@ type TxPoolIntf interface {
 	AddRemotes([]*types.Transaction) []error
 	Content() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
 	SubscribeBlockTxsProcsEvent(chan ChainHeadEvent) event.Subscription
+	ShardStatus(hashes []common.Hash) []*ShardTxStatus
 	Stop()
 }
 
@@ -68,6 +71,9 @@ type TxPoolShardConfig struct {
 	NoLocals bool             // Whether local transaction handling should be disabled
 	Journal  string           // Journal of local transactions to survive node restarts
 
+	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
+	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
+
 	AccountSlots uint64 // Number of executable transaction slots guaranteed per account
 	GlobalSlots  uint64 // Maximum number of executable transaction slots for all accounts
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
@@ -78,14 +84,27 @@ type TxPoolShardConfig struct {
 
 func (tpc *TxPoolConfig) ToShardConfig() *TxPoolShardConfig {
 	return &TxPoolShardConfig{
-		tpc.Locals, tpc.NoLocals, tpc.Journal, tpc.AccountSlots, tpc.GlobalSlots, tpc.AccountQueue, tpc.GlobalQueue, tpc.Lifetime}
-
+		Locals:       tpc.Locals,
+		NoLocals:     tpc.NoLocals,
+		Journal:      tpc.Journal,
+		PriceLimit:   tpc.PriceLimit,
+		PriceBump:    tpc.PriceBump,
+		AccountSlots: tpc.AccountSlots,
+		GlobalSlots:  tpc.GlobalSlots,
+		AccountQueue: tpc.AccountQueue,
+		GlobalQueue:  tpc.GlobalQueue,
+		Lifetime:     tpc.Lifetime,
+	}
 }
 
 // DefaultTxPoolShardConfig contains the default configurations for the transaction
 // pool.
 var DefaultTxPoolShardConfig = TxPoolShardConfig{
-	Journal:      "transactions.rlp",
+	Journal: "transactions.rlp",
+
+	PriceLimit: 1,
+	PriceBump:  10,
+
 	AccountSlots: 160,
 	GlobalSlots:  40960,
 	AccountQueue: 640,
@@ -94,6 +113,21 @@ var DefaultTxPoolShardConfig = TxPoolShardConfig{
 	Lifetime: 3 * time.Hour,
 }
 
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *TxPoolShardConfig) sanitize() TxPoolShardConfig {
+	conf := *config
+	if conf.PriceLimit < 1 {
+		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolShardConfig.PriceLimit)
+		conf.PriceLimit = DefaultTxPoolShardConfig.PriceLimit
+	}
+	if conf.PriceBump < 1 {
+		log.Warn("Sanitizing invalid txpool price bump", "provided", conf.PriceBump, "updated", DefaultTxPoolShardConfig.PriceBump)
+		conf.PriceBump = DefaultTxPoolShardConfig.PriceBump
+	}
+	return conf
+}
+
 // TxPoolShard contains all currently known transactions. Transactions
 // enter the pool when they are received from the network or submitted
 // locally. They exit the pool when they are included in the blockchain.
@@ -120,8 +154,11 @@ type TxPoolShard struct {
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
 
-	//queue   map[common.Address]*txList   // Queued but non-processable transactions
-	all *txLookup // All transactions to allow lookups
+	locals   *accountSet                // Set of local transaction to exempt from eviction rules
+	accounts map[common.Address]*txList // Transactions of every account, sorted by nonce
+	all      *txLookup                  // All transactions to allow lookups
+	priced   *txPricedList              // All transactions sorted by price
+	journal  *shardTxJournal            // Journal of pending transactions to restore them after restarts
 
 	wg sync.WaitGroup // for shutdown sync
 
@@ -132,6 +169,7 @@ type TxPoolShard struct {
 // transactions from the network.
 func NewTxPoolShard(config TxPoolShardConfig, chainconfig *params.ChainConfig, chain blockChain, shardId uint16) *TxPoolShard {
 	// Sanitize the input to ensure no vulnerable gas prices are set
+	config = (&config).sanitize()
 
 	// Create the transaction pool with its initial settings
 	pool := &TxPoolShard{
@@ -140,11 +178,17 @@ func NewTxPoolShard(config TxPoolShardConfig, chainconfig *params.ChainConfig, c
 		chain:       chain,
 		shardId:     shardId,
 		signer:      types.NewEIP155Signer(chainconfig.ChainID),
-
-		//queue:       make(map[common.Address]*txList),
+		accounts:    make(map[common.Address]*txList),
 		all:         newTxLookup(),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
+		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
+	}
+	pool.locals = newAccountSet(pool.signer)
+	for _, addr := range config.Locals {
+		log.Info("Setting new local account", "address", addr)
+		pool.locals.add(addr)
 	}
+	pool.priced = newTxPricedList(pool.all)
 
 	if shardId == types.ShardMaster {
 		panic(" no master should be here")
@@ -152,6 +196,18 @@ func NewTxPoolShard(config TxPoolShardConfig, chainconfig *params.ChainConfig, c
 		pool.resetOfSHeader(nil, chain.CurrentBlock().Header().ToSHeader())
 	}
 
+	// If journaling is enabled, restore the pending transactions and compact the journal
+	if config.Journal != "" {
+		pool.journal = newShardTxJournal(shardJournalPath(config.Journal, shardId))
+
+		if err := pool.journal.load(pool.restore); err != nil {
+			log.Warn("Failed to load pending transaction journal", "err", err)
+		}
+		if err := pool.journal.rotate(pool.all); err != nil {
+			log.Warn("Failed to rotate pending transaction journal", "err", err)
+		}
+	}
+
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
@@ -161,17 +217,24 @@ func NewTxPoolShard(config TxPoolShardConfig, chainconfig *params.ChainConfig, c
 
 	return pool
 }
+
+// AddLocal enqueues a single transaction into the pool if it is valid, marking
+// the sender as a local one in the mean time, ensuring it goes around the local
+// pricing constraints.
+func (pool *TxPoolShard) AddLocal(tx *types.Transaction) error {
+	return pool.AddTx(tx, !pool.config.NoLocals)
+}
+
+// AddRemotes attempts to enqueue a batch of transactions into the pool if they
+// are valid, returning the reason of every rejected one.
 func (pool *TxPoolShard) AddRemotes(txs []*types.Transaction) []error {
-	pool.addTxs(txs, false)
-	return nil
+	return pool.addTxs(txs, false)
 }
+
+// AddLocals enqueues a batch of transactions into the pool if they are valid,
+// marking the senders as local ones.
 func (pool *TxPoolShard) AddLocals(txs []*types.Transaction) []error {
-	pool.addTxs(txs, false)
-	return nil
-}
-func (pool *TxPoolShard) AddLocal(tx *types.Transaction) error {
-	pool.AddTx(tx, false)
-	return nil
+	return pool.addTxs(txs, !pool.config.NoLocals)
 }
 
 // loop is the transaction pool's main event loop, waiting for and reacting to
@@ -189,19 +252,6 @@ func (pool *TxPoolShard) loop() {
 	evict := time.NewTicker(evictionInterval)
 	defer evict.Stop()
 
-	//reload pending txs
-	hashes, err := rawdb.ReadPendingTransactions(pool.chain.DB())
-	txs := make([]*types.Transaction, 0, len(hashes))
-	if err != nil && hashes != nil {
-		for _, hash := range hashes {
-			tx, err := rawdb.ReadRawTransaction(pool.chain.DB(), *hash)
-			if err != nil {
-				txs = append(txs, tx)
-			}
-		}
-	}
-
-	pool.addTxs(txs, false)
 	// Track the previous head headers for transaction reorgs
 	head := pool.chain.CurrentBlock()
 
@@ -269,6 +319,49 @@ func (pool *TxPoolShard) loop() {
 	}
 }
 
+// restore reinserts the transactions recovered from the pending journal, except
+// for the ones included in a shard block while the node was down. They are
+// validated against the current state like any new transaction.
+func (pool *TxPoolShard) restore(txs []*types.Transaction) []error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		if _, blockHash, _, _ := rawdb.ReadShardTxLookupEntry(pool.chain.DB(), tx.Hash()); blockHash != (common.Hash{}) {
+			errs[i] = fmt.Errorf("included transaction: %x", tx.Hash())
+			continue
+		}
+		if _, errs[i] = pool.add(tx, false); errs[i] == nil {
+			if _tx, err := rawdb.ReadRawTransaction(pool.chain.DB(), tx.Hash()); _tx == nil || err != nil {
+				rawdb.WriteRawTransaction(pool.chain.DB(), tx.Hash(), tx)
+			}
+		}
+	}
+	return errs
+}
+
+// journalTx adds the specified transaction to the pending journal, if enabled.
+func (pool *TxPoolShard) journalTx(tx *types.Transaction) {
+	if pool.journal == nil {
+		return
+	}
+	if err := pool.journal.insert(tx); err != nil {
+		log.Warn("Failed to journal pending transaction", "err", err)
+	}
+}
+
+// journalDelete records a transaction leaving the pool in the pending journal,
+// if enabled.
+func (pool *TxPoolShard) journalDelete(hash common.Hash) {
+	if pool.journal == nil {
+		return
+	}
+	if err := pool.journal.delete(hash); err != nil {
+		log.Warn("Failed to journal dropped transaction", "err", err)
+	}
+}
+
 // lockedResetOfSHeader is a wrapper around resetOfSHeader to allow calling it in a thread safe
 // manner. This method is only ever used in the tester!
 func (pool *TxPoolShard) lockedReset(oldHead, newHead types.HeaderIntf) {
@@ -368,17 +461,45 @@ func (pool *TxPoolShard) resetOfSHeader(oldHead, newHead types.HeaderIntf) {
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 
-	pool.addTxsLocked(reinject, false)
+	for _, tx := range reinject {
+		if tx != nil {
+			pool.add(tx, false)
+		}
+	}
 
 	for _, tx := range included {
+		if tx != nil {
+			pool.removeTx(tx.Hash(), true)
+		}
+	}
+	pool.dropStale()
 
-		pool.all.Remove(tx.Hash())
-
+	if pool.journal != nil && pool.journal.needsCompaction() {
+		if err := pool.journal.rotate(pool.all); err != nil {
+			log.Warn("Failed to rotate pending transaction journal", "err", err)
+		}
 	}
 	//scp.newShardFeed.Send(&core.ChainsShardEvent{Block: newBlocks})
 	pool.txsProcFeed.Send(ChainHeadEvent{Block: types.NewSBlockWithHeader(newHead)})
 }
 
+// dropStale removes all transactions whose nonce was already used up in the
+// current state, e.g. because another node of the shard included them.
+func (pool *TxPoolShard) dropStale() {
+	for addr, list := range pool.accounts {
+		for _, tx := range list.Forward(pool.currentState.GetNonce(addr)) {
+			hash := tx.Hash()
+			log.Trace("Removed old shard transaction", "hash", hash)
+			pool.all.Remove(hash)
+			pool.priced.Removed()
+			pool.journalDelete(hash)
+		}
+		if list.Empty() {
+			delete(pool.accounts, addr)
+		}
+	}
+}
+
 // Stop terminates the transaction pool.
 func (pool *TxPoolShard) Stop() {
 	// Unsubscribe all subscriptions registered from txpool
@@ -388,6 +509,10 @@ func (pool *TxPoolShard) Stop() {
 	pool.chainHeadSub.Unsubscribe()
 	pool.wg.Wait()
 
+	if pool.journal != nil {
+		pool.journal.close()
+	}
+
 	log.Info("Transaction pool stopped")
 }
 
@@ -417,6 +542,10 @@ func (pool *TxPoolShard) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
+	pool.gasPrice = price
+	for _, tx := range pool.priced.Cap(price, pool.locals) {
+		pool.removeTx(tx.Hash(), false)
+	}
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
@@ -488,6 +617,10 @@ func (pool *TxPoolShard) Pending() (map[common.Address]types.Transactions, error
 
 		return true
 	})
+	// Shards own the nonce space of their accounts, hand out txs in nonce order
+	for _, txs := range result {
+		sort.Sort(types.TxByNonce(txs))
+	}
 	return result, errs
 }
 
@@ -512,6 +645,15 @@ func (pool *TxPoolShard) validateTx(tx *types.Transaction, local bool) error {
 	if err != nil {
 		return ErrInvalidSender
 	}
+	// Drop non-local transactions under our own minimal accepted gas price
+	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
+	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+		return ErrUnderpriced
+	}
+	// Make sure the sending account is owned by this shard
+	if err := checkTxShard(pool.chain, pool.chain.CurrentMasterHeader(), tx, pool.shardId); err != nil {
+		return ErrWrongShard
+	}
 
 	// Ensure the transaction adheres to nonce ordering
 	if pool.currentState.GetNonce(from) > tx.Nonce() {
@@ -533,67 +675,144 @@ func (pool *TxPoolShard) validateTx(tx *types.Transaction, local bool) error {
 	return nil
 }
 
-// addTx enqueues a single transaction into the pool if it is valid.
+// AddTx enqueues a single transaction into the pool if it is valid.
 func (pool *TxPoolShard) AddTx(tx *types.Transaction, local bool) error {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	// Try to inject the transaction and update any state
-	_tx, err := rawdb.ReadRawTransaction(pool.chain.DB(), tx.Hash())
-	if _tx == nil || err != nil {
-		rawdb.WriteRawTransaction(pool.chain.DB(), tx.Hash(), tx)
-		pool.all.Add(tx)
-
-	} else {
-		log.Debug("Try to add duplicated tx:", "hash:", tx.Hash())
-	}
-	return nil
-
+	return pool.addTxsLocked([]*types.Transaction{tx}, local)[0]
 }
 
 // addTxs attempts to queue a batch of transactions if they are valid.
 func (pool *TxPoolShard) addTxs(txs []*types.Transaction, local bool) []error {
-
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	err := pool.addTxsLocked(txs, local)
-
-	return err
+	return pool.addTxsLocked(txs, local)
 }
 
 // addTxsLocked attempts to queue a batch of transactions if they are valid,
 // whilst assuming the transaction pool lock is already held.
 func (pool *TxPoolShard) addTxsLocked(txs []*types.Transaction, local bool) []error {
 	// Add the batch of transaction, tracking the accepted ones
-
-	for _, tx := range txs {
-		_tx, err := rawdb.ReadRawTransaction(pool.chain.DB(), tx.Hash())
-		if _tx == nil || err != nil {
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		// Transactions known to the database were pooled or included before
+		if _tx, err := rawdb.ReadRawTransaction(pool.chain.DB(), tx.Hash()); _tx != nil && err == nil {
+			log.Trace("Discarding already known transaction", "hash", tx.Hash())
+			errs[i] = fmt.Errorf("known transaction: %x", tx.Hash())
+			continue
+		}
+		if _, errs[i] = pool.add(tx, local); errs[i] == nil {
 			rawdb.WriteRawTransaction(pool.chain.DB(), tx.Hash(), tx)
-			pool.all.Add(tx)
-		} else {
-			log.Debug("Try to add duplicated tx:", "hash:", tx.Hash())
 		}
+	}
+	return errs
+}
 
+// add validates a transaction and inserts it into the pool. If the transaction
+// is a replacement for an already pooled one of the same nonce, it overwrites
+// the previous one provided it pays the required price bump.
+//
+// If a newly added transaction is marked as local, its sending account will be
+// whitelisted, preventing any associated transaction from being dropped out of
+// the pool due to pricing constraints.
+func (pool *TxPoolShard) add(tx *types.Transaction, local bool) (bool, error) {
+	// If the transaction is already known, discard it
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil {
+		log.Trace("Discarding already known transaction", "hash", hash)
+		return false, fmt.Errorf("known transaction: %x", hash)
 	}
-	//fmt.Println("txs inpool","shard Id:",pool.shardId," counts:",pool.all.Count())
-	keys := make([]*common.Hash, 0, pool.all.Count())
-	pool.all.Range(func(hash common.Hash, tx *types.Transaction) bool {
-		keys = append(keys, &hash)
-		return true
-	})
-	rawdb.WritePendingTransactions(pool.chain.DB(), keys)
-	return nil
+	// If the transaction fails basic validation, discard it
+	if err := pool.validateTx(tx, local); err != nil {
+		log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
+		invalidTxCounter.Inc(1)
+		return false, err
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	local = local || pool.locals.contains(from)
+
+	// If the transaction pool is full, discard underpriced transactions
+	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
+		// If the new transaction is underpriced, don't accept it
+		if !local && pool.priced.Underpriced(tx, pool.locals) {
+			log.Trace("Discarding underpriced transaction", "hash", hash, "price", tx.GasPrice())
+			underpricedTxCounter.Inc(1)
+			return false, ErrUnderpriced
+		}
+		// New transaction is better than our worse ones, make room for it
+		drop := pool.priced.Discard(pool.all.Count()-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
+		for _, tx := range drop {
+			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
+			underpricedTxCounter.Inc(1)
+			pool.removeTx(tx.Hash(), false)
+		}
+	}
+	list := pool.accounts[from]
+	if list == nil {
+		list = newTxList(false)
+	}
+	// Remote accounts may only occupy a limited number of slots
+	if !local && !list.Overlaps(tx) && uint64(list.Len()) >= pool.config.AccountSlots+pool.config.AccountQueue {
+		log.Trace("Discarding transaction over the account limit", "hash", hash, "from", from)
+		return false, ErrAccountLimit
+	}
+	// Insert the transaction, replacing a pooled one of the same nonce if the
+	// required price bump is met
+	inserted, old := list.Add(tx, pool.config.PriceBump)
+	if !inserted {
+		pendingDiscardCounter.Inc(1)
+		return false, ErrReplaceUnderpriced
+	}
+	pool.accounts[from] = list
+	if old != nil {
+		pool.all.Remove(old.Hash())
+		pool.priced.Removed()
+		pool.journalDelete(old.Hash())
+		pendingReplaceCounter.Inc(1)
+	}
+	pool.all.Add(tx)
+	pool.priced.Put(tx)
+	pool.journalTx(tx)
+
+	if local && !pool.locals.contains(from) {
+		log.Info("Setting new local account", "address", from)
+		pool.locals.add(from)
+	}
+	log.Trace("Pooled new shard transaction", "hash", hash, "from", from, "to", tx.To())
+
+	return old != nil, nil
 }
 
-// Status returns the status (unknown/pending/queued) of a batch of transactions
-// identified by their hashes.
+// Status returns the status (unknown/pending/included/referenced/final) of a
+// batch of transactions identified by their hashes.
 func (pool *TxPoolShard) Status(hashes []common.Hash) []TxStatus {
+	status := make([]TxStatus, len(hashes))
+	for i, txStatus := range pool.ShardStatus(hashes) {
+		if txStatus != nil {
+			status[i] = txStatus.Status
+		}
+	}
+	return status
+}
+
+// ShardStatus returns the lifecycle position of a batch of transactions
+// identified by their hashes, nil for unknown ones. All transactions of a shard
+// pool are pending, the others are looked up in the chain.
+func (pool *TxPoolShard) ShardStatus(hashes []common.Hash) []*ShardTxStatus {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
 
-	return nil
+	status := make([]*ShardTxStatus, len(hashes))
+	for i, hash := range hashes {
+		if pool.all.Get(hash) != nil {
+			status[i] = &ShardTxStatus{Status: TxStatusPending, ShardId: pool.shardId}
+			continue
+		}
+		status[i] = pool.chain.ShardTxStatus(hash)
+	}
+	return status
 }
 
 // Get returns a transaction if it is contained in the pool
@@ -603,7 +822,7 @@ func (pool *TxPoolShard) Get(hash common.Hash) *types.Transaction {
 	if tx == nil {
 		tx2, err := rawdb.ReadRawTransaction(pool.chain.DB(), hash)
 		if err != nil {
-			log.Error("Error read tx:", "hash", hash)
+			log.Debug("Transaction not in shard pool", "hash", hash)
 		} else {
 			tx = tx2
 		}
@@ -611,11 +830,27 @@ func (pool *TxPoolShard) Get(hash common.Hash) *types.Transaction {
 	return tx
 }
 
-// removeTx removes a single transaction from the queue, moving all subsequent
-// transactions back to the future queue.
+// removeTx removes a single transaction from the pool. Out of bound removals
+// happen without the price list knowing about them.
 func (pool *TxPoolShard) removeTx(hash common.Hash, outofbound bool) {
 	// Fetch the transaction we wish to delete
+	tx := pool.all.Get(hash)
+	if tx == nil {
+		return
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated during insertion
+
+	// Remove it from the list of known transactions
 	pool.all.Remove(hash)
+	if outofbound {
+		pool.priced.Removed()
+	}
+	if list := pool.accounts[from]; list != nil {
+		if removed, _ := list.Remove(tx); removed && list.Empty() {
+			delete(pool.accounts, from)
+		}
+	}
+	pool.journalDelete(hash)
 }
 
 // txLookup is used internally by TxPoolShard to track transactions while allowing lookup without
@@ -0,0 +1,82 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/state"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/event"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// Tests that resetting the shard pool to a new head drops the transactions whose
+// nonce the new state already used up, even if no known block included them.
+func TestShardPoolDropsStaleNonces(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	newState := func(nonce uint64) *state.StateDB {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+		statedb.AddBalance(addr, big.NewInt(100000000000000))
+		statedb.SetNonce(addr, nonce)
+		return statedb
+	}
+	chain := &testBlockChain{0, newState(0), 1000000, new(event.Feed)}
+	pool := NewTxPoolShard(*testTxPoolConfig.ToShardConfig(), params.TestChainConfig, chain, 0)
+	defer pool.Stop()
+
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key), transaction(2, 100000, key)}
+	for i, tx := range txs {
+		if _, err := pool.add(tx, false); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	// Move the state past the first two nonces and reset
+	chain.statedb = newState(2)
+	pool.lockedReset(nil, nil)
+
+	if count := pool.all.Count(); count != 1 {
+		t.Fatalf("transaction count mismatch: have %d, want 1", count)
+	}
+	for i, tx := range txs[:2] {
+		if pool.all.Get(tx.Hash()) != nil {
+			t.Errorf("stale transaction %d not dropped", i)
+		}
+	}
+	if pool.all.Get(txs[2].Hash()) == nil {
+		t.Errorf("executable transaction dropped")
+	}
+	if list := pool.accounts[addr]; list == nil || list.Len() != 1 {
+		t.Errorf("account transactions mismatch: have %v, want 1", list)
+	}
+	// Use up the last nonce too, the account must be forgotten
+	chain.statedb = newState(3)
+	pool.lockedReset(nil, nil)
+
+	if count := pool.all.Count(); count != 0 {
+		t.Errorf("transaction count mismatch: have %d, want 0", count)
+	}
+	if _, ok := pool.accounts[addr]; ok {
+		t.Errorf("account without transactions still tracked")
+	}
+}
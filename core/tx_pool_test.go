@@ -78,6 +78,38 @@ func (bc *testBlockChain) StateAt(common.Hash) (*state.StateDB, error) {
 func (bc *testBlockChain) GetShardBlock(shardId uint16, hash  common.Hash,number uint64) (types.BlockIntf) {
 	return nil
 }
+func (bc *testBlockChain) TxShard(master types.HeaderIntf, tx *types.Transaction) (uint16, error) {
+	return bc.shardId, nil
+}
+
+func (bc *testBlockChain) TxShards(master types.HeaderIntf, tx *types.Transaction) ([]uint16, error) {
+	return []uint16{bc.shardId}, nil
+}
+
+func (bc *testBlockChain) AccountShard(master types.HeaderIntf, addr common.Address) uint16 {
+	return bc.shardId
+}
+
+func (bc *testBlockChain) ShardBlockConfirmed(hash common.Hash) bool {
+	return false
+}
+
+func (bc *testBlockChain) CrossShardRejected(blockHash, txHash common.Hash) bool {
+	return true
+}
+
+func (bc *testBlockChain) CurrentMasterHeader() types.HeaderIntf {
+	return nil
+}
+
+func (bc *testBlockChain) DB() ethdb.Database {
+	return nil
+}
+
+func (bc *testBlockChain) ShardTxStatus(hash common.Hash) *ShardTxStatus {
+	return nil
+}
+
 func (bc *testBlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
 	return bc.chainHeadFeed.Subscribe(ch)
 }
@@ -146,7 +178,7 @@ func validateEvents(events chan NewTxsEvent, count int) error {
 		case ev := <-events:
 			received = append(received, ev.Txs...)
 		case <-time.After(time.Second):
-			return fmt.Errorf("event #%d not fired", received)
+			return fmt.Errorf("event #%d not fired", len(received))
 		}
 	}
 	if len(received) > count {
@@ -17,6 +17,9 @@
 package core
 
 import (
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/core/state"
 	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/core/vm"
@@ -40,6 +43,10 @@ type ShardTxsStat struct {
 	BlkNo  uint64
 	Difficulty uint64
 	TxCounts   uint64
+	GasUsed    uint64
+	GasLimit   uint64
+
+	Rejected []*types.RejectedTx // Transactions of the shard block refused by the master
 }
 // Processor is an interface for processing blocks using a given initial state.
 //
@@ -50,3 +57,12 @@ type ShardTxsStat struct {
 type Processor interface {
 	Process(block types.BlockIntf, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, []ShardTxsStat, error)
 }
+
+// ShardTxFetcher retrieves transactions by hash from the nodes of a shard, for
+// shard blocks whose results refer to transactions the local node never saw.
+type ShardTxFetcher interface {
+	// FetchShardTxs requests the given transactions from a peer of a shard, asking
+	// another one whenever a peer fails to deliver before the timeout expires, and
+	// returns the ones delivered.
+	FetchShardTxs(shardId uint16, hashes []common.Hash, timeout time.Duration) []*types.Transaction
+}
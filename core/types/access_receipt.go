@@ -0,0 +1,87 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/crypto"
+)
+
+// ErrInvalidAccessSig is returned if the signature of an access receipt can't
+// be recovered.
+var ErrInvalidAccessSig = errors.New("invalid access receipt signature")
+
+// AccessReceipt acknowledges, signed by the reader, that a storage provider
+// served data to it. Accesses are counted per session: Nonce identifies the
+// session of the reader with the provider and Mask the number of accesses in
+// it so far, so that the latest receipt of a session covers all of them.
+type AccessReceipt struct {
+	Provider common.Address // Account of the storage node to be paid
+	Hash     common.Hash    // Hash of the last data accessed
+	Nonce    uint64         // Session of the reader with the provider
+	Mask     uint16         // Number of accesses in the session
+	Fee      *big.Int       // Fee per access agreed by the reader
+	Sig      []byte         // Signature of the reader over SigHash
+}
+
+// SigHash returns the hash signed by the reader.
+func (r *AccessReceipt) SigHash() common.Hash {
+	return rlpHash([]interface{}{r.Provider, r.Hash, r.Nonce, r.Mask, r.Fee})
+}
+
+// Reader recovers the account which signed the receipt.
+func (r *AccessReceipt) Reader() (common.Address, error) {
+	if len(r.Sig) != 65 || r.Fee == nil {
+		return common.Address{}, ErrInvalidAccessSig
+	}
+	pub, err := crypto.SigToPub(r.SigHash().Bytes(), r.Sig)
+	if err != nil {
+		return common.Address{}, ErrInvalidAccessSig
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// WithSignature returns a copy of the receipt carrying the given signature,
+// which has to be in the [R || S || V] format where V is 0 or 1.
+func (r *AccessReceipt) WithSignature(sig []byte) (*AccessReceipt, error) {
+	if len(sig) != 65 {
+		return nil, ErrInvalidAccessSig
+	}
+	cpy := *r
+	if cpy.Fee == nil {
+		cpy.Fee = new(big.Int)
+	}
+	cpy.Sig = common.CopyBytes(sig)
+	return &cpy, nil
+}
+
+// SignAccessReceipt returns a copy of the receipt signed with the given key.
+func SignAccessReceipt(r *AccessReceipt, prv *ecdsa.PrivateKey) (*AccessReceipt, error) {
+	cpy := *r
+	if cpy.Fee == nil {
+		cpy.Fee = new(big.Int)
+	}
+	sig, err := crypto.Sign(cpy.SigHash().Bytes(), prv)
+	if err != nil {
+		return nil, err
+	}
+	return cpy.WithSignature(sig)
+}
@@ -230,6 +230,7 @@ func (b *Header) SetCoinbase(v common.Address) {
 }
 func (b *Header) SetRoot(v common.Hash) { b.root = v; b.setHashDirty(true) }
 func (b *Header) SetBloom(v Bloom)      { b.bloom = v; b.setHashDirty(true) }
+func (b *Header) SetBloomRejected(v Bloom) { b.bloomReject = v; b.setHashDirty(true) }
 func (b *Header) SetDifficulty(v *big.Int) {
 	b.difficulty = new(big.Int).SetUint64(v.Uint64())
 	b.setHashDirty(true)
@@ -67,6 +67,9 @@ var (
 	ShardEnableLen = 32
 )
 
+// NativeTokenId is the token id of the native EDX balance of an account.
+const NativeTokenId uint64 = 0
+
 type contractReception struct {
 	key   uint64 `json:"key"  	gencodec:"required"`
 	value []byte `json:"value" 	gencodec:"required"`
@@ -0,0 +1,61 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/EDXFund/MasterChain/common"
+)
+
+// CrossShardReceipt is emitted by the source shard of a value transfer whose
+// recipient lives on another shard. The source shard block carries it in the
+// Data of a ContractResult, so it is committed by the result root of the shard
+// header and, through ShardBlockInfo, by the master block including it.
+type CrossShardReceipt struct {
+	SrcShard uint16         `json:"srcShard"  gencodec:"required"`
+	DstShard uint16         `json:"dstShard"  gencodec:"required"`
+	TxHash   common.Hash    `json:"txHash"    gencodec:"required"`
+	From     common.Address `json:"from"      gencodec:"required"`
+	To       common.Address `json:"to"        gencodec:"required"`
+	TokenId  uint64         `json:"tokenId"   gencodec:"required"`
+	Amount   *big.Int       `json:"value"     gencodec:"required"`
+}
+
+// Hash returns the keccak256 hash of the receipt's RLP encoding, which is the
+// key used for replay protection.
+func (r *CrossShardReceipt) Hash() common.Hash {
+	return rlpHash(r)
+}
+
+// CrossShardClaim is the payload of a transaction crediting a cross shard
+// receipt on its destination shard. It carries the header of the source shard
+// block and a merkle proof of the receipt's ContractResult against the result
+// root of that header.
+type CrossShardClaim struct {
+	Header  *SHeaderStruct     // Header of the source shard block
+	Index   uint64             // Position of the receipt in the source block results
+	Receipt *CrossShardReceipt // Receipt being claimed
+	Proof   [][]byte           // Trie nodes proving Results[Index] against Header.ReceiptHash
+}
+
+// BlockHash returns the hash of the source shard block referenced by the claim.
+func (c *CrossShardClaim) BlockHash() common.Hash {
+	header := new(SHeader)
+	header.FillBy(c.Header)
+	return header.Hash()
+}
@@ -0,0 +1,39 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"github.com/EDXFund/MasterChain/common"
+)
+
+// FraudProof shows that the results, gas used or state root of a shard block
+// don't follow from the state of its parent. It carries everything needed to
+// execute the block without access to the shard state: the transactions of its
+// results and a witness of the parent state, made up of the trie nodes and
+// contract code the execution reads. Witness items are addressed by their
+// hash, so they can't be forged.
+type FraudProof struct {
+	Parent  *SHeaderStruct // Header of the parent of the disputed block
+	Block   *SBlock        // Disputed shard block, including its results
+	Txs     Transactions   // Transactions of the block results, in order
+	Witness [][]byte       // Trie nodes and contract code of the parent state
+}
+
+// Hash returns the hash of the disputed block, which identifies the proof.
+func (p *FraudProof) Hash() common.Hash {
+	return p.Block.Hash()
+}
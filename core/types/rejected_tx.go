@@ -0,0 +1,48 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/EDXFund/MasterChain/common"
+)
+
+// RejectedTx records a transaction which a shard block included, but the master
+// refused to apply, e.g. because of an invalid signature, insufficient funds or
+// a nonce conflict.
+type RejectedTx struct {
+	TxHash    common.Hash    // Hash of the rejected transaction
+	From      common.Address // Sender of the transaction, zero if it can't be recovered
+	ShardId   uint16         // Shard which included the transaction
+	BlockHash common.Hash    // Hash of the shard block including the transaction
+	Index     uint64         // Index of the transaction result in the shard block
+	Reason    string         // Error the master refused the transaction with
+}
+
+// CreateRejectBloom creates the bloom filter of the rejected transactions of a
+// master block, covering the hash and the sender of every transaction.
+func CreateRejectBloom(rejected []*RejectedTx) Bloom {
+	bin := new(big.Int)
+	for _, tx := range rejected {
+		bin.Or(bin, bloom9(tx.TxHash.Bytes()))
+		if tx.From != (common.Address{}) {
+			bin.Or(bin, bloom9(tx.From.Bytes()))
+		}
+	}
+	return BytesToBloom(bin.Bytes())
+}
@@ -20,6 +20,10 @@ type SHeader struct {
 	shardId    uint16      `json:"shardId"			gencodec:"required"`
 	parentHash common.Hash `json:"parentHash"       gencodec:"required"`
 
+	// master block whose shard layouts route the transactions of this block
+	masterHash   common.Hash `json:"masterHash"       gencodec:"required"`
+	masterNumber uint64      `json:"masterNumber"     gencodec:"required"`
+
 	coinbase    common.Address `json:"miner"            gencodec:"required"`
 	root        common.Hash    `json:"stateRoot,omitempty"        gencodec:"nil"`
 	txHash      common.Hash    `json:"transactionsRoot,omitempty" gencodec:"nil"`
@@ -40,6 +44,9 @@ type SHeaderStruct struct {
 	ShardId    uint16      `json:"shardId"			gencodec:"required"`
 	ParentHash common.Hash `json:"parentHash"       gencodec:"required"`
 
+	MasterHash   common.Hash `json:"masterHash"       gencodec:"required"`
+	MasterNumber uint64      `json:"masterNumber"     gencodec:"required"`
+
 	Coinbase    common.Address `json:"miner"            gencodec:"required"`
 	Root        common.Hash    `json:"stateRoot,omitempty"        gencodec:"nil"`
 	TxHash      common.Hash    `json:"transactionsRoot,omitempty" gencodec:"nil"`
@@ -57,11 +64,13 @@ type SHeaderStruct struct {
 }
 
 type SHeaderMarshal struct {
-	ShardId    uint16         `json:"shardId"			gencodec:"required"`
-	ParentHash common.Hash    `json:"parentHash"       gencodec:"required"`
-	Coinbase   common.Address `json:"miner"            gencodec:"required"`
-	Root       common.Hash    `json:"stateRoot"        gencodec:"required"`
-	TxHash     common.Hash    `json:"transactionsRoot" gencodec:"required"`
+	ShardId      uint16         `json:"shardId"			gencodec:"required"`
+	ParentHash   common.Hash    `json:"parentHash"       gencodec:"required"`
+	MasterHash   common.Hash    `json:"masterHash"       gencodec:"required"`
+	MasterNumber hexutil.Uint64 `json:"masterNumber"     gencodec:"required"`
+	Coinbase     common.Address `json:"miner"            gencodec:"required"`
+	Root         common.Hash    `json:"stateRoot"        gencodec:"required"`
+	TxHash       common.Hash    `json:"transactionsRoot" gencodec:"required"`
 	// hash of shard block included in this master block
 	ReceiptHash common.Hash    `json:"receiptsRoot"     gencodec:"required"`
 	Bloom       Bloom          `json:"logsBloom"        gencodec:"required"`
@@ -76,21 +85,23 @@ type SHeaderMarshal struct {
 	Hash        common.Hash    `json:"hash"`
 }
 type SHeaderUnmarshal struct {
-	ShardId     uint16          `json:"shardId"			gencodec:"required"`
-	ParentHash  *common.Hash    `json:"parentHash"       gencodec:"required"`
-	Coinbase    *common.Address `json:"miner"            gencodec:"required"`
-	Root        *common.Hash    `json:"stateRoot"        gencodec:"required"`
-	TxHash      *common.Hash    `json:"transactionsRoot" gencodec:"required"`
-	ReceiptHash *common.Hash    `json:"receiptsRoot"     gencodec:"required"`
-	Bloom       *Bloom          `json:"logsBloom"        gencodec:"required"`
-	Difficulty  *big.Int        `json:"difficulty"       gencodec:"required"`
-	Number      *big.Int        `json:"number"           gencodec:"required"`
-	GasLimit    *hexutil.Uint64 `json:"gasLimit"         gencodec:"required"`
-	GasUsed     *hexutil.Uint64 `json:"gasUsed"          gencodec:"required"`
-	Time        *big.Int        `json:"timestamp"        gencodec:"required"`
-	Extra       *hexutil.Bytes  `json:"extraData"        gencodec:"required"`
-	MixDigest   *common.Hash    `json:"mixHash"          gencodec:"required"`
-	Nonce       *BlockNonce     `json:"nonce"            gencodec:"required"`
+	ShardId      uint16          `json:"shardId"			gencodec:"required"`
+	ParentHash   *common.Hash    `json:"parentHash"       gencodec:"required"`
+	MasterHash   *common.Hash    `json:"masterHash"       gencodec:"required"`
+	MasterNumber *hexutil.Uint64 `json:"masterNumber"     gencodec:"required"`
+	Coinbase     *common.Address `json:"miner"            gencodec:"required"`
+	Root         *common.Hash    `json:"stateRoot"        gencodec:"required"`
+	TxHash       *common.Hash    `json:"transactionsRoot" gencodec:"required"`
+	ReceiptHash  *common.Hash    `json:"receiptsRoot"     gencodec:"required"`
+	Bloom        *Bloom          `json:"logsBloom"        gencodec:"required"`
+	Difficulty   *big.Int        `json:"difficulty"       gencodec:"required"`
+	Number       *big.Int        `json:"number"           gencodec:"required"`
+	GasLimit     *hexutil.Uint64 `json:"gasLimit"         gencodec:"required"`
+	GasUsed      *hexutil.Uint64 `json:"gasUsed"          gencodec:"required"`
+	Time         *big.Int        `json:"timestamp"        gencodec:"required"`
+	Extra        *hexutil.Bytes  `json:"extraData"        gencodec:"required"`
+	MixDigest    *common.Hash    `json:"mixHash"          gencodec:"required"`
+	Nonce        *BlockNonce     `json:"nonce"            gencodec:"required"`
 }
 
 type SInfo struct {
@@ -122,6 +133,8 @@ func (h *SHeader) Hash() common.Hash {
 func (h *SHeader) FillBy(h2 *SHeaderStruct) {
 	h.shardId = h2.ShardId
 	h.parentHash = h2.ParentHash
+	h.masterHash = h2.MasterHash
+	h.masterNumber = h2.MasterNumber
 
 	h.coinbase = h2.Coinbase
 	h.root = h2.Root
@@ -140,21 +153,23 @@ func (h *SHeader) FillBy(h2 *SHeaderStruct) {
 }
 func (h *SHeader) ToStruct() *SHeaderStruct {
 	return &SHeaderStruct{
-		ShardId:     h.shardId,
-		ParentHash:  h.parentHash,
-		Coinbase:    h.coinbase,
-		Root:        h.root,
-		TxHash:      h.txHash,
-		ReceiptHash: h.receiptHash,
-		Bloom:       h.bloom,
-		Difficulty:  h.difficulty,
-		Number:      h.number,
-		GasLimit:    h.gasLimit,
-		GasUsed:     h.gasUsed,
-		Time:        h.time,
-		Extra:       h.extra,
-		MixDigest:   h.mixDigest,
-		Nonce:       h.nonce,
+		ShardId:      h.shardId,
+		ParentHash:   h.parentHash,
+		MasterHash:   h.masterHash,
+		MasterNumber: h.masterNumber,
+		Coinbase:     h.coinbase,
+		Root:         h.root,
+		TxHash:       h.txHash,
+		ReceiptHash:  h.receiptHash,
+		Bloom:        h.bloom,
+		Difficulty:   h.difficulty,
+		Number:       h.number,
+		GasLimit:     h.gasLimit,
+		GasUsed:      h.gasUsed,
+		Time:         h.time,
+		Extra:        h.extra,
+		MixDigest:    h.mixDigest,
+		Nonce:        h.nonce,
 	}
 }
 
@@ -193,6 +208,8 @@ func (b *SHeader) Bloom() Bloom              { return b.bloom }
 func (b *SHeader) Coinbase() common.Address  { return b.coinbase }
 func (b *SHeader) Root() common.Hash         { return b.root }
 func (b *SHeader) ParentHash() common.Hash   { return b.parentHash }
+func (b *SHeader) MasterHash() common.Hash   { return b.masterHash }
+func (b *SHeader) MasterNumber() uint64      { return b.masterNumber }
 func (b *SHeader) TxHash() common.Hash       { return b.txHash }
 func (b *SHeader) ReceiptHash() common.Hash  { return b.receiptHash }
 func (b *SHeader) Extra() []byte             { return b.extra }
@@ -205,6 +222,8 @@ func (b *SHeader) SetNumber(v *big.Int)  { b.number = new(big.Int).Set(v); b.set
 func (b *SHeader) SetNumberU64(v uint64) { b.number = new(big.Int).SetUint64(v); b.setHashDirty(true) }
 
 func (b *SHeader) SetParentHash(v common.Hash)  { b.parentHash = v; b.setHashDirty(true) }
+func (b *SHeader) SetMasterHash(v common.Hash)  { b.masterHash = v; b.setHashDirty(true) }
+func (b *SHeader) SetMasterNumber(v uint64)     { b.masterNumber = v; b.setHashDirty(true) }
 func (b *SHeader) SetUncleHash(v common.Hash)   { ; b.setHashDirty(true) }
 func (b *SHeader) SetReceiptHash(v common.Hash) { b.receiptHash = v; b.setHashDirty(true) }
 func (b *SHeader) SetTxHash(v common.Hash)      { b.txHash = v; b.setHashDirty(true) }
@@ -214,7 +233,7 @@ func (b *SHeader) SetExtra(v []byte) {
 }
 func (b *SHeader) SetTime(v *big.Int)           { b.time = v; b.setHashDirty(true) }
 func (b *SHeader) SetCoinbase(v common.Address) { b.coinbase = v; b.setHashDirty(true) }
-func (b *SHeader) SetRoot(v common.Hash)        { /*b.root = v; b.setHashDirty(true) */ }
+func (b *SHeader) SetRoot(v common.Hash)        { b.root = v; b.setHashDirty(true) }
 func (b *SHeader) SetBloom(v Bloom)             { b.bloom = v; b.setHashDirty(true) }
 func (b *SHeader) SetDifficulty(v *big.Int) {
 	b.difficulty = new(big.Int).SetUint64(v.Uint64())
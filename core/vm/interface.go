@@ -31,6 +31,10 @@ type StateDB interface {
 	AddBalance(common.Address, *big.Int)
 	GetBalance(common.Address) *big.Int
 
+	SubTokenBalance(common.Address, uint64, *big.Int)
+	AddTokenBalance(common.Address, uint64, *big.Int)
+	GetTokenBalance(common.Address, uint64) *big.Int
+
 	GetNonce(common.Address) uint64
 	SetNonce(common.Address, uint64)
 
@@ -42,6 +42,12 @@ const menuSkeletons: Array<{|id: string, menu: ProvidedMenuProp|}> = [
 			title: 'Network',
 			icon:  'globe',
 		},
+	}, {
+		id:   'shard',
+		menu: {
+			title: 'Shards',
+			icon:  'sitemap',
+		},
 	}, {
 		id:   'system',
 		menu: {
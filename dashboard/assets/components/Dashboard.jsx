@@ -99,6 +99,11 @@ const defaultContent: () => Content = () => ({
 		diskRead:       [],
 		diskWrite:      [],
 	},
+	shard: {
+		exp:     0,
+		enabled: null,
+		shards:  [],
+	},
 	logs: {
 		chunks:        [],
 		endTop:        false,
@@ -130,6 +135,11 @@ const updaters = {
 		diskRead:       appender(200),
 		diskWrite:      appender(200),
 	},
+	shard: {
+		exp:     replacer,
+		enabled: replacer,
+		shards:  replacer,
+	},
 	logs: logInserter(5),
 };
 
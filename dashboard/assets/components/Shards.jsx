@@ -0,0 +1,105 @@
+// @flow
+
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+import React, {Component} from 'react';
+
+import Table, {TableBody, TableCell, TableHead, TableRow} from 'material-ui/Table';
+import type {Shard} from '../types/content';
+
+// enabledShards decodes the hex encoded bitmap of the enabled shards into the list
+// of enabled shard ids. Shard 0 is always enabled.
+const enabledShards = (bitmap: ?string) => {
+	const ids = [0];
+	if (typeof bitmap !== 'string') {
+		return ids;
+	}
+	const hex = bitmap.startsWith('0x') ? bitmap.slice(2) : bitmap;
+	for (let i = 0; i < hex.length / 2; i++) {
+		const byte = parseInt(hex.substr(i * 2, 2), 16);
+		for (let bit = 0; bit < 8; bit++) {
+			const id = i * 8 + bit;
+			if (id !== 0 && (byte & (1 << bit)) !== 0) {
+				ids.push(id);
+			}
+		}
+	}
+	return ids;
+};
+
+// styles contains the constant styles of the component.
+const styles = {
+	layout: {
+		marginBottom: 16,
+	},
+};
+
+export type Props = {
+	content:      Shard,
+	shouldUpdate: Object,
+};
+
+// Shards renders the shard layout of the master chain and the state of the shard chains.
+class Shards extends Component<Props> {
+	shouldComponentUpdate(nextProps) {
+		return typeof nextProps.shouldUpdate.shard !== 'undefined';
+	}
+
+	render() {
+		const {content} = this.props;
+		if (!Array.isArray(content.shards) || content.shards.length < 1) {
+			return <div>No shard chains tracked by this node.</div>;
+		}
+		const enabled = new Set(enabledShards(content.enabled));
+
+		return (
+			<div>
+				<div style={styles.layout}>
+					Routing key bits: {content.exp}, enabled shards: {[...enabled].join(', ')}
+				</div>
+				<Table>
+					<TableHead>
+						<TableRow>
+							<TableCell>Shard</TableCell>
+							<TableCell>Enabled</TableCell>
+							<TableCell numeric>Head</TableCell>
+							<TableCell numeric>Total difficulty</TableCell>
+							<TableCell numeric>Pending headers</TableCell>
+							<TableCell numeric>Txs per block</TableCell>
+							<TableCell numeric>Reward remains</TableCell>
+						</TableRow>
+					</TableHead>
+					<TableBody>
+						{content.shards.map(shard => (
+							<TableRow key={shard.shardId}>
+								<TableCell>{shard.shardId}</TableCell>
+								<TableCell>{enabled.has(shard.shardId) ? 'yes' : 'no'}</TableCell>
+								<TableCell numeric>{shard.head}</TableCell>
+								<TableCell numeric>{shard.td}</TableCell>
+								<TableCell numeric>{shard.pending}</TableCell>
+								<TableCell numeric>{shard.txs.toFixed(2)}</TableCell>
+								<TableCell numeric>{shard.rewardRemains}</TableCell>
+							</TableRow>
+						))}
+					</TableBody>
+				</Table>
+			</div>
+		);
+	}
+}
+
+export default Shards;
@@ -23,6 +23,7 @@ export type Content = {
 	txpool:  TxPool,
 	network: Network,
 	system:  System,
+	shard:   Shard,
 	logs:    Logs,
 };
 
@@ -65,6 +66,21 @@ export type System = {
 	diskWrite:      ChartEntries,
 };
 
+export type Shard = {
+	exp:     number,
+	enabled: ?string,
+	shards:  Array<ShardEntry>,
+};
+
+export type ShardEntry = {
+	shardId:       number,
+	head:          number,
+	td:            number,
+	pending:       number,
+	txs:           number,
+	rewardRemains: number,
+};
+
 export type Record = {
 	t:   string,
 	lvl: Object,
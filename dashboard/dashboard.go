@@ -66,7 +66,8 @@ type Dashboard struct {
 	history  *Message
 	lock     sync.RWMutex // Lock protecting the dashboard's internals
 
-	logdir string
+	logdir  string
+	backend ShardBackend // Master node the shard view is collected from, nil if not available
 
 	quit chan chan error // Channel used for graceful exit
 	wg   sync.WaitGroup
@@ -79,8 +80,9 @@ type client struct {
 	logger log.Logger      // Logger for the particular live websocket connection
 }
 
-// New creates a new dashboard instance with the given configuration.
-func New(config *Config, commit string, logdir string) *Dashboard {
+// New creates a new dashboard instance with the given configuration. The shard
+// view is only populated if a master node backend is given.
+func New(config *Config, commit string, logdir string, backend ShardBackend) *Dashboard {
 	now := time.Now()
 	versionMeta := ""
 	if len(params.VersionMeta) > 0 {
@@ -106,7 +108,8 @@ func New(config *Config, commit string, logdir string) *Dashboard {
 				DiskWrite:      emptyChartEntries(now, diskWriteSampleLimit, config.Refresh),
 			},
 		},
-		logdir: logdir,
+		logdir:  logdir,
+		backend: backend,
 	}
 }
 
@@ -388,6 +391,13 @@ func (db *Dashboard) collectData() {
 					DiskWrite:      ChartEntries{diskWrite},
 				},
 			})
+			if shard := db.collectShards(); shard != nil {
+				db.lock.Lock()
+				db.history.Shard = shard
+				db.lock.Unlock()
+
+				db.sendToAll(&Message{Shard: shard})
+			}
 		}
 	}
 }
@@ -19,6 +19,8 @@ package dashboard
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/EDXFund/MasterChain/common/hexutil"
 )
 
 type Message struct {
@@ -28,6 +30,7 @@ type Message struct {
 	TxPool  *TxPoolMessage  `json:"txpool,omitempty"`
 	Network *NetworkMessage `json:"network,omitempty"`
 	System  *SystemMessage  `json:"system,omitempty"`
+	Shard   *ShardMessage   `json:"shard,omitempty"`
 	Logs    *LogsMessage    `json:"logs,omitempty"`
 }
 
@@ -70,6 +73,24 @@ type SystemMessage struct {
 	DiskWrite      ChartEntries `json:"diskWrite,omitempty"`
 }
 
+// ShardMessage contains the shard layout of the master chain and the state of
+// every known shard chain.
+type ShardMessage struct {
+	Exp     uint16        `json:"exp"`     // Number of routing key bits of the shard layout
+	Enabled hexutil.Bytes `json:"enabled"` // Bitmap of the enabled shards
+	Shards  []*ShardEntry `json:"shards"`
+}
+
+// ShardEntry contains the state of a single shard chain.
+type ShardEntry struct {
+	ShardId       uint16  `json:"shardId"`
+	Head          uint64  `json:"head"`          // Number of the heaviest known shard block
+	Td            uint64  `json:"td"`            // Total difficulty of the heaviest known shard block
+	Pending       int     `json:"pending"`       // Number of headers in the unconfirmed header tree
+	Txs           float64 `json:"txs"`           // Average number of transactions per included shard block
+	RewardRemains uint32  `json:"rewardRemains"` // Reward remaining to the shard in the master head
+}
+
 // LogsMessage wraps up a log chunk. If Source isn't present, the chunk is a stream chunk.
 type LogsMessage struct {
 	Source *LogFile        `json:"source,omitempty"` // Attributes of the log file.
@@ -0,0 +1,117 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dashboard
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/common/hexutil"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/qchain"
+)
+
+const shardBlockSampleLimit = 32 // Maximum number of master blocks the shard block samples are taken from
+
+// ShardBackend is the part of a master node the shard view is collected from.
+type ShardBackend interface {
+	BlockChain() *core.BlockChain
+	ShardPool() *qchain.ShardChainPool
+}
+
+// shardChain is the part of the master chain the shard view is collected from.
+type shardChain interface {
+	CurrentBlock() types.BlockIntf
+	GetBlock(hash common.Hash, number uint64) types.BlockIntf
+}
+
+// shardPool is the part of the shard chain pool the shard view is collected from.
+type shardPool interface {
+	GetMaxTds() map[uint16]types.ShardBlockInfo
+	PendingCounts() map[uint16]int
+}
+
+// collectShards assembles the current state of the shard chains, or returns nil
+// if the node doesn't track them.
+func (db *Dashboard) collectShards() *ShardMessage {
+	if db.backend == nil || db.backend.ShardPool() == nil {
+		return nil
+	}
+	return newShardMessage(db.backend.BlockChain(), db.backend.ShardPool())
+}
+
+// newShardMessage assembles the shard layout of the master chain head and the
+// state of the shard chains known to the pool.
+func newShardMessage(chain shardChain, pool shardPool) *ShardMessage {
+	var (
+		head    = chain.CurrentBlock()
+		layout  = core.LayoutOf(head.Header())
+		entries = make(map[uint16]*ShardEntry)
+	)
+	entry := func(shardId uint16) *ShardEntry {
+		if e, ok := entries[shardId]; ok {
+			return e
+		}
+		e := &ShardEntry{ShardId: shardId}
+		entries[shardId] = e
+		return e
+	}
+	for shardId, info := range pool.GetMaxTds() {
+		e := entry(shardId)
+		e.Head, e.Td = info.BlockNumber, info.Td
+	}
+	for shardId, count := range pool.PendingCounts() {
+		entry(shardId).Pending = count
+	}
+	for _, state := range head.Header().ToHeader().ShardState() {
+		entry(state.ShardId).RewardRemains = state.RewardRemains
+	}
+	// Sample the transactions of the shard blocks included by recent master blocks
+	var (
+		blocks = make(map[uint16]uint64)
+		txs    = make(map[uint16]uint64)
+	)
+	for i, block := 0, head; i < shardBlockSampleLimit && block != nil && !reflect.ValueOf(block).IsNil(); i++ {
+		for _, info := range block.ShardBlocks() {
+			if shardBlock := chain.GetBlock(info.Hash, info.BlockNumber); shardBlock != nil && !reflect.ValueOf(shardBlock).IsNil() {
+				stat := core.NewShardTxsStat(shardBlock)
+				blocks[stat.ShardId]++
+				txs[stat.ShardId] += stat.TxCounts
+			}
+		}
+		if block.NumberU64() == 0 {
+			break
+		}
+		block = chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	for shardId, count := range blocks {
+		entry(shardId).Txs = float64(txs[shardId]) / float64(count)
+	}
+	shards := make([]*ShardEntry, 0, len(entries))
+	for _, e := range entries {
+		shards = append(shards, e)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ShardId < shards[j].ShardId })
+
+	return &ShardMessage{
+		Exp:     layout.Exp,
+		Enabled: hexutil.Bytes(layout.Enabled[:]),
+		Shards:  shards,
+	}
+}
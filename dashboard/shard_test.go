@@ -0,0 +1,108 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dashboard
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+)
+
+// testShardChain is a master chain along with the shard blocks it includes.
+type testShardChain struct {
+	head   types.BlockIntf
+	blocks map[common.Hash]types.BlockIntf
+}
+
+func (c *testShardChain) CurrentBlock() types.BlockIntf { return c.head }
+
+func (c *testShardChain) GetBlock(hash common.Hash, number uint64) types.BlockIntf {
+	if block, ok := c.blocks[hash]; ok && block.NumberU64() == number {
+		return block
+	}
+	return nil
+}
+
+// testShardPool is a shard chain pool with fixed shard heads and header trees.
+type testShardPool struct {
+	heads   map[uint16]types.ShardBlockInfo
+	pending map[uint16]int
+}
+
+func (p *testShardPool) GetMaxTds() map[uint16]types.ShardBlockInfo { return p.heads }
+func (p *testShardPool) PendingCounts() map[uint16]int              { return p.pending }
+
+// add inserts a shard block with the given number of transactions, returning
+// its inclusion info.
+func (c *testShardChain) add(shardId uint16, number int64, txs int) *types.ShardBlockInfo {
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: shardId, Number: big.NewInt(number), Difficulty: big.NewInt(1), Time: new(big.Int)})
+
+	block := types.NewSBlock(header, make([]*types.ContractResult, txs))
+	c.blocks[block.Hash()] = block
+	return &types.ShardBlockInfo{ShardId: shardId, BlockNumber: block.NumberU64(), Hash: block.Hash()}
+}
+
+// Tests that the shard view merges the shard heads and header trees of the pool
+// with the layout, rewards and included shard blocks of the master chain.
+func TestCollectShards(t *testing.T) {
+	chain := &testShardChain{blocks: make(map[common.Hash]types.BlockIntf)}
+
+	// Master block 1 includes two blocks of shard 1, the head one block of each shard
+	header := new(types.Header)
+	header.FillBy(&types.HeaderStruct{Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: new(big.Int)})
+	parent := types.NewBlock(header, []*types.ShardBlockInfo{chain.add(1, 1, 2), chain.add(1, 2, 4)}, nil, nil)
+	chain.blocks[parent.Hash()] = parent
+
+	header = new(types.Header)
+	header.FillBy(&types.HeaderStruct{
+		ParentHash:   parent.Hash(),
+		Number:       big.NewInt(2),
+		Difficulty:   big.NewInt(1),
+		Time:         new(big.Int),
+		ShardMaskEp:  1,
+		ShardEnabled: [32]byte{0x03},
+		ShardState:   []types.ShardState{{ShardId: 0, RewardRemains: 7}, {ShardId: 1, RewardRemains: 9}},
+	})
+	chain.head = types.NewBlock(header, []*types.ShardBlockInfo{chain.add(0, 1, 1), chain.add(1, 3, 9)}, nil, nil)
+	chain.blocks[chain.head.Hash()] = chain.head
+
+	// The pool knows a shard the master chain has included nothing of yet
+	pool := &testShardPool{
+		heads:   map[uint16]types.ShardBlockInfo{1: {ShardId: 1, BlockNumber: 5, Td: 6}, 2: {ShardId: 2, BlockNumber: 1, Td: 2}},
+		pending: map[uint16]int{1: 3, 2: 1},
+	}
+	msg := newShardMessage(chain, pool)
+	if msg.Exp != 1 || len(msg.Enabled) != 32 || msg.Enabled[0] != 0x03 {
+		t.Errorf("layout mismatch: have exp %d, enabled %x", msg.Exp, msg.Enabled)
+	}
+	want := []ShardEntry{
+		{ShardId: 0, Txs: 1, RewardRemains: 7},
+		{ShardId: 1, Head: 5, Td: 6, Pending: 3, Txs: 5, RewardRemains: 9},
+		{ShardId: 2, Head: 1, Td: 2, Pending: 1},
+	}
+	if len(msg.Shards) != len(want) {
+		t.Fatalf("shard count mismatch: have %d, want %d", len(msg.Shards), len(want))
+	}
+	for i, shard := range msg.Shards {
+		if *shard != want[i] {
+			t.Errorf("shard %d: entry mismatch: have %+v, want %+v", i, *shard, want[i])
+		}
+	}
+}
@@ -114,6 +114,11 @@ func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (type
 	return b.eth.blockchain.GetReceiptsByHash(hash), nil
 }
 
+func (b *EthAPIBackend) GetRejectedTx(ctx context.Context, txHash common.Hash) (*types.RejectedTx, common.Hash, uint64, error) {
+	rejected, blockHash, number := b.eth.blockchain.GetRejectedTx(txHash)
+	return rejected, blockHash, number, nil
+}
+
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
 	receipts := b.eth.blockchain.GetReceiptsByHash(hash)
 	if receipts == nil {
@@ -182,6 +187,10 @@ func (b *EthAPIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (
 	return b.eth.txPool.State().GetNonce(addr), nil
 }
 
+func (b *EthAPIBackend) GetShardTxStatus(ctx context.Context, txHash common.Hash) (*core.ShardTxStatus, error) {
+	return b.eth.txPool.ShardStatus([]common.Hash{txHash})[0], nil
+}
+
 func (b *EthAPIBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats()
 }
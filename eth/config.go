@@ -87,6 +87,10 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// ShardPruneDepth is the number of confirmations after which a master node
+	// drops the bodies of the shard blocks it keeps (0 = keep all).
+	ShardPruneDepth uint64 `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -168,6 +168,77 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// NewRejectedTransactionFilter creates a filter that fetches the hashes of the
+// transactions sent by one of the given addresses, or by anyone if none is given,
+// which a shard included but the master refused to apply.
+//
+// It is part of the filter package because this filter can be used through the
+// `eth_getFilterChanges` polling method that is also used for log filters.
+func (api *PublicFilterAPI) NewRejectedTransactionFilter(addresses []common.Address) rpc.ID {
+	var (
+		rejectedTxs   = make(chan []common.Hash)
+		rejectedTxSub = api.events.SubscribeRejectedTxs(addresses, rejectedTxs)
+	)
+
+	api.filtersMu.Lock()
+	api.filters[rejectedTxSub.ID] = &filter{typ: RejectedTransactionsSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: rejectedTxSub}
+	api.filtersMu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case rh := <-rejectedTxs:
+				api.filtersMu.Lock()
+				if f, found := api.filters[rejectedTxSub.ID]; found {
+					f.hashes = append(f.hashes, rh...)
+				}
+				api.filtersMu.Unlock()
+			case <-rejectedTxSub.Err():
+				api.filtersMu.Lock()
+				delete(api.filters, rejectedTxSub.ID)
+				api.filtersMu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return rejectedTxSub.ID
+}
+
+// RejectedTransactions creates a subscription that is triggered each time an
+// imported master block refuses to apply a transaction sent by one of the given
+// addresses, or by anyone if none is given.
+func (api *PublicFilterAPI) RejectedTransactions(ctx context.Context, addresses []common.Address) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		txHashes := make(chan []common.Hash, 128)
+		rejectedTxSub := api.events.SubscribeRejectedTxs(addresses, txHashes)
+
+		for {
+			select {
+			case hashes := <-txHashes:
+				for _, h := range hashes {
+					notifier.Notify(rpcSub.ID, h)
+				}
+			case <-rpcSub.Err():
+				rejectedTxSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				rejectedTxSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
@@ -428,7 +499,7 @@ func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 		f.deadline.Reset(deadline)
 
 		switch f.typ {
-		case PendingTransactionsSubscription, BlocksSubscription:
+		case PendingTransactionsSubscription, BlocksSubscription, RejectedTransactionsSubscription:
 			hashes := f.hashes
 			f.hashes = nil
 			return returnHashes(hashes), nil
@@ -322,6 +322,18 @@ Logs:
 	return nil
 }
 
+// filterRejected returns the hashes of the rejected transactions sent by one of
+// the given addresses, or of all of them if no address is given.
+func filterRejected(rejected []*types.RejectedTx, addresses []common.Address) []common.Hash {
+	var hashes []common.Hash
+	for _, tx := range rejected {
+		if len(addresses) == 0 || includes(addresses, tx.From) {
+			hashes = append(hashes, tx.TxHash)
+		}
+	}
+	return hashes
+}
+
 func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		var included bool
@@ -54,6 +54,9 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// RejectedTransactionsSubscription queries tx hashes for transactions
+	// rejected by imported master blocks
+	RejectedTransactionsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -315,6 +318,24 @@ func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscript
 	return es.subscribe(sub)
 }
 
+// SubscribeRejectedTxs creates a subscription that writes the hashes of the
+// transactions sent by one of the given addresses (or by anyone if none is given)
+// which imported master blocks refused to apply.
+func (es *EventSystem) SubscribeRejectedTxs(addresses []common.Address, hashes chan []common.Hash) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       RejectedTransactionsSubscription,
+		logsCrit:  ethereum.FilterQuery{Addresses: addresses},
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    hashes,
+		headers:   make(chan types.HeaderIntf),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 type filterIndex map[Type]map[rpc.ID]*subscription
 
 // broadcast event to filters that match criteria.
@@ -360,6 +381,18 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 		for _, f := range filters[BlocksSubscription] {
 			f.headers <- e.Block.Header()
 		}
+		if len(filters[RejectedTransactionsSubscription]) > 0 && e.Block.ShardId() == types.ShardMaster &&
+			e.Block.BloomRejected() != (types.Bloom{}) {
+			rejected := rawdb.ReadRejectedTxs(es.backend.ChainDb(), e.Block.Hash(), e.Block.NumberU64())
+			for _, f := range filters[RejectedTransactionsSubscription] {
+				if !bloomFilter(e.Block.BloomRejected(), f.logsCrit.Addresses, nil) {
+					continue
+				}
+				if hashes := filterRejected(rejected, f.logsCrit.Addresses); len(hashes) > 0 {
+					f.hashes <- hashes
+				}
+			}
+		}
 		if es.lightMode && len(filters[LogsSubscription]) > 0 {
 			es.lightFilterNewHead(e.Block.Header(), func(header types.HeaderIntf, remove bool) {
 				for _, f := range filters[LogsSubscription] {
@@ -23,10 +23,11 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
 		NoPruning               bool
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		ShardPruneDepth         uint64 `toml:",omitempty"`
+		LightServ               int    `toml:",omitempty"`
+		LightPeers              int    `toml:",omitempty"`
+		SkipBcVersionCheck      bool   `toml:"-"`
+		DatabaseHandles         int    `toml:"-"`
 		DatabaseCache           int
 		TrieCache               int
 		TrieTimeout             time.Duration
@@ -49,6 +50,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
 	enc.NoPruning = c.NoPruning
+	enc.ShardPruneDepth = c.ShardPruneDepth
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
@@ -79,10 +81,11 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
 		NoPruning               *bool
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		ShardPruneDepth         *uint64 `toml:",omitempty"`
+		LightServ               *int    `toml:",omitempty"`
+		LightPeers              *int    `toml:",omitempty"`
+		SkipBcVersionCheck      *bool   `toml:"-"`
+		DatabaseHandles         *int    `toml:"-"`
 		DatabaseCache           *int
 		TrieCache               *int
 		TrieTimeout             *time.Duration
@@ -116,6 +119,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
+	if dec.ShardPruneDepth != nil {
+		c.ShardPruneDepth = *dec.ShardPruneDepth
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -35,6 +35,7 @@ import (
 	"github.com/EDXFund/MasterChain/consensus/misc"
 	"github.com/EDXFund/MasterChain/core"
 	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
 	"github.com/EDXFund/MasterChain/eth/downloader"
 	"github.com/EDXFund/MasterChain/eth/fetcher"
 	"github.com/EDXFund/MasterChain/ethdb"
@@ -44,6 +45,7 @@ import (
 	"github.com/EDXFund/MasterChain/p2p/enode"
 	"github.com/EDXFund/MasterChain/params"
 	"github.com/EDXFund/MasterChain/rlp"
+	"github.com/hashicorp/golang-lru"
 )
 
 const (
@@ -54,6 +56,13 @@ const (
 	// The number is referenced from the size of tx pool.
 	txChanSize = 40960
 
+	// fraudChanSize is the size of channel listening to FraudProofEvent.
+	fraudChanSize = 16
+
+	// fraudCacheSize is the number of checked fraud proofs kept to avoid
+	// verifying the same proof twice.
+	fraudCacheSize = 256
+
 	// minimim number of peers to broadcast new blocks to
 	minBroadcastPeers = 4
 )
@@ -84,6 +93,7 @@ type ProtocolManager struct {
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	shardTxs   *shardTxFetcher
 	peers      *peerSet
 
 	SubProtocols []p2p.Protocol
@@ -92,6 +102,9 @@ type ProtocolManager struct {
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
+	fraudCh       chan core.FraudProofEvent
+	fraudSub      event.Subscription
+	fraudProofs   *lru.Cache // Outcome of the fraud proofs checked, keyed by content hash
 
 	// channels for fetcher, syncer, txsyncLoop
 	newPeerCh   chan *peer
@@ -121,6 +134,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
 	}
+	manager.fraudProofs, _ = lru.New(fraudCacheSize)
 	// Figure out whether to allow fast sync or not
 	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
@@ -206,6 +220,10 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	manager.fetcher = fetcher.New(getblockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
 
+	// Retrieve the transactions of shard blocks missing locally from the shard
+	manager.shardTxs = newShardTxFetcher(manager.peers)
+	blockchain.SetShardTxFetcher(manager.shardTxs)
+
 	return manager, nil
 }
 
@@ -240,6 +258,11 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.minedBlockSub = pm.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go pm.minedBroadcastLoop()
 
+	// broadcast proofs of invalid shard blocks
+	pm.fraudCh = make(chan core.FraudProofEvent, fraudChanSize)
+	pm.fraudSub = pm.blockchain.SubscribeFraudProofEvent(pm.fraudCh)
+	go pm.fraudBroadcastLoop()
+
 	// start sync handlers
 	go pm.syncer()
 	go pm.txsyncLoop()
@@ -250,6 +273,7 @@ func (pm *ProtocolManager) Stop() {
 
 	pm.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	pm.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	pm.fraudSub.Unsubscribe()      // quits fraudBroadcastLoop
 
 	// Quit the sync loop.
 	// After this send has completed, no new peers will be accepted.
@@ -720,10 +744,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
-			// Retrieve the requested block's receipts, skipping if unknown to us
+			// Retrieve the requested block's receipts, skipping if unknown to us.
+			// Shard blocks carry their results in the body and have no receipts.
 			results := pm.blockchain.GetReceiptsByHash(hash)
 			if results == nil {
-				if header := pm.blockchain.GetHeaderByHash(hash); header == nil || reflect.ValueOf(header).IsNil() || header.ReceiptHash() != types.EmptyRootHash {
+				if header := pm.blockchain.GetHeaderByHash(hash); header == nil || reflect.ValueOf(header).IsNil() || (header.ShardId() == types.ShardMaster && header.ReceiptHash() != types.EmptyRootHash) {
 					continue
 				}
 			}
@@ -843,7 +868,68 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddLocals(txs)
+		pm.txpool.AddRemotes(txs)
+
+	case p.version >= eth63 && msg.Code == GetShardTxsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash  common.Hash
+			bytes int
+			txs   types.Transactions
+		)
+		for bytes < softResponseLimit && len(txs) < maxShardTxsFetch {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping unknown ones
+			if tx := pm.txpool.Get(hash); tx != nil {
+				txs = append(txs, tx)
+				bytes += int(tx.Size())
+			}
+		}
+		return p.SendShardTxs(txs)
+
+	case p.version >= eth63 && msg.Code == ShardTxsMsg:
+		// A batch of shard transactions arrived to one of our previous requests
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, tx := range txs {
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+		}
+		pm.shardTxs.deliver(txs)
+
+	case msg.Code == FraudProofMsg:
+		// A shard block was proven invalid, check the proof before relaying it
+		var proof types.FraudProof
+		if err := msg.Decode(&proof); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if proof.Parent == nil || proof.Block == nil {
+			return errResp(ErrDecode, "fraud proof without block")
+		}
+		p.MarkFraudProof(proof.Hash())
+		// Only a malformed proof is the fault of the peer, a valid block or one we
+		// can't execute locally may just be seen differently by it
+		switch err := pm.checkFraudProof(&proof); err {
+		case nil:
+		case core.ErrInvalidFraudProof, core.ErrIncompleteWitness:
+			return errResp(ErrInvalidFraudProof, "%x: %v", proof.Hash(), err)
+		default:
+			p.Log().Debug("Fraud proof not accepted", "hash", proof.Hash(), "err", err)
+		}
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -851,6 +937,34 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	return nil
 }
 
+// checkFraudProof reports a fraud proof to the chain, unless the very same proof
+// was checked before, in which case the former outcome is returned. Proofs of
+// blocks already known to be invalid are not an error. Only outcomes following
+// from the proof itself are cached, ones depending on the local chain may change
+// once it catches up.
+func (pm *ProtocolManager) checkFraudProof(proof *types.FraudProof) error {
+	enc, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		return err
+	}
+	key := crypto.Keccak256Hash(enc)
+	if cached, ok := pm.fraudProofs.Get(key); ok {
+		if cached == nil {
+			return nil
+		}
+		return cached.(error)
+	}
+	err = pm.blockchain.ReportFraud(proof)
+	if err == core.ErrKnownFraud {
+		err = nil
+	}
+	switch err {
+	case nil, core.ErrInvalidFraudProof, core.ErrIncompleteWitness, core.ErrNoFraud:
+		pm.fraudProofs.Add(key, err)
+	}
+	return err
+}
+
 func (pm *ProtocolManager) defineShardId(shardId uint16) (bool, error) {
 
 	selfShardId := pm.blockchain.ShardId()
@@ -983,9 +1097,15 @@ func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
 
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
-		shardId := pm.blockchain.TxShardByHash(tx.Hash())
+		shards, err := pm.blockchain.TxShards(pm.blockchain.CurrentMasterHeader(), tx)
+		if err != nil {
+			log.Debug("Dropping unroutable transaction", "hash", tx.Hash(), "err", err)
+			continue
+		}
 		peers := pm.peers.MasterPeersWithoutTx(tx.Hash())
-		peers = append(peers, pm.peers.ShardPeersWithoutTx(shardId, tx.Hash())...)
+		for _, shardId := range shards {
+			peers = append(peers, pm.peers.ShardPeersWithoutTx(shardId, tx.Hash())...)
+		}
 		for _, peer := range peers {
 			//// must to do
 			txset[peer] = append(txset[peer], tx)
@@ -1028,6 +1148,32 @@ func (pm *ProtocolManager) txBroadcastLoop() {
 	}
 }
 
+// BroadcastFraudProof will propagate a fraud proof to the master peers and the
+// peers of the disputed shard which are not known to already have it.
+func (pm *ProtocolManager) BroadcastFraudProof(proof *types.FraudProof) {
+	hash := proof.Hash()
+	peers := pm.peers.PeersWithoutFraudProof(proof.Block.ShardId(), hash)
+	for _, peer := range peers {
+		if err := peer.SendFraudProof(proof); err != nil {
+			peer.Log().Debug("Failed to send fraud proof", "hash", hash, "err", err)
+		}
+	}
+	log.Trace("Broadcast fraud proof", "hash", hash, "recipients", len(peers))
+}
+
+func (pm *ProtocolManager) fraudBroadcastLoop() {
+	for {
+		select {
+		case event := <-pm.fraudCh:
+			pm.BroadcastFraudProof(event.Proof)
+
+		// Err() channel will be closed when unsubscribing.
+		case <-pm.fraudSub.Err():
+			return
+		}
+	}
+}
+
 // NodeInfo represents a short summary of the Ethereum sub-protocol metadata
 // known about the host peer.
 type NodeInfo struct {
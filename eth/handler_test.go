@@ -32,6 +32,7 @@ import (
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/consensus/ethash"
 	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
 	"github.com/EDXFund/MasterChain/core/state"
 	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/core/vm"
@@ -232,7 +233,7 @@ func testGetBlockHeaders(t *testing.T, protocol int, shardId uint16) {
 			// Send the hash request and verify the response
 			p2p.Send(peer.app, 0x03, tt.query)
 			data, _ := rlp.EncodeToBytes(headers)
-			msg := blockHeaderMsgData{ShardId: shardId, data: data}
+			msg := blockHeaderMsgData{ShardId: shardId, Data: data}
 			if err := p2p.ExpectMsg(peer.app, 0x04, msg); err != nil {
 				t.Errorf("test %d: headers mismatch: %v", i, err)
 			}
@@ -256,7 +257,7 @@ func testGetBlockHeaders(t *testing.T, protocol int, shardId uint16) {
 			// Send the hash request and verify the response
 			p2p.Send(peer.app, 0x03, tt.query)
 			data, _ := rlp.EncodeToBytes(headers)
-			msg := blockHeaderMsgData{ShardId: shardId, data: data}
+			msg := blockHeaderMsgData{ShardId: shardId, Data: data}
 			if err := p2p.ExpectMsg(peer.app, 0x04, msg); err != nil {
 				t.Errorf("test %d: headers mismatch: %v", i, err)
 			}
@@ -577,6 +578,106 @@ func testGetReceipt(t *testing.T, protocol int, shardId uint16) {
 	}
 }
 
+// Tests that the transactions of shard block results can be retrieved based on
+// hashes, both from the shard pool and from the shard blocks including them, and
+// that unknown ones are skipped.
+func TestGetShardTxs63(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	sign := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, big.NewInt(0), params.TxGas, big.NewInt(1), nil, types.NativeTokenId), signer, testBankKey)
+		return tx
+	}
+	// Include a transaction in a shard block, it's only found in the database
+	included := sign(0)
+	generator := func(i int, block *core.BlockGen) {
+		block.AddTx(included)
+	}
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 1, generator, nil, 0)
+	defer pm.Stop()
+
+	txpool := newTestShardTxPool(pm)
+	defer txpool.Stop()
+
+	pending := []*types.Transaction{sign(1), sign(2)}
+	for i, err := range txpool.AddRemotes(pending) {
+		if err != nil {
+			t.Fatalf("transaction %d: failed to add to pool: %v", i, err)
+		}
+	}
+	if tx := txpool.Get(included.Hash()); tx == nil || tx.Hash() != included.Hash() {
+		t.Fatalf("included transaction not served by the pool: %v", tx)
+	}
+	// Pending transactions are synced to new peers before anything else
+	peer, _ := newTestPeer("peer", eth63, pm, true, 0)
+	defer peer.close()
+
+	if err := p2p.ExpectMsg(peer.app, TxMsg, pending); err != nil {
+		t.Fatalf("pending transactions mismatch: %v", err)
+	}
+	hashes := []common.Hash{pending[0].Hash(), {0x01}, included.Hash(), pending[1].Hash()}
+	p2p.Send(peer.app, GetShardTxsMsg, hashes)
+	if err := p2p.ExpectMsg(peer.app, ShardTxsMsg, types.Transactions{pending[0], included, pending[1]}); err != nil {
+		t.Errorf("shard transactions mismatch: %v", err)
+	}
+	// Requesting only unknown transactions yields an empty reply
+	p2p.Send(peer.app, GetShardTxsMsg, []common.Hash{{0x01}, {0x02}})
+	if err := p2p.ExpectMsg(peer.app, ShardTxsMsg, types.Transactions{}); err != nil {
+		t.Errorf("unknown shard transactions mismatch: %v", err)
+	}
+}
+
+// Tests that shard transaction retrievals are capped both in the number of
+// transactions and in the size of the reply.
+func TestGetShardTxsLimits63(t *testing.T) {
+	pm, db := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil, 0)
+	defer pm.Stop()
+
+	txpool := newTestShardTxPool(pm)
+	defer txpool.Stop()
+
+	// The transactions are only found in the database
+	peer, _ := newTestPeer("peer", eth63, pm, true, 0)
+	defer peer.close()
+
+	// Request more transactions than served at once
+	var (
+		hashes []common.Hash
+		txs    types.Transactions
+	)
+	for i := 0; i < maxShardTxsFetch+10; i++ {
+		tx := newTestTransaction(testBankKey, uint64(i), 0)
+		rawdb.WriteRawTransaction(db, tx.Hash(), tx)
+
+		hashes = append(hashes, tx.Hash())
+		txs = append(txs, tx)
+	}
+	p2p.Send(peer.app, GetShardTxsMsg, hashes)
+	if err := p2p.ExpectMsg(peer.app, ShardTxsMsg, txs[:maxShardTxsFetch]); err != nil {
+		t.Errorf("count limited shard transactions mismatch: %v", err)
+	}
+	// Request transactions exceeding the response size limit
+	hashes = nil
+
+	var limited types.Transactions
+	for i, bytes := 0, 0; i < 16; i++ {
+		tx := newTestTransaction(testBankKey, uint64(i), 256*1024)
+		rawdb.WriteRawTransaction(db, tx.Hash(), tx)
+
+		hashes = append(hashes, tx.Hash())
+		if bytes < softResponseLimit {
+			limited = append(limited, tx)
+			bytes += int(tx.Size())
+		}
+	}
+	if len(limited) == len(hashes) {
+		t.Fatalf("size limit not reached by %d transactions", len(hashes))
+	}
+	p2p.Send(peer.app, GetShardTxsMsg, hashes)
+	if err := p2p.ExpectMsg(peer.app, ShardTxsMsg, limited); err != nil {
+		t.Errorf("size limited shard transactions mismatch: %v", err)
+	}
+}
+
 /*
 // Tests that post eth protocol handshake, DAO fork-enabled clients also execute
 // a DAO "challenge" verifying each others' DAO fork headers to ensure they're on
@@ -617,7 +718,7 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 	if err != nil {
 		t.Fatalf("failed to create new blockchain: %v", err)
 	}
-	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), pow, blockchain, db)
+	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), newTestShardPool(blockchain, db), pow, blockchain, db)
 	if err != nil {
 		t.Fatalf("failed to start test protocol manager: %v", err)
 	}
@@ -709,7 +810,7 @@ func testBroadcastBlock(t *testing.T, totalPeers, broadcastExpected int, shardId
 	if err != nil {
 		t.Fatalf("failed to create new blockchain: %v", err)
 	}
-	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), pow, blockchain, db)
+	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), newTestShardPool(blockchain, db), pow, blockchain, db)
 	if err != nil {
 		t.Fatalf("failed to start test protocol manager: %v", err)
 	}
@@ -767,3 +868,75 @@ outer:
 		t.Errorf("block broadcast to %d peers, expected %d", receivedCount, broadcastExpected)
 	}
 }
+
+// Tests that a peer relaying an invalid fraud proof is dropped, and that every
+// proof is only checked once.
+func TestFraudProofInvalid(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil, types.ShardMaster)
+	defer pm.Stop()
+
+	// Dispute a block which doesn't descend from the parent of the proof
+	parent := new(types.SHeader)
+	parent.FillBy(&types.SHeaderStruct{ShardId: 0, Number: big.NewInt(0), Difficulty: big.NewInt(1), Time: big.NewInt(0)})
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: 0, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10)})
+	proof := &types.FraudProof{Parent: parent.ToStruct(), Block: types.NewSBlockWithHeader(header)}
+
+	if err := pm.checkFraudProof(proof); err != core.ErrInvalidFraudProof {
+		t.Fatalf("fraud proof error mismatch: have %v, want %v", err, core.ErrInvalidFraudProof)
+	}
+	if err := pm.checkFraudProof(proof); err != core.ErrInvalidFraudProof {
+		t.Fatalf("cached fraud proof error mismatch: have %v, want %v", err, core.ErrInvalidFraudProof)
+	}
+	if checked := pm.fraudProofs.Len(); checked != 1 {
+		t.Fatalf("checked fraud proof count mismatch: have %d, want 1", checked)
+	}
+	// Relay the proof and make sure the peer is dropped
+	p, errc := newTestPeer("peer", eth63, pm, true, types.ShardMaster)
+	defer p.close()
+
+	if err := p2p.Send(p.app, FraudProofMsg, proof); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatalf("peer dropped without error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("peer relaying an invalid fraud proof not dropped")
+	}
+}
+
+// Tests that a fraud proof which can't be checked against the local chain is
+// neither cached nor held against the relaying peer.
+func TestFraudProofUnverifiable(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil, types.ShardMaster)
+	defer pm.Stop()
+
+	// Dispute a block routed by a master block unknown locally
+	parent := new(types.SHeader)
+	parent.FillBy(&types.SHeaderStruct{ShardId: 0, Number: big.NewInt(0), Difficulty: big.NewInt(1), Time: big.NewInt(0)})
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: 0, ParentHash: parent.Hash(), MasterHash: common.Hash{0x01}, MasterNumber: 1, Number: big.NewInt(1), Difficulty: big.NewInt(1), Time: big.NewInt(10)})
+	proof := &types.FraudProof{Parent: parent.ToStruct(), Block: types.NewSBlockWithHeader(header)}
+
+	if err := pm.checkFraudProof(proof); err != core.ErrUnknownMasterBlock {
+		t.Fatalf("fraud proof error mismatch: have %v, want %v", err, core.ErrUnknownMasterBlock)
+	}
+	if checked := pm.fraudProofs.Len(); checked != 0 {
+		t.Fatalf("checked fraud proof count mismatch: have %d, want 0", checked)
+	}
+	// Relay the proof and make sure the peer is kept
+	p, errc := newTestPeer("peer", eth63, pm, true, types.ShardMaster)
+	defer p.close()
+
+	if err := p2p.Send(p.app, FraudProofMsg, proof); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("peer relaying an unverifiable fraud proof dropped: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/EDXFund/MasterChain/p2p"
 	"github.com/EDXFund/MasterChain/p2p/enode"
 	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/qchain"
 )
 
 var (
@@ -46,6 +47,15 @@ var (
 	testBank       = crypto.PubkeyToAddress(testBankKey.PublicKey)
 )
 
+// newTestShardPool creates the shard block pool of a master chain, the same way
+// the full node does. Shard chains run without one.
+func newTestShardPool(blockchain *core.BlockChain, db ethdb.Database) *qchain.ShardChainPool {
+	if blockchain.ShardId() != types.ShardMaster {
+		return nil
+	}
+	return qchain.NewShardChainPool(blockchain, db)
+}
+
 // newTestProtocolManager creates a new protocol manager for testing purposes,
 // with the given number of blocks already known, and potential notification
 // channels for different events.
@@ -66,7 +76,7 @@ func newTestProtocolManager(mode downloader.SyncMode, blocks int, generator func
 		panic(err)
 	}
 
-	pm, err := NewProtocolManager(gspec.Config, mode, DefaultConfig.NetworkId, evmux, &testTxPool{added: newtx}, engine, blockchain, db)
+	pm, err := NewProtocolManager(gspec.Config, mode, DefaultConfig.NetworkId, evmux, &testTxPool{added: newtx}, newTestShardPool(blockchain, db), engine, blockchain, db)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -86,6 +96,17 @@ func newTestProtocolManagerMust(t *testing.T, mode downloader.SyncMode, blocks i
 	return pm, db
 }
 
+// newTestShardTxPool replaces the transaction pool of a shard protocol manager
+// with a real shard pool, which also serves the transactions of the shard chain.
+func newTestShardTxPool(pm *ProtocolManager) *core.TxPoolShard {
+	config := core.DefaultTxPoolShardConfig
+	config.Journal = ""
+
+	txpool := core.NewTxPoolShard(config, pm.blockchain.Config(), pm.blockchain, pm.blockchain.ShardId())
+	pm.txpool = txpool
+	return txpool
+}
+
 // testTxPool is a fake, helper transaction pool for testing purposes
 type testTxPool struct {
 	txFeed event.Feed
@@ -108,6 +129,25 @@ func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
 	return make([]error, len(txs))
 }
 
+// AddLocals appends a batch of local transactions to the pool, the same way as
+// remote ones.
+func (p *testTxPool) AddLocals(txs []*types.Transaction) []error {
+	return p.AddRemotes(txs)
+}
+
+// Get returns the transaction of the given hash, if known to the pool.
+func (p *testTxPool) Get(hash common.Hash) *types.Transaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, tx := range p.pool {
+		if tx.Hash() == hash {
+			return tx
+		}
+	}
+	return nil
+}
+
 // Pending returns all the transactions known to the pool
 func (p *testTxPool) Pending() (map[common.Address]types.Transactions, error) {
 	p.lock.RLock()
@@ -184,10 +224,8 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesi
 		ProtocolVersion: uint32(p.version),
 		NetworkId:       DefaultConfig.NetworkId,
 		ShardId:         shardId,
-		TD:              td,
-		CurrentBlock:    head,
 		GenesisBlock:    genesis,
-		ShardInfo:       []*types.SInfo{},
+		ShardInfo:       []*types.SInfo{{ShardId: shardId, Td: td, HeadHash: head}},
 	}
 	if err := p2p.ExpectMsg(p.app, StatusMsg, msg); err != nil {
 		t.Fatalf("status recv: %v", err)
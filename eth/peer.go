@@ -42,6 +42,7 @@ var (
 const (
 	maxKnownTxs    = 32768 // Maximum transactions hashes to keep in the known list (prevent DOS)
 	maxKnownBlocks = 1024  // Maximum block hashes to keep in the known list (prevent DOS)
+	maxKnownFrauds = 256   // Maximum fraud proof hashes to keep in the known list (prevent DOS)
 
 	// maxQueuedTxs is the maximum number of transaction lists to queue up before
 	// dropping broadcasts. This is a sensitive number as a transaction list might
@@ -93,6 +94,7 @@ type peer struct {
 
 	knownTxs    mapset.Set                // Set of transaction hashes known to be known by this peer
 	knownBlocks mapset.Set                // Set of block hashes known to be known by this peer
+	knownFrauds mapset.Set                // Set of invalid shard block hashes known to be known by this peer
 	queuedTxs   chan []*types.Transaction // Queue of transactions to broadcast to the peer
 	queuedProps chan *propEvent           // Queue of blocks to broadcast to the peer
 	//	queuedShardProps chan *propShardEvent // Queue of blocks to broadcast to the peer
@@ -110,6 +112,7 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		id:          fmt.Sprintf("%x", p.ID().Bytes()[:8]),
 		knownTxs:    mapset.NewSet(),
 		knownBlocks: mapset.NewSet(),
+		knownFrauds: mapset.NewSet(),
 		queuedTxs:   make(chan []*types.Transaction, maxQueuedTxs),
 		queuedProps: make(chan *propEvent, maxQueuedProps),
 		queuedAnns:  make(chan types.BlockIntf, maxQueuedAnns),
@@ -237,6 +240,23 @@ func (p *peer) MarkTransaction(hash common.Hash) {
 	p.knownTxs.Add(hash)
 }
 
+// MarkFraudProof marks a fraud proof as known for the peer, ensuring that it
+// will never be propagated to this particular peer.
+func (p *peer) MarkFraudProof(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known proof hash
+	for p.knownFrauds.Cardinality() >= maxKnownFrauds {
+		p.knownFrauds.Pop()
+	}
+	p.knownFrauds.Add(hash)
+}
+
+// SendFraudProof sends a fraud proof to the peer and includes the hash of the
+// disputed block in its fraud proof set for future reference.
+func (p *peer) SendFraudProof(proof *types.FraudProof) error {
+	p.MarkFraudProof(proof.Hash())
+	return p2p.Send(p.rw, FraudProofMsg, proof)
+}
+
 // SendTransactions sends transactions to the peer and includes the hashes
 // in its transaction hash set for future reference.
 func (p *peer) SendTransactions(txs types.Transactions) error {
@@ -441,6 +461,19 @@ func (p *peer) RequestReceipts(hashes []common.Hash) error {
 	return p2p.Send(p.rw, GetReceiptsMsg, hashes)
 }
 
+// RequestShardTxs fetches a batch of transactions of shard block results from a
+// remote node of the shard.
+func (p *peer) RequestShardTxs(hashes []common.Hash) error {
+	p.Log().Debug("Fetching batch of shard transactions", "count", len(hashes))
+	return p2p.Send(p.rw, GetShardTxsMsg, hashes)
+}
+
+// SendShardTxs sends a batch of transactions of shard block results, as
+// requested by the remote node.
+func (p *peer) SendShardTxs(txs types.Transactions) error {
+	return p2p.Send(p.rw, ShardTxsMsg, txs)
+}
+
 // Handshake executes the eth protocol handshake, negotiating version number,
 // network IDs, difficulties, head and genesis blocks.
 func (p *peer) Handshake(network uint64, blockChain *core.BlockChain, shardPool *qchain.ShardChainPool) error {
@@ -666,6 +699,26 @@ func (ps *peerSet) PeersWithoutShardBlock(shardId uint16, hash common.Hash) []*p
 	return list
 }
 
+// PeersWithoutFraudProof retrieves a list of master peers and peers of the
+// given shard that do not have a fraud proof in their set of known hashes.
+func (ps *peerSet) PeersWithoutFraudProof(shardId uint16, hash common.Hash) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for id, peers := range ps.peers {
+		if id != types.ShardMaster && id != shardId {
+			continue
+		}
+		for _, p := range peers {
+			if !p.knownFrauds.Contains(hash) {
+				list = append(list, p)
+			}
+		}
+	}
+	return list
+}
+
 // PeersWithoutTx retrieves a list of peers that do not have a given transaction
 // in their set of known hashes.
 func (ps *peerSet) MasterPeersWithoutTx(hash common.Hash) []*peer {
@@ -697,6 +750,18 @@ func (ps *peerSet) ShardPeersWithoutTx(shardId uint16, hash common.Hash) []*peer
 	return list
 }
 
+// ShardPeers retrieves the list of peers of the given shard.
+func (ps *peerSet) ShardPeers(shardId uint16) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers[shardId]))
+	for _, p := range ps.peers[shardId] {
+		list = append(list, p)
+	}
+	return list
+}
+
 // BestPeer retrieves the known peer with the currently highest total difficulty.
 func (ps *peerSet) BestPeer() *peer {
 	ps.lock.RLock()
@@ -41,7 +41,7 @@ var ProtocolName = "eth"
 var ProtocolVersions = []uint{eth63, eth62}
 
 // ProtocolLengths are the number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{18, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -58,11 +58,20 @@ const (
 	NewBlockMsg        = 0x07
 
 	ShardBlockMsg = 0x08
+
+	// GetShardTxsMsg requests the transactions of shard block results by hash,
+	// which are returned by ShardTxsMsg
+	GetShardTxsMsg = 0x09
+	ShardTxsMsg    = 0x0a
+
 	// Protocol messages belonging to eth/63
 	GetNodeDataMsg = 0x0d
 	NodeDataMsg    = 0x0e
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
+
+	// FraudProofMsg carries a proof that a shard block is invalid
+	FraudProofMsg = 0x11
 )
 
 type errCode int
@@ -79,6 +88,7 @@ const (
 	ErrSuspendedPeer
 
 	ErrNoShardIdData
+	ErrInvalidFraudProof
 )
 
 func (e errCode) String() string {
@@ -96,12 +106,16 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrInvalidFraudProof:       "Invalid fraud proof",
 }
 
 type txPool interface {
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
+	// Get should return a known transaction, or nil if it is unknown.
+	Get(hash common.Hash) *types.Transaction
+
 	AddLocals([]*types.Transaction) []error
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
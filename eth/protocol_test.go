@@ -44,11 +44,7 @@ func TestStatusMsgErrors63S(t *testing.T) { testStatusMsgErrors(t, 63, 0) }
 
 func testStatusMsgErrors(t *testing.T, protocol int, shardId uint16) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil, shardId)
-	var (
-		genesis = pm.blockchain.Genesis()
-		head    = pm.blockchain.CurrentHeader()
-		td      = pm.blockchain.GetTd(head.Hash(), head.NumberU64())
-	)
+	genesis := pm.blockchain.Genesis()
 	defer pm.Stop()
 
 	tests := []struct {
@@ -61,15 +57,15 @@ func testStatusMsgErrors(t *testing.T, protocol int, shardId uint16) {
 			wantError: errResp(ErrNoStatusMsg, "first msg has code 2 (!= 0)"),
 		},
 		{
-			code: StatusMsg, data: statusData{10, DefaultConfig.NetworkId, shardId, td, head.Hash(), genesis.Hash(), []*types.SInfo{}},
+			code: StatusMsg, data: statusData{10, DefaultConfig.NetworkId, shardId, genesis.Hash(), []*types.SInfo{}},
 			wantError: errResp(ErrProtocolVersionMismatch, "10 (!= %d)", protocol),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), 999, shardId, td, head.Hash(), genesis.Hash(), []*types.SInfo{}},
+			code: StatusMsg, data: statusData{uint32(protocol), 999, shardId, genesis.Hash(), []*types.SInfo{}},
 			wantError: errResp(ErrNetworkIdMismatch, "999 (!= 1)"),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), DefaultConfig.NetworkId, shardId, td, head.Hash(), common.Hash{3}, []*types.SInfo{}},
+			code: StatusMsg, data: statusData{uint32(protocol), DefaultConfig.NetworkId, shardId, common.Hash{3}, []*types.SInfo{}},
 			wantError: errResp(ErrGenesisBlockMismatch, "0300000000000000 (!= %x)", genesis.Hash().Bytes()[:8]),
 		},
 	}
@@ -0,0 +1,162 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/log"
+)
+
+// maxShardTxsFetch is the maximum number of transactions requested in, or
+// served for, a single GetShardTxsMsg.
+const maxShardTxsFetch = 256
+
+// maxShardTxsPeers is the maximum number of peers asked in turn for the
+// transactions of a single retrieval before giving up.
+const maxShardTxsPeers = 3
+
+// shardTxRequest is a retrieval of shard transactions waiting for deliveries.
+type shardTxRequest struct {
+	wanted map[common.Hash]bool // Transactions not delivered yet
+	txs    []*types.Transaction // Transactions delivered so far
+	done   chan struct{}        // Closed once all transactions are delivered
+}
+
+// shardTxFetcher retrieves the transactions of shard block results which never
+// reached the local node from the peers of the shard that included them. It
+// implements core.ShardTxFetcher.
+type shardTxFetcher struct {
+	peers    *peerSet
+	requests map[*shardTxRequest]struct{}
+	lock     sync.Mutex
+}
+
+// newShardTxFetcher creates a fetcher requesting transactions from peers.
+func newShardTxFetcher(peers *peerSet) *shardTxFetcher {
+	return &shardTxFetcher{
+		peers:    peers,
+		requests: make(map[*shardTxRequest]struct{}),
+	}
+}
+
+// FetchShardTxs requests the given transactions from a single peer of a shard
+// and waits until they are delivered. Whenever a peer fails to deliver within the
+// timeout, the transactions still missing are requested from another one. The
+// transactions received are returned.
+func (f *shardTxFetcher) FetchShardTxs(shardId uint16, hashes []common.Hash, timeout time.Duration) []*types.Transaction {
+	if len(hashes) == 0 {
+		return nil
+	}
+	req := &shardTxRequest{
+		wanted: make(map[common.Hash]bool, len(hashes)),
+		done:   make(chan struct{}),
+	}
+	for _, hash := range hashes {
+		req.wanted[hash] = true
+	}
+	f.lock.Lock()
+	f.requests[req] = struct{}{}
+	f.lock.Unlock()
+
+	defer func() {
+		f.lock.Lock()
+		delete(f.requests, req)
+		f.lock.Unlock()
+	}()
+	tried := make(map[string]bool)
+	for len(tried) < maxShardTxsPeers {
+		p := f.untriedPeer(shardId, tried)
+		if p == nil {
+			break
+		}
+		tried[p.id] = true
+
+		if err := f.request(p, req); err != nil {
+			p.Log().Debug("Failed to request shard transactions", "err", err)
+			continue
+		}
+		select {
+		case <-req.done:
+			return req.txs
+		case <-time.After(timeout):
+			p.Log().Debug("Shard transaction retrieval timed out", "shard", shardId, "wanted", len(hashes))
+		}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	log.Debug("Failed to retrieve shard transactions", "shard", shardId, "wanted", len(hashes), "missing", len(req.wanted))
+	return req.txs
+}
+
+// untriedPeer returns a peer of the shard not asked yet, or nil if there is none.
+// The random iteration order of the peer set spreads retrievals over the peers.
+func (f *shardTxFetcher) untriedPeer(shardId uint16, tried map[string]bool) *peer {
+	for _, p := range f.peers.ShardPeers(shardId) {
+		if !tried[p.id] {
+			return p
+		}
+	}
+	return nil
+}
+
+// request asks a peer for the transactions of a retrieval not delivered yet, in
+// batches of at most maxShardTxsFetch hashes.
+func (f *shardTxFetcher) request(p *peer, req *shardTxRequest) error {
+	f.lock.Lock()
+	hashes := make([]common.Hash, 0, len(req.wanted))
+	for hash := range req.wanted {
+		hashes = append(hashes, hash)
+	}
+	f.lock.Unlock()
+
+	for start := 0; start < len(hashes); start += maxShardTxsFetch {
+		end := start + maxShardTxsFetch
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		if err := p.RequestShardTxs(hashes[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver hands transactions sent by a peer to the requests waiting for them.
+func (f *shardTxFetcher) deliver(txs []*types.Transaction) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for req := range f.requests {
+		if len(req.wanted) == 0 {
+			continue
+		}
+		for _, tx := range txs {
+			if hash := tx.Hash(); req.wanted[hash] {
+				delete(req.wanted, hash)
+				req.txs = append(req.txs, tx)
+			}
+		}
+		if len(req.wanted) == 0 {
+			close(req.done)
+		}
+	}
+}
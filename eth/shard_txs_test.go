@@ -0,0 +1,171 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/p2p"
+	"github.com/EDXFund/MasterChain/p2p/enode"
+)
+
+// shardTxsRequest is a GetShardTxsMsg received by one of the fetcher's peers.
+type shardTxsRequest struct {
+	peer   int
+	hashes []common.Hash
+}
+
+// newShardTxsPeers registers the given number of peers of a shard, returning the
+// requests they receive.
+func newShardTxsPeers(t *testing.T, peers *peerSet, count int, shardId uint16) (<-chan shardTxsRequest, func()) {
+	var (
+		requests = make(chan shardTxsRequest, 16)
+		apps     []*p2p.MsgPipeRW
+		ids      []string
+	)
+	for i := 0; i < count; i++ {
+		app, net := p2p.MsgPipe()
+		apps = append(apps, app)
+
+		var id enode.ID
+		rand.Read(id[:])
+		p := newPeer(eth63, p2p.NewPeer(id, fmt.Sprintf("peer %d", i), nil), net)
+		p.shardId = shardId
+		if err := peers.Register(p); err != nil {
+			t.Fatalf("peer %d: failed to register: %v", i, err)
+		}
+		ids = append(ids, p.id)
+		go func(i int) {
+			for {
+				msg, err := app.ReadMsg()
+				if err != nil {
+					return
+				}
+				var hashes []common.Hash
+				if msg.Code != GetShardTxsMsg || msg.Decode(&hashes) != nil {
+					t.Errorf("peer %d: unexpected message %v", i, msg)
+					return
+				}
+				requests <- shardTxsRequest{i, hashes}
+			}
+		}(i)
+	}
+	return requests, func() {
+		for i, app := range apps {
+			peers.Unregister(ids[i])
+			app.Close()
+		}
+	}
+}
+
+// Tests that shard transactions are requested from a single peer, and that the
+// ones still missing are requested from another peer whenever one times out.
+func TestShardTxFetcherRetry(t *testing.T) {
+	peers := newPeerSet()
+	requests, closePeers := newShardTxsPeers(t, peers, maxShardTxsPeers+1, 0)
+	defer closePeers()
+
+	fetcher := newShardTxFetcher(peers)
+	txs := types.Transactions{newTestTransaction(testBankKey, 0, 0), newTestTransaction(testBankKey, 1, 0)}
+
+	result := make(chan []*types.Transaction)
+	go func() {
+		result <- fetcher.FetchShardTxs(0, []common.Hash{txs[0].Hash(), txs[1].Hash()}, 100*time.Millisecond)
+	}()
+	asked := make(map[int]bool)
+	expect := func(hashes ...common.Hash) {
+		select {
+		case req := <-requests:
+			if asked[req.peer] {
+				t.Fatalf("peer %d asked twice", req.peer)
+			}
+			asked[req.peer] = true
+
+			if len(req.hashes) != len(hashes) {
+				t.Fatalf("requested hashes mismatch: have %x, want %x", req.hashes, hashes)
+			}
+			wanted := make(map[common.Hash]bool)
+			for _, hash := range hashes {
+				wanted[hash] = true
+			}
+			for _, hash := range req.hashes {
+				if !wanted[hash] {
+					t.Fatalf("requested hashes mismatch: have %x, want %x", req.hashes, hashes)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("shard transactions not requested")
+		}
+	}
+	// The first peer doesn't deliver, the second one only delivers partially
+	expect(txs[0].Hash(), txs[1].Hash())
+	expect(txs[0].Hash(), txs[1].Hash())
+	fetcher.deliver(txs[:1])
+
+	// The third peer is only asked for the missing transaction
+	expect(txs[1].Hash())
+	fetcher.deliver(txs[1:])
+
+	select {
+	case fetched := <-result:
+		if len(fetched) != len(txs) || fetched[0] != txs[0] || fetched[1] != txs[1] {
+			t.Fatalf("fetched transactions mismatch: have %v, want %v", fetched, txs)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("shard transaction retrieval not finished")
+	}
+	select {
+	case req := <-requests:
+		t.Fatalf("peer %d asked after delivery", req.peer)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// Tests that a retrieval nobody delivers gives up after asking a limited number
+// of peers.
+func TestShardTxFetcherGiveUp(t *testing.T) {
+	peers := newPeerSet()
+	requests, closePeers := newShardTxsPeers(t, peers, maxShardTxsPeers+1, 0)
+	defer closePeers()
+
+	fetcher := newShardTxFetcher(peers)
+	if fetched := fetcher.FetchShardTxs(0, []common.Hash{{0x01}}, 10*time.Millisecond); len(fetched) != 0 {
+		t.Fatalf("fetched transactions nobody delivered: %v", fetched)
+	}
+	// Peers of other shards are never asked
+	if fetched := fetcher.FetchShardTxs(1, []common.Hash{{0x01}}, 10*time.Millisecond); len(fetched) != 0 {
+		t.Fatalf("fetched transactions without peers: %v", fetched)
+	}
+	asked := make(map[int]bool)
+	for {
+		select {
+		case req := <-requests:
+			asked[req.peer] = true
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	if len(asked) != maxShardTxsPeers {
+		t.Fatalf("asked peer count mismatch: have %d, want %d", len(asked), maxShardTxsPeers)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/common/hexutil"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/p2p/enode"
+	"github.com/EDXFund/MasterChain/p2p/simulations"
+	"github.com/EDXFund/MasterChain/params"
+	"github.com/EDXFund/MasterChain/rlp"
+	"github.com/EDXFund/MasterChain/rpc"
+)
+
+const mockerInterval = 100 * time.Millisecond // Time between two batches of injected transactions
+
+// GenerateAccounts creates n accounts and funds them in the allocation of the
+// genesis, to be used as senders of a TxMocker.
+func GenerateAccounts(genesis *core.Genesis, n int) ([]*ecdsa.PrivateKey, error) {
+	if genesis.Alloc == nil {
+		genesis.Alloc = make(core.GenesisAlloc)
+	}
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{
+			Balance: new(big.Int).Mul(big.NewInt(1000000), big.NewInt(params.Ether)),
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// MockerConfig is the set of parameters of the transactions injected by a
+// TxMocker.
+type MockerConfig struct {
+	Rate     int                 // Number of transactions injected per second
+	Accounts []*ecdsa.PrivateKey // Funded accounts sending the transactions
+	GasPrice *big.Int            // Gas price of the transactions (nil = 1 GWei)
+}
+
+// TxMocker injects value transfers into the nodes of a simulated network at a
+// fixed rate, spreading them over the nodes in a round robin fashion. Every
+// account sends to itself, so the transactions never cross shards. The time a
+// transaction was sent at is kept until a Collector sees it included.
+type TxMocker struct {
+	net    *simulations.Network
+	nodes  []enode.ID
+	config *MockerConfig
+	signer types.Signer
+
+	lock   sync.Mutex
+	nonces []uint64                  // Next nonce of each account
+	next   int                       // Index of the next sending account
+	sent   map[common.Hash]time.Time // Injected transactions not seen included yet
+	total  uint64                    // Number of transactions accepted by the nodes
+	failed uint64                    // Number of transactions rejected by the nodes
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTxMocker creates a transaction injector sending to the given nodes, which
+// should run the master chain so that transactions are routed to the shards by
+// the network itself.
+func NewTxMocker(net *simulations.Network, nodes []enode.ID, chainID *big.Int, config *MockerConfig) *TxMocker {
+	return &TxMocker{
+		net:    net,
+		nodes:  nodes,
+		config: config,
+		signer: types.NewEIP155Signer(chainID),
+		nonces: make([]uint64, len(config.Accounts)),
+		sent:   make(map[common.Hash]time.Time),
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start begins injecting transactions.
+func (m *TxMocker) Start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// Stop terminates the injection of transactions.
+func (m *TxMocker) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// Stats returns the number of transactions accepted and rejected by the nodes.
+func (m *TxMocker) Stats() (total uint64, failed uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.total, m.failed
+}
+
+// take returns the time a transaction was injected at and forgets about it.
+func (m *TxMocker) take(hash common.Hash) (time.Time, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	sent, ok := m.sent[hash]
+	delete(m.sent, hash)
+	return sent, ok
+}
+
+// loop injects a batch of transactions into the next node at every tick, sized
+// to keep up with the configured rate.
+func (m *TxMocker) loop() {
+	defer m.wg.Done()
+
+	if m.config.Rate <= 0 || len(m.config.Accounts) == 0 || len(m.nodes) == 0 {
+		log.Warn("Transaction mocker has nothing to do", "rate", m.config.Rate, "accounts", len(m.config.Accounts), "nodes", len(m.nodes))
+		return
+	}
+	ticker := time.NewTicker(mockerInterval)
+	defer ticker.Stop()
+
+	var (
+		start    = time.Now()
+		injected = uint64(0)
+		target   = 0
+	)
+	for {
+		select {
+		case <-m.quit:
+			return
+		case now := <-ticker.C:
+			due := uint64(now.Sub(start).Seconds() * float64(m.config.Rate))
+			if due <= injected {
+				continue
+			}
+			id := m.nodes[target%len(m.nodes)]
+			target++
+
+			n := m.net.GetNode(id)
+			if n == nil {
+				log.Warn("Unknown transaction mocker target", "id", id)
+				continue
+			}
+			client, err := n.Client()
+			if err != nil {
+				log.Warn("Transaction mocker target not available", "id", id, "err", err)
+				continue
+			}
+			if err := m.inject(client, int(due-injected)); err != nil {
+				log.Warn("Failed to inject transactions", "id", id, "err", err)
+			}
+			injected = due
+		}
+	}
+}
+
+// inject signs count transactions and sends them in a single RPC batch.
+func (m *TxMocker) inject(client *rpc.Client, count int) error {
+	gasPrice := m.config.GasPrice
+	if gasPrice == nil {
+		gasPrice = big.NewInt(params.GWei)
+	}
+	var (
+		batch   = make([]rpc.BatchElem, 0, count)
+		txs     = make([]*types.Transaction, 0, count)
+		senders = make([]int, 0, count)
+	)
+	m.lock.Lock()
+	for i := 0; i < count; i++ {
+		sender := m.next
+		m.next = (m.next + 1) % len(m.config.Accounts)
+
+		key := m.config.Accounts[sender]
+		tx := types.NewTransaction(m.nonces[sender], crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1), params.TxGas, gasPrice, nil, 0)
+		tx, err := types.SignTx(tx, m.signer, key)
+		if err != nil {
+			m.lock.Unlock()
+			return err
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			m.lock.Unlock()
+			return err
+		}
+		m.nonces[sender]++
+
+		batch = append(batch, rpc.BatchElem{Method: "eth_sendRawTransaction", Args: []interface{}{hexutil.Bytes(data)}, Result: new(common.Hash)})
+		txs = append(txs, tx)
+		senders = append(senders, sender)
+	}
+	m.lock.Unlock()
+
+	if err := client.BatchCall(batch); err != nil {
+		// Nothing was delivered, hand the nonces out again
+		m.lock.Lock()
+		for i, sender := range senders {
+			if nonce := txs[i].Nonce(); nonce < m.nonces[sender] {
+				m.nonces[sender] = nonce
+			}
+		}
+		m.lock.Unlock()
+		return err
+	}
+	now := time.Now()
+
+	rejected := make(map[int]bool)
+
+	m.lock.Lock()
+	for i, elem := range batch {
+		if elem.Error != nil {
+			log.Debug("Mocked transaction rejected", "hash", txs[i].Hash(), "err", elem.Error)
+			rejected[senders[i]] = true
+			m.failed++
+			continue
+		}
+		m.sent[txs[i].Hash()] = now
+		m.total++
+	}
+	m.lock.Unlock()
+
+	// The nonces of rejected transactions were never used, so the later ones of the
+	// same senders would be stuck in the pool: ask the node where they stand
+	if len(rejected) > 0 {
+		return m.resync(client, rejected)
+	}
+	return nil
+}
+
+// resync resets the next nonces of the given senders to the pending nonces known
+// to the node.
+func (m *TxMocker) resync(client *rpc.Client, senders map[int]bool) error {
+	var (
+		batch   = make([]rpc.BatchElem, 0, len(senders))
+		indexes = make([]int, 0, len(senders))
+	)
+	for sender := range senders {
+		addr := crypto.PubkeyToAddress(m.config.Accounts[sender].PublicKey)
+		batch = append(batch, rpc.BatchElem{Method: "eth_getTransactionCount", Args: []interface{}{addr, "pending"}, Result: new(hexutil.Uint64)})
+		indexes = append(indexes, sender)
+	}
+	if err := client.BatchCall(batch); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, elem := range batch {
+		if elem.Error != nil {
+			log.Warn("Failed to resync mocked sender nonce", "sender", indexes[i], "err", elem.Error)
+			continue
+		}
+		m.nonces[indexes[i]] = uint64(*elem.Result.(*hexutil.Uint64))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package simulation runs master and shard nodes of an EDX network inside p2p
+// network simulations, injects transactions into them and measures the
+// throughput and inclusion latency of every shard.
+package simulation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/eth"
+	"github.com/EDXFund/MasterChain/eth/downloader"
+	"github.com/EDXFund/MasterChain/node"
+	"github.com/EDXFund/MasterChain/p2p"
+	"github.com/EDXFund/MasterChain/p2p/enode"
+	"github.com/EDXFund/MasterChain/p2p/simulations"
+	"github.com/EDXFund/MasterChain/p2p/simulations/adapters"
+)
+
+var (
+	// ErrNotSimNode is returned if the services of a node are requested from a
+	// network not running on the in-memory simulation adapter.
+	ErrNotSimNode = errors.New("node not run by the simulation adapter")
+
+	// ErrServiceNotRunning is returned if a node doesn't run the requested chain.
+	ErrServiceNotRunning = errors.New("chain service not running")
+)
+
+// ServiceName returns the name the simulation service of the master chain or of
+// a shard chain is registered under.
+func ServiceName(shardId uint16) string {
+	if shardId == types.ShardMaster {
+		return "master"
+	}
+	return fmt.Sprintf("shard%d", shardId)
+}
+
+// Services returns the simulation services of the master chain and of the given
+// shard chains, keyed by their names, to be passed to a simulation adapter. A
+// node runs as master or as shard node depending on the service it is created
+// with.
+func Services(genesis *core.Genesis, shards []uint16) map[string]adapters.ServiceFunc {
+	services := map[string]adapters.ServiceFunc{
+		ServiceName(types.ShardMaster): NewService(genesis, types.ShardMaster),
+	}
+	for _, shardId := range shards {
+		services[ServiceName(shardId)] = NewService(genesis, shardId)
+	}
+	return services
+}
+
+// NewService returns the constructor of a mining node of the given chain. The
+// genesis must use ethash, which is run in fake mode so that blocks are sealed
+// as soon as they are assembled.
+func NewService(genesis *core.Genesis, shardId uint16) adapters.ServiceFunc {
+	return func(ctx *adapters.ServiceContext) (node.Service, error) {
+		config := eth.DefaultConfig
+		config.Genesis = genesis
+		config.ShardId = shardId
+		config.NetworkId = genesis.Config.ChainID.Uint64()
+		config.Ethash.PowMode = ethash.ModeFake
+		config.SyncMode = downloader.FullSync // Fast sync would discard the propagated blocks of fresh nodes
+		config.Etherbase = crypto.PubkeyToAddress(ctx.Config.PrivateKey.PublicKey)
+
+		ethereum, err := eth.New(ctx.NodeContext, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &Service{Ethereum: ethereum}, nil
+	}
+}
+
+// Service is a full node of the master chain or of a shard chain which starts
+// mining as soon as it joins the simulated network.
+type Service struct {
+	*eth.Ethereum
+}
+
+// Start implements node.Service, starting the protocol handlers and the miner.
+func (s *Service) Start(srvr *p2p.Server) error {
+	if err := s.Ethereum.Start(srvr); err != nil {
+		return err
+	}
+	return s.StartMining(1)
+}
+
+// NodeService returns the chain service run by a node of a network using the
+// in-memory simulation adapter.
+func NodeService(net *simulations.Network, id enode.ID, shardId uint16) (*Service, error) {
+	n := net.GetNode(id)
+	if n == nil {
+		return nil, fmt.Errorf("unknown node: %s", id)
+	}
+	sn, ok := n.Node.(*adapters.SimNode)
+	if !ok {
+		return nil, ErrNotSimNode
+	}
+	service, ok := sn.Service(ServiceName(shardId)).(*Service)
+	if !ok {
+		return nil, ErrServiceNotRunning
+	}
+	return service, nil
+}
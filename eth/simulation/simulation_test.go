@@ -0,0 +1,161 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"flag"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/p2p/enode"
+	"github.com/EDXFund/MasterChain/p2p/simulations"
+	"github.com/EDXFund/MasterChain/p2p/simulations/adapters"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+var (
+	shardCount = flag.Int("sim.shards", 2, "number of shards of the simulated network")
+	txRate     = flag.Int("sim.rate", 100, "transactions injected per second")
+	duration   = flag.Duration("sim.duration", 10*time.Second, "time transactions are injected for")
+	timeout    = flag.Duration("sim.timeout", 3*time.Minute, "time to wait for the master chain to include every shard")
+	minTps     = flag.Float64("sim.mintps", 0, "minimum total throughput required to pass")
+)
+
+// included reports whether the master chain included blocks of every given shard
+// carrying mocked transactions.
+func included(collector *Collector, shards []uint16) bool {
+	report := make(map[uint16]*ShardStats)
+	for _, shard := range collector.Report() {
+		report[shard.ShardId] = shard
+	}
+	for _, shardId := range shards {
+		if shard := report[shardId]; shard == nil || shard.Blocks == 0 || shard.latencies == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Tests that a network of one master node and one node per shard can be run,
+// that the injected transactions are accepted and included in the master chain
+// through the blocks of every shard, and that the shard statistics are collected
+// from the master chain.
+func TestShardedNetwork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping network simulation in short mode")
+	}
+	enabled := true
+	shards := make(map[uint16]*core.GenesisShard)
+	for i := 1; i < *shardCount; i++ {
+		shards[uint16(i)] = &core.GenesisShard{Enabled: &enabled}
+	}
+	genesis := &core.Genesis{
+		Config: &params.ChainConfig{
+			ChainID:        big.NewInt(1337),
+			HomesteadBlock: big.NewInt(0),
+			EIP150Block:    big.NewInt(0),
+			EIP155Block:    big.NewInt(0),
+			EIP158Block:    big.NewInt(0),
+			ByzantiumBlock: big.NewInt(0),
+			Ethash:         new(params.EthashConfig),
+		},
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Shards:     shards,
+	}
+	accounts, err := GenerateAccounts(genesis, 64)
+	if err != nil {
+		t.Fatalf("failed to generate accounts: %v", err)
+	}
+	adapter := adapters.NewSimAdapter(Services(genesis, genesis.EnabledShards()))
+	net := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: ServiceName(types.ShardMaster)})
+	defer net.Shutdown()
+
+	// Start the master node and connect a node of every shard to it
+	services := []string{ServiceName(types.ShardMaster)}
+	for _, shardId := range genesis.EnabledShards() {
+		services = append(services, ServiceName(shardId))
+	}
+	var ids []enode.ID
+	for _, service := range services {
+		config := adapters.RandomNodeConfig()
+		config.Services = []string{service}
+
+		node, err := net.NewNodeWithConfig(config)
+		if err != nil {
+			t.Fatalf("failed to create %s node: %v", service, err)
+		}
+		if err := net.Start(node.ID()); err != nil {
+			t.Fatalf("failed to start %s node: %v", service, err)
+		}
+		if len(ids) > 0 {
+			if err := net.Connect(ids[0], node.ID()); err != nil {
+				t.Fatalf("failed to connect %s node: %v", service, err)
+			}
+		}
+		ids = append(ids, node.ID())
+	}
+	master, err := NodeService(net, ids[0], types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to retrieve master service: %v", err)
+	}
+	// Inject transactions into the master node and collect the shard statistics
+	mocker := NewTxMocker(net, ids[:1], genesis.Config.ChainID, &MockerConfig{Rate: *txRate, Accounts: accounts})
+	collector := NewCollector(master, mocker)
+
+	mocker.Start()
+	time.Sleep(*duration)
+	mocker.Stop()
+
+	// Shard blocks are only included once they are deep enough in their shard,
+	// give the master chain the time to catch up with the injected ones
+	for deadline := time.Now().Add(*timeout); !included(collector, genesis.EnabledShards()); time.Sleep(time.Second) {
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+	collector.Stop()
+
+	total, failed := mocker.Stats()
+	if total == 0 || failed > 0 {
+		t.Errorf("transactions accepted: %d, rejected: %d", total, failed)
+	}
+	// Every shard must have had blocks with mocked transactions included
+	report := make(map[uint16]*ShardStats)
+	for _, shard := range collector.Report() {
+		t.Logf("shard %d: blocks %d, txs %d, tps %.2f, latency %v (max %v)", shard.ShardId, shard.Blocks, shard.Txs, shard.Tps, shard.Latency, shard.MaxLatency)
+		report[shard.ShardId] = shard
+	}
+	var tps float64
+	for _, shardId := range genesis.EnabledShards() {
+		shard := report[shardId]
+		if shard == nil || shard.Blocks == 0 {
+			t.Errorf("shard %d: no blocks included in the master chain", shardId)
+			continue
+		}
+		if shard.latencies == 0 {
+			t.Errorf("shard %d: no inclusion latency measured", shardId)
+		}
+		tps += shard.Tps
+	}
+	if tps < *minTps {
+		t.Errorf("throughput too low: have %.2f tps, want at least %.2f", tps, *minTps)
+	}
+}
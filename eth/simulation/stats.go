@@ -0,0 +1,188 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/metrics"
+)
+
+// ShardStats is the throughput and inclusion latency of a shard chain, measured
+// on the master chain: a shard block only counts once a master block includes it.
+type ShardStats struct {
+	ShardId    uint16        `json:"shardId"`
+	Blocks     uint64        `json:"blocks"`     // Shard blocks included in the master chain
+	Txs        uint64        `json:"txs"`        // Transactions of the included shard blocks
+	Tps        float64       `json:"tps"`        // Included transactions per second since the collector started
+	Latency    time.Duration `json:"latency"`    // Average time from injection to inclusion of mocked transactions
+	MaxLatency time.Duration `json:"maxLatency"` // Longest time from injection to inclusion of a mocked transaction
+
+	latencies uint64        // Number of mocked transactions with a measured latency
+	delays    time.Duration // Sum of the measured latencies
+}
+
+// Collector follows the master chain of a node and accumulates the statistics
+// of the shard blocks it includes. Inclusion latencies are measured for the
+// transactions injected by a TxMocker. The statistics are also exported to the
+// default metrics registry as sim/shard/<id>/txs meters and sim/shard/<id>/latency
+// timers.
+type Collector struct {
+	chain  *core.BlockChain
+	mocker *TxMocker
+	start  time.Time
+
+	lock   sync.Mutex
+	shards map[uint16]*ShardStats
+	seen   map[common.Hash]bool // Shard blocks already accounted for
+	done   map[common.Hash]bool // Master blocks already processed
+	first  uint64               // Number of the master head the collector started at
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCollector starts collecting shard statistics from the master chain of the
+// given service. The mocker may be nil if latencies are not to be measured.
+func NewCollector(master *Service, mocker *TxMocker) *Collector {
+	head := master.BlockChain().CurrentBlock()
+	c := &Collector{
+		chain:  master.BlockChain(),
+		mocker: mocker,
+		start:  time.Now(),
+		shards: make(map[uint16]*ShardStats),
+		seen:   make(map[common.Hash]bool),
+		done:   map[common.Hash]bool{head.Hash(): true},
+		first:  head.NumberU64(),
+		quit:   make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c
+}
+
+// Stop terminates the collection of statistics.
+func (c *Collector) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// Report returns the statistics of every shard seen so far, ordered by shard id.
+func (c *Collector) Report() []*ShardStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elapsed := time.Since(c.start).Seconds()
+
+	report := make([]*ShardStats, 0, len(c.shards))
+	for _, shard := range c.shards {
+		stats := *shard
+		if elapsed > 0 {
+			stats.Tps = float64(stats.Txs) / elapsed
+		}
+		if stats.latencies > 0 {
+			stats.Latency = stats.delays / time.Duration(stats.latencies)
+		}
+		report = append(report, &stats)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].ShardId < report[j].ShardId })
+	return report
+}
+
+// loop processes every new head of the master chain.
+func (c *Collector) loop() {
+	defer c.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := c.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-heads:
+			c.process(head.Block, time.Now())
+		case <-sub.Err():
+			return
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// process accounts for the shard blocks included by the master blocks leading to
+// head which were not processed yet, including those reorged in below earlier
+// heads. Shard blocks included by master blocks that were reorged out are not
+// accounted for a second time.
+func (c *Collector) process(head types.BlockIntf, now time.Time) {
+	var blocks []types.BlockIntf
+	for block := head; block != nil && !reflect.ValueOf(block).IsNil() && block.NumberU64() > c.first && !c.done[block.Hash()]; {
+		blocks = append(blocks, block)
+		block = c.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		c.done[blocks[i].Hash()] = true
+		for _, info := range blocks[i].ShardBlocks() {
+			if c.seen[info.Hash] {
+				continue
+			}
+			c.seen[info.Hash] = true
+
+			shardBlock := c.chain.GetBlock(info.Hash, info.BlockNumber)
+			if shardBlock == nil || reflect.ValueOf(shardBlock).IsNil() {
+				continue
+			}
+			shard, ok := c.shards[info.ShardId]
+			if !ok {
+				shard = &ShardStats{ShardId: info.ShardId}
+				c.shards[info.ShardId] = shard
+			}
+			results := shardBlock.Results()
+			shard.Blocks++
+			shard.Txs += uint64(len(results))
+			metrics.GetOrRegisterMeter(fmt.Sprintf("sim/shard/%d/txs", info.ShardId), nil).Mark(int64(len(results)))
+
+			if c.mocker == nil {
+				continue
+			}
+			timer := metrics.GetOrRegisterTimer(fmt.Sprintf("sim/shard/%d/latency", info.ShardId), nil)
+			for _, result := range results {
+				sent, ok := c.mocker.take(result.TxHash)
+				if !ok {
+					continue
+				}
+				delay := now.Sub(sent)
+				timer.Update(delay)
+
+				shard.latencies++
+				shard.delays += delay
+				if delay > shard.MaxLatency {
+					shard.MaxLatency = delay
+				}
+			}
+		}
+	}
+}
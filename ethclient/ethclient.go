@@ -271,6 +271,34 @@ func (ec *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*
 	return r, err
 }
 
+// ShardTxStatus is the lifecycle position of a transaction, as reported by
+// TransactionShardStatus. Status is one of "queued", "pending", "included",
+// "referenced" and "final"; the block fields are only set once the transaction
+// has been included in a shard block, respectively referenced by a master block.
+type ShardTxStatus struct {
+	TxHash  common.Hash  `json:"transactionHash"`
+	Status  string       `json:"status"`
+	ShardId hexutil.Uint `json:"shardId"`
+
+	BlockHash   *common.Hash    `json:"blockHash,omitempty"`
+	BlockNumber *hexutil.Uint64 `json:"blockNumber,omitempty"`
+	Index       *hexutil.Uint64 `json:"transactionIndex,omitempty"`
+
+	MasterHash   *common.Hash    `json:"masterBlockHash,omitempty"`
+	MasterNumber *hexutil.Uint64 `json:"masterBlockNumber,omitempty"`
+}
+
+// TransactionShardStatus returns the shard a transaction is routed to and how far
+// it progressed towards a final master block.
+func (ec *Client) TransactionShardStatus(ctx context.Context, txHash common.Hash) (*ShardTxStatus, error) {
+	var status *ShardTxStatus
+	err := ec.c.CallContext(ctx, &status, "eth_getTransactionShardStatus", txHash)
+	if err == nil && status == nil {
+		return nil, ethereum.NotFound
+	}
+	return status, err
+}
+
 func toBlockNumArg(number *big.Int) string {
 	if number == nil {
 		return "latest"
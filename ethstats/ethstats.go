@@ -27,6 +27,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +42,7 @@ import (
 	"github.com/EDXFund/MasterChain/les"
 	"github.com/EDXFund/MasterChain/log"
 	"github.com/EDXFund/MasterChain/p2p"
+	"github.com/EDXFund/MasterChain/qchain"
 	"github.com/EDXFund/MasterChain/rpc"
 	"golang.org/x/net/websocket"
 )
@@ -55,6 +57,9 @@ const (
 	txChanSize = 4096
 	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
 	chainHeadChanSize = 10
+	// shardStatsRange is the number of recent master blocks the shard chain
+	// statistics are computed over.
+	shardStatsRange = 64
 )
 
 type txPool interface {
@@ -81,6 +86,8 @@ type Service struct {
 
 	pongCh chan struct{} // Pong notifications are fed into this channel
 	histCh chan []uint64 // History request block numbers are fed into this channel
+
+	shards shardStatsWindow // Shard statistics of the recent master blocks, only used by the report loop
 }
 
 // New returns a monitoring service ready for stats reporting.
@@ -263,6 +270,9 @@ func (s *Service) loop() {
 				if err = s.reportPending(conn); err != nil {
 					log.Warn("Post-block transaction stats report failed", "err", err)
 				}
+				if err = s.reportShards(conn); err != nil {
+					log.Warn("Post-block shard stats report failed", "err", err)
+				}
 			case <-txCh:
 				if err = s.reportPending(conn); err != nil {
 					log.Warn("Transaction stats report failed", "err", err)
@@ -424,6 +434,9 @@ func (s *Service) report(conn *websocket.Conn) error {
 	if err := s.reportPending(conn); err != nil {
 		return err
 	}
+	if err := s.reportShards(conn); err != nil {
+		return err
+	}
 	if err := s.reportStats(conn); err != nil {
 		return err
 	}
@@ -482,6 +495,7 @@ type blockStats struct {
 	TxHash     common.Hash    `json:"transactionsRoot"`
 	Root       common.Hash    `json:"stateRoot"`
 	Uncles     uncleStats     `json:"uncles"`
+	Shards     int            `json:"shardBlocks"` // Number of shard blocks included by a master block
 }
 
 // txStats is the information to report about individual transactions.
@@ -527,6 +541,7 @@ func (s *Service) assembleBlockStats(block types.BlockIntf) *blockStats {
 		td     *big.Int
 		txs    []txStats
 		uncles []types.HeaderIntf
+		shards int
 	)
 	if s.eth != nil {
 		// Full nodes have all needed information available
@@ -541,6 +556,7 @@ func (s *Service) assembleBlockStats(block types.BlockIntf) *blockStats {
 			txs[i].Hash = tx.Hash()
 		}
 		uncles = block.Uncles()
+		shards = len(block.ShardBlocks())
 	} else {
 		// Light nodes would need on-demand lookups for transactions/uncles, skip
 		if block != nil {
@@ -568,6 +584,7 @@ func (s *Service) assembleBlockStats(block types.BlockIntf) *blockStats {
 		TxHash:     header.TxHash(),
 		Root:       header.Root(),
 		Uncles:     uncles,
+		Shards:     shards,
 	}
 }
 
@@ -662,6 +679,204 @@ func (s *Service) reportPending(conn *websocket.Conn) error {
 	return websocket.JSON.Send(conn, report)
 }
 
+// shardStats is the information to report about an individual shard chain.
+type shardStats struct {
+	ShardId   uint16  `json:"shardId"`
+	Head      uint64  `json:"head"`      // Number of the heaviest known shard block
+	Confirmed uint64  `json:"confirmed"` // Number of the last shard block included in the master chain
+	Pending   int     `json:"pending"`   // Number of shard blocks awaiting master inclusion
+	Latency   uint64  `json:"latency"`   // Average seconds between creation and master inclusion
+	Tps       float64 `json:"tps"`       // Transactions per second included from the shard
+}
+
+// reportShards retrieves the state of the shard chains as seen by the master
+// chain and reports it to the stats server. Only master full nodes track the
+// shard chains, other nodes report nothing.
+func (s *Service) reportShards(conn *websocket.Conn) error {
+	if s.eth == nil || s.eth.ShardPool() == nil {
+		return nil
+	}
+	details := s.assembleShardStats()
+
+	// Assemble the shard report and send it to the server
+	log.Trace("Sending shard chains to ethstats", "shards", len(details))
+
+	stats := map[string]interface{}{
+		"id":     s.node,
+		"shards": details,
+	}
+	report := map[string][]interface{}{
+		"emit": {"shards", stats},
+	}
+	return websocket.JSON.Send(conn, report)
+}
+
+// shardStatsChain is the part of the master chain the shard statistics are
+// gathered from.
+type shardStatsChain interface {
+	GetBlock(hash common.Hash, number uint64) types.BlockIntf
+}
+
+// shardBlockStats accumulates the shard blocks of a single shard included by a
+// master block.
+type shardBlockStats struct {
+	confirmed uint64 // Number of the last included shard block
+	delay     uint64 // Total seconds between creation and inclusion
+	count     uint64 // Number of included shard blocks
+	txs       uint64 // Number of transactions in the included shard blocks
+}
+
+// masterBlockStats is the contribution of a master block to the statistics of
+// the shard chains.
+type masterBlockStats struct {
+	hash   common.Hash
+	number uint64
+	time   uint64
+	shards map[uint16]*shardBlockStats
+}
+
+// newMasterBlockStats loads the shard blocks included by a master block and
+// accumulates them per shard.
+func newMasterBlockStats(chain shardStatsChain, block types.BlockIntf) *masterBlockStats {
+	stats := &masterBlockStats{
+		hash:   block.Hash(),
+		number: block.NumberU64(),
+		time:   block.Time().Uint64(),
+		shards: make(map[uint16]*shardBlockStats),
+	}
+	for _, info := range block.ShardBlocks() {
+		shardBlock := chain.GetBlock(info.Hash, info.BlockNumber)
+		if shardBlock == nil || reflect.ValueOf(shardBlock).IsNil() {
+			continue
+		}
+		stat := core.NewShardTxsStat(shardBlock)
+		shard, ok := stats.shards[stat.ShardId]
+		if !ok {
+			shard = new(shardBlockStats)
+			stats.shards[stat.ShardId] = shard
+		}
+		if stat.BlkNo > shard.confirmed {
+			shard.confirmed = stat.BlkNo
+		}
+		if shardBlock.Time().Cmp(block.Time()) < 0 {
+			shard.delay += new(big.Int).Sub(block.Time(), shardBlock.Time()).Uint64()
+		}
+		shard.count++
+		shard.txs += stat.TxCounts
+	}
+	return stats
+}
+
+// shardStatsWindow caches the contributions of the most recent master blocks to
+// the shard statistics, so that a new head only loads the shard blocks of the
+// master blocks not seen yet.
+type shardStatsWindow struct {
+	blocks []*masterBlockStats // Consecutive master blocks, oldest first
+}
+
+// index returns the position of a master block in the window, or -1.
+func (w *shardStatsWindow) index(hash common.Hash, number uint64) int {
+	if len(w.blocks) == 0 || number < w.blocks[0].number {
+		return -1
+	}
+	if i := number - w.blocks[0].number; i < uint64(len(w.blocks)) && w.blocks[i].hash == hash {
+		return int(i)
+	}
+	return -1
+}
+
+// update moves the window to end at the given master head, dropping the blocks
+// reorged out or too old and adding the new ones.
+func (w *shardStatsWindow) update(chain shardStatsChain, head types.BlockIntf) {
+	var (
+		fresh    []*masterBlockStats // New master blocks, newest first
+		ancestor = -1                // Position of the newest cached ancestor of the head
+	)
+	for block := head; block != nil && !reflect.ValueOf(block).IsNil(); {
+		if ancestor = w.index(block.Hash(), block.NumberU64()); ancestor >= 0 {
+			break
+		}
+		fresh = append(fresh, newMasterBlockStats(chain, block))
+		if len(fresh) == shardStatsRange || block.NumberU64() == 0 {
+			break
+		}
+		block = chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	w.blocks = w.blocks[:ancestor+1]
+	for i := len(fresh) - 1; i >= 0; i-- {
+		w.blocks = append(w.blocks, fresh[i])
+	}
+	if len(w.blocks) > shardStatsRange {
+		w.blocks = append([]*masterBlockStats(nil), w.blocks[len(w.blocks)-shardStatsRange:]...)
+	}
+}
+
+// assembleShardStats gathers the statistics of every shard chain known to the
+// shard pool, deriving the inclusion latency and throughput of each shard from
+// the shard blocks included by the most recent master blocks.
+func (s *Service) assembleShardStats() []*shardStats {
+	var (
+		pool    = s.eth.ShardPool()
+		stats   = make(map[uint16]*shardStats)
+		pending map[uint16]qchain.PendingShard
+	)
+	pending, _ = pool.Pending()
+	for shardId, info := range pool.GetMaxTds() {
+		stats[shardId] = &shardStats{ShardId: shardId, Head: info.BlockNumber, Pending: len(pending[shardId])}
+	}
+	s.shards.update(s.eth.BlockChain(), s.eth.BlockChain().CurrentBlock())
+	return s.shards.assemble(stats)
+}
+
+// assemble adds the inclusion statistics of the master blocks in the window to
+// the given shard statistics, returning them ordered by shard id.
+func (w *shardStatsWindow) assemble(stats map[uint16]*shardStats) []*shardStats {
+	var (
+		delays = make(map[uint16]uint64)
+		counts = make(map[uint16]uint64)
+		txs    = make(map[uint16]uint64)
+		span   uint64
+	)
+	for i, block := range w.blocks {
+		for shardId, stat := range block.shards {
+			shard, ok := stats[shardId]
+			if !ok {
+				shard = &shardStats{ShardId: shardId}
+				stats[shardId] = shard
+			}
+			if stat.confirmed > shard.Confirmed {
+				shard.Confirmed = stat.confirmed
+			}
+			delays[shardId] += stat.delay
+			counts[shardId] += stat.count
+
+			// The throughput is measured between the oldest and the newest master
+			// block, so only the transactions included after the oldest count
+			if i > 0 {
+				txs[shardId] += stat.txs
+			}
+		}
+	}
+	if n := len(w.blocks); n > 1 && w.blocks[n-1].time > w.blocks[0].time {
+		span = w.blocks[n-1].time - w.blocks[0].time
+	}
+	details := make([]*shardStats, 0, len(stats))
+	for shardId, shard := range stats {
+		if shard.Head < shard.Confirmed {
+			shard.Head = shard.Confirmed
+		}
+		if counts[shardId] > 0 {
+			shard.Latency = delays[shardId] / counts[shardId]
+		}
+		if span > 0 {
+			shard.Tps = float64(txs[shardId]) / float64(span)
+		}
+		details = append(details, shard)
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].ShardId < details[j].ShardId })
+	return details
+}
+
 // nodeStats is the information to report about the local node.
 type nodeStats struct {
 	Active   bool `json:"active"`
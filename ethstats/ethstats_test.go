@@ -0,0 +1,125 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethstats
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+)
+
+// testShardStatsChain is a master chain with its shard blocks, counting the
+// blocks loaded from it.
+type testShardStatsChain struct {
+	blocks map[common.Hash]types.BlockIntf
+	loads  int
+}
+
+func (c *testShardStatsChain) GetBlock(hash common.Hash, number uint64) types.BlockIntf {
+	c.loads++
+	if block, ok := c.blocks[hash]; ok && block.NumberU64() == number {
+		return block
+	}
+	return nil
+}
+
+// extend adds master blocks on top of the parent, one second apart, each of them
+// including a shard 1 block with the given number of transactions.
+func (c *testShardStatsChain) extend(parent types.BlockIntf, n int, txs int) []types.BlockIntf {
+	var blocks []types.BlockIntf
+	for i := 0; i < n; i++ {
+		number := new(big.Int).Add(parent.Number(), common.Big1)
+		time := new(big.Int).Add(parent.Time(), common.Big1)
+
+		results := make([]*types.ContractResult, txs)
+		for j := range results {
+			results[j] = &types.ContractResult{TxHash: common.Hash{byte(j)}}
+		}
+		sheader := new(types.SHeader)
+		sheader.FillBy(&types.SHeaderStruct{ShardId: 1, Number: number, Difficulty: big.NewInt(int64(txs)), Time: new(big.Int).Sub(time, common.Big1)})
+		shard := types.NewSBlock(sheader, results)
+		c.blocks[shard.Hash()] = shard
+
+		header := new(types.Header)
+		header.FillBy(&types.HeaderStruct{ParentHash: parent.Hash(), Number: number, Difficulty: common.Big1, Time: time})
+		block := types.NewBlock(header, []*types.ShardBlockInfo{{ShardId: 1, BlockNumber: shard.NumberU64(), Hash: shard.Hash()}}, nil, nil)
+		c.blocks[block.Hash()] = block
+
+		blocks = append(blocks, block)
+		parent = block
+	}
+	return blocks
+}
+
+// Tests that the shard statistics window only loads the master blocks it has not
+// seen yet, follows reorgs, and measures the throughput between its oldest and
+// newest master block.
+func TestShardStatsWindow(t *testing.T) {
+	header := new(types.Header)
+	header.FillBy(&types.HeaderStruct{Number: new(big.Int), Difficulty: common.Big1, Time: big.NewInt(100)})
+	genesis := types.NewBlock(header, nil, nil, nil)
+
+	chain := &testShardStatsChain{blocks: map[common.Hash]types.BlockIntf{genesis.Hash(): genesis}}
+	blocks := chain.extend(genesis, shardStatsRange+10, 2)
+
+	// The first head loads a full window, each shard block being loaded once
+	var window shardStatsWindow
+	window.update(chain, blocks[shardStatsRange-1])
+	if chain.loads != 2*shardStatsRange-1 {
+		t.Errorf("initial loads mismatch: have %d, want %d", chain.loads, 2*shardStatsRange-1)
+	}
+	if len(window.blocks) != shardStatsRange || window.blocks[0].number != 1 {
+		t.Fatalf("initial window mismatch: have %d blocks from #%d", len(window.blocks), window.blocks[0].number)
+	}
+	// Following heads only load the new master blocks and their shard blocks
+	chain.loads = 0
+	window.update(chain, blocks[shardStatsRange+1])
+	if chain.loads != 2*2 {
+		t.Errorf("extension loads mismatch: have %d, want 4", chain.loads)
+	}
+	if len(window.blocks) != shardStatsRange || window.blocks[0].number != 3 || window.blocks[shardStatsRange-1].hash != blocks[shardStatsRange+1].Hash() {
+		t.Fatalf("extended window mismatch: have %d blocks from #%d", len(window.blocks), window.blocks[0].number)
+	}
+	// The transactions of the oldest master block predate the measured span
+	stats := window.assemble(make(map[uint16]*shardStats))
+	if len(stats) != 1 || stats[0].ShardId != 1 {
+		t.Fatalf("shard stats mismatch: have %v", stats)
+	}
+	if want := float64(2*(shardStatsRange-1)) / float64(shardStatsRange-1); stats[0].Tps != want {
+		t.Errorf("throughput mismatch: have %v, want %v", stats[0].Tps, want)
+	}
+	if stats[0].Latency != 1 || stats[0].Confirmed != uint64(shardStatsRange+2) || stats[0].Head != stats[0].Confirmed {
+		t.Errorf("latency or confirmation mismatch: have %+v", stats[0])
+	}
+	// A reorg drops the master blocks of the old chain
+	fork := chain.extend(blocks[shardStatsRange-2], 2, 4)
+
+	chain.loads = 0
+	window.update(chain, fork[1])
+	if chain.loads != 2*2 {
+		t.Errorf("reorg loads mismatch: have %d, want 4", chain.loads)
+	}
+	if len(window.blocks) != shardStatsRange-1 || window.blocks[len(window.blocks)-1].hash != fork[1].Hash() || window.blocks[len(window.blocks)-3].hash != blocks[shardStatsRange-2].Hash() {
+		t.Fatalf("reorged window mismatch: have %d blocks", len(window.blocks))
+	}
+	stats = window.assemble(make(map[uint16]*shardStats))
+	if want := float64(2*(shardStatsRange-4)+2*4) / float64(shardStatsRange-2); stats[0].Tps != want {
+		t.Errorf("reorged throughput mismatch: have %v, want %v", stats[0].Tps, want)
+	}
+}
@@ -508,6 +508,16 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 	return (*hexutil.Big)(state.GetBalance(address)), state.Error()
 }
 
+// GetTokenBalance returns the balance of the given address in a token in the
+// state of the given block number. Token 0 is the native balance.
+func (s *PublicBlockChainAPI) GetTokenBalance(ctx context.Context, address common.Address, token hexutil.Uint64, blockNr rpc.BlockNumber) (*hexutil.Big, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(state.GetTokenBalance(address, uint64(token))), state.Error()
+}
+
 // Result structs for GetProof
 type AccountResult struct {
 	Address      common.Address  `json:"address"`
@@ -1192,6 +1202,52 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	return fields, nil
 }
 
+// GetTransactionShardStatus returns the shard a transaction is routed to and how
+// far it progressed: pending in the pool, included in a shard block, referenced
+// by a canonical master block or final.
+func (s *PublicTransactionPoolAPI) GetTransactionShardStatus(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	status, err := s.b.GetShardTxStatus(ctx, hash)
+	if status == nil || err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		"transactionHash": hash,
+		"status":          status.Status.String(),
+		"shardId":         hexutil.Uint(status.ShardId),
+	}
+	if status.Status >= core.TxStatusIncluded {
+		fields["blockHash"] = status.BlockHash
+		fields["blockNumber"] = hexutil.Uint64(status.BlockNumber)
+		fields["transactionIndex"] = hexutil.Uint64(status.Index)
+	}
+	if status.Status >= core.TxStatusReferenced {
+		fields["masterBlockHash"] = status.MasterHash
+		fields["masterBlockNumber"] = hexutil.Uint64(status.MasterNumber)
+	}
+	return fields, nil
+}
+
+// GetRejectedTransaction returns the record of a transaction which a shard block
+// included, but the canonical master block referencing it refused to apply.
+// Nil is returned if the transaction was not rejected.
+func (s *PublicTransactionPoolAPI) GetRejectedTransaction(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	rejected, blockHash, blockNumber, err := s.b.GetRejectedTx(ctx, hash)
+	if rejected == nil || err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		"transactionHash":   hash,
+		"from":              rejected.From,
+		"shardId":           hexutil.Uint(rejected.ShardId),
+		"shardBlockHash":    rejected.BlockHash,
+		"transactionIndex":  hexutil.Uint64(rejected.Index),
+		"masterBlockHash":   blockHash,
+		"masterBlockNumber": hexutil.Uint64(blockNumber),
+		"reason":            rejected.Reason,
+	}
+	return fields, nil
+}
+
 // sign is a helper function that signs a transaction with the private key of the given address.
 func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
 	// Look up the wallet containing the requested signer
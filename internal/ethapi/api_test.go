@@ -0,0 +1,76 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/common/hexutil"
+	"github.com/EDXFund/MasterChain/core/types"
+)
+
+// rejectedBackend is a Backend only serving rejected transactions.
+type rejectedBackend struct {
+	Backend
+	rejected map[common.Hash]*types.RejectedTx
+}
+
+func (b *rejectedBackend) GetRejectedTx(ctx context.Context, hash common.Hash) (*types.RejectedTx, common.Hash, uint64, error) {
+	if tx, ok := b.rejected[hash]; ok {
+		return tx, common.Hash{0xff}, 7, nil
+	}
+	return nil, common.Hash{}, 0, nil
+}
+
+// Tests that rejected transactions are reported along with the master block
+// which refused them, and that others are reported as nil.
+func TestGetRejectedTransaction(t *testing.T) {
+	rejected := &types.RejectedTx{
+		TxHash:    common.Hash{0x01},
+		From:      common.Address{0xaa},
+		ShardId:   2,
+		BlockHash: common.Hash{0x02},
+		Index:     3,
+		Reason:    "nonce too low",
+	}
+	api := NewPublicTransactionPoolAPI(&rejectedBackend{rejected: map[common.Hash]*types.RejectedTx{rejected.TxHash: rejected}}, nil)
+
+	fields, err := api.GetRejectedTransaction(context.Background(), rejected.TxHash)
+	if err != nil {
+		t.Fatalf("failed to retrieve rejected transaction: %v", err)
+	}
+	want := map[string]interface{}{
+		"transactionHash":   rejected.TxHash,
+		"from":              rejected.From,
+		"shardId":           hexutil.Uint(2),
+		"shardBlockHash":    rejected.BlockHash,
+		"transactionIndex":  hexutil.Uint64(3),
+		"masterBlockHash":   common.Hash{0xff},
+		"masterBlockNumber": hexutil.Uint64(7),
+		"reason":            "nonce too low",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("rejected transaction mismatch: have %v, want %v", fields, want)
+	}
+	fields, err = api.GetRejectedTransaction(context.Background(), common.Hash{0x03})
+	if fields != nil || err != nil {
+		t.Errorf("accepted transaction reported rejected: %v, %v", fields, err)
+	}
+}
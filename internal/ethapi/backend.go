@@ -53,6 +53,7 @@ type Backend interface {
 	GetBlock(ctx context.Context, blockHash common.Hash) (types.BlockIntf, error)
 	GetShardBlock(ctx context.Context, blockHash common.Hash, shardId uint16) (types.BlockIntf, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
+	GetRejectedTx(ctx context.Context, txHash common.Hash) (*types.RejectedTx, common.Hash, uint64, error)
 	GetTd(blockHash common.Hash) *big.Int
 	GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header types.HeaderIntf, vmCfg vm.Config) (*vm.EVM, func() error, error)
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
@@ -64,6 +65,7 @@ type Backend interface {
 	GetPoolTransactions() (types.Transactions, error)
 	GetPoolTransaction(txHash common.Hash) *types.Transaction
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
+	GetShardTxStatus(ctx context.Context, txHash common.Hash) (*core.ShardTxStatus, error)
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
@@ -481,6 +481,23 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.toHex]
 		}),
+		new web3._extend.Method({
+			name: 'getTransactionShardStatus',
+			call: 'eth_getTransactionShardStatus',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getRejectedTransaction',
+			call: 'eth_getRejectedTransaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getTokenBalance',
+			call: 'eth_getTokenBalance',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.utils.toHex, web3._extend.formatters.inputDefaultBlockNumberFormatter],
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
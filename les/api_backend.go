@@ -99,6 +99,12 @@ func (b *LesApiBackend) GetReceipts(ctx context.Context, hash common.Hash) (type
 	return nil, nil
 }
 
+// GetRejectedTx is not supported by light clients, which don't process the
+// shard blocks rejecting transactions.
+func (b *LesApiBackend) GetRejectedTx(ctx context.Context, txHash common.Hash) (*types.RejectedTx, common.Hash, uint64, error) {
+	return nil, common.Hash{}, 0, nil
+}
+
 func (b *LesApiBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
 	if number := rawdb.ReadHeaderNumber(b.eth.chainDb, hash); number != nil {
 		return light.GetBlockLogs(ctx, b.eth.odr, hash, *number)
@@ -136,6 +142,15 @@ func (b *LesApiBackend) GetPoolNonce(ctx context.Context, addr common.Address) (
 	return b.eth.txPool.GetNonce(ctx, addr)
 }
 
+// GetShardTxStatus only knows the transactions sent through the light pool, as
+// light clients don't track shard blocks. They are not routed to a shard yet.
+func (b *LesApiBackend) GetShardTxStatus(ctx context.Context, txHash common.Hash) (*core.ShardTxStatus, error) {
+	if b.eth.txPool.GetTransaction(txHash) != nil {
+		return &core.ShardTxStatus{Status: core.TxStatusPending, ShardId: types.ShardMaster}, nil
+	}
+	return nil, nil
+}
+
 func (b *LesApiBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats(), 0
 }
@@ -215,6 +215,9 @@ func (f *lightFetcher) syncLoop() {
 
 // registerPeer adds a new peer to the fetcher's peer set
 func (f *lightFetcher) registerPeer(p *peer) {
+	if p.ShardId() != f.chain.ShardId() {
+		return
+	}
 	p.lock.Lock()
 	p.hasBlock = func(hash common.Hash, number uint64, hasState bool) bool {
 		return f.peerHasBlock(p, hash, number, hasState)
@@ -229,6 +232,9 @@ func (f *lightFetcher) registerPeer(p *peer) {
 
 // unregisterPeer removes a new peer from the fetcher's peer set
 func (f *lightFetcher) unregisterPeer(p *peer) {
+	if p.ShardId() != f.chain.ShardId() {
+		return
+	}
 	p.lock.Lock()
 	p.hasBlock = nil
 	p.lock.Unlock()
@@ -496,7 +502,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 					time.Sleep(hardRequestTimeout)
 					f.timeoutChn <- reqID
 				}()
-				return func() { p.RequestHeadersByHash(reqID, cost, bestHash, int(bestAmount), 0, true) }
+				return func() { p.RequestHeadersByHash(reqID, cost, bestHash, int(bestAmount), 0, true, f.chain.ShardId()) }
 			},
 		}
 	}
@@ -519,7 +525,7 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 		headers[int(req.amount)-1-i] = header
 	}
 	if _, err := f.chain.InsertHeaderChain(headers, 1); err != nil {
-		if err == consensus.ErrFutureBlock {
+		if err == consensus.ErrFutureBlock || err == light.ErrUnreferencedShardHeader {
 			return true
 		}
 		log.Debug("Failed to insert header chain", "err", err)
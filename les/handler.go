@@ -109,6 +109,7 @@ type ProtocolManager struct {
 
 	downloader *downloader.Downloader
 	fetcher    *lightFetcher
+	master     *masterFollower // Master header follower of shard light clients
 	peers      *peerSet
 	maxPeers   int
 
@@ -160,11 +161,29 @@ func NewProtocolManager(chainConfig *params.ChainConfig, indexerConfig *light.In
 		manager.downloader = downloader.New(downloader.LightSync, chainDb, manager.eventMux, nil, blockchain, removePeer)
 		manager.peers.notify((*downloaderPeerNotify)(manager))
 		manager.fetcher = newLightFetcher(manager)
+		if blockchain.ShardId() != types.ShardMaster {
+			manager.master = newMasterFollower(manager)
+		}
 	}
 
 	return manager, nil
 }
 
+// announce hands a new head announcement over to the fetcher if the peer serves
+// our own chain, or to the master follower if it is a master server.
+func (pm *ProtocolManager) announce(p *peer, head *announceData) {
+	switch shardId := p.ShardId(); {
+	case shardId == pm.blockchain.ShardId():
+		if pm.fetcher != nil {
+			pm.fetcher.announce(p, head)
+		}
+	case shardId == types.ShardMaster:
+		if pm.master != nil {
+			pm.master.announce(p, head)
+		}
+	}
+}
+
 // removePeer initiates disconnection from a peer by removing it from the peer set
 func (pm *ProtocolManager) removePeer(id string) {
 	pm.peers.Unregister(id)
@@ -252,13 +271,13 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 	// Execute the LES handshake
 	var (
-		genesis = pm.blockchain.Genesis()
+		genesis = rawdb.ReadCanonicalHash(pm.chainDb, types.ShardMaster, 0)
 		head    = pm.blockchain.CurrentHeader()
 		hash    = head.Hash()
 		number  = head.NumberU64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
-	if err := p.Handshake(td, hash, number, genesis.Hash(), pm.server); err != nil {
+	if err := p.Handshake(td, hash, number, genesis, pm.blockchain.ShardId(), pm.server); err != nil {
 		p.Log().Debug("Light Ethereum handshake failed", "err", err)
 		return err
 	}
@@ -294,9 +313,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		p.lock.Lock()
 		head := p.headInfo
 		p.lock.Unlock()
-		if pm.fetcher != nil {
-			pm.fetcher.announce(p, head)
-		}
+		pm.announce(p, head)
 
 		if p.poolEntry != nil {
 			pm.serverPool.registered(p.poolEntry)
@@ -391,9 +408,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 
 		p.Log().Trace("Announce message content", "number", req.Number, "hash", req.Hash, "td", req.Td, "reorg", req.ReorgDepth)
-		if pm.fetcher != nil {
-			pm.fetcher.announce(p, &req)
-		}
+		pm.announce(p, &req)
 
 	case GetBlockHeadersMsg:
 		p.Log().Trace("Received block header request")
@@ -410,6 +425,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if reject(query.Amount, MaxHeaderFetch) {
 			return errResp(ErrRequestRejected, "")
 		}
+		shardId := pm.blockchain.ShardId()
 
 		hashMode := query.Origin.Hash != (common.Hash{})
 		first := true
@@ -421,7 +437,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			headers []types.HeaderIntf
 			unknown bool
 		)
-		for !unknown && len(headers) < int(query.Amount) && bytes < softResponseLimit {
+		for query.ShardId == shardId && !unknown && len(headers) < int(query.Amount) && bytes < softResponseLimit {
 			// Retrieve the next header satisfying the query
 			var origin types.HeaderIntf
 			if hashMode {
@@ -493,7 +509,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + query.Amount*costs.reqCost)
 		pm.server.fcCostStats.update(msg.Code, query.Amount, rcost)
-		return p.SendBlockHeaders(req.ReqID, bv, headers)
+		return p.SendBlockHeaders(req.ReqID, bv, shardId, headers)
 
 	case BlockHeadersMsg:
 		if pm.downloader == nil {
@@ -504,16 +520,22 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of headers arrived to one of our previous requests
 		var resp struct {
 			ReqID, BV uint64
-			Headers   []types.HeaderIntf
+			Data      rlp.RawValue
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		headers, err := p.decodeBlockHeaders(resp.Data)
+		if err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
 		p.fcServer.GotReply(resp.ReqID, resp.BV)
-		if pm.fetcher != nil && pm.fetcher.requestedID(resp.ReqID) {
-			pm.fetcher.deliverHeaders(p, resp.ReqID, resp.Headers)
+		if pm.master != nil && pm.master.requestedID(resp.ReqID) {
+			pm.master.deliverHeaders(p, resp.ReqID, headers)
+		} else if pm.fetcher != nil && pm.fetcher.requestedID(resp.ReqID) {
+			pm.fetcher.deliverHeaders(p, resp.ReqID, headers)
 		} else {
-			err := pm.downloader.DeliverHeaders(p.id, resp.Headers)
+			err := pm.downloader.DeliverHeaders(p.id, headers)
 			if err != nil {
 				log.Debug(fmt.Sprint(err))
 			}
@@ -527,7 +549,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Hashes  []common.Hash
 		}
-		if err := msg.Decode(&req); err != nil {
+		if err := p.decodeShardRequest(msg, &req.ReqID, &req.ShardId, &req.Hashes); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather blocks until the fetch or network limits is reached
@@ -564,7 +586,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of block bodies arrived to one of our previous requests
 		var resp struct {
 			ReqID, BV uint64
-			Data      []*types.Body
+			Data      []rlp.RawValue
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
@@ -584,7 +606,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Reqs    []CodeReq
 		}
-		if err := msg.Decode(&reqm); err != nil {
+		if err := p.decodeShardRequest(msg, &reqm.ReqID, &reqm.ShardId, &reqm.Reqs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -650,7 +672,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Hashes  []common.Hash
 		}
-		if err := msg.Decode(&req); err != nil {
+		if err := p.decodeShardRequest(msg, &req.ReqID, &req.ShardId, &req.Hashes); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -717,7 +739,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Reqs    []ProofReq
 		}
-		if err := msg.Decode(&reqm); err != nil {
+		if err := p.decodeShardRequest(msg, &reqm.ReqID, &reqm.ShardId, &reqm.Reqs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -771,7 +793,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Reqs    []ProofReq
 		}
-		if err := msg.Decode(&reqm); err != nil {
+		if err := p.decodeShardRequest(msg, &reqm.ReqID, &reqm.ShardId, &reqm.Reqs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -876,7 +898,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Reqs    []ChtReq
 		}
-		if err := msg.Decode(&reqm); err != nil {
+		if err := p.decodeShardRequest(msg, &reqm.ReqID, &reqm.ShardId, &reqm.Reqs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -922,7 +944,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			ShardId uint16
 			Reqs    []HelperTrieReq
 		}
-		if err := msg.Decode(&reqm); err != nil {
+		if err := p.decodeShardRequest(msg, &reqm.ReqID, &reqm.ShardId, &reqm.Reqs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -1169,18 +1191,18 @@ func (pm *ProtocolManager) getHelperTrieAuxData(req HelperTrieReq, shardId uint1
 
 func (pm *ProtocolManager) txStatus(hashes []common.Hash) []txStatus {
 	stats := make([]txStatus, len(hashes))
-	//for i, stat := range pm.txpool.Status(hashes) {
-	//	// Save the status we've got from the transaction pool
-	//	stats[i].Status = stat
-	//
-	//	// If the transaction is unknown to the pool, try looking it up locally
-	//	if stat == core.TxStatusUnknown {
-	//		if shardId, block, number, index := rawdb.ReadTxLookupEntry(pm.chainDb, hashes[i]); block != (common.Hash{}) {
-	//			stats[i].Status = core.TxStatusIncluded
-	//			stats[i].Lookup = &rawdb.TxLookupEntry{ShardId: shardId, BlockHash: block, BlockIndex: number, Index: index}
-	//		}
-	//	}
-	//}
+	for i, stat := range pm.txpool.ShardStatus(hashes) {
+		// Transactions neither in the pool nor in a known shard block stay unknown
+		if stat == nil {
+			continue
+		}
+		stats[i].Status = stat.Status
+
+		// Included transactions are looked up in the shard block including them
+		if stat.BlockHash != (common.Hash{}) {
+			stats[i].Lookup = &rawdb.TxLookupEntry{ShardId: stat.ShardId, BlockHash: stat.BlockHash, BlockIndex: stat.BlockNumber, Index: stat.Index}
+		}
+	}
 	return stats
 }
 
@@ -1210,7 +1232,9 @@ func (pc *peerConnection) RequestHeadersByHash(origin common.Hash, amount int, s
 			peer := dp.(*peer)
 			cost := peer.GetRequestCost(GetBlockHeadersMsg, amount)
 			peer.fcServer.QueueRequest(reqID, cost)
-			return func() { peer.RequestHeadersByHash(reqID, cost, origin, amount, skip, reverse) }
+			return func() {
+				peer.RequestHeadersByHash(reqID, cost, origin, amount, skip, reverse, pc.manager.blockchain.ShardId())
+			}
 		},
 	}
 	_, ok := <-pc.manager.reqDist.queue(rq)
@@ -46,9 +46,29 @@ func expectResponse(r p2p.MsgReader, msgcode, reqID, bv uint64, data interface{}
 	return p2p.ExpectMsg(r, msgcode, resp{reqID, bv, data})
 }
 
+// sendTestRequest sends a request for the data of a shard through the local end
+// of a test peer, in the request layout of the peer's protocol version.
+func sendTestRequest(p *testPeer, msgcode, reqID, cost uint64, shardId uint16, data interface{}) error {
+	return (&peer{version: p.version, rw: p.app}).sendShardRequest(msgcode, reqID, cost, shardId, data)
+}
+
+// headersResponse returns the payload of a block headers response in the layout
+// of the given protocol version, older peers receive bare master headers.
+func headersResponse(t *testing.T, protocol int, shardId uint16, headers []types.HeaderIntf) interface{} {
+	data, err := encodeBlockHeaders(shardId, headers)
+	if err != nil {
+		t.Fatalf("failed to encode headers: %v", err)
+	}
+	if protocol < lpv3 {
+		return rlp.RawValue(data.Data)
+	}
+	return data
+}
+
 // Tests that block headers can be retrieved from a remote chain based on user queries.
 func TestGetBlockHeadersLes1(t *testing.T) { testGetBlockHeaders(t, 1) }
 func TestGetBlockHeadersLes2(t *testing.T) { testGetBlockHeaders(t, 2) }
+func TestGetBlockHeadersLes3(t *testing.T) { testGetBlockHeaders(t, 3) }
 
 func testGetBlockHeaders(t *testing.T, protocol int) {
 	server, tearDown := newServerEnv(t, downloader.MaxHashFetch+15, protocol, nil)
@@ -160,15 +180,16 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 	var reqID uint64
 	for i, tt := range tests {
 		// Collect the headers to expect in the response
-		headers := []*types.Header{}
+		headers := []types.HeaderIntf{}
 		for _, hash := range tt.expect {
 			headers = append(headers, bc.GetHeaderByHash(hash))
 		}
 		// Send the hash request and verify the response
 		reqID++
+		tt.query.ShardId = bc.ShardId()
 		cost := server.tPeer.GetRequestCost(GetBlockHeadersMsg, int(tt.query.Amount))
 		sendRequest(server.tPeer.app, GetBlockHeadersMsg, reqID, cost, tt.query)
-		if err := expectResponse(server.tPeer.app, BlockHeadersMsg, reqID, testBufLimit, headers); err != nil {
+		if err := expectResponse(server.tPeer.app, BlockHeadersMsg, reqID, testBufLimit, headersResponse(t, protocol, bc.ShardId(), headers)); err != nil {
 			t.Errorf("test %d: headers mismatch: %v", i, err)
 		}
 	}
@@ -177,6 +198,7 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 // Tests that block contents can be retrieved from a remote chain based on their hashes.
 func TestGetBlockBodiesLes1(t *testing.T) { testGetBlockBodies(t, 1) }
 func TestGetBlockBodiesLes2(t *testing.T) { testGetBlockBodies(t, 2) }
+func TestGetBlockBodiesLes3(t *testing.T) { testGetBlockBodies(t, 3) }
 
 func testGetBlockBodies(t *testing.T, protocol int) {
 	server, tearDown := newServerEnv(t, downloader.MaxBlockFetch+15, protocol, nil)
@@ -215,7 +237,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 	for i, tt := range tests {
 		// Collect the hashes to request, and the response to expect
 		hashes, seen := []common.Hash{}, make(map[int64]bool)
-		bodies := []*types.Body{}
+		bodies := []rlp.RawValue{}
 
 		for j := 0; j < tt.random; j++ {
 			for {
@@ -226,7 +248,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 					block := bc.GetBlockByNumber(uint64(num))
 					hashes = append(hashes, block.Hash())
 					if len(bodies) < tt.expected {
-						bodies = append(bodies, &types.Body{Transactions: block.Transactions(), Uncles: block.Uncles()})
+						bodies = append(bodies, rawdb.ReadBodyRLP(server.db, block.Hash(), block.NumberU64()))
 					}
 					break
 				}
@@ -236,13 +258,13 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 			hashes = append(hashes, hash)
 			if tt.available[j] && len(bodies) < tt.expected {
 				block := bc.GetBlockByHash(hash)
-				bodies = append(bodies, &types.Body{Transactions: block.Transactions(), Uncles: block.Uncles()})
+				bodies = append(bodies, rawdb.ReadBodyRLP(server.db, block.Hash(), block.NumberU64()))
 			}
 		}
 		reqID++
 		// Send the hash request and verify the response
 		cost := server.tPeer.GetRequestCost(GetBlockBodiesMsg, len(hashes))
-		sendRequest(server.tPeer.app, GetBlockBodiesMsg, reqID, cost, hashes)
+		sendTestRequest(server.tPeer, GetBlockBodiesMsg, reqID, cost, bc.ShardId(), hashes)
 		if err := expectResponse(server.tPeer.app, BlockBodiesMsg, reqID, testBufLimit, bodies); err != nil {
 			t.Errorf("test %d: bodies mismatch: %v", i, err)
 		}
@@ -252,6 +274,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 // Tests that the contract codes can be retrieved based on account addresses.
 func TestGetCodeLes1(t *testing.T) { testGetCode(t, 1) }
 func TestGetCodeLes2(t *testing.T) { testGetCode(t, 2) }
+func TestGetCodeLes3(t *testing.T) { testGetCode(t, 3) }
 
 func testGetCode(t *testing.T, protocol int) {
 	// Assemble the test environment
@@ -262,6 +285,8 @@ func testGetCode(t *testing.T, protocol int) {
 	var codereqs []*CodeReq
 	var codes [][]byte
 
+	// Master blocks don't execute transactions, the contract only exists on shards
+	deployed := bc.ShardId() != types.ShardMaster
 	for i := uint64(0); i <= bc.CurrentBlock().NumberU64(); i++ {
 		header := bc.GetHeaderByNumber(i)
 		req := &CodeReq{
@@ -269,13 +294,13 @@ func testGetCode(t *testing.T, protocol int) {
 			AccKey: crypto.Keccak256(testContractAddr[:]),
 		}
 		codereqs = append(codereqs, req)
-		if i >= testContractDeployed {
+		if deployed && i >= testContractDeployed {
 			codes = append(codes, testContractCodeDeployed)
 		}
 	}
 
 	cost := server.tPeer.GetRequestCost(GetCodeMsg, len(codereqs))
-	sendRequest(server.tPeer.app, GetCodeMsg, 42, cost, codereqs)
+	sendTestRequest(server.tPeer, GetCodeMsg, 42, cost, bc.ShardId(), codereqs)
 	if err := expectResponse(server.tPeer.app, CodeMsg, 42, testBufLimit, codes); err != nil {
 		t.Errorf("codes mismatch: %v", err)
 	}
@@ -310,6 +335,7 @@ func testGetReceipt(t *testing.T, protocol int) {
 // Tests that trie merkle proofs can be retrieved
 func TestGetProofsLes1(t *testing.T) { testGetProofs(t, 1) }
 func TestGetProofsLes2(t *testing.T) { testGetProofs(t, 2) }
+func TestGetProofsLes3(t *testing.T) { testGetProofs(t, 3) }
 
 func testGetProofs(t *testing.T, protocol int) {
 	// Assemble the test environment
@@ -326,7 +352,7 @@ func testGetProofs(t *testing.T, protocol int) {
 	accounts := []common.Address{testBankAddress, acc1Addr, acc2Addr, {}}
 	for i := uint64(0); i <= bc.CurrentBlock().NumberU64(); i++ {
 		header := bc.GetHeaderByNumber(i)
-		root := header.Root
+		root := header.Root()
 		trie, _ := trie.New(root, trie.NewDatabase(server.db))
 
 		for _, acc := range accounts {
@@ -341,7 +367,7 @@ func testGetProofs(t *testing.T, protocol int) {
 				var proof light.NodeList
 				trie.Prove(crypto.Keccak256(acc[:]), 0, &proof)
 				proofsV1 = append(proofsV1, proof)
-			case 2:
+			case 2, 3:
 				trie.Prove(crypto.Keccak256(acc[:]), 0, proofsV2)
 			}
 		}
@@ -350,13 +376,13 @@ func testGetProofs(t *testing.T, protocol int) {
 	switch protocol {
 	case 1:
 		cost := server.tPeer.GetRequestCost(GetProofsV1Msg, len(proofreqs))
-		sendRequest(server.tPeer.app, GetProofsV1Msg, 42, cost, proofreqs)
+		sendTestRequest(server.tPeer, GetProofsV1Msg, 42, cost, bc.ShardId(), proofreqs)
 		if err := expectResponse(server.tPeer.app, ProofsV1Msg, 42, testBufLimit, proofsV1); err != nil {
 			t.Errorf("proofs mismatch: %v", err)
 		}
-	case 2:
+	case 2, 3:
 		cost := server.tPeer.GetRequestCost(GetProofsV2Msg, len(proofreqs))
-		sendRequest(server.tPeer.app, GetProofsV2Msg, 42, cost, proofreqs)
+		sendTestRequest(server.tPeer, GetProofsV2Msg, 42, cost, bc.ShardId(), proofreqs)
 		if err := expectResponse(server.tPeer.app, ProofsV2Msg, 42, testBufLimit, proofsV2.NodeList()); err != nil {
 			t.Errorf("proofs mismatch: %v", err)
 		}
@@ -366,11 +392,12 @@ func testGetProofs(t *testing.T, protocol int) {
 // Tests that CHT proofs can be correctly retrieved.
 func TestGetCHTProofsLes1(t *testing.T) { testGetCHTProofs(t, 1) }
 func TestGetCHTProofsLes2(t *testing.T) { testGetCHTProofs(t, 2) }
+func TestGetCHTProofsLes3(t *testing.T) { testGetCHTProofs(t, 3) }
 
 func testGetCHTProofs(t *testing.T, protocol int) {
 	config := light.TestServerIndexerConfig
 	frequency := config.ChtSize
-	if protocol == 2 {
+	if protocol >= 2 {
 		frequency = config.PairChtSize
 	}
 
@@ -391,7 +418,7 @@ func testGetCHTProofs(t *testing.T, protocol int) {
 
 	// Assemble the proofs from the different protocols
 	header := bc.GetHeaderByNumber(frequency - 1)
-	rlp, _ := rlp.EncodeToBytes(header)
+	rlp := rawdb.ReadHeaderRLP(server.db, header.Hash(), header.NumberU64())
 
 	key := make([]byte, 8)
 	binary.BigEndian.PutUint64(key, frequency-1)
@@ -411,7 +438,7 @@ func testGetCHTProofs(t *testing.T, protocol int) {
 		trie.Prove(key, 0, &proof)
 		proofsV1[0].Proof = proof
 
-	case 2:
+	case 2, 3:
 		root := light.GetChtRoot(server.db, (frequency/config.ChtSize)-1, bc.GetHeaderByNumber(frequency-1).Hash())
 		trie, _ := trie.New(root, trie.NewDatabase(ethdb.NewTable(server.db, light.ChtTablePrefix)))
 		trie.Prove(key, 0, &proofsV2.Proofs)
@@ -431,13 +458,13 @@ func testGetCHTProofs(t *testing.T, protocol int) {
 	switch protocol {
 	case 1:
 		cost := server.tPeer.GetRequestCost(GetHeaderProofsMsg, len(requestsV1))
-		sendRequest(server.tPeer.app, GetHeaderProofsMsg, 42, cost, requestsV1)
+		sendTestRequest(server.tPeer, GetHeaderProofsMsg, 42, cost, bc.ShardId(), requestsV1)
 		if err := expectResponse(server.tPeer.app, HeaderProofsMsg, 42, testBufLimit, proofsV1); err != nil {
 			t.Errorf("proofs mismatch: %v", err)
 		}
-	case 2:
+	case 2, 3:
 		cost := server.tPeer.GetRequestCost(GetHelperTrieProofsMsg, len(requestsV2))
-		sendRequest(server.tPeer.app, GetHelperTrieProofsMsg, 42, cost, requestsV2)
+		sendTestRequest(server.tPeer, GetHelperTrieProofsMsg, 42, cost, bc.ShardId(), requestsV2)
 		if err := expectResponse(server.tPeer.app, HelperTrieProofsMsg, 42, testBufLimit, proofsV2); err != nil {
 			t.Errorf("proofs mismatch: %v", err)
 		}
@@ -492,20 +519,12 @@ func TestGetBloombitsProofs(t *testing.T) {
 	}
 }
 
-func TestTransactionStatusLes2(t *testing.T) {
-	db := ethdb.NewMemDatabase()
-	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
-	chain := pm.blockchain.(*core.BlockChain)
-	config := core.DefaultTxPoolConfig
-	config.Journal = ""
-	txpool := core.NewTxPool(config, params.TestChainConfig, chain)
-	pm.txpool = txpool
-	peer, _ := newTestPeer(t, "peer", 2, pm, true)
-	defer peer.close()
-
+// txStatusTester returns a function sending a transaction to or querying its
+// status from a server through a test peer, expecting the given status back.
+func txStatusTester(t *testing.T, peer *testPeer) func(tx *types.Transaction, send bool, expStatus txStatus) {
 	var reqID uint64
 
-	test := func(tx *types.Transaction, send bool, expStatus txStatus) {
+	return func(tx *types.Transaction, send bool, expStatus txStatus) {
 		reqID++
 		if send {
 			cost := peer.GetRequestCost(SendTxV2Msg, 1)
@@ -515,28 +534,39 @@ func TestTransactionStatusLes2(t *testing.T) {
 			sendRequest(peer.app, GetTxStatusMsg, reqID, cost, []common.Hash{tx.Hash()})
 		}
 		if err := expectResponse(peer.app, TxStatusMsg, reqID, testBufLimit, []txStatus{expStatus}); err != nil {
-			t.Errorf("transaction status mismatch")
+			t.Errorf("transaction status mismatch: %v", err)
 		}
 	}
+}
+
+// Tests that the status of transactions is reported from the pool of the shard
+// they are sent to, and from the shard blocks including them. Master pools only
+// route transactions, so the test needs a shard server and thus les/3.
+func TestTransactionStatusLes3(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db, 0)
+	chain := pm.blockchain.(*core.BlockChain)
+	config := core.DefaultTxPoolShardConfig
+	config.Journal = ""
+	txpool := core.NewTxPoolShard(config, params.TestChainConfig, chain, 0)
+	pm.txpool = txpool
+	peer, _ := newTestPeer(t, "peer", 3, pm, true)
+	defer peer.close()
 
+	test := txStatusTester(t, peer)
 	signer := types.HomesteadSigner{}
 
 	// test error status by sending an underpriced transaction
-	tx0, _ := types.SignTx(types.NewTransaction(0, acc1Addr, big.NewInt(10000), params.TxGas, nil, nil), signer, testBankKey)
+	tx0, _ := types.SignTx(types.NewTransaction(0, acc1Addr, big.NewInt(10000), params.TxGas, nil, nil, types.NativeTokenId), signer, testBankKey)
 	test(tx0, true, txStatus{Status: core.TxStatusUnknown, Error: core.ErrUnderpriced.Error()})
 
-	tx1, _ := types.SignTx(types.NewTransaction(0, acc1Addr, big.NewInt(10000), params.TxGas, big.NewInt(100000000000), nil), signer, testBankKey)
+	tx1, _ := types.SignTx(types.NewTransaction(0, acc1Addr, big.NewInt(10000), params.TxGas, big.NewInt(100000000000), nil, types.NativeTokenId), signer, testBankKey)
 	test(tx1, false, txStatus{Status: core.TxStatusUnknown}) // query before sending, should be unknown
 	test(tx1, true, txStatus{Status: core.TxStatusPending})  // send valid processable tx, should return pending
 	test(tx1, true, txStatus{Status: core.TxStatusPending})  // adding it again should not return an error
 
-	tx2, _ := types.SignTx(types.NewTransaction(1, acc1Addr, big.NewInt(10000), params.TxGas, big.NewInt(100000000000), nil), signer, testBankKey)
-	tx3, _ := types.SignTx(types.NewTransaction(2, acc1Addr, big.NewInt(10000), params.TxGas, big.NewInt(100000000000), nil), signer, testBankKey)
-	// send transactions in the wrong order, tx3 should be queued
-	test(tx3, true, txStatus{Status: core.TxStatusQueued})
+	tx2, _ := types.SignTx(types.NewTransaction(1, acc1Addr, big.NewInt(10000), params.TxGas, big.NewInt(100000000000), nil, types.NativeTokenId), signer, testBankKey)
 	test(tx2, true, txStatus{Status: core.TxStatusPending})
-	// query again, now tx3 should be pending too
-	test(tx3, false, txStatus{Status: core.TxStatusPending})
 
 	// generate and add a block with tx1 and tx2 included
 	gchain, _ := core.GenerateChain(params.TestChainConfig, chain.GetBlockByNumber(0), ethash.NewFaker(), db, 1, func(i int, block *core.BlockGen) {
@@ -548,19 +578,19 @@ func TestTransactionStatusLes2(t *testing.T) {
 	}
 	// wait until TxPool processes the inserted block
 	for i := 0; i < 10; i++ {
-		if pending, _ := txpool.Stats(); pending == 1 {
+		if pending, _ := txpool.Stats(); pending == 0 {
 			break
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
-	if pending, _ := txpool.Stats(); pending != 1 {
-		t.Fatalf("pending count mismatch: have %d, want 1", pending)
+	if pending, _ := txpool.Stats(); pending != 0 {
+		t.Fatalf("pending count mismatch: have %d, want 0", pending)
 	}
 
 	// check if their status is included now
-	block1hash := rawdb.ReadCanonicalHash(db, 1)
-	test(tx1, false, txStatus{Status: core.TxStatusIncluded, Lookup: &rawdb.TxLookupEntry{BlockHash: block1hash, BlockIndex: 1, Index: 0}})
-	test(tx2, false, txStatus{Status: core.TxStatusIncluded, Lookup: &rawdb.TxLookupEntry{BlockHash: block1hash, BlockIndex: 1, Index: 1}})
+	block1hash := rawdb.ReadCanonicalHash(db, 0, 1)
+	test(tx1, false, txStatus{Status: core.TxStatusIncluded, Lookup: &rawdb.TxLookupEntry{ShardId: 0, BlockHash: block1hash, BlockIndex: 1, Index: 0}})
+	test(tx2, false, txStatus{Status: core.TxStatusIncluded, Lookup: &rawdb.TxLookupEntry{ShardId: 0, BlockHash: block1hash, BlockIndex: 1, Index: 1}})
 
 	// create a reorg that rolls them back
 	gchain, _ = core.GenerateChain(params.TestChainConfig, chain.GetBlockByNumber(0), ethash.NewFaker(), db, 2, func(i int, block *core.BlockGen) {})
@@ -569,13 +599,13 @@ func TestTransactionStatusLes2(t *testing.T) {
 	}
 	// wait until TxPool processes the reorg
 	for i := 0; i < 10; i++ {
-		if pending, _ := txpool.Stats(); pending == 3 {
+		if pending, _ := txpool.Stats(); pending == 2 {
 			break
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
-	if pending, _ := txpool.Stats(); pending != 3 {
-		t.Fatalf("pending count mismatch: have %d, want 3", pending)
+	if pending, _ := txpool.Stats(); pending != 2 {
+		t.Fatalf("pending count mismatch: have %d, want 2", pending)
 	}
 	// check if their status is pending again
 	test(tx1, false, txStatus{Status: core.TxStatusPending})
@@ -0,0 +1,307 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/light"
+	"github.com/EDXFund/MasterChain/log"
+)
+
+const (
+	masterReorgMargin  = 16              // number of recent master headers requested again to pick up shallow reorgs
+	masterIndexTimeout = time.Minute * 5 // maximum time spent indexing shard block references in one run
+)
+
+// masterFollower keeps the master header chain of a shard light client in sync
+// with the heads announced by master servers. The shard chain is only extended
+// with headers referenced by the canonical master chain, so the follower also
+// indexes the shard blocks included in each new master block.
+type masterFollower struct {
+	pm    *ProtocolManager
+	chain *light.LightChain
+
+	lock      sync.Mutex
+	heads     map[*peer]*announceData // Latest head announced by each registered master server
+	requested map[uint64]*peer        // Header requests currently in flight
+
+	requestCh chan struct{}
+	deliverCh chan fetchResponse
+	timeoutCh chan uint64
+	indexing  int32 // Whether shard block references are being indexed (atomic)
+}
+
+// newMasterFollower creates a master header follower for the shard light chain
+// of the protocol manager.
+func newMasterFollower(pm *ProtocolManager) *masterFollower {
+	f := &masterFollower{
+		pm:        pm,
+		chain:     pm.blockchain.(*light.LightChain).Master(),
+		heads:     make(map[*peer]*announceData),
+		requested: make(map[uint64]*peer),
+		requestCh: make(chan struct{}, 1),
+		deliverCh: make(chan fetchResponse, 100),
+		timeoutCh: make(chan uint64),
+	}
+	pm.peers.notify(f)
+
+	f.pm.wg.Add(1)
+	go f.syncLoop()
+	return f
+}
+
+// syncLoop requests the next batch of master headers whenever a master server
+// announces a heavier chain, and inserts the delivered headers.
+func (f *masterFollower) syncLoop() {
+	defer f.pm.wg.Done()
+	for {
+		select {
+		case <-f.pm.quitSync:
+			return
+
+		case <-f.requestCh:
+			f.nextRequest()
+
+		case reqID := <-f.timeoutCh:
+			f.lock.Lock()
+			p, ok := f.requested[reqID]
+			delete(f.requested, reqID)
+			f.lock.Unlock()
+			if ok {
+				p.Log().Debug("Fetching master headers timed out hard")
+				go f.pm.removePeer(p.id)
+				f.trigger()
+			}
+
+		case resp := <-f.deliverCh:
+			f.lock.Lock()
+			p, ok := f.requested[resp.reqID]
+			if ok && p == resp.peer {
+				delete(f.requested, resp.reqID)
+			} else {
+				ok = false
+			}
+			f.lock.Unlock()
+			if !ok {
+				continue
+			}
+			if len(resp.headers) > 0 {
+				if _, err := f.chain.InsertHeaderChain(resp.headers, 1); err != nil {
+					resp.peer.Log().Debug("Failed to insert master header chain", "err", err)
+					if err != consensus.ErrFutureBlock {
+						go f.pm.removePeer(resp.peer.id)
+					}
+					continue
+				}
+				go f.index()
+			}
+			f.trigger()
+		}
+	}
+}
+
+// trigger schedules a new header request check without blocking.
+func (f *masterFollower) trigger() {
+	select {
+	case f.requestCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextRequest asks the master server announcing the heaviest chain for the
+// headers following our own master head, unless a request is already running.
+func (f *masterFollower) nextRequest() {
+	f.lock.Lock()
+	if len(f.requested) > 0 {
+		f.lock.Unlock()
+		return
+	}
+	var (
+		best     *peer
+		bestHead *announceData
+	)
+	for p, head := range f.heads {
+		if head != nil && (bestHead == nil || head.Td.Cmp(bestHead.Td) > 0) {
+			best, bestHead = p, head
+		}
+	}
+	f.lock.Unlock()
+
+	if best == nil {
+		return
+	}
+	current := f.chain.CurrentHeader()
+	if td := f.chain.GetTd(current.Hash(), current.NumberU64()); td != nil && bestHead.Td.Cmp(td) <= 0 {
+		return
+	}
+	origin := uint64(1)
+	if number := current.NumberU64(); number > masterReorgMargin {
+		origin = number - masterReorgMargin + 1
+	}
+	amount := uint64(MaxHeaderFetch)
+	if bestHead.Number >= origin && bestHead.Number-origin+1 < amount {
+		amount = bestHead.Number - origin + 1
+	}
+	reqID := genReqID()
+
+	f.lock.Lock()
+	f.requested[reqID] = best
+	f.lock.Unlock()
+
+	rq := &distReq{
+		getCost: func(dp distPeer) uint64 {
+			return dp.(*peer).GetRequestCost(GetBlockHeadersMsg, int(amount))
+		},
+		canSend: func(dp distPeer) bool {
+			return dp.(*peer) == best
+		},
+		request: func(dp distPeer) func() {
+			p := dp.(*peer)
+			cost := p.GetRequestCost(GetBlockHeadersMsg, int(amount))
+			p.fcServer.QueueRequest(reqID, cost)
+			go func() {
+				time.Sleep(hardRequestTimeout)
+				select {
+				case f.timeoutCh <- reqID:
+				case <-f.pm.quitSync:
+				}
+			}()
+			return func() { p.RequestHeadersByNumber(reqID, cost, origin, int(amount), 0, false, types.ShardMaster) }
+		},
+	}
+	if _, ok := <-f.pm.reqDist.queue(rq); !ok {
+		f.lock.Lock()
+		delete(f.requested, reqID)
+		f.lock.Unlock()
+	}
+}
+
+// index records the shard blocks referenced by the newly inserted master blocks,
+// skipping the run if a previous one is still in progress.
+func (f *masterFollower) index() {
+	if !atomic.CompareAndSwapInt32(&f.indexing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&f.indexing, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), masterIndexTimeout)
+	defer cancel()
+	if err := f.chain.IndexShardRefs(ctx); err != nil {
+		log.Debug("Failed to index shard block references", "err", err)
+	}
+}
+
+// registerPeer starts tracking the heads announced by a master server.
+func (f *masterFollower) registerPeer(p *peer) {
+	if p.ShardId() != types.ShardMaster {
+		return
+	}
+	p.lock.Lock()
+	p.hasBlock = func(hash common.Hash, number uint64, hasState bool) bool {
+		return f.peerHasBlock(p, hash, number, hasState)
+	}
+	p.lock.Unlock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.heads[p] = nil
+}
+
+// unregisterPeer stops tracking a master server.
+func (f *masterFollower) unregisterPeer(p *peer) {
+	if p.ShardId() != types.ShardMaster {
+		return
+	}
+	p.lock.Lock()
+	p.hasBlock = nil
+	p.lock.Unlock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.heads, p)
+	for reqID, rp := range f.requested {
+		if rp == p {
+			delete(f.requested, reqID)
+		}
+	}
+	f.trigger()
+}
+
+// announce processes a new head announced by a master server.
+func (f *masterFollower) announce(p *peer, head *announceData) {
+	f.lock.Lock()
+	prev, ok := f.heads[p]
+	if !ok {
+		f.lock.Unlock()
+		p.Log().Debug("Master announcement from unknown peer")
+		return
+	}
+	if prev != nil && head.Td.Cmp(prev.Td) <= 0 {
+		f.lock.Unlock()
+		p.Log().Debug("Received non-monotonic master td", "current", head.Td, "previous", prev.Td)
+		go f.pm.removePeer(p.id)
+		return
+	}
+	f.heads[p] = head
+	f.lock.Unlock()
+
+	p.lock.Lock()
+	p.headInfo = head
+	p.lock.Unlock()
+
+	f.trigger()
+}
+
+// peerHasBlock reports whether a master server is expected to know a given
+// canonical master block.
+func (f *masterFollower) peerHasBlock(p *peer, hash common.Hash, number uint64, hasState bool) bool {
+	f.lock.Lock()
+	head := f.heads[p]
+	f.lock.Unlock()
+
+	if head == nil || head.Number < number {
+		return false
+	}
+	if hasState && head.Number > number+serverStateAvailable {
+		return false
+	}
+	return rawdb.ReadCanonicalHash(f.pm.chainDb, types.ShardMaster, number) == hash
+}
+
+// requestedID tells if a certain reqID has been requested by the follower.
+func (f *masterFollower) requestedID(reqID uint64) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, ok := f.requested[reqID]
+	return ok
+}
+
+// deliverHeaders delivers master header responses for processing.
+func (f *masterFollower) deliverHeaders(peer *peer, reqID uint64, headers []types.HeaderIntf) {
+	f.deliverCh <- fetchResponse{reqID: reqID, headers: headers, peer: peer}
+}
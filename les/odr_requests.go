@@ -22,6 +22,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/core/rawdb"
@@ -45,6 +46,7 @@ var (
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
 	errCHTNumberMismatch   = errors.New("cht number mismatch")
 	errUselessNodes        = errors.New("useless nodes in merkle proof nodeset")
+	errShardMismatch       = errors.New("shard mismatch")
 )
 
 type LesOdrRequest interface {
@@ -84,13 +86,13 @@ func (r *BlockRequest) GetCost(peer *peer) uint64 {
 
 // CanSend tells if a certain peer is suitable for serving the given request
 func (r *BlockRequest) CanSend(peer *peer) bool {
-	return peer.HasBlock(r.Hash, r.Number, false)
+	return peer.ShardId() == r.ShardId && peer.HasBlock(r.Hash, r.Number, false)
 }
 
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
 func (r *BlockRequest) Request(reqID uint64, peer *peer) error {
 	peer.Log().Debug("Requesting block body", "hash", r.Hash)
-	return peer.RequestBodies(reqID, r.GetCost(peer), []common.Hash{r.Hash})
+	return peer.RequestBodies(reqID, r.GetCost(peer), r.ShardId, []common.Hash{r.Hash})
 }
 
 // Valid processes an ODR request reply message from the LES network
@@ -103,27 +105,47 @@ func (r *BlockRequest) Validate(db ethdb.Database, msg *Msg) error {
 	if msg.MsgType != MsgBlockBodies {
 		return errInvalidMessageType
 	}
-	bodies := msg.Obj.([]*types.Body)
+	bodies := msg.Obj.([]rlp.RawValue)
 	if len(bodies) != 1 {
 		return errInvalidEntryCount
 	}
-	body := bodies[0]
-
+	encoded := new(types.BodyEncode)
+	if err := rlp.DecodeBytes(bodies[0], encoded); err != nil {
+		return err
+	}
+	body := new(types.SuperBody)
+	if err := rlp.DecodeBytes(encoded.Body, body); err != nil {
+		return err
+	}
 	// Retrieve our stored header and validate block content against it
 	header := rawdb.ReadHeader(db, r.Hash, r.Number)
-	if header == nil {
+	if header == nil || reflect.ValueOf(header).IsNil() {
 		return errHeaderUnavailable
 	}
-	if header.TxHash() != types.DeriveSha(types.ShardBlockInfos(body.Transactions)) {
-		return errTxHashMismatch
+	if header.ShardId() != r.ShardId || encoded.ShardId != r.ShardId {
+		return errShardMismatch
 	}
-
-	// Validations passed, encode and store RLP
-	data, err := rlp.EncodeToBytes(body)
-	if err != nil {
-		return err
+	if r.ShardId == types.ShardMaster {
+		if header.ShardTxsHash() != types.DeriveSha(types.ShardBlockInfos(body.ShardBlocks)) {
+			return errTxHashMismatch
+		}
+		uncles := make([]types.HeaderIntf, len(body.Uncles))
+		for i, uncle := range body.Uncles {
+			uncles[i] = uncle
+		}
+		if header.UncleHash() != types.CalcUncleHash(uncles) {
+			return errUncleHashMismatch
+		}
+	} else {
+		if header.TxHash() != types.DeriveSha(types.Transactions(body.Transactions)) {
+			return errTxHashMismatch
+		}
+		if header.ReceiptHash() != types.DeriveSha(types.ContractResults(body.Results)) {
+			return errReceiptHashMismatch
+		}
 	}
-	r.Rlp = data
+	// Validations passed, store the RLP as received
+	r.Rlp = bodies[0]
 	return nil
 }
 
@@ -138,7 +160,7 @@ func (r *ReceiptsRequest) GetCost(peer *peer) uint64 {
 
 // CanSend tells if a certain peer is suitable for serving the given request
 func (r *ReceiptsRequest) CanSend(peer *peer) bool {
-	return peer.HasBlock(r.Hash, r.Number, false)
+	return peer.ShardId() == types.ShardMaster && peer.HasBlock(r.Hash, r.Number, false)
 }
 
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
@@ -191,7 +213,7 @@ func (r *TrieRequest) GetCost(peer *peer) uint64 {
 	switch peer.version {
 	case lpv1:
 		return peer.GetRequestCost(GetProofsV1Msg, 1)
-	case lpv2:
+	case lpv2, lpv3:
 		return peer.GetRequestCost(GetProofsV2Msg, 1)
 	default:
 		panic(nil)
@@ -200,7 +222,7 @@ func (r *TrieRequest) GetCost(peer *peer) uint64 {
 
 // CanSend tells if a certain peer is suitable for serving the given request
 func (r *TrieRequest) CanSend(peer *peer) bool {
-	return peer.HasBlock(r.Id.BlockHash, r.Id.BlockNumber, true)
+	return peer.ShardId() == r.Id.ShardId && peer.HasBlock(r.Id.BlockHash, r.Id.BlockNumber, true)
 }
 
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
@@ -211,7 +233,7 @@ func (r *TrieRequest) Request(reqID uint64, peer *peer) error {
 		AccKey: r.Id.AccKey,
 		Key:    r.Key,
 	}
-	return peer.RequestProofs(reqID, r.GetCost(peer), []ProofReq{req})
+	return peer.RequestProofs(reqID, r.GetCost(peer), r.Id.ShardId, []ProofReq{req})
 }
 
 // Valid processes an ODR request reply message from the LES network
@@ -270,7 +292,7 @@ func (r *CodeRequest) GetCost(peer *peer) uint64 {
 
 // CanSend tells if a certain peer is suitable for serving the given request
 func (r *CodeRequest) CanSend(peer *peer) bool {
-	return peer.HasBlock(r.Id.BlockHash, r.Id.BlockNumber, true)
+	return peer.ShardId() == r.Id.ShardId && peer.HasBlock(r.Id.BlockHash, r.Id.BlockNumber, true)
 }
 
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
@@ -280,7 +302,7 @@ func (r *CodeRequest) Request(reqID uint64, peer *peer) error {
 		BHash:  r.Id.BlockHash,
 		AccKey: r.Id.AccKey,
 	}
-	return peer.RequestCode(reqID, r.GetCost(peer), []CodeReq{req})
+	return peer.RequestCode(reqID, r.GetCost(peer), r.Id.ShardId, []CodeReq{req})
 }
 
 // Valid processes an ODR request reply message from the LES network
@@ -351,7 +373,7 @@ func (r *ChtRequest) GetCost(peer *peer) uint64 {
 	switch peer.version {
 	case lpv1:
 		return peer.GetRequestCost(GetHeaderProofsMsg, 1)
-	case lpv2:
+	case lpv2, lpv3:
 		return peer.GetRequestCost(GetHelperTrieProofsMsg, 1)
 	default:
 		panic(nil)
@@ -363,6 +385,9 @@ func (r *ChtRequest) CanSend(peer *peer) bool {
 	peer.lock.RLock()
 	defer peer.lock.RUnlock()
 
+	if peer.shardId != r.ShardId {
+		return false
+	}
 	return peer.headInfo.Number >= r.Config.ChtConfirms && r.ChtNum <= (peer.headInfo.Number-r.Config.ChtConfirms)/r.Config.ChtSize
 }
 
@@ -386,9 +411,9 @@ func (r *ChtRequest) Request(reqID uint64, peer *peer) error {
 		blockNum := binary.BigEndian.Uint64(req.Key)
 		// convert HelperTrie request to old CHT request
 		reqsV1 = ChtReq{ChtNum: (req.TrieIdx + 1) * (r.Config.ChtSize / r.Config.PairChtSize), BlockNum: blockNum, FromLevel: req.FromLevel}
-		return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), []ChtReq{reqsV1})
-	case lpv2:
-		return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), []HelperTrieReq{req})
+		return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), r.ShardId, []ChtReq{reqsV1})
+	case lpv2, lpv3:
+		return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), r.ShardId, []HelperTrieReq{req})
 	default:
 		panic(nil)
 	}
@@ -493,7 +518,7 @@ func (r *BloomRequest) CanSend(peer *peer) bool {
 	peer.lock.RLock()
 	defer peer.lock.RUnlock()
 
-	if peer.version < lpv2 {
+	if peer.version < lpv2 || peer.shardId != r.ShardId {
 		return false
 	}
 	return peer.headInfo.Number >= r.Config.BloomTrieConfirms && r.BloomTrieNum <= (peer.headInfo.Number-r.Config.BloomTrieConfirms)/r.Config.BloomTrieSize
@@ -515,7 +540,7 @@ func (r *BloomRequest) Request(reqID uint64, peer *peer) error {
 			Key:     common.CopyBytes(encNumber[:]),
 		}
 	}
-	return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), reqs)
+	return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), r.ShardId, reqs)
 }
 
 // Valid processes an ODR request reply message from the LES network
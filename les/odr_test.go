@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"math/big"
+	"reflect"
 	"testing"
 	"time"
 
@@ -42,14 +43,16 @@ func TestOdrGetBlockLes1(t *testing.T) { testOdr(t, 1, 1, odrGetBlock) }
 
 func TestOdrGetBlockLes2(t *testing.T) { testOdr(t, 2, 1, odrGetBlock) }
 
+func TestOdrGetBlockLes3(t *testing.T) { testOdr(t, 3, 1, odrGetBlock) }
+
 func odrGetBlock(ctx context.Context, db ethdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
-	var block *types.Block
+	var block types.BlockIntf
 	if bc != nil {
 		block = bc.GetBlockByHash(bhash)
 	} else {
 		block, _ = lc.GetBlockByHash(ctx, bhash)
 	}
-	if block == nil {
+	if block == nil || reflect.ValueOf(block).IsNil() {
 		return nil
 	}
 	rlp, _ := rlp.EncodeToBytes(block)
@@ -60,18 +63,34 @@ func TestOdrGetReceiptsLes1(t *testing.T) { testOdr(t, 1, 1, odrGetReceipts) }
 
 func TestOdrGetReceiptsLes2(t *testing.T) { testOdr(t, 2, 1, odrGetReceipts) }
 
+func TestOdrGetReceiptsLes3(t *testing.T) { testOdr(t, 3, 1, odrGetReceipts) }
+
+// odrGetReceipts retrieves the receipts of master blocks and the contract results
+// of shard blocks, which carry them instead of receipts. Master blocks of the test
+// chain have no receipts, so a failed retrieval is told apart from an empty one.
 func odrGetReceipts(ctx context.Context, db ethdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
-	var receipts types.Receipts
+	number := rawdb.ReadHeaderNumber(db, bhash)
+	if number == nil {
+		return nil
+	}
+	var (
+		receipts interface{}
+		err      error
+	)
 	if bc != nil {
-		if number := rawdb.ReadHeaderNumber(db, bhash); number != nil {
+		if bc.ShardId() == types.ShardMaster {
 			receipts = rawdb.ReadReceipts(db, bhash, *number)
+		} else {
+			receipts = bc.GetBlockByHash(bhash).Results()
 		}
 	} else {
-		if number := rawdb.ReadHeaderNumber(db, bhash); number != nil {
-			receipts, _ = light.GetBlockReceipts(ctx, lc.Odr(), bhash, *number)
+		if lc.ShardId() == types.ShardMaster {
+			receipts, err = light.GetBlockReceipts(ctx, lc.Odr(), bhash, *number)
+		} else {
+			receipts, err = light.GetShardResults(ctx, lc.Odr(), lc.ShardId(), bhash, *number)
 		}
 	}
-	if receipts == nil {
+	if err != nil {
 		return nil
 	}
 	rlp, _ := rlp.EncodeToBytes(receipts)
@@ -82,6 +101,8 @@ func TestOdrAccountsLes1(t *testing.T) { testOdr(t, 1, 1, odrAccounts) }
 
 func TestOdrAccountsLes2(t *testing.T) { testOdr(t, 2, 1, odrAccounts) }
 
+func TestOdrAccountsLes3(t *testing.T) { testOdr(t, 3, 1, odrAccounts) }
+
 func odrAccounts(ctx context.Context, db ethdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
 	dummyAddr := common.HexToAddress("1234567812345678123456781234567812345678")
 	acc := []common.Address{testBankAddress, acc1Addr, acc2Addr, dummyAddr}
@@ -94,7 +115,7 @@ func odrAccounts(ctx context.Context, db ethdb.Database, config *params.ChainCon
 	for _, addr := range acc {
 		if bc != nil {
 			header := bc.GetHeaderByHash(bhash)
-			st, err = state.New(header.Root, state.NewDatabase(db))
+			st, err = state.New(header.Root(), state.NewDatabase(db))
 		} else {
 			header := lc.GetHeaderByHash(bhash)
 			st = light.NewState(ctx, header, lc.Odr())
@@ -108,9 +129,11 @@ func odrAccounts(ctx context.Context, db ethdb.Database, config *params.ChainCon
 	return res
 }
 
-func TestOdrContractCallLes1(t *testing.T) { testOdr(t, 1, 2, odrContractCall) }
+func TestOdrContractCallLes1(t *testing.T) { testOdr(t, 1, 1, odrContractCall) }
+
+func TestOdrContractCallLes2(t *testing.T) { testOdr(t, 2, 1, odrContractCall) }
 
-func TestOdrContractCallLes2(t *testing.T) { testOdr(t, 2, 2, odrContractCall) }
+func TestOdrContractCallLes3(t *testing.T) { testOdr(t, 3, 1, odrContractCall) }
 
 type callmsg struct {
 	types.Message
@@ -118,6 +141,9 @@ type callmsg struct {
 
 func (callmsg) CheckNonce() bool { return false }
 
+// odrContractCall calls the test contract, which only exists on shards. The
+// results are encoded so that empty ones still tell a successful call from one
+// failing for lack of state.
 func odrContractCall(ctx context.Context, db ethdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
 	data := common.Hex2Bytes("60CD26850000000000000000000000000000000000000000000000000000000000000000")
 
@@ -126,33 +152,35 @@ func odrContractCall(ctx context.Context, db ethdb.Database, config *params.Chai
 		data[35] = byte(i)
 		if bc != nil {
 			header := bc.GetHeaderByHash(bhash)
-			statedb, err := state.New(header.Root, state.NewDatabase(db))
+			statedb, err := state.New(header.Root(), state.NewDatabase(db))
 
 			if err == nil {
 				from := statedb.GetOrNewStateObject(testBankAddress)
 				from.SetBalance(math.MaxBig256)
 
-				msg := callmsg{types.NewMessage(from.Address(), &testContractAddr, 0, new(big.Int), 100000, new(big.Int), data, false)}
+				msg := callmsg{types.NewMessage(from.Address(), &testContractAddr, 0, types.NativeTokenId, new(big.Int), 100000, new(big.Int), data, false)}
 
 				context := core.NewEVMContext(msg, header, bc, nil)
 				vmenv := vm.NewEVM(context, statedb, config, vm.Config{})
 
 				//vmenv := core.NewEnv(statedb, config, bc, msg, header, vm.Config{})
 				gp := new(core.GasPool).AddGas(math.MaxUint64)
-				ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp)
-				res = append(res, ret...)
+				ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp, nil)
+				enc, _ := rlp.EncodeToBytes(ret)
+				res = append(res, enc...)
 			}
 		} else {
 			header := lc.GetHeaderByHash(bhash)
 			state := light.NewState(ctx, header, lc.Odr())
 			state.SetBalance(testBankAddress, math.MaxBig256)
-			msg := callmsg{types.NewMessage(testBankAddress, &testContractAddr, 0, new(big.Int), 100000, new(big.Int), data, false)}
+			msg := callmsg{types.NewMessage(testBankAddress, &testContractAddr, 0, types.NativeTokenId, new(big.Int), 100000, new(big.Int), data, false)}
 			context := core.NewEVMContext(msg, header, lc, nil)
 			vmenv := vm.NewEVM(context, state, config, vm.Config{})
 			gp := new(core.GasPool).AddGas(math.MaxUint64)
-			ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp)
+			ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp, nil)
 			if state.Error() == nil {
-				res = append(res, ret...)
+				enc, _ := rlp.EncodeToBytes(ret)
+				res = append(res, enc...)
 			}
 		}
 	}
@@ -167,8 +195,8 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	client.pm.synchronise(client.rPeer)
 
 	test := func(expFail uint64) {
-		for i := uint64(0); i <= server.pm.blockchain.CurrentHeader().Number.Uint64(); i++ {
-			bhash := rawdb.ReadCanonicalHash(server.db, i)
+		for i := uint64(0); i <= server.pm.blockchain.CurrentHeader().NumberU64(); i++ {
+			bhash := rawdb.ReadCanonicalHash(server.db, server.pm.blockchain.ShardId(), i)
 			b1 := fn(light.NoOdr, server.db, server.pm.chainConfig, server.pm.blockchain.(*core.BlockChain), nil, bhash)
 
 			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
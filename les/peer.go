@@ -55,6 +55,7 @@ type peer struct {
 
 	version int    // Protocol version negotiated
 	network uint64 // Network ID being on
+	shardId uint16 // Shard whose chain the peer serves
 
 	announceType, requestAnnounceType uint64
 
@@ -115,6 +116,14 @@ func (p *peer) Head() (hash common.Hash) {
 	return hash
 }
 
+// ShardId retrieves the shard whose chain the peer serves.
+func (p *peer) ShardId() uint16 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.shardId
+}
+
 func (p *peer) SHead(shardId uint16) (hash common.Hash, td *big.Int) {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
@@ -159,6 +168,46 @@ func sendRequest(w p2p.MsgWriter, msgcode, reqID, cost uint64, data interface{})
 	return p2p.Send(w, msgcode, req{reqID, data})
 }
 
+// sendShardRequest sends a request for data belonging to the chain of a given
+// shard, letting servers that keep several chains pick the right one. Peers
+// older than lpv3 only serve the master chain, so their requests name no shard.
+func (p *peer) sendShardRequest(msgcode, reqID, cost uint64, shardId uint16, data interface{}) error {
+	if p.version < lpv3 {
+		return sendRequest(p.rw, msgcode, reqID, cost, data)
+	}
+	type req struct {
+		ReqID   uint64
+		ShardId uint16
+		Data    interface{}
+	}
+	return p2p.Send(p.rw, msgcode, req{reqID, shardId, data})
+}
+
+// decodeShardRequest decodes a request for data of the chain of a shard into
+// data, along with its id and shard. Requests of peers older than lpv3 are for
+// the master chain.
+func (p *peer) decodeShardRequest(msg p2p.Msg, reqID *uint64, shardId *uint16, data interface{}) error {
+	var req struct {
+		ReqID   uint64
+		ShardId uint16
+		Data    rlp.RawValue
+	}
+	if p.version < lpv3 {
+		var legacy struct {
+			ReqID uint64
+			Data  rlp.RawValue
+		}
+		if err := msg.Decode(&legacy); err != nil {
+			return err
+		}
+		req.ReqID, req.ShardId, req.Data = legacy.ReqID, types.ShardMaster, legacy.Data
+	} else if err := msg.Decode(&req); err != nil {
+		return err
+	}
+	*reqID, *shardId = req.ReqID, req.ShardId
+	return rlp.DecodeBytes(req.Data, data)
+}
+
 func sendResponse(w p2p.MsgWriter, msgcode, reqID, bv uint64, data interface{}) error {
 	type resp struct {
 		ReqID, BV uint64
@@ -192,9 +241,29 @@ func (p *peer) SendAnnounce(request announceData) error {
 	return p2p.Send(p.rw, AnnounceMsg, request)
 }
 
-// SendBlockHeaders sends a batch of block headers to the remote peer.
-func (p *peer) SendBlockHeaders(reqID, bv uint64, headers []types.HeaderIntf) error {
-	return sendResponse(p.rw, BlockHeadersMsg, reqID, bv, headers)
+// SendBlockHeaders sends a batch of block headers of the given shard to the
+// remote peer.
+func (p *peer) SendBlockHeaders(reqID, bv uint64, shardId uint16, headers []types.HeaderIntf) error {
+	data, err := encodeBlockHeaders(shardId, headers)
+	if err != nil {
+		return err
+	}
+	if p.version < lpv3 {
+		return sendResponse(p.rw, BlockHeadersMsg, reqID, bv, rlp.RawValue(data.Data))
+	}
+	return sendResponse(p.rw, BlockHeadersMsg, reqID, bv, data)
+}
+
+// decodeBlockHeaders unpacks a batch of block headers sent by the peer. Peers
+// older than lpv3 send bare master headers.
+func (p *peer) decodeBlockHeaders(data rlp.RawValue) ([]types.HeaderIntf, error) {
+	batch := &blockHeadersData{ShardId: types.ShardMaster, Data: data}
+	if p.version >= lpv3 {
+		if err := rlp.DecodeBytes(data, batch); err != nil {
+			return nil, err
+		}
+	}
+	return batch.headers()
 }
 
 // SendBlockBodiesRLP sends a batch of block contents to the remote peer from
@@ -242,9 +311,9 @@ func (p *peer) SendTxStatus(reqID, bv uint64, stats []txStatus) error {
 
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
-func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool) error {
+func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool, shardId uint16) error {
 	p.Log().Debug("Fetching batch of headers", "count", amount, "fromhash", origin, "skip", skip, "reverse", reverse)
-	return sendRequest(p.rw, GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return sendRequest(p.rw, GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{ShardId: shardId, Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
 // RequestHeadersByNumber fetches a batch of blocks' headers corresponding to the
@@ -256,39 +325,39 @@ func (p *peer) RequestHeadersByNumber(reqID, cost, origin uint64, amount int, sk
 
 // RequestBodies fetches a batch of blocks' bodies corresponding to the hashes
 // specified.
-func (p *peer) RequestBodies(reqID, cost uint64, hashes []common.Hash) error {
+func (p *peer) RequestBodies(reqID, cost uint64, shardId uint16, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of block bodies", "count", len(hashes))
-	return sendRequest(p.rw, GetBlockBodiesMsg, reqID, cost, hashes)
+	return p.sendShardRequest(GetBlockBodiesMsg, reqID, cost, shardId, hashes)
 }
 
 // RequestCode fetches a batch of arbitrary data from a node's known state
 // data, corresponding to the specified hashes.
-func (p *peer) RequestCode(reqID, cost uint64, reqs []CodeReq) error {
+func (p *peer) RequestCode(reqID, cost uint64, shardId uint16, reqs []CodeReq) error {
 	p.Log().Debug("Fetching batch of codes", "count", len(reqs))
-	return sendRequest(p.rw, GetCodeMsg, reqID, cost, reqs)
+	return p.sendShardRequest(GetCodeMsg, reqID, cost, shardId, reqs)
 }
 
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(reqID, cost uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
-	return sendRequest(p.rw, GetReceiptsMsg, reqID, cost, hashes)
+	return p.sendShardRequest(GetReceiptsMsg, reqID, cost, types.ShardMaster, hashes)
 }
 
 // RequestProofs fetches a batch of merkle proofs from a remote node.
-func (p *peer) RequestProofs(reqID, cost uint64, reqs []ProofReq) error {
+func (p *peer) RequestProofs(reqID, cost uint64, shardId uint16, reqs []ProofReq) error {
 	p.Log().Debug("Fetching batch of proofs", "count", len(reqs))
 	switch p.version {
 	case lpv1:
-		return sendRequest(p.rw, GetProofsV1Msg, reqID, cost, reqs)
-	case lpv2:
-		return sendRequest(p.rw, GetProofsV2Msg, reqID, cost, reqs)
+		return p.sendShardRequest(GetProofsV1Msg, reqID, cost, shardId, reqs)
+	case lpv2, lpv3:
+		return p.sendShardRequest(GetProofsV2Msg, reqID, cost, shardId, reqs)
 	default:
 		panic(nil)
 	}
 }
 
 // RequestHelperTrieProofs fetches a batch of HelperTrie merkle proofs from a remote node.
-func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, data interface{}) error {
+func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, shardId uint16, data interface{}) error {
 	switch p.version {
 	case lpv1:
 		reqs, ok := data.([]ChtReq)
@@ -296,14 +365,14 @@ func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, data interface{}) err
 			return errInvalidHelpTrieReq
 		}
 		p.Log().Debug("Fetching batch of header proofs", "count", len(reqs))
-		return sendRequest(p.rw, GetHeaderProofsMsg, reqID, cost, reqs)
-	case lpv2:
+		return p.sendShardRequest(GetHeaderProofsMsg, reqID, cost, shardId, reqs)
+	case lpv2, lpv3:
 		reqs, ok := data.([]HelperTrieReq)
 		if !ok {
 			return errInvalidHelpTrieReq
 		}
 		p.Log().Debug("Fetching batch of HelperTrie proofs", "count", len(reqs))
-		return sendRequest(p.rw, GetHelperTrieProofsMsg, reqID, cost, reqs)
+		return p.sendShardRequest(GetHelperTrieProofsMsg, reqID, cost, shardId, reqs)
 	default:
 		panic(nil)
 	}
@@ -321,7 +390,7 @@ func (p *peer) SendTxs(reqID, cost uint64, txs types.Transactions) error {
 	switch p.version {
 	case lpv1:
 		return p2p.Send(p.rw, SendTxMsg, txs) // old message format does not include reqID
-	case lpv2:
+	case lpv2, lpv3:
 		return sendRequest(p.rw, SendTxV2Msg, reqID, cost, txs)
 	default:
 		panic(nil)
@@ -396,8 +465,10 @@ func (p *peer) sendReceiveHandshake(sendList keyValueList) (keyValueList, error)
 }
 
 // Handshake executes the les protocol handshake, negotiating version number,
-// network IDs, difficulties, head and genesis blocks.
-func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, server *LesServer) error {
+// network IDs, served shards, difficulties, head and genesis blocks. The head
+// and difficulty belong to the chain of the given shard, while the genesis is
+// always the one of the master chain shared by all shards.
+func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, shardId uint16, server *LesServer) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
@@ -408,6 +479,9 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	send = send.add("headHash", head)
 	send = send.add("headNum", headNum)
 	send = send.add("genesisHash", genesis)
+	if p.version >= lpv3 {
+		send = send.add("shardId", uint64(shardId))
+	}
 	if server != nil {
 		send = send.add("serveHeaders", nil)
 		send = send.add("serveChainSince", uint64(0))
@@ -431,6 +505,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	var rGenesis, rHash common.Hash
 	var rVersion, rNetwork, rNum uint64
 	var rTd *big.Int
+	var rShard = uint64(types.ShardMaster) // Peers older than lpv3 only know the master chain
 
 	if err := recv.get("protocolVersion", &rVersion); err != nil {
 		return err
@@ -450,6 +525,11 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	if err := recv.get("genesisHash", &rGenesis); err != nil {
 		return err
 	}
+	if p.version >= lpv3 {
+		if err := recv.get("shardId", &rShard); err != nil {
+			return err
+		}
+	}
 
 	if rGenesis != genesis {
 		return errResp(ErrGenesisBlockMismatch, "%x (!= %x)", rGenesis[:8], genesis[:8])
@@ -460,6 +540,10 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	if int(rVersion) != p.version {
 		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", rVersion, p.version)
 	}
+	if p.version < lpv3 && shardId != types.ShardMaster {
+		return errResp(ErrUselessPeer, "shard %d needs les/%d", shardId, lpv3)
+	}
+	p.shardId = uint16(rShard)
 	if server != nil {
 		// until we have a proper peer connectivity API, allow LES connection to other servers
 		/*if recv.get("serveStateSince", nil) == nil {
@@ -470,6 +554,10 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		}
 		p.fcClient = flowcontrol.NewClientNode(server.fcManager, server.defParams)
 	} else {
+		// Shard clients need master servers too, for verifying shard headers
+		if p.shardId != shardId && p.shardId != types.ShardMaster {
+			return errResp(ErrUselessPeer, "peer serves shard %d", p.shardId)
+		}
 		if recv.get("serveChainSince", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot serve chain")
 		}
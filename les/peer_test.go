@@ -0,0 +1,190 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/p2p"
+	"github.com/EDXFund/MasterChain/p2p/enode"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+// newTestPeerPipe creates a local peer of the given version, along with the
+// message pipe end of the remote peer it is connected to.
+func newTestPeerPipe(version int) (*peer, *p2p.MsgPipeRW) {
+	local, remote := p2p.MsgPipe()
+	return newPeer(version, NetworkId, p2p.NewPeer(enode.ID{}, "test", nil), local), remote
+}
+
+// Tests that requests for shard data only name the shard from lpv3 on, and that
+// the requests of older peers are decoded as being for the master chain.
+func TestShardRequestEncoding(t *testing.T) {
+	hashes := []common.Hash{{0x01}, {0x02}}
+
+	for _, version := range []int{lpv2, lpv3} {
+		sender, rw := newTestPeerPipe(version)
+		receiver := newPeer(version, NetworkId, p2p.NewPeer(enode.ID{}, "test", nil), nil)
+
+		go sender.sendShardRequest(GetBlockBodiesMsg, 42, 0, 3, hashes)
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			t.Fatalf("les/%d: failed to read request: %v", version, err)
+		}
+		payload := make([]byte, msg.Size)
+		msg.Payload.Read(payload)
+
+		// Older peers must receive the request layout they know
+		if version < lpv3 {
+			var legacy struct {
+				ReqID  uint64
+				Hashes []common.Hash
+			}
+			if err := rlp.DecodeBytes(payload, &legacy); err != nil || legacy.ReqID != 42 || len(legacy.Hashes) != len(hashes) {
+				t.Errorf("les/%d: legacy request mismatch: have %+v (%v)", version, legacy, err)
+			}
+		}
+		msg.Payload = bytes.NewReader(payload)
+
+		var (
+			reqID   uint64
+			shardId uint16
+			decoded []common.Hash
+		)
+		if err := receiver.decodeShardRequest(msg, &reqID, &shardId, &decoded); err != nil {
+			t.Fatalf("les/%d: failed to decode request: %v", version, err)
+		}
+		want := uint16(3)
+		if version < lpv3 {
+			want = types.ShardMaster
+		}
+		if reqID != 42 || shardId != want || len(decoded) != len(hashes) || decoded[1] != hashes[1] {
+			t.Errorf("les/%d: request mismatch: have id %d, shard %d, hashes %x; want id 42, shard %d, hashes %x", version, reqID, shardId, decoded, want, hashes)
+		}
+	}
+}
+
+// Tests that header batches are only wrapped with their shard from lpv3 on, and
+// that the batches of older peers are decoded as master headers.
+func TestBlockHeadersEncoding(t *testing.T) {
+	header := new(types.Header)
+	header.FillBy(&types.HeaderStruct{Number: big.NewInt(7), Difficulty: big.NewInt(1), Time: big.NewInt(70)})
+
+	for _, version := range []int{lpv2, lpv3} {
+		sender, rw := newTestPeerPipe(version)
+		receiver := newPeer(version, NetworkId, p2p.NewPeer(enode.ID{}, "test", nil), nil)
+
+		go sender.SendBlockHeaders(42, 100, types.ShardMaster, []types.HeaderIntf{header})
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			t.Fatalf("les/%d: failed to read headers: %v", version, err)
+		}
+		var resp struct {
+			ReqID, BV uint64
+			Data      rlp.RawValue
+		}
+		if err := msg.Decode(&resp); err != nil {
+			t.Fatalf("les/%d: failed to decode response: %v", version, err)
+		}
+		// Older peers must receive a bare list of headers
+		if version < lpv3 {
+			var legacy []*types.HeaderStruct
+			if err := rlp.DecodeBytes(resp.Data, &legacy); err != nil || len(legacy) != 1 || legacy[0].Number.Uint64() != 7 {
+				t.Errorf("les/%d: legacy headers mismatch: have %v (%v)", version, legacy, err)
+			}
+		}
+		headers, err := receiver.decodeBlockHeaders(resp.Data)
+		if err != nil {
+			t.Fatalf("les/%d: failed to decode headers: %v", version, err)
+		}
+		if len(headers) != 1 || headers[0].Hash() != header.Hash() || headers[0].ShardId() != types.ShardMaster {
+			t.Errorf("les/%d: headers mismatch: have %v, want %x", version, headers, header.Hash())
+		}
+	}
+}
+
+// Tests that the served shard is only exchanged in the handshake from lpv3 on,
+// that older servers count as master servers, and that shard clients refuse to
+// talk to them.
+func TestHandshakeShardVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		local   uint16 // Shard of the local client
+		remote  uint16 // Shard served by the remote server, only sent from lpv3
+		useless bool   // Whether the remote server must be refused
+	}{
+		{lpv2, types.ShardMaster, types.ShardMaster, false},
+		{lpv2, 3, types.ShardMaster, true},
+		{lpv3, 3, 3, false},
+		{lpv3, 3, types.ShardMaster, false},
+		{lpv3, 3, 4, true},
+	}
+	for i, tt := range tests {
+		p, rw := newTestPeerPipe(tt.version)
+
+		var status keyValueList
+		status = status.add("protocolVersion", uint64(tt.version))
+		status = status.add("networkId", uint64(NetworkId))
+		status = status.add("headTd", big.NewInt(1))
+		status = status.add("headHash", common.Hash{})
+		status = status.add("headNum", uint64(0))
+		status = status.add("genesisHash", common.Hash{0x01})
+		if tt.version >= lpv3 {
+			status = status.add("shardId", uint64(tt.remote))
+		}
+		status = status.add("serveHeaders", nil)
+		status = status.add("serveChainSince", uint64(0))
+		status = status.add("serveStateSince", uint64(0))
+		status = status.add("txRelay", nil)
+		status = status.add("flowControl/BL", uint64(1000))
+		status = status.add("flowControl/MRR", uint64(10))
+		status = status.add("flowControl/MRC", RequestCostList{})
+
+		sent := make(chan map[string]bool, 1)
+		go func() {
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				sent <- nil
+				return
+			}
+			var list keyValueList
+			msg.Decode(&list)
+			keys := make(map[string]bool)
+			for _, entry := range list {
+				keys[entry.Key] = true
+			}
+			sent <- keys
+			p2p.Send(rw, StatusMsg, status)
+		}()
+		err := p.Handshake(big.NewInt(1), common.Hash{}, 0, common.Hash{0x01}, tt.local, nil)
+		switch {
+		case !tt.useless && err != nil:
+			t.Errorf("test %d: handshake failed: %v", i, err)
+		case tt.useless && err == nil:
+			t.Errorf("test %d: useless peer accepted", i)
+		case !tt.useless && p.shardId != tt.remote:
+			t.Errorf("test %d: remote shard mismatch: have %d, want %d", i, p.shardId, tt.remote)
+		}
+		if keys := <-sent; keys == nil || keys["shardId"] != (tt.version >= lpv3) {
+			t.Errorf("test %d: shard sent mismatch: have %v, want %v", i, keys["shardId"], tt.version >= lpv3)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/EDXFund/MasterChain/common"
 	"github.com/EDXFund/MasterChain/core"
 	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
 	"github.com/EDXFund/MasterChain/crypto"
 	"github.com/EDXFund/MasterChain/p2p/enode"
 	"github.com/EDXFund/MasterChain/rlp"
@@ -36,17 +37,18 @@ import (
 const (
 	lpv1 = 1
 	lpv2 = 2
+	lpv3 = 3 // Shard aware: requests name a shard, header batches are shard encoded
 )
 
 // Supported versions of the les protocol (first is primary)
 var (
-	ClientProtocolVersions    = []uint{lpv2, lpv1}
-	ServerProtocolVersions    = []uint{lpv2, lpv1}
-	AdvertiseProtocolVersions = []uint{lpv2} // clients are searching for the first advertised protocol in the list
+	ClientProtocolVersions    = []uint{lpv3, lpv2, lpv1}
+	ServerProtocolVersions    = []uint{lpv3, lpv2, lpv1}
+	AdvertiseProtocolVersions = []uint{lpv3, lpv2} // clients are searching for the first advertised protocol in the list
 )
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22}
+var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22, lpv3: 22}
 
 const (
 	NetworkId          = 1
@@ -177,6 +179,69 @@ type getBlockHeadersData struct {
 	Reverse bool         // Query direction (false = rising towards latest, true = falling towards genesis)
 }
 
+// blockHeadersData is the network packet for a batch of block headers, all of
+// them belonging to the chain of one shard and encoded in its header layout.
+type blockHeadersData struct {
+	ShardId uint16
+	Data    []byte
+}
+
+// encodeBlockHeaders packs a batch of headers of the given shard.
+func encodeBlockHeaders(shardId uint16, headers []types.HeaderIntf) (*blockHeadersData, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if shardId == types.ShardMaster {
+		hs := make([]*types.HeaderStruct, len(headers))
+		for i, header := range headers {
+			hs[i] = header.ToHeader().ToHeaderStruct()
+		}
+		data, err = rlp.EncodeToBytes(hs)
+	} else {
+		hs := make([]*types.SHeaderStruct, len(headers))
+		for i, header := range headers {
+			hs[i] = header.ToSHeader().ToStruct()
+		}
+		data, err = rlp.EncodeToBytes(hs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blockHeadersData{ShardId: shardId, Data: data}, nil
+}
+
+// headers unpacks the batch of headers, rejecting any header that does not
+// belong to the announced shard.
+func (d *blockHeadersData) headers() ([]types.HeaderIntf, error) {
+	var headers []types.HeaderIntf
+	if d.ShardId == types.ShardMaster {
+		var hs []*types.HeaderStruct
+		if err := rlp.DecodeBytes(d.Data, &hs); err != nil {
+			return nil, err
+		}
+		for _, h := range hs {
+			header := new(types.Header)
+			header.FillBy(h)
+			headers = append(headers, header)
+		}
+	} else {
+		var hs []*types.SHeaderStruct
+		if err := rlp.DecodeBytes(d.Data, &hs); err != nil {
+			return nil, err
+		}
+		for _, h := range hs {
+			header := new(types.SHeader)
+			header.FillBy(h)
+			if header.ShardId() != d.ShardId {
+				return nil, fmt.Errorf("header of shard %d in batch of shard %d", header.ShardId(), d.ShardId)
+			}
+			headers = append(headers, header)
+		}
+	}
+	return headers, nil
+}
+
 // hashOrNumber is a combined field for specifying an origin block.
 type hashOrNumber struct {
 	Hash   common.Hash // Block hash from which to retrieve headers (excludes Number)
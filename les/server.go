@@ -47,6 +47,8 @@ type LesServer struct {
 	lesTopics   []discv5.Topic
 	privateKey  *ecdsa.PrivateKey
 	quitSync    chan struct{}
+
+	shardIndexers *shardIndexerSet // Helper trie indexers of the shard chains, nil on shard nodes
 }
 
 func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
@@ -96,6 +98,9 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 	}
 
 	srv.chtIndexer.Start(eth.BlockChain())
+	if pool := eth.ShardPool(); pool != nil {
+		srv.shardIndexers = newShardIndexerSet(eth.ChainDb(), pool)
+	}
 	pm.server = srv
 
 	srv.defParams = &flowcontrol.ServerParams{
@@ -138,6 +143,9 @@ func (s *LesServer) SetBloomBitsIndexer(bloomIndexer *core.ChainIndexer) {
 func (s *LesServer) Stop() {
 	s.chtIndexer.Close()
 	// bloom trie indexer is closed by parent bloombits indexer
+	if s.shardIndexers != nil {
+		s.shardIndexers.close()
+	}
 	s.fcCostStats.store()
 	s.fcManager.Stop()
 	go func() {
@@ -0,0 +1,135 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"sync"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/eth"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/event"
+	"github.com/EDXFund/MasterChain/light"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// shardHeadSource is the source of the shard chains confirmed by the master
+// chain, implemented by the shard chain pool of a master node.
+type shardHeadSource interface {
+	// SubscribeShardHeadEvent subscribes to the shard heads confirmed by the
+	// master chain.
+	SubscribeShardHeadEvent(ch chan<- core.ShardChainHeadEvent) event.Subscription
+
+	// IndexerChain returns the confirmed chain of a shard to be indexed.
+	IndexerChain(shardId uint16) core.ChainIndexerChain
+}
+
+// shardIndexers are the chain indexers post-processing a single shard chain.
+type shardIndexers struct {
+	bloomIndexer     *core.ChainIndexer // Bloom bits of the shard headers
+	chtIndexer       *core.ChainIndexer // Canonical hash tries of the shard chain
+	bloomTrieIndexer *core.ChainIndexer // Bloom tries, fed by the bloom bits indexer
+}
+
+// shardIndexerSet runs the CHT and bloom trie indexers of every shard chain known
+// to a master node, fed with the shard heads confirmed by the master chain, so
+// that light clients of any shard can be served.
+type shardIndexerSet struct {
+	db   ethdb.Database
+	pool shardHeadSource
+
+	lock     sync.Mutex
+	indexers map[uint16]*shardIndexers
+
+	sub event.Subscription
+	wg  sync.WaitGroup
+}
+
+// newShardIndexerSet starts the indexers of the shards already confirmed by the
+// master chain and of any shard confirmed later on.
+func newShardIndexerSet(db ethdb.Database, pool shardHeadSource) *shardIndexerSet {
+	s := &shardIndexerSet{
+		db:       db,
+		pool:     pool,
+		indexers: make(map[uint16]*shardIndexers),
+	}
+	for _, shardId := range rawdb.ReadHeaderForestShards(db) {
+		if rawdb.ReadHeadHeaderHash(db, shardId) != (common.Hash{}) {
+			s.start(shardId)
+		}
+	}
+	heads := make(chan core.ShardChainHeadEvent, 10)
+	s.sub = pool.SubscribeShardHeadEvent(heads)
+
+	s.wg.Add(1)
+	go s.loop(heads)
+	return s
+}
+
+// loop starts the indexers of newly confirmed shards until unsubscribed.
+func (s *shardIndexerSet) loop(heads chan core.ShardChainHeadEvent) {
+	defer s.wg.Done()
+	for {
+		select {
+		case ev := <-heads:
+			s.start(ev.Block.ShardId())
+		case <-s.sub.Err():
+			return
+		}
+	}
+}
+
+// start creates and starts the indexers of a shard, unless already running.
+func (s *shardIndexerSet) start(shardId uint16) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.indexers[shardId]; ok || shardId == types.ShardMaster {
+		return
+	}
+	idx := &shardIndexers{
+		bloomIndexer:     eth.NewBloomIndexer(s.db, params.BloomBitsBlocks, params.BloomConfirms, shardId),
+		chtIndexer:       light.NewChtIndexer(s.db, nil, params.CHTFrequencyServer, params.HelperTrieProcessConfirmations, shardId),
+		bloomTrieIndexer: light.NewBloomTrieIndexer(s.db, nil, params.BloomBitsBlocks, params.BloomTrieFrequency, shardId),
+	}
+	idx.bloomIndexer.AddChildIndexer(idx.bloomTrieIndexer)
+
+	chain := s.pool.IndexerChain(shardId)
+	idx.bloomIndexer.Start(chain)
+	idx.chtIndexer.Start(chain)
+	s.indexers[shardId] = idx
+
+	log.Info("Started shard chain indexers", "shard", shardId)
+}
+
+// close stops following new shards and tears down all running indexers.
+func (s *shardIndexerSet) close() {
+	s.sub.Unsubscribe()
+	s.wg.Wait()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, idx := range s.indexers {
+		idx.chtIndexer.Close()
+		idx.bloomIndexer.Close() // bloom trie indexer is closed by parent bloombits indexer
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/event"
+)
+
+// testShardHeadSource is a shard head source whose confirmations and shard chain
+// heads are fired by hand.
+type testShardHeadSource struct {
+	db        ethdb.Database
+	shardFeed event.Feed // Confirmed shard heads
+	chainFeed event.Feed // Heads of the indexed shard chains
+}
+
+func (s *testShardHeadSource) SubscribeShardHeadEvent(ch chan<- core.ShardChainHeadEvent) event.Subscription {
+	return s.shardFeed.Subscribe(ch)
+}
+
+func (s *testShardHeadSource) IndexerChain(shardId uint16) core.ChainIndexerChain {
+	return &testIndexerChain{source: s, shardId: shardId}
+}
+
+// testIndexerChain is a shard chain made of its genesis header only.
+type testIndexerChain struct {
+	source  *testShardHeadSource
+	shardId uint16
+}
+
+func (c *testIndexerChain) CurrentHeader() types.HeaderIntf {
+	db := c.source.db
+	return rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, c.shardId, 0), 0)
+}
+
+func (c *testIndexerChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.source.chainFeed.Subscribe(ch)
+}
+
+// writeTestShardGenesis stores the genesis header of a shard, returning it as a
+// block.
+func writeTestShardGenesis(db ethdb.Database, shardId uint16) *types.SBlock {
+	header := new(types.SHeader)
+	header.FillBy(&types.SHeaderStruct{ShardId: shardId, Number: new(big.Int), Difficulty: big.NewInt(1), Time: new(big.Int)})
+	rawdb.WriteHeader(db, header)
+	rawdb.WriteCanonicalHash(db, shardId, header.Hash(), 0)
+	return types.NewSBlockWithHeader(header)
+}
+
+// Tests that the indexers of the shards with a confirmed head are started right
+// away, those of other shards once the master chain confirms them, and that all
+// of them are torn down on close.
+func TestShardIndexerSet(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	source := &testShardHeadSource{db: db}
+
+	// Shard 1 was confirmed by a previous run, shard 2 only has a header forest
+	first, second := writeTestShardGenesis(db, 1), writeTestShardGenesis(db, 2)
+	rawdb.WriteHeaderForestShards(db, []uint16{1, 2})
+	rawdb.WriteHeadHeaderHash(db, 1, first.Hash())
+
+	set := newShardIndexerSet(db, source)
+	started := func() map[uint16]bool {
+		set.lock.Lock()
+		defer set.lock.Unlock()
+
+		shards := make(map[uint16]bool)
+		for shardId := range set.indexers {
+			shards[shardId] = true
+		}
+		return shards
+	}
+	if shards := started(); len(shards) != 1 || !shards[1] {
+		t.Fatalf("initial indexers mismatch: have %v, want shard 1", shards)
+	}
+	// Confirm shard 2, along with already indexed shard 1
+	source.shardFeed.Send(core.ShardChainHeadEvent{Block: first})
+	source.shardFeed.Send(core.ShardChainHeadEvent{Block: second})
+
+	for deadline := time.Now().Add(time.Second); !started()[2]; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("indexers of confirmed shard not started: have %v", started())
+		}
+	}
+	if shards := started(); len(shards) != 2 {
+		t.Errorf("indexers mismatch: have %v, want shards 1 and 2", shards)
+	}
+	// The bloom bits and CHT indexers of both shards follow their chains
+	if subs := source.chainFeed.Send(core.ChainHeadEvent{Block: first}); subs != 4 {
+		t.Errorf("shard chain subscription count mismatch: have %d, want 4", subs)
+	}
+	set.close()
+
+	if subs := source.shardFeed.Send(core.ShardChainHeadEvent{Block: first}); subs != 0 {
+		t.Errorf("confirmations followed after close: %d subscriptions", subs)
+	}
+	if subs := source.chainFeed.Send(core.ChainHeadEvent{Block: first}); subs != 0 {
+		t.Errorf("shard chains followed after close: %d subscriptions", subs)
+	}
+}
@@ -69,12 +69,13 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	}
 
 	// Make sure the peer's TD is higher than our own.
-	if !pm.needToSync(peer.headBlockInfo()) {
+	head := peer.headBlockInfo()
+	if !pm.needToSync(head) {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	pm.blockchain.(*light.LightChain).SyncCht(ctx)
-	pm.downloader.Synchronise(peer.id, []*types.SInfo{}, downloader.LightSync)
+	pm.downloader.Synchronise(peer.id, []*types.SInfo{{ShardId: pm.blockchain.ShardId(), Td: head.Td, HeadHash: head.Hash}}, downloader.LightSync)
 }
@@ -58,9 +58,11 @@ type LightChain struct {
 	chainHeadFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  types.BlockIntf
+	master        *LightChain // Master header chain referencing the shard headers, nil on the master chain
 
 	mu      sync.RWMutex
 	chainmu sync.RWMutex
+	refsMu  sync.Mutex // Lock serialising the indexing of shard block references
 
 	bodyCache    *lru.Cache // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache // Cache for the most recent block bodies in RLP encoded format
@@ -79,6 +81,13 @@ type LightChain struct {
 // available in the database. It initialises the default Ethereum header
 // validator.
 func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.Engine,shardId uint16) (*LightChain, error) {
+	return newLightChain(odr, config, engine, shardId, true)
+}
+
+// newLightChain creates a light chain of the given shard. The trusted checkpoint
+// of the chain is only registered with the indexers of the ODR backend if asked
+// to, as the master chain followed by a shard chain shares them with the shard.
+func newLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.Engine, shardId uint16, checkpoint bool) (*LightChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -95,6 +104,11 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 		engine:        engine,
 	}
 	var err error
+	if shardId != types.ShardMaster {
+		if bc.master, err = newLightChain(odr, config, engine, types.ShardMaster, false); err != nil {
+			return nil, err
+		}
+	}
 	bc.hc, err = core.NewHeaderChain(odr.Database(), config, bc.engine, bc.getProcInterrupt,shardId)
 	if err != nil {
 		return nil, err
@@ -109,8 +123,14 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 	if bc.genesisBlock == nil {
 		return nil, core.ErrNoGenesis
 	}
-	if cp, ok := trustedCheckpoints[bc.genesisBlock.Hash()]; ok {
-		bc.addTrustedCheckpoint(cp)
+	if checkpoint {
+		genesis := bc.genesisBlock.Hash()
+		if shardId != types.ShardMaster {
+			genesis = rawdb.ReadCanonicalHash(bc.chainDb, types.ShardMaster, 0)
+		}
+		if cp := trustedCheckpoint(genesis, shardId); cp != nil {
+			bc.addTrustedCheckpoint(cp)
+		}
 	}
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
@@ -320,6 +340,9 @@ func (bc *LightChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+	if bc.master != nil {
+		bc.master.Stop()
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -370,6 +393,14 @@ func (self *LightChain) InsertHeaderChain(chain []types.HeaderIntf, checkFreq in
 	if i, err := self.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
 	}
+	// Shard headers are only accepted once a canonical master block references them
+	if self.master != nil {
+		for i, header := range chain {
+			if err := self.master.VerifyShardHeader(header); err != nil {
+				return i, err
+			}
+		}
+	}
 
 	// Make sure only one thread manipulates the chain at once
 	self.chainmu.Lock()
@@ -420,9 +451,13 @@ func (self *LightChain) CurrentHeader() types.HeaderIntf {
 }
 
 // GetTd retrieves a block's total difficulty in the canonical chain from the
-// database by hash and number, caching it if found.
+// database by hash and number, caching it if found. Nil is returned for unknown
+// blocks, which the header chain reports with a zero difficulty.
 func (self *LightChain) GetTd(hash common.Hash, number uint64) *big.Int {
-	return self.hc.GetTd(hash, number)
+	if td := self.hc.GetTd(hash, number); td.Sign() > 0 {
+		return td
+	}
+	return nil
 }
 
 // GetTdByHash retrieves a block's total difficulty in the canonical chain from the
@@ -502,7 +537,7 @@ func (self *LightChain) SyncCht(ctx context.Context) bool {
 		return false
 	}
 	// Retrieve the latest useful header and update to it
-	if header, err := GetHeaderByNumber(ctx, self.odr, self.shardId, latest); header == nil || reflect.ValueOf(header).IsNil() && err == nil {
+	if header, err := GetHeaderByNumber(ctx, self.odr, self.shardId, latest); header != nil && !reflect.ValueOf(header).IsNil() && err == nil {
 		self.mu.Lock()
 		defer self.mu.Unlock()
 
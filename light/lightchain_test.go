@@ -53,6 +53,7 @@ func makeHeaderChain(parent types.HeaderIntf, n int, db ethdb.Database, seed int
 	for i, block := range blocks {
 		headers[i] = block.Header()
 	}
+	referenceShardHeaders(db, headers)
 	return headers
 }
 
@@ -365,8 +366,10 @@ func testReorg(t *testing.T, first, second []int, td int64,shardId uint16) {
 	bc := newTestLightChain(shardId)
 
 	// Insert an easy and a difficult chain afterwards
-	bc.InsertHeaderChain(makeHeaderChainWithDiff(bc.genesisBlock, first, 11), 1)
-	bc.InsertHeaderChain(makeHeaderChainWithDiff(bc.genesisBlock, second, 22), 1)
+	for _, headers := range [][]types.HeaderIntf{makeHeaderChainWithDiff(bc.genesisBlock, first, 11), makeHeaderChainWithDiff(bc.genesisBlock, second, 22)} {
+		referenceShardHeaders(bc.chainDb, headers)
+		bc.InsertHeaderChain(headers, 1)
+	}
 	// Check that the chain is valid number and link wise
 	prev := bc.CurrentHeader()
 	for header := bc.GetHeaderByNumber(bc.CurrentHeader().NumberU64() - 1); header.NumberU64() != 0; prev, header = header, bc.GetHeaderByNumber(header.NumberU64()-1) {
@@ -407,6 +410,7 @@ func testReorgBadHeaderHashes(t *testing.T,shardId uint16) {
 
 	// Create a chain, import and ban afterwards
 	headers := makeHeaderChainWithDiff(bc.genesisBlock, []int{1, 2, 3, 4}, 10)
+	referenceShardHeaders(bc.chainDb, headers)
 
 	if _, err := bc.InsertHeaderChain(headers, 1); err != nil {
 		t.Fatalf("failed to import headers: %v", err)
@@ -54,6 +54,7 @@ type OdrRequest interface {
 
 // TrieID identifies a state or account storage trie
 type TrieID struct {
+	ShardId         uint16
 	BlockHash, Root common.Hash
 	BlockNumber     uint64
 	AccKey          []byte
@@ -63,6 +64,7 @@ type TrieID struct {
 // header.
 func StateTrieID(header types.HeaderIntf) *TrieID {
 	return &TrieID{
+		ShardId:     header.ShardId(),
 		BlockHash:   header.Hash(),
 		BlockNumber: header.NumberU64(),
 		AccKey:      nil,
@@ -75,6 +77,7 @@ func StateTrieID(header types.HeaderIntf) *TrieID {
 // checking Merkle proofs.
 func StorageTrieID(state *TrieID, addrHash, root common.Hash) *TrieID {
 	return &TrieID{
+		ShardId:     state.ShardId,
 		BlockHash:   state.BlockHash,
 		BlockNumber: state.BlockNumber,
 		AccKey:      addrHash[:],
@@ -138,6 +141,7 @@ func (req *ReceiptsRequest) StoreResult(db ethdb.Database) {
 // ChtRequest is the ODR request type for state/storage trie entries
 type ChtRequest struct {
 	OdrRequest
+	ShardId          uint16
 	Config           *IndexerConfig
 	ChtNum, BlockNum uint64
 	ChtRoot          common.Hash
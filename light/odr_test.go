@@ -124,14 +124,18 @@ func odrGetBlock(ctx context.Context, db ethdb.Database, bc *core.BlockChain, lc
 func TestOdrGetReceiptsLes1Master(t *testing.T) { testChainOdr(t, 1, odrGetReceipts,types.ShardMaster) }
 func TestOdrGetReceiptsLes1Shard(t *testing.T) { testChainOdr(t, 1, odrGetReceipts,0) }
 func odrGetReceipts(ctx context.Context, db ethdb.Database, bc *core.BlockChain, lc *LightChain, bhash common.Hash) ([]byte, error) {
+	// Shard blocks carry the results of their transactions instead of receipts
+	if (bc != nil && bc.ShardId() != types.ShardMaster) || (lc != nil && lc.ShardId() != types.ShardMaster) {
+		return odrGetShardResults(ctx, db, bc, lc, bhash)
+	}
 	var receipts types.Receipts
 	if bc != nil {
-		number := rawdb.ReadHeaderNumber(db, bc.ShardId(), bhash)
+		number := rawdb.ReadHeaderNumber(db, bhash)
 		if number != nil {
-			receipts = rawdb.ReadReceipts(db, bc.ShardId(), bhash, *number)
+			receipts = rawdb.ReadReceipts(db, bhash, *number)
 		}
 	} else {
-		number := rawdb.ReadHeaderNumber(db,  bc.ShardId(),bhash)
+		number := rawdb.ReadHeaderNumber(db, bhash)
 		if number != nil {
 			receipts, _ = GetBlockReceipts(ctx, lc.Odr(), bhash, *number)
 		}
@@ -143,6 +147,25 @@ func odrGetReceipts(ctx context.Context, db ethdb.Database, bc *core.BlockChain,
 	return rlp, nil
 }
 
+func odrGetShardResults(ctx context.Context, db ethdb.Database, bc *core.BlockChain, lc *LightChain, bhash common.Hash) ([]byte, error) {
+	var results types.ContractResults
+	if bc != nil {
+		if block := bc.GetBlockByHash(bhash); block != nil && !reflect.ValueOf(block).IsNil() {
+			results = block.Results()
+		}
+	} else {
+		number := rawdb.ReadHeaderNumber(db, bhash)
+		if number != nil {
+			results, _ = GetShardResults(ctx, lc.Odr(), lc.ShardId(), bhash, *number)
+		}
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	rlp, _ := rlp.EncodeToBytes(results)
+	return rlp, nil
+}
+
 func TestOdrAccountsLes1(t *testing.T) { testChainOdr(t, 1, odrAccounts, types.ShardMaster) }
 func TestOdrAccountsLes1Shard(t *testing.T) { testChainOdr(t, 1, odrAccounts,0) }
 func odrAccounts(ctx context.Context, db ethdb.Database, bc *core.BlockChain, lc *LightChain, bhash common.Hash) ([]byte, error) {
@@ -204,7 +227,7 @@ func odrContractCall(ctx context.Context, db ethdb.Database, bc *core.BlockChain
 		context := core.NewEVMContext(msg, header, chain, nil)
 		vmenv := vm.NewEVM(context, st, config, vm.Config{})
 		gp := new(core.GasPool).AddGas(math.MaxUint64)
-		ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp)
+		ret, _, _, _ := core.ApplyMessage(vmenv, msg, gp, nil)
 		res = append(res, ret...)
 		if st.Error() != nil {
 			return res, st.Error()
@@ -218,17 +241,17 @@ func testChainGen(i int, block *core.BlockGen) {
 	switch i {
 	case 0:
 		// In block 1, the test bank sends account #1 some ether.
-		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), acc1Addr, big.NewInt(10000), params.TxGas, nil, nil), signer, testBankKey)
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), acc1Addr, big.NewInt(10000), params.TxGas, nil, nil, 0), signer, testBankKey)
 		block.AddTx(tx)
 	case 1:
 		// In block 2, the test bank sends some more ether to account #1.
 		// acc1Addr passes it on to account #2.
 		// acc1Addr creates a test contract.
-		tx1, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), acc1Addr, big.NewInt(1000), params.TxGas, nil, nil), signer, testBankKey)
+		tx1, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), acc1Addr, big.NewInt(1000), params.TxGas, nil, nil, 0), signer, testBankKey)
 		nonce := block.TxNonce(acc1Addr)
-		tx2, _ := types.SignTx(types.NewTransaction(nonce, acc2Addr, big.NewInt(1000), params.TxGas, nil, nil), signer, acc1Key)
+		tx2, _ := types.SignTx(types.NewTransaction(nonce, acc2Addr, big.NewInt(1000), params.TxGas, nil, nil, 0), signer, acc1Key)
 		nonce++
-		tx3, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(0), 1000000, big.NewInt(0), testContractCode), signer, acc1Key)
+		tx3, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(0), 1000000, big.NewInt(0), testContractCode, 0), signer, acc1Key)
 		testContractAddr = crypto.CreateAddress(acc1Addr, nonce)
 		block.AddTx(tx1)
 		block.AddTx(tx2)
@@ -238,7 +261,7 @@ func testChainGen(i int, block *core.BlockGen) {
 		block.SetCoinbase(acc2Addr)
 		block.SetExtra([]byte("yeehaw"))
 		data := common.Hex2Bytes("C16431B900000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001")
-		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), testContractAddr, big.NewInt(0), 100000, nil, data), signer, testBankKey)
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), testContractAddr, big.NewInt(0), 100000, nil, data, 0), signer, testBankKey)
 		block.AddTx(tx)
 	case 3:
 		// Block 4 includes blocks 2 and 3 as uncle headers (with modified extra data).
@@ -250,11 +273,26 @@ func testChainGen(i int, block *core.BlockGen) {
 		block.AddUncle(b3)
 	*/
 		data := common.Hex2Bytes("C16431B900000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000002")
-		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), testContractAddr, big.NewInt(0), 100000, nil, data), signer, testBankKey)
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), testContractAddr, big.NewInt(0), 100000, nil, data, 0), signer, testBankKey)
 		block.AddTx(tx)
 	}
 }
 
+// testChainGenerator returns the block generator of the test chain of a shard.
+// Master blocks reference shard blocks instead of executing transactions, so the
+// master test chain only varies its coinbase and extra data.
+func testChainGenerator(shardId uint16) func(int, *core.BlockGen) {
+	if shardId != types.ShardMaster {
+		return testChainGen
+	}
+	return func(i int, block *core.BlockGen) {
+		if i == 2 {
+			block.SetCoinbase(acc2Addr)
+			block.SetExtra([]byte("yeehaw"))
+		}
+	}
+}
+
 func testChainOdr(t *testing.T, protocol int, fn odrTestFn,shardId uint16) {
 	var (
 		sdb     = ethdb.NewMemDatabase()
@@ -265,7 +303,7 @@ func testChainOdr(t *testing.T, protocol int, fn odrTestFn,shardId uint16) {
 	gspec.MustCommit(ldb,shardId)
 	// Assemble the test environment
 	blockchain, _ := core.NewBlockChain(sdb, nil, params.TestChainConfig, ethash.NewFullFaker(), vm.Config{}, nil,shardId)
-	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), sdb, 4, testChainGen)
+	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), sdb, 4, testChainGenerator(shardId))
 
 	fmt.Println("Number:",gchain[1].NumberU64(),"hash:",gchain[1].Hash(),"header:",gchain[1].Header().Hash())
 	if _, err := blockchain.InsertChain(gchain); err != nil {
@@ -281,6 +319,7 @@ func testChainOdr(t *testing.T, protocol int, fn odrTestFn,shardId uint16) {
 	for i, block := range gchain {
 		headers[i] = block.Header()
 	}
+	referenceShardHeaders(ldb, headers)
 	if _, err := lightchain.InsertHeaderChain(headers, 1); err != nil {
 		t.Fatal(err)
 	}
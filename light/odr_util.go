@@ -63,7 +63,7 @@ func GetHeaderByNumber(ctx context.Context, odr OdrBackend, shardId uint16,numbe
 	if number >= chtCount*odr.IndexerConfig().ChtSize {
 		return nil, ErrNoTrustedCht
 	}
-	r := &ChtRequest{ChtRoot: GetChtRoot(db, chtCount-1, sectionHead), ChtNum: chtCount - 1, BlockNum: number, Config: odr.IndexerConfig()}
+	r := &ChtRequest{ShardId: shardId, ChtRoot: GetChtRoot(db, chtCount-1, sectionHead), ChtNum: chtCount - 1, BlockNum: number, Config: odr.IndexerConfig()}
 	if err := odr.Retrieve(ctx, r); err != nil {
 		return nil, err
 	}
@@ -105,7 +105,10 @@ func GetBody(ctx context.Context, odr OdrBackend, shardId uint16,hash common.Has
 	bodyData := new(types.BodyEncode)
 	body := new (types.SuperBody)
 	if err := rlp.Decode(bytes.NewReader(data), bodyData); err != nil {
-		rlp.DecodeBytes(bodyData.Body,body)
+		return nil, err
+	}
+	if err := rlp.DecodeBytes(bodyData.Body, body); err != nil {
+		return nil, err
 	}
 	return body, nil
 }
@@ -230,7 +233,7 @@ func GetBloomBits(ctx context.Context, odr OdrBackend, shardId uint16,bitIdx uin
 		return result, nil
 	}
 
-	r := &BloomRequest{BloomTrieRoot: GetBloomTrieRoot(db, bloomTrieCount-1, sectionHead), BloomTrieNum: bloomTrieCount - 1,
+	r := &BloomRequest{ShardId: shardId, BloomTrieRoot: GetBloomTrieRoot(db, bloomTrieCount-1, sectionHead), BloomTrieNum: bloomTrieCount - 1,
 		BitIdx: bitIdx, SectionIndexList: reqList, Config: odr.IndexerConfig()}
 	if err := odr.Retrieve(ctx, r); err != nil {
 		return nil, err
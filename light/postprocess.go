@@ -111,6 +111,20 @@ var trustedCheckpoints = map[common.Hash]*params.TrustedCheckpoint{
 	params.RinkebyGenesisHash: params.RinkebyTrustedCheckpoint,
 }
 
+// shardTrustedCheckpoints associates the known shard checkpoints with the genesis
+// hash of the master chain they belong to. No network has published any yet, so
+// shard light clients sync from the shard genesis.
+var shardTrustedCheckpoints = map[common.Hash]map[uint16]*params.TrustedCheckpoint{}
+
+// trustedCheckpoint returns the known checkpoint of a shard chain, given the
+// genesis hash of the master chain, or nil if there is none.
+func trustedCheckpoint(genesis common.Hash, shardId uint16) *params.TrustedCheckpoint {
+	if shardId == types.ShardMaster {
+		return trustedCheckpoints[genesis]
+	}
+	return shardTrustedCheckpoints[genesis][shardId]
+}
+
 var (
 	ErrNoTrustedCht       = errors.New("no trusted canonical hash trie")
 	ErrNoTrustedBloomTrie = errors.New("no trusted bloom trie")
@@ -164,7 +178,7 @@ func NewChtIndexer(db ethdb.Database, odr OdrBackend, size, confirms uint64,shar
 		triedb:      trie.NewDatabase(trieTable),
 		sectionSize: size,
 	}
-	return core.NewChainIndexer(db, ethdb.NewTable(db, "chtIndex-"), backend, size, confirms, time.Millisecond*100, "cht",shardId)
+	return core.NewChainIndexer(db, ethdb.NewTable(db, rawdb.ShardIndexPrefix("chtIndex-", shardId)), backend, size, confirms, time.Millisecond*100, "cht", shardId)
 }
 
 // fetchMissingNodes tries to retrieve the last entry of the latest trusted CHT from the
@@ -291,7 +305,7 @@ func NewBloomTrieIndexer(db ethdb.Database, odr OdrBackend, parentSize, size uin
 	}
 	backend.bloomTrieRatio = size / parentSize
 	backend.sectionHeads = make([]common.Hash, backend.bloomTrieRatio)
-	return core.NewChainIndexer(db, ethdb.NewTable(db, "bltIndex-"), backend, size, 0, time.Millisecond*100, "bloomtrie",shardId)
+	return core.NewChainIndexer(db, ethdb.NewTable(db, rawdb.ShardIndexPrefix("bltIndex-", shardId)), backend, size, 0, time.Millisecond*100, "bloomtrie", shardId)
 }
 
 // fetchMissingNodes tries to retrieve the last entries of the latest trusted bloom trie from the
@@ -0,0 +1,143 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+)
+
+// ErrUnreferencedShardHeader is returned if a shard header is not (yet) included
+// in any block of the canonical master chain.
+var ErrUnreferencedShardHeader = errors.New("shard header not referenced by master chain")
+
+var shardRefsHeadKey = []byte("LastShardRefs") // master hash + number (uint64 big endian) of the last indexed master block
+
+// GetShardRefsHead reads the last master block whose shard block references
+// were indexed into the database.
+func GetShardRefsHead(db ethdb.Database) (common.Hash, uint64) {
+	data, _ := db.Get(shardRefsHeadKey)
+	if len(data) != common.HashLength+8 {
+		return common.Hash{}, 0
+	}
+	return common.BytesToHash(data[:common.HashLength]), binary.BigEndian.Uint64(data[common.HashLength:])
+}
+
+// StoreShardRefsHead writes the last master block whose shard block references
+// were indexed into the database.
+func StoreShardRefsHead(db ethdb.Database, hash common.Hash, number uint64) {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], number)
+	db.Put(shardRefsHeadKey, append(hash.Bytes(), encNumber[:]...))
+}
+
+// Master returns the master header chain following a shard chain, or nil if
+// the chain itself is the master chain.
+func (self *LightChain) Master() *LightChain {
+	return self.master
+}
+
+// shardRefsStart returns the master block the shard references are indexed
+// from: the head of the trusted checkpoint if there is one, as the chain is not
+// synced below it, or the genesis block otherwise.
+func (self *LightChain) shardRefsStart() (common.Hash, uint64) {
+	if cp := trustedCheckpoint(self.genesisBlock.Hash(), types.ShardMaster); cp != nil {
+		return cp.SectionHead, (cp.SectionIndex+1)*self.indexerConfig.ChtSize - 1
+	}
+	return self.genesisBlock.Hash(), 0
+}
+
+// IndexShardRefs retrieves the bodies of the canonical master blocks not indexed
+// yet and records which master block references each of the contained shard
+// blocks. Indexing starts after the trusted checkpoint, so shard blocks only
+// referenced below it are never verified. Master blocks that were reorged out
+// since the last run are unwound first. It must be called on the master chain.
+func (self *LightChain) IndexShardRefs(ctx context.Context) error {
+	self.refsMu.Lock()
+	defer self.refsMu.Unlock()
+
+	db := self.chainDb
+	hash, number := GetShardRefsHead(db)
+	startHash, start := self.shardRefsStart()
+
+	// Rewind to the last indexed block still on the canonical chain
+	for number > start && rawdb.ReadCanonicalHash(db, types.ShardMaster, number) != hash {
+		header := rawdb.ReadHeader(db, hash, number)
+		if header == nil || reflect.ValueOf(header).IsNil() {
+			break
+		}
+		hash, number = header.ParentHash(), number-1
+	}
+	if number <= start || rawdb.ReadCanonicalHash(db, types.ShardMaster, number) != hash {
+		hash, number = startHash, start
+	}
+	head := self.CurrentHeader().NumberU64()
+	for number < head {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-self.quit:
+			return nil
+		default:
+		}
+		number++
+		hash = rawdb.ReadCanonicalHash(db, types.ShardMaster, number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		block, err := GetBlock(ctx, self.odr, types.ShardMaster, hash, number)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteShardBlockEntries(db, block)
+		StoreShardRefsHead(db, hash, number)
+	}
+	return nil
+}
+
+// VerifyShardHeader checks that a shard header is referenced by a block of the
+// canonical master chain, as recorded by IndexShardRefs. It must be called on
+// the master chain.
+func (self *LightChain) VerifyShardHeader(header types.HeaderIntf) error {
+	shardId, masterHash, masterNumber, _ := rawdb.ReadTxLookupEntry(self.chainDb, header.Hash())
+	if masterHash == (common.Hash{}) || shardId != types.ShardMaster {
+		return ErrUnreferencedShardHeader
+	}
+	if rawdb.ReadCanonicalHash(self.chainDb, types.ShardMaster, masterNumber) != masterHash {
+		log.Debug("Shard header referenced by non-canonical master block", "hash", header.Hash(), "master", masterHash)
+		return ErrUnreferencedShardHeader
+	}
+	return nil
+}
+
+// GetShardResults retrieves the contract results of a shard block, proven by the
+// receipt hash of its header.
+func GetShardResults(ctx context.Context, odr OdrBackend, shardId uint16, hash common.Hash, number uint64) (types.ContractResults, error) {
+	body, err := GetBody(ctx, odr, shardId, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	return body.Results, nil
+}
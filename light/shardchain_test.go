@@ -0,0 +1,157 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/consensus/ethash"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/params"
+)
+
+// referenceShardHeaders writes a canonical master block on top of the master
+// chain in the database, referencing the given shard headers, as if the master
+// chain had been indexed by IndexShardRefs. Master headers are left alone.
+func referenceShardHeaders(db ethdb.Database, headers []types.HeaderIntf) {
+	if len(headers) == 0 || headers[0].ShardId() == types.ShardMaster {
+		return
+	}
+	number := uint64(1)
+	for rawdb.ReadCanonicalHash(db, types.ShardMaster, number) != (common.Hash{}) {
+		number++
+	}
+	infos := make([]*types.ShardBlockInfo, len(headers))
+	for i, header := range headers {
+		infos[i] = &types.ShardBlockInfo{ShardId: header.ShardId(), BlockNumber: header.NumberU64(), Hash: header.Hash(), ParentHash: header.ParentHash()}
+	}
+	block := types.NewBlock(masterHeader(rawdb.ReadCanonicalHash(db, types.ShardMaster, number-1), number), infos, nil, nil)
+	rawdb.WriteCanonicalHash(db, types.ShardMaster, block.Hash(), number)
+	rawdb.WriteShardBlockEntries(db, block)
+}
+
+// masterHeader creates a master header of the given number on top of parent.
+func masterHeader(parent common.Hash, number uint64) *types.Header {
+	header := new(types.Header)
+	header.FillBy(&types.HeaderStruct{
+		ParentHash: parent,
+		Difficulty: big.NewInt(1),
+		Number:     new(big.Int).SetUint64(number),
+		Time:       new(big.Int).SetUint64(number * 10),
+	})
+	return header
+}
+
+// countingOdr is a test ODR backend counting the block bodies it retrieved.
+type countingOdr struct {
+	*testOdr
+	bodies map[uint64]int
+}
+
+func (odr *countingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if req, ok := req.(*BlockRequest); ok {
+		odr.bodies[req.Number]++
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+// Tests that the shard references of the master chain are indexed starting from
+// the trusted checkpoint if there is one, without retrieving the bodies of the
+// master blocks below it.
+func TestIndexShardRefsCheckpoint(t *testing.T) {
+	t.Run("genesis", func(t *testing.T) { testIndexShardRefs(t, false) })
+	t.Run("checkpoint", func(t *testing.T) { testIndexShardRefs(t, true) })
+}
+
+func testIndexShardRefs(t *testing.T, checkpoint bool) {
+	var (
+		sdb     = ethdb.NewMemDatabase()
+		ldb     = ethdb.NewMemDatabase()
+		gspec   = core.Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(sdb, types.ShardMaster)
+		config  = &IndexerConfig{ChtSize: 8}
+		odr     = &countingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb, indexerConfig: config}, bodies: make(map[uint64]int)}
+	)
+	gspec.MustCommit(ldb, types.ShardMaster)
+
+	lc, err := NewLightChain(odr, gspec.Config, ethash.NewFullFaker(), types.ShardMaster)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	defer lc.Stop()
+
+	// Create a master chain referencing a shard block from every block
+	var (
+		headers = make([]types.HeaderIntf, 20)
+		shards  = make([]common.Hash, len(headers)+1)
+		parent  = genesis.Hash()
+	)
+	for i := range headers {
+		number := uint64(i + 1)
+		shards[number] = common.Hash{0x01, byte(number)}
+
+		infos := []*types.ShardBlockInfo{{ShardId: 0, BlockNumber: number, Hash: shards[number]}}
+		block := types.NewBlock(masterHeader(parent, number), infos, nil, nil)
+		rawdb.WriteBlock(sdb, block)
+
+		headers[i], parent = block.Header(), block.Hash()
+	}
+	if _, err := lc.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert master headers: %v", err)
+	}
+	start := uint64(0)
+	if checkpoint {
+		start = 2*config.ChtSize - 1
+		trustedCheckpoints[genesis.Hash()] = &params.TrustedCheckpoint{SectionIndex: 1, SectionHead: headers[start-1].Hash()}
+		defer delete(trustedCheckpoints, genesis.Hash())
+	}
+	if err := lc.IndexShardRefs(context.Background()); err != nil {
+		t.Fatalf("failed to index shard references: %v", err)
+	}
+	for number := uint64(1); number <= uint64(len(headers)); number++ {
+		want := 0
+		if number > start {
+			want = 1
+		}
+		if have := odr.bodies[number]; have != want {
+			t.Errorf("block %d: body retrieval count mismatch: have %d, want %d", number, have, want)
+		}
+		_, hash, _, _ := rawdb.ReadTxLookupEntry(ldb, shards[number])
+		if indexed := hash == headers[number-1].Hash(); indexed != (number > start) {
+			t.Errorf("block %d: shard reference indexed mismatch: have %v, want %v", number, indexed, number > start)
+		}
+	}
+	if hash, number := GetShardRefsHead(ldb); hash != parent || number != uint64(len(headers)) {
+		t.Errorf("indexed head mismatch: have #%d [%x], want #%d [%x]", number, hash, len(headers), parent)
+	}
+	// Indexing again must not retrieve anything more
+	for number := range odr.bodies {
+		delete(odr.bodies, number)
+	}
+	if err := lc.IndexShardRefs(context.Background()); err != nil {
+		t.Fatalf("failed to reindex shard references: %v", err)
+	}
+	if len(odr.bodies) != 0 {
+		t.Errorf("indexed blocks retrieved again: %v", odr.bodies)
+	}
+}
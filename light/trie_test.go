@@ -47,7 +47,7 @@ func testNodeIterator(t *testing.T,shardId uint16) {
 	)
 	gspec.MustCommit(lightdb,shardId)
 	blockchain, _ := core.NewBlockChain(fulldb, nil, params.TestChainConfig, ethash.NewFullFaker(), vm.Config{}, nil,shardId)
-	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), fulldb, 4, testChainGen)
+	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), fulldb, 4, testChainGenerator(shardId))
 	if _, err := blockchain.InsertChain(gchain); err != nil {
 		panic(err)
 	}
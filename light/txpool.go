@@ -112,7 +112,7 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 
 // currentState returns the light state of the current head header
 func (pool *TxPool) currentState(ctx context.Context) *state.StateDB {
-	return NewState(ctx, pool.chain.CurrentHeader().ToHeader(), pool.odr)
+	return NewState(ctx, pool.chain.CurrentHeader(), pool.odr)
 }
 
 // GetNonce returns the "pending" nonce of a given address. It always queries
@@ -172,21 +172,34 @@ func (pool *TxPool) checkMinedTxs(ctx context.Context, shardId uint16, hash comm
 	if err != nil {
 		return err
 	}
-	// Gather all the local transaction mined in this block
+	// Gather all the local transaction mined in this block, shard blocks only
+	// carry the results of theirs
 	list := pool.mined[hash]
-	for _, tx := range block.Transactions() {
-		if _, ok := pool.pending[tx.Hash()]; ok {
-			list = append(list, tx)
+	if shardId == types.ShardMaster {
+		for _, tx := range block.Transactions() {
+			if _, ok := pool.pending[tx.Hash()]; ok {
+				list = append(list, tx)
+			}
+		}
+	} else {
+		for _, result := range block.Results() {
+			if tx, ok := pool.pending[result.TxHash]; ok {
+				list = append(list, tx)
+			}
 		}
 	}
 	// If some transactions have been mined, write the needed data to disk and update
 	if list != nil {
-		// Retrieve all the receipts belonging to this block and write the loopup table
-		receipts, err := GetBlockReceipts(ctx, pool.odr, hash, number)
-		if err != nil { // ODR caches, ignore results
-			return err
+		if shardId == types.ShardMaster {
+			// Retrieve all the receipts belonging to this block and write the loopup table
+			receipts, err := GetBlockReceipts(ctx, pool.odr, hash, number)
+			if err != nil { // ODR caches, ignore results
+				return err
+			}
+			rawdb.WriteTxLookupEntries(pool.chainDb, block, receipts)
+		} else {
+			rawdb.WriteShardTxLookupEntries(pool.chainDb, block)
 		}
-		rawdb.WriteTxLookupEntries(pool.chainDb, block, receipts)
 
 		// Update the transaction pool's state
 		for _, tx := range list {
@@ -206,6 +219,7 @@ func (pool *TxPool) rollbackTxs(hash common.Hash, txc txStateChanges) {
 		for _, tx := range list {
 			txHash := tx.Hash()
 			rawdb.DeleteTxLookupEntry(batch, txHash)
+			rawdb.DeleteShardTxLookupEntry(batch, txHash)
 			pool.pending[txHash] = tx
 			txc.setState(txHash, false)
 		}
@@ -233,10 +247,10 @@ func (pool *TxPool) reorgOnNewHead(ctx context.Context, newHeader types.HeaderIn
 		}
 		if oldh.NumberU64() < newh.NumberU64() {
 			newHashes = append(newHashes, newh.Hash())
-			newh = pool.chain.GetHeader(newh.ParentHash(), newh.NumberU64()-1).ToHeader()
+			newh = pool.chain.GetHeader(newh.ParentHash(), newh.NumberU64()-1)
 			if newh == nil || reflect.ValueOf(newh).IsNil() {
 				// happens when CHT syncing, nothing to do
-				newh = oldh.ToHeader()
+				newh = oldh
 			}
 		}
 	}
@@ -289,7 +303,7 @@ func (pool *TxPool) eventLoop() {
 	for {
 		select {
 		case ev := <-pool.chainHeadCh:
-			pool.setNewHead(ev.Block.Header().ToHeader())
+			pool.setNewHead(ev.Block.Header())
 			// hack in order to avoid hogging the lock; this part will
 			// be replaced by a subsequent PR.
 			time.Sleep(time.Millisecond)
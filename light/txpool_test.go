@@ -78,7 +78,7 @@ func txPoolTestChainGen(i int, block *core.BlockGen) {
 func TestTxPool(t *testing.T) {
 	shardId := uint16(0)
 	for i := range testTx {
-		testTx[i], _ = types.SignTx(types.NewTransaction(uint64(i), acc1Addr, big.NewInt(10000), params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+		testTx[i], _ = types.SignTx(types.NewTransaction(uint64(i), acc1Addr, big.NewInt(10000), params.TxGas, nil, nil, 0), types.HomesteadSigner{}, testBankKey)
 	}
 
 	var (
@@ -120,7 +120,9 @@ func TestTxPool(t *testing.T) {
 			}
 		}
 
-		if _, err := lightchain.InsertHeaderChain([]types.HeaderIntf{block.Header()}, 1); err != nil {
+		headers := []types.HeaderIntf{block.Header()}
+		referenceShardHeaders(ldb, headers)
+		if _, err := lightchain.InsertHeaderChain(headers, 1); err != nil {
 			panic(err)
 		}
 
@@ -0,0 +1,131 @@
+package mdc
+
+import (
+	"github.com/EDXFund/MasterChain/accounts"
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/common/hexutil"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/log"
+)
+
+// PublicMdcAPI provides the mdc RPC namespace, exposing the receipts a
+// provider collected. It holds no keys, data is accessed through PrivateMdcAPI.
+type PublicMdcAPI struct {
+	provider MdcIntf
+}
+
+// NewPublicMdcAPI creates a new data custody API on top of provider.
+func NewPublicMdcAPI(provider MdcIntf) *PublicMdcAPI {
+	return &PublicMdcAPI{provider: provider}
+}
+
+// PrivateMdcAPI provides the data custody methods of the personal namespace,
+// accessing the data of a provider on behalf of the accounts of the node. Every
+// call is authorized by the passphrase of the account it acts for, the same way
+// personal_sign is, so the node never signs with an account merely unlocked.
+type PrivateMdcAPI struct {
+	provider MdcIntf
+	am       *accounts.Manager
+}
+
+// NewPrivateMdcAPI creates a new personal data custody API on top of provider.
+func NewPrivateMdcAPI(provider MdcIntf, am *accounts.Manager) *PrivateMdcAPI {
+	return &PrivateMdcAPI{provider: provider, am: am}
+}
+
+// Access is the result of a read, the data and the access it was counted as.
+type Access struct {
+	Data  hexutil.Bytes  `json:"data"`
+	Nonce hexutil.Uint64 `json:"nonce"`
+	Mask  hexutil.Uint   `json:"mask"`
+}
+
+// RPCAccessReceipt represents an access receipt that will serialize to the RPC
+// representation of a receipt.
+type RPCAccessReceipt struct {
+	Provider common.Address `json:"provider"`
+	Reader   common.Address `json:"reader"`
+	Hash     common.Hash    `json:"hash"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	Mask     hexutil.Uint   `json:"mask"`
+	Fee      *hexutil.Big   `json:"fee"`
+	Sig      hexutil.Bytes  `json:"sig"`
+}
+
+func newRPCAccessReceipt(reader common.Address, receipt *types.AccessReceipt) *RPCAccessReceipt {
+	return &RPCAccessReceipt{
+		Provider: receipt.Provider,
+		Reader:   reader,
+		Hash:     receipt.Hash,
+		Nonce:    hexutil.Uint64(receipt.Nonce),
+		Mask:     hexutil.Uint(receipt.Mask),
+		Fee:      (*hexutil.Big)(receipt.Fee),
+		Sig:      receipt.Sig,
+	}
+}
+
+// MdcPut stores data with the provider on behalf of owner, returning the hash it
+// can be read by. The passphrase of owner proves the call is made on its behalf.
+func (api *PrivateMdcAPI) MdcPut(owner common.Address, data hexutil.Bytes, passwd string) (common.Hash, error) {
+	account := accounts.Account{Address: owner}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hash := crypto.Keccak256Hash(data)
+	if _, err := wallet.SignHashWithPassphrase(account, passwd, hash.Bytes()); err != nil {
+		log.Warn("Failed data custody put attempt", "owner", owner, "err", err)
+		return common.Hash{}, err
+	}
+	if err := api.provider.Put(owner, hash, data); err != nil {
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
+
+// MdcGet reads the data stored under hash on behalf of reader, which
+// acknowledges the access with a receipt signed with the given passphrase.
+func (api *PrivateMdcAPI) MdcGet(reader common.Address, hash common.Hash, passwd string) (*Access, error) {
+	account := accounts.Account{Address: reader}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the passphrase unlocks the reader before the access is counted
+	if _, err := wallet.SignHashWithPassphrase(account, passwd, hash.Bytes()); err != nil {
+		log.Warn("Failed data custody get attempt", "reader", reader, "err", err)
+		return nil, err
+	}
+	mdb := NewMdbWithSigner(reader, func(hash []byte) ([]byte, error) {
+		return wallet.SignHashWithPassphrase(account, passwd, hash)
+	}, api.provider)
+
+	data, err := mdb.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &Access{Data: data, Nonce: hexutil.Uint64(mdb.prevAccessNonce), Mask: hexutil.Uint(mdb.prevAccessMasks)}, nil
+}
+
+// GetReceipt returns the latest receipt of reader for the session nonce, or nil
+// if it sent none.
+func (api *PublicMdcAPI) GetReceipt(reader common.Address, nonce hexutil.Uint64) *RPCAccessReceipt {
+	for _, receipt := range api.provider.Receipts(reader) {
+		if receipt.Nonce == uint64(nonce) {
+			return newRPCAccessReceipt(reader, receipt)
+		}
+	}
+	return nil
+}
+
+// ListReceipts returns the latest receipt of every session of reader, ordered
+// by session nonce.
+func (api *PublicMdcAPI) ListReceipts(reader common.Address) []*RPCAccessReceipt {
+	receipts := api.provider.Receipts(reader)
+	result := make([]*RPCAccessReceipt, len(receipts))
+	for i, receipt := range receipts {
+		result[i] = newRPCAccessReceipt(reader, receipt)
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package mdc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/accounts"
+	"github.com/EDXFund/MasterChain/accounts/keystore"
+	"github.com/EDXFund/MasterChain/common"
+)
+
+// Tests that data is only put and read on behalf of an account given its
+// passphrase, even if the account is unlocked.
+func TestPrivateAPIAuthorization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdc-api-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary keystore: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("secret")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := ks.Unlock(account, "secret"); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	provider := NewMDCDemo(common.HexToAddress("0xfeed"), big.NewInt(10))
+	api := NewPrivateMdcAPI(provider, accounts.NewManager(ks))
+
+	if _, err := api.MdcPut(account.Address, []byte("blob"), "wrong"); err == nil {
+		t.Fatalf("put with wrong passphrase succeeded")
+	}
+	hash, err := api.MdcPut(account.Address, []byte("blob"), "secret")
+	if err != nil {
+		t.Fatalf("failed to put data: %v", err)
+	}
+	if _, err := api.MdcGet(account.Address, hash, ""); err == nil {
+		t.Fatalf("read of unlocked account without passphrase succeeded")
+	}
+	if receipts := provider.Receipts(account.Address); len(receipts) != 0 {
+		t.Fatalf("receipts sent without passphrase: %d", len(receipts))
+	}
+	access, err := api.MdcGet(account.Address, hash, "secret")
+	if err != nil {
+		t.Fatalf("failed to read data: %v", err)
+	}
+	if !bytes.Equal(access.Data, []byte("blob")) {
+		t.Fatalf("data mismatch: have %x, want %x", access.Data, []byte("blob"))
+	}
+	receipts := provider.Receipts(account.Address)
+	if len(receipts) != 1 {
+		t.Fatalf("receipt count mismatch: have %d, want 1", len(receipts))
+	}
+	if reader, err := receipts[0].Reader(); err != nil || reader != account.Address {
+		t.Fatalf("receipt signer mismatch: have %x (%v), want %x", reader, err, account.Address)
+	}
+}
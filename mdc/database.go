@@ -0,0 +1,208 @@
+package mdc
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/rlp"
+)
+
+var (
+	dataPrefix    = []byte("mdc-d") // dataPrefix + hash -> data
+	sessionPrefix = []byte("mdc-s") // sessionPrefix + address -> RLP(session)
+	receiptPrefix = []byte("mdc-r") // receiptPrefix + address -> RLP([]*types.AccessReceipt)
+)
+
+// dataKey = dataPrefix + hash
+func dataKey(hash common.Hash) []byte {
+	return append(dataPrefix, hash.Bytes()...)
+}
+
+// sessionKey = sessionPrefix + address
+func sessionKey(address common.Address) []byte {
+	return append(sessionPrefix, address.Bytes()...)
+}
+
+// receiptKey = receiptPrefix + address
+func receiptKey(address common.Address) []byte {
+	return append(receiptPrefix, address.Bytes()...)
+}
+
+// session is the persisted access state of a reader.
+type session struct {
+	Nonce uint64
+	Mask  uint16
+}
+
+// blobStore is the backend keeping the data served by a provider.
+type blobStore interface {
+	put(hash common.Hash, value []byte) error
+	get(hash common.Hash) ([]byte, error)
+	close()
+}
+
+// dbBlobs keeps data in the database of the provider itself.
+type dbBlobs struct {
+	db ethdb.Database
+}
+
+func (b *dbBlobs) put(hash common.Hash, value []byte) error {
+	return b.db.Put(dataKey(hash), value)
+}
+
+func (b *dbBlobs) get(hash common.Hash) ([]byte, error) {
+	value, err := b.db.Get(dataKey(hash))
+	if err != nil || value == nil {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (b *dbBlobs) close() {}
+
+// DBProvider is a data custody provider keeping the access sessions of its
+// readers and their receipts in a database, so that receipts survive a restart
+// until they are redeemed.
+type DBProvider struct {
+	db    ethdb.Database
+	blobs blobStore
+	payee common.Address
+	fee   *big.Int
+	mu    sync.Mutex
+}
+
+// NewDBProvider creates a provider on top of db, paid to payee, which keeps the
+// data in db too.
+func NewDBProvider(db ethdb.Database, payee common.Address, fee *big.Int) *DBProvider {
+	return newDBProvider(db, &dbBlobs{db: db}, payee, fee)
+}
+
+func newDBProvider(db ethdb.Database, blobs blobStore, payee common.Address, fee *big.Int) *DBProvider {
+	return &DBProvider{
+		db:    db,
+		blobs: blobs,
+		payee: payee,
+		fee:   new(big.Int).Set(fee),
+	}
+}
+
+// Close releases the data backend of the provider. The database is owned by the
+// caller and left open.
+func (p *DBProvider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.blobs.close()
+}
+
+func (p *DBProvider) SetProvider(string) {
+
+}
+
+func (p *DBProvider) Terms() (common.Address, *big.Int) {
+	return p.payee, new(big.Int).Set(p.fee)
+}
+
+func (p *DBProvider) Put(address common.Address, hash common.Hash, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.blobs.put(hash, value)
+}
+
+func (p *DBProvider) Get(address common.Address, hash common.Hash) ([]byte, error, uint64, uint16) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, err := p.blobs.get(hash)
+	if err != nil {
+		return []byte{}, err, 0, 0
+	}
+	current := p.readSession(address)
+	if current == nil {
+		current = &nonce{nonce: newSessionNonce()}
+	}
+	current.next()
+	if err := p.writeSession(address, current); err != nil {
+		return []byte{}, err, 0, 0
+	}
+	return value, nil, current.nonce, current.mask
+}
+
+func (p *DBProvider) SendReceiption(address common.Address, enc []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	receipt, err := verifyReceipt(enc, address, p.payee, p.fee, p.readSession(address))
+	if err != nil {
+		return err
+	}
+	receipts := p.readReceipts(address)
+	for i, prev := range receipts {
+		if prev.Nonce == receipt.Nonce {
+			if prev.Mask >= receipt.Mask {
+				return nil
+			}
+			receipts = append(receipts[:i], receipts[i+1:]...)
+			break
+		}
+	}
+	receipts = append(receipts, receipt)
+	sort.Slice(receipts, func(i, j int) bool { return receipts[i].Nonce < receipts[j].Nonce })
+
+	data, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return err
+	}
+	return p.db.Put(receiptKey(address), data)
+}
+
+func (p *DBProvider) Receipts(address common.Address) []*types.AccessReceipt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.readReceipts(address)
+}
+
+// readSession retrieves the current access session of a reader, or nil if it
+// never accessed the provider.
+func (p *DBProvider) readSession(address common.Address) *nonce {
+	data, _ := p.db.Get(sessionKey(address))
+	if len(data) == 0 {
+		return nil
+	}
+	var s session
+	if err := rlp.DecodeBytes(data, &s); err != nil {
+		log.Error("Invalid access session RLP", "address", address, "err", err)
+		return nil
+	}
+	return &nonce{nonce: s.Nonce, mask: s.Mask}
+}
+
+// writeSession stores the current access session of a reader.
+func (p *DBProvider) writeSession(address common.Address, current *nonce) error {
+	data, err := rlp.EncodeToBytes(&session{Nonce: current.nonce, Mask: current.mask})
+	if err != nil {
+		return err
+	}
+	return p.db.Put(sessionKey(address), data)
+}
+
+// readReceipts retrieves the latest receipt of every session of a reader.
+func (p *DBProvider) readReceipts(address common.Address) []*types.AccessReceipt {
+	data, _ := p.db.Get(receiptKey(address))
+	if len(data) == 0 {
+		return nil
+	}
+	var receipts []*types.AccessReceipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		log.Error("Invalid access receipts RLP", "address", address, "err", err)
+		return nil
+	}
+	return receipts
+}
@@ -1,90 +1,243 @@
 package mdc
 
 import (
+	"crypto/ecdsa"
 	"errors"
-	"github.com/EDXFund/MasterChain/common"
+	"math"
+	"math/big"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/rlp"
 )
 
-type Mdb struct {
+var (
+	// ErrNotFound is returned if the provider stores no data under a hash.
+	ErrNotFound = errors.New("hash not exist")
+
+	// ErrInvalidReceipt is returned if a receipt is not signed by the reader
+	// sending it, or doesn't match the terms or the accesses of the provider.
+	ErrInvalidReceipt = errors.New("invalid access receipt")
+)
+
+// SignerFn signs the hash of an access receipt on behalf of a reader.
+type SignerFn func(hash []byte) ([]byte, error)
 
-	self    common.Address
+type Mdb struct {
+	self   common.Address
+	signer SignerFn
 	//previously stored access
 	prevAccessMasks uint16
-    prevAccessNonce uint64
-	provider   MdcIntf
+	prevAccessNonce uint64
+	provider        MdcIntf
 }
 
 type MdcIntf interface {
-
 	SetProvider(string)
+	//Account of the storage node to be paid and its fee per access
+	Terms() (common.Address, *big.Int)
 
-	Put(self common.Address,  hash common.Hash, value []byte)
+	Put(self common.Address, hash common.Hash, value []byte) error
 	//Get data from storage, returns data, nonce,masks
-	Get(self common.Address, hash common.Hash) ([]byte,error,uint64,uint16)
+	Get(self common.Address, hash common.Hash) ([]byte, error, uint64, uint16)
 	//Write and send receipt of(nonce,masks ) storage
-	SendReceiption(self common.Address, receipt []byte )
+	SendReceiption(self common.Address, receipt []byte) error
+	//Latest receipt of every session of a reader, to be redeemed on chain
+	Receipts(self common.Address) []*types.AccessReceipt
 }
 
-func (m *Mdb)Put(hash common.Hash,value []byte){
-	m.provider.Put(m.self,hash,value)
+// NewMdb creates a reader of the given provider, acknowledging every access
+// with a receipt signed by key.
+func NewMdb(key *ecdsa.PrivateKey, provider MdcIntf) *Mdb {
+	return NewMdbWithSigner(crypto.PubkeyToAddress(key.PublicKey), func(hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	}, provider)
 }
 
-func (m *Mdb)Get(hash common.Hash) ([]byte,error){
-	data,err,nonce,masks := m.provider.Get(m.self,hash)
-	if err == nil {
-		m.prevAccessNonce = nonce
-		m.prevAccessMasks = masks
+// NewMdbWithSigner creates a reader of the given provider for the account self,
+// whose receipts are signed by signer, e.g. an unlocked wallet.
+func NewMdbWithSigner(self common.Address, signer SignerFn, provider MdcIntf) *Mdb {
+	return &Mdb{
+		self:     self,
+		signer:   signer,
+		provider: provider,
+	}
+}
 
-		//m.provider.SendReceiption(crypto.Sign(crypto.Keccak256Hash()))
+func (m *Mdb) Put(hash common.Hash, value []byte) error {
+	return m.provider.Put(m.self, hash, value)
+}
 
-		return data,err
+// Get retrieves data from the provider and sends it a signed receipt of the
+// access, which entitles the provider to the agreed fee.
+func (m *Mdb) Get(hash common.Hash) ([]byte, error) {
+	data, err, nonce, masks := m.provider.Get(m.self, hash)
+	if err != nil {
+		return data, err
+	}
+	m.prevAccessNonce = nonce
+	m.prevAccessMasks = masks
+
+	payee, fee := m.provider.Terms()
+	receipt := &types.AccessReceipt{
+		Provider: payee,
+		Hash:     hash,
+		Nonce:    nonce,
+		Mask:     masks,
+		Fee:      fee,
+	}
+	sig, err := m.signer(receipt.SigHash().Bytes())
+	if err != nil {
+		return data, err
 	}
-	return data,err
+	if receipt, err = receipt.WithSignature(sig); err != nil {
+		return data, err
+	}
+	enc, err := rlp.EncodeToBytes(receipt)
+	if err != nil {
+		return data, err
+	}
+	return data, m.provider.SendReceiption(m.self, enc)
+}
 
+// RedeemTransaction creates the transaction a provider sends to get paid for
+// the accesses acknowledged by the given receipts. It still has to be signed
+// by the provider.
+func RedeemTransaction(nonce uint64, receipts []*types.AccessReceipt, gasLimit uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	data, err := core.EncodeAccessReceipts(receipts)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTransaction(nonce, core.MdcRegistryAddress, new(big.Int), gasLimit, gasPrice, data, types.NativeTokenId), nil
 }
 
 type nonce struct {
 	nonce uint64
 	mask  uint16
-	receipt   bool
 }
+
+// next counts an access, starting a new session when the mask is exhausted.
+func (n *nonce) next() {
+	if n.mask == math.MaxUint16 {
+		n.nonce, n.mask = newSessionNonce(), 0
+	}
+	n.mask++
+}
+
+func newSessionNonce() uint64 {
+	return rand.New(rand.NewSource(time.Now().UnixNano())).Uint64()
+}
+
+// verifyReceipt decodes a receipt sent by self and checks it acknowledges an
+// access of its current session on the terms of the provider.
+func verifyReceipt(enc []byte, self, payee common.Address, fee *big.Int, session *nonce) (*types.AccessReceipt, error) {
+	receipt := new(types.AccessReceipt)
+	if err := rlp.DecodeBytes(enc, receipt); err != nil {
+		return nil, ErrInvalidReceipt
+	}
+	reader, err := receipt.Reader()
+	if err != nil || reader != self || receipt.Provider != payee || receipt.Fee.Cmp(fee) < 0 {
+		return nil, ErrInvalidReceipt
+	}
+	if session == nil || receipt.Nonce != session.nonce || receipt.Mask == 0 || receipt.Mask > session.mask {
+		return nil, ErrInvalidReceipt
+	}
+	return receipt, nil
+}
+
 type MDCDemo struct {
 	addrInfo map[common.Address]*nonce
 	mu       sync.RWMutex
 
 	cache    map[common.Hash][]byte
+	receipts map[common.Address]map[uint64]*types.AccessReceipt
+	payee    common.Address
+	fee      *big.Int
+}
+
+// NewMDCDemo creates an in-memory provider paid to payee.
+func NewMDCDemo(payee common.Address, fee *big.Int) *MDCDemo {
+	return &MDCDemo{
+		addrInfo: make(map[common.Address]*nonce),
+		cache:    make(map[common.Hash][]byte),
+		receipts: make(map[common.Address]map[uint64]*types.AccessReceipt),
+		payee:    payee,
+		fee:      new(big.Int).Set(fee),
+	}
 }
 
-func (m *MDCDemo)SetProvider(string) {
+func (m *MDCDemo) SetProvider(string) {
 
 }
 
-func (m *MDCDemo)Put(address common.Address,hash common.Hash,value []byte){
-	m.cache[hash] = common.CopyBytes(value)
+func (m *MDCDemo) Terms() (common.Address, *big.Int) {
+	return m.payee, new(big.Int).Set(m.fee)
 }
 
-func (m *MDCDemo)setupMask(address common.Address){
+func (m *MDCDemo) Put(address common.Address, hash common.Hash, value []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	value,ok := m.addrInfo[address]
-	if !ok {
-		value = &nonce{nonce:rand.New(rand.NewSource(time.Now().UnixNano())).Uint64(),receipt:false, mask:1}
 
+	m.cache[hash] = common.CopyBytes(value)
+	return nil
+}
+
+func (m *MDCDemo) setupMask(address common.Address) *nonce {
+	value, ok := m.addrInfo[address]
+	if !ok {
+		value = &nonce{nonce: newSessionNonce()}
 		m.addrInfo[address] = value
-	}else {
-		value.mask = value.mask+1
 	}
+	value.next()
+	return value
 }
-func (m *MDCDemo)Get(address common.Address,hash common.Hash)([]byte,error,uint64,uint16){
 
-	value,ok := m.cache[hash]
+func (m *MDCDemo) Get(address common.Address, hash common.Hash) ([]byte, error, uint64, uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.cache[hash]
 	if ok {
-		m.setupMask(address)
-		return common.CopyBytes(value),nil,m.addrInfo[address].nonce,m.addrInfo[address].mask
-	}else {
-		return []byte{},errors.New("hash not exist"),0,0
+		session := m.setupMask(address)
+		return common.CopyBytes(value), nil, session.nonce, session.mask
+	} else {
+		return []byte{}, ErrNotFound, 0, 0
 	}
-}
\ No newline at end of file
+}
+
+func (m *MDCDemo) SendReceiption(address common.Address, enc []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	receipt, err := verifyReceipt(enc, address, m.payee, m.fee, m.addrInfo[address])
+	if err != nil {
+		return err
+	}
+	sessions, ok := m.receipts[address]
+	if !ok {
+		sessions = make(map[uint64]*types.AccessReceipt)
+		m.receipts[address] = sessions
+	}
+	if prev, ok := sessions[receipt.Nonce]; !ok || prev.Mask < receipt.Mask {
+		sessions[receipt.Nonce] = receipt
+	}
+	return nil
+}
+
+func (m *MDCDemo) Receipts(address common.Address) []*types.AccessReceipt {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	receipts := make([]*types.AccessReceipt, 0, len(m.receipts[address]))
+	for _, receipt := range m.receipts[address] {
+		receipts = append(receipts, receipt)
+	}
+	sort.Slice(receipts, func(i, j int) bool { return receipts[i].Nonce < receipts[j].Nonce })
+	return receipts
+}
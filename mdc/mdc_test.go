@@ -0,0 +1,105 @@
+package mdc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/crypto"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/rlp"
+	"github.com/EDXFund/MasterChain/swarm/storage"
+)
+
+// Tests that reads through a database provider are acknowledged with receipts
+// signed by the reader, of which the latest one of a session is kept.
+func TestDBProviderReceipts(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		payee    = common.HexToAddress("0xfeed")
+		fee      = big.NewInt(10)
+		hash     = common.HexToHash("0x01")
+	)
+	provider := NewDBProvider(ethdb.NewMemDatabase(), payee, fee)
+	reader := NewMdb(key, provider)
+
+	if _, err := reader.Get(hash); err != ErrNotFound {
+		t.Fatalf("missing data: have %v, want %v", err, ErrNotFound)
+	}
+	if err := reader.Put(hash, []byte("blob")); err != nil {
+		t.Fatalf("failed to put data: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		data, err := reader.Get(hash)
+		if err != nil {
+			t.Fatalf("read %d failed: %v", i, err)
+		}
+		if !bytes.Equal(data, []byte("blob")) {
+			t.Fatalf("read %d: data mismatch: have %x", i, data)
+		}
+	}
+	receipts := provider.Receipts(reader.self)
+	if len(receipts) != 1 {
+		t.Fatalf("receipt count mismatch: have %d, want 1", len(receipts))
+	}
+	receipt := receipts[0]
+	if receipt.Mask != 2 || receipt.Nonce != reader.prevAccessNonce || receipt.Provider != payee || receipt.Fee.Cmp(fee) != 0 {
+		t.Fatalf("receipt mismatch: have %+v", receipt)
+	}
+	if signer, err := receipt.Reader(); err != nil || signer != reader.self {
+		t.Fatalf("receipt signer mismatch: have %x (%v), want %x", signer, err, reader.self)
+	}
+	// Receipts signed by another account or beyond the accesses are refused
+	forged, _ := types.SignAccessReceipt(receipt, other)
+	enc, _ := rlp.EncodeToBytes(forged)
+	if err := provider.SendReceiption(reader.self, enc); err != ErrInvalidReceipt {
+		t.Fatalf("forged receipt accepted: %v", err)
+	}
+	ahead := *receipt
+	ahead.Mask++
+	signed, _ := types.SignAccessReceipt(&ahead, key)
+	enc, _ = rlp.EncodeToBytes(signed)
+	if err := provider.SendReceiption(reader.self, enc); err != ErrInvalidReceipt {
+		t.Fatalf("receipt of unserved access accepted: %v", err)
+	}
+}
+
+// Tests that a swarm backed provider serves the data it stored.
+func TestSwarmProvider(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "mdc-swarm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+
+	store, err := storage.NewLocalFileStore(datadir, make([]byte, 32))
+	if err != nil {
+		t.Fatalf("failed to create swarm store: %v", err)
+	}
+	provider := NewSwarmProvider(ethdb.NewMemDatabase(), store, common.HexToAddress("0xfeed"), big.NewInt(1))
+	defer provider.Close()
+
+	key, _ := crypto.GenerateKey()
+	reader := NewMdb(key, provider)
+
+	blob := bytes.Repeat([]byte("blob"), 4096)
+	hash := crypto.Keccak256Hash(blob)
+	if err := reader.Put(hash, blob); err != nil {
+		t.Fatalf("failed to put data: %v", err)
+	}
+	data, err := reader.Get(hash)
+	if err != nil {
+		t.Fatalf("failed to get data: %v", err)
+	}
+	if !bytes.Equal(data, blob) {
+		t.Fatalf("data mismatch: have %d bytes, want %d", len(data), len(blob))
+	}
+	if _, err := reader.Get(common.Hash{}); err != ErrNotFound {
+		t.Fatalf("missing data: have %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,221 @@
+package mdc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/EDXFund/MasterChain/accounts"
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/log"
+	"github.com/EDXFund/MasterChain/p2p"
+	"github.com/EDXFund/MasterChain/rpc"
+	"github.com/EDXFund/MasterChain/swarm/storage"
+)
+
+// Names of the providers the service can run on.
+const (
+	MemoryProvider  = "memory"  // Data and receipts are kept in memory
+	LevelDBProvider = "leveldb" // Data and receipts are kept in the node database
+	SwarmProvider   = "swarm"   // Data is kept in a local swarm store, receipts in the node database
+)
+
+const (
+	databaseCache   = 16 // Megabytes of memory allocated to the provider database
+	databaseHandles = 16 // Number of file handles allocated to the provider database
+)
+
+// ErrUnknownProvider is returned if a provider name is none of MemoryProvider,
+// LevelDBProvider or SwarmProvider.
+var ErrUnknownProvider = errors.New("unknown data custody provider")
+
+// Config represents the configuration of the data custody service.
+type Config struct {
+	Provider string         `toml:",omitempty"` // Provider to serve data from, the service is disabled if empty
+	Payee    common.Address `toml:",omitempty"` // Account paid for accesses, the etherbase if empty
+	Fee      *big.Int       `toml:",omitempty"` // Fee charged per access
+}
+
+// DefaultConfig contains the default settings of the data custody service.
+var DefaultConfig = Config{
+	Fee: new(big.Int),
+}
+
+// ServiceContext is the part of node.ServiceContext the service depends on.
+type ServiceContext interface {
+	OpenDatabase(name string, cache int, handles int) (ethdb.Database, error)
+	ResolvePath(path string) string
+}
+
+// Service is the data custody node service. It serves the mdc RPC namespace
+// from one of the providers, which can be switched with SetProvider.
+type Service struct {
+	config *Config
+	ctx    ServiceContext
+	am     *accounts.Manager
+
+	db        ethdb.Database // Database of the persistent providers, opened on first use
+	providers map[string]MdcIntf
+	current   MdcIntf
+	mu        sync.RWMutex
+}
+
+// New creates a data custody service running on the configured provider, which
+// signs receipts with the accounts of am.
+func New(ctx ServiceContext, am *accounts.Manager, config *Config) (*Service, error) {
+	if config.Fee == nil {
+		config.Fee = new(big.Int)
+	}
+	s := &Service{
+		config:    config,
+		ctx:       ctx,
+		am:        am,
+		providers: make(map[string]MdcIntf),
+	}
+	current, err := s.provider(config.Provider)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+	s.current = current
+	return s, nil
+}
+
+// provider returns the provider of the given name, creating it on first use.
+// The caller must hold the lock.
+func (s *Service) provider(name string) (MdcIntf, error) {
+	if provider, ok := s.providers[name]; ok {
+		return provider, nil
+	}
+	var provider MdcIntf
+	switch name {
+	case MemoryProvider:
+		provider = NewMDCDemo(s.config.Payee, s.config.Fee)
+
+	case LevelDBProvider, SwarmProvider:
+		if s.db == nil {
+			db, err := s.ctx.OpenDatabase("mdc", databaseCache, databaseHandles)
+			if err != nil {
+				return nil, err
+			}
+			s.db = db
+		}
+		if name == LevelDBProvider {
+			provider = NewDBProvider(s.db, s.config.Payee, s.config.Fee)
+			break
+		}
+		params := storage.NewDefaultLocalStoreParams()
+		params.Init(s.ctx.ResolvePath("mdc-swarm"))
+		localStore, err := storage.NewLocalStore(params, nil)
+		if err != nil {
+			return nil, err
+		}
+		localStore.Validators = append(localStore.Validators, storage.NewContentAddressValidator(storage.MakeHashFunc(storage.DefaultHash)))
+		provider = NewSwarmProvider(s.db, storage.NewFileStore(localStore, storage.NewFileStoreParams()), s.config.Payee, s.config.Fee)
+
+	default:
+		return nil, fmt.Errorf("%v: %q", ErrUnknownProvider, name)
+	}
+	s.providers[name] = provider
+	return provider, nil
+}
+
+// SetProvider switches the service to the provider of the given name. Data and
+// receipts are not moved between providers.
+func (s *Service) SetProvider(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.provider(name)
+	if err != nil {
+		log.Error("Failed to switch data custody provider", "provider", name, "err", err)
+		return
+	}
+	s.current = provider
+	log.Info("Switched data custody provider", "provider", name)
+}
+
+func (s *Service) Terms() (common.Address, *big.Int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current.Terms()
+}
+
+func (s *Service) Put(address common.Address, hash common.Hash, value []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current.Put(address, hash, value)
+}
+
+func (s *Service) Get(address common.Address, hash common.Hash) ([]byte, error, uint64, uint16) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current.Get(address, hash)
+}
+
+func (s *Service) SendReceiption(address common.Address, receipt []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current.SendReceiption(address, receipt)
+}
+
+func (s *Service) Receipts(address common.Address) []*types.AccessReceipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current.Receipts(address)
+}
+
+// Protocols implements node.Service, the service runs no network protocol.
+func (s *Service) Protocols() []p2p.Protocol {
+	return nil
+}
+
+// APIs implements node.Service, returning the public mdc RPC namespace and the
+// data access methods of the private personal namespace.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "mdc",
+			Version:   "1.0",
+			Service:   NewPublicMdcAPI(s),
+			Public:    true,
+		}, {
+			Namespace: "personal",
+			Version:   "1.0",
+			Service:   NewPrivateMdcAPI(s, s.am),
+			Public:    false,
+		},
+	}
+}
+
+// Start implements node.Service.
+func (s *Service) Start(server *p2p.Server) error {
+	log.Info("Started data custody service", "provider", s.config.Provider, "payee", s.config.Payee, "fee", s.config.Fee)
+	return nil
+}
+
+// Stop implements node.Service, closing the providers and their database.
+func (s *Service) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, provider := range s.providers {
+		if provider, ok := provider.(*DBProvider); ok {
+			provider.Close()
+		}
+	}
+	s.providers = make(map[string]MdcIntf)
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+	return nil
+}
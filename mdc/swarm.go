@@ -0,0 +1,74 @@
+package mdc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/ethdb"
+	"github.com/EDXFund/MasterChain/swarm/storage"
+)
+
+// swarmTimeout is the time allowed to store or retrieve data in the swarm.
+const swarmTimeout = 10 * time.Second
+
+var swarmPrefix = []byte("mdc-w") // swarmPrefix + hash -> swarm address
+
+// swarmKey = swarmPrefix + hash
+func swarmKey(hash common.Hash) []byte {
+	return append(swarmPrefix, hash.Bytes()...)
+}
+
+// swarmBlobs keeps data in a swarm chunk store, indexing the swarm address of
+// every hash in the database of the provider.
+type swarmBlobs struct {
+	db    ethdb.Database
+	store *storage.FileStore
+}
+
+func (b *swarmBlobs) put(hash common.Hash, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), swarmTimeout)
+	defer cancel()
+
+	addr, wait, err := b.store.Store(ctx, bytes.NewReader(value), int64(len(value)), false)
+	if err != nil {
+		return err
+	}
+	if err := wait(ctx); err != nil {
+		return err
+	}
+	return b.db.Put(swarmKey(hash), addr)
+}
+
+func (b *swarmBlobs) get(hash common.Hash) ([]byte, error) {
+	addr, err := b.db.Get(swarmKey(hash))
+	if err != nil || len(addr) == 0 {
+		return nil, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), swarmTimeout)
+	defer cancel()
+
+	reader, _ := b.store.Retrieve(ctx, storage.Address(addr))
+	size, err := reader.Size(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if _, err := reader.ReadAt(value, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (b *swarmBlobs) close() {
+	b.store.Close()
+}
+
+// NewSwarmProvider creates a provider paid to payee, which keeps the data in the
+// given swarm store and the sessions and receipts of its readers in db.
+func NewSwarmProvider(db ethdb.Database, store *storage.FileStore, payee common.Address, fee *big.Int) *DBProvider {
+	return newDBProvider(db, &swarmBlobs{db: db, store: store}, payee, fee)
+}
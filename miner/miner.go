@@ -140,9 +140,6 @@ func (self *Miner) HashRate() uint64 {
 	}
 	return 0
 }
-func (self *Miner) SetupShardExps(exp uint16, enabled [32]byte) {
-	self.worker.SetupShardExps(exp, enabled)
-}
 func (self *Miner) SetExtra(extra []byte) error {
 	if uint64(len(extra)) > params.MaximumExtraDataSize {
 		return fmt.Errorf("Extra exceeds max length. %d > %v", len(extra), params.MaximumExtraDataSize)
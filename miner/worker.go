@@ -23,8 +23,7 @@ import (
 	"fmt"
 	"github.com/EDXFund/MasterChain/core/rawdb"
 	"github.com/EDXFund/MasterChain/core/vm"
-	"github.com/hashicorp/golang-lru"
-	"math"
+	"reflect"
 
 	//"github.com/golang/dep/gps"
 	"math/big"
@@ -44,8 +43,6 @@ import (
 )
 
 const (
-	//cache size for recently caculated txs, about for one block
-	txCacheSize = 2560
 	// resultQueueSize is the size of channel listening to sealing result.
 	resultQueueSize = 10
 
@@ -97,10 +94,12 @@ type environment struct {
 	gasPool   *core.GasPool  // available gas used to pack transactions
 
 	header       types.HeaderIntf
+	master       types.HeaderIntf // master header routing the shard transactions
 	txs          []*types.Transaction
 	shards       []*types.ShardBlockInfo
 	results      []*types.ContractResult
 	receipts     []*types.Receipt
+	rejected     []*types.RejectedTx
 	prevSealHash common.Hash
 	prevTxsHash  common.Hash
 	stopEngineCh chan struct{}
@@ -213,11 +212,8 @@ type worker struct {
 	exitFuncs   []E_EFuncs
 	enterFuncs  []E_EFuncs
 	timer       *time.Timer
-	txsCache    *lru.Cache //cache for recent caculated txs
 	recommit    time.Duration
 	timedelay   time.Duration
-	nextExp     uint16
-	nextEnabled [32]byte
 }
 
 func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, recommit time.Duration, gasFloor, gasCeil uint64, isLocalBlock func(types.BlockIntf) bool, shardId uint16) *worker {
@@ -251,8 +247,6 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend,
 		timer:              time.NewTimer(0),
 		recommit:           10000000,
 		timedelay:          10000000,
-		nextExp:            0,
-		nextEnabled:        [32]byte{1},
 	}
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
@@ -268,7 +262,6 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend,
 
 	}
 
-	worker.txsCache, _ = lru.New(txCacheSize)
 	// Sanitize recommit interval if the user-specified one is too short.
 	if recommit < minRecommitInterval {
 		log.Warn("Sanitizing miner recommit interval", "provided", recommit, "updated", minRecommitInterval)
@@ -378,16 +371,26 @@ func (w *worker) shardBuildEnvironment() types.BlockIntf {
 		time.Sleep(wait)
 	}
 
+	// Route by the local master head, unless it fell behind the parent's reference
+	master := w.chain.CurrentMasterHeader()
+	if ref := parent.Header(); master.NumberU64() < ref.ToSHeader().MasterNumber() {
+		if master = w.chain.RoutingHeader(ref); master == nil {
+			log.Error("Failed to retrieve parent master reference", "number", parent.NumberU64())
+			return nil
+		}
+	}
 	num := parent.Number()
 	var header types.HeaderIntf
 	sheader := new(types.SHeader)
 	sheader.FillBy(&types.SHeaderStruct{
-		ShardId:    w.chain.ShardId(),
-		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
-		GasLimit:   core.CalcGasLimit(parent, w.gasFloor, w.gasCeil),
-		Extra:      w.extra,
-		Time:       big.NewInt(timestamp),
+		ShardId:      w.chain.ShardId(),
+		ParentHash:   parent.Hash(),
+		MasterHash:   master.Hash(),
+		MasterNumber: master.NumberU64(),
+		Number:       num.Add(num, common.Big1),
+		GasLimit:     core.CalcGasLimit(parent, w.gasFloor, w.gasCeil),
+		Extra:        w.extra,
+		Time:         big.NewInt(timestamp),
 	})
 
 	header = sheader
@@ -413,6 +416,7 @@ func (w *worker) shardBuildEnvironment() types.BlockIntf {
 		log.Error("Failed to create mining context", "err", err)
 		return nil
 	}
+	w.current.master = master
 	// Fill the block with all available pending transactions.
 
 	if err != nil {
@@ -443,10 +447,6 @@ func (w *worker) shardBuildEnvironment() types.BlockIntf {
 		return block
 	}
 }
-func (self *worker) SetupShardExps(exp uint16, enabled [32]byte) {
-	self.nextExp = exp
-	self.nextEnabled = enabled
-}
 func (w *worker) masterBuildEnvironment() types.BlockIntf {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
@@ -482,36 +482,22 @@ func (w *worker) masterBuildEnvironment() types.BlockIntf {
 	})
 	header = header_
 
-	shardExp := parent.ShardExp()
-	if w.nextExp > shardExp {
-		shardExp = w.nextExp
-	}
-	shardEnabled := parent.ShardEnabled()
-	for i := 0; i < 32; i++ {
-		shardEnabled[i] |= w.nextEnabled[i]
-	}
+	//setup the shard layout, which only changes at epoch boundaries
+	layout := w.chain.ShardLayout(parent.Header())
+	header_.SetShardExp(layout.Exp)
+	header_.SetShardEnabled(layout.Enabled)
 
-	type SHARD struct {
-		shardId uint16
-		number  uint64
-	}
 	shardInfo, err := w.eth.ShardPool().Pending()
 
-	//build shard enabled
-	for shardId, _ := range shardInfo {
-		seg := shardId >> 3
-		offset := shardId % 8
-		//if shardBlock
-		shardEnabled[seg] |= 0x01 << offset
-		if shardId > uint16(math.Pow(2, float64(shardExp))) {
-			shardExp = shardExp + 1
+	//only blocks of enabled shards may be packed
+	layouts := core.AcceptedLayouts(w.chain, header)
+	for shardId := range shardInfo {
+		if !layouts.IsEnabled(shardId) {
+			log.Debug("Skipping blocks of disabled shard", "shard", shardId)
+			delete(shardInfo, shardId)
 		}
 	}
 
-	//setup shardExp
-	header_.SetShardExp(shardExp)
-	header_.SetShardEnabled(shardEnabled)
-
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
 	if w.isRunning() {
 		if w.coinbase == (common.Address{}) {
@@ -975,7 +961,7 @@ func (w *worker) updateSnapshot() {
 */
 func (w *worker) shardCommitTransaction(tx *types.Transaction, coinbase common.Address, gasPool *core.GasPool, gasUsed *uint64) (*types.ContractResult, error) {
 
-	result, err := core.ApplyToInstruction(w.config, w.current.header, tx, gasPool, gasUsed)
+	result, err := core.ApplyToInstruction(w.config, w.chain, w.chain, w.current.master, w.current.state, w.current.header, tx, gasPool, gasUsed, vm.Config{})
 	if err != nil {
 
 		return nil, err
@@ -1031,59 +1017,51 @@ func (w *worker) shardCommitTransactions(txs *types.TransactionsByPriceAndNonce,
 		if tx == nil {
 			break
 		}
+		// Error may be ignored here. The error has already been checked
+		// during transaction acceptance is the transaction pool.
 		//
-		if txResult, ok := w.txsCache.Get(tx.Hash()); ok {
-			coalescedResults = append(coalescedResults, txResult.(*types.ContractResult))
-			txs.Shift()
-		} else { //recaculate
-			// Error may be ignored here. The error has already been checked
-			// during transaction acceptance is the transaction pool.
-			//
-			// We use the eip155 signer regardless of the current hf.
-			from, _ := types.Sender(w.current.signer, tx)
-			// Check whether the tx is replay protected. If we're not in the EIP155 hf
-			// phase, start ignoring the sender until we do.
-			if tx.Protected() && !w.config.IsEIP155(w.current.header.Number()) {
-				log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", w.config.EIP155Block)
-
-				txs.Pop()
-				continue
-			}
-			// Start executing the transaction
-			w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
-
-			logs, err := w.shardCommitTransaction(tx, coinbase, w.current.gasPool, &gasUsed)
-			switch err {
-			case core.ErrGasLimitReached:
-				// Pop the current out-of-gas transaction without shifting in the next from the account
-				log.Trace("Gas limit exceeded for current block", "sender", from)
-				txs.Pop()
-
-			case core.ErrNonceTooLow:
-				// New head notification data race between the transaction pool and miner, shift
-				log.Trace("Skipping transaction with low nonce", "sender", from, "nonce", tx.Nonce())
-				txs.Shift()
-
-			case core.ErrNonceTooHigh:
-				// Reorg notification data race between the transaction pool and miner, skip account =
-				log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
-				txs.Pop()
-
-			case nil:
-				// Everything ok, collect the logs and shift in the next transaction from the same account
-				coalescedResults = append(coalescedResults, logs)
-				w.current.tcount++
-				w.txsCache.Add(tx.Hash(), logs)
-				txs.Shift()
-
-			default:
-				// Strange error, discard the transaction and get the next in line (note, the
-				// nonce-too-high clause will prevent us from executing in vain).
-				log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
-				txs.Shift()
-			}
+		// We use the eip155 signer regardless of the current hf.
+		from, _ := types.Sender(w.current.signer, tx)
+		// Check whether the tx is replay protected. If we're not in the EIP155 hf
+		// phase, start ignoring the sender until we do.
+		if tx.Protected() && !w.config.IsEIP155(w.current.header.Number()) {
+			log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", w.config.EIP155Block)
+
+			txs.Pop()
+			continue
 		}
+		// Start executing the transaction
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		logs, err := w.shardCommitTransaction(tx, coinbase, w.current.gasPool, &gasUsed)
+		switch err {
+		case core.ErrGasLimitReached:
+			// Pop the current out-of-gas transaction without shifting in the next from the account
+			log.Trace("Gas limit exceeded for current block", "sender", from)
+			txs.Pop()
+
+		case core.ErrNonceTooLow:
+			// New head notification data race between the transaction pool and miner, shift
+			log.Trace("Skipping transaction with low nonce", "sender", from, "nonce", tx.Nonce())
+			txs.Shift()
+
+		case core.ErrNonceTooHigh:
+			// Reorg notification data race between the transaction pool and miner, skip account =
+			log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
+			txs.Pop()
 
+		case nil:
+			// Everything ok, collect the logs and shift in the next transaction from the same account
+			coalescedResults = append(coalescedResults, logs)
+			w.current.tcount++
+			txs.Shift()
+
+		default:
+			// Strange error, discard the transaction and get the next in line (note, the
+			// nonce-too-high clause will prevent us from executing in vain).
+			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
+			txs.Shift()
+		}
 	}
 	w.current.header.SetGasUsed(gasUsed)
 	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
@@ -1143,51 +1121,37 @@ func (w *worker) masterProcessShards(blocks types.BlockIntfs, coinbase common.Ad
 
 	defer f.Close()
 	*/
-	//log.Trace("Process shard blocks:"," count:",blocks)
-	for _, block := range blocks {
-		//   if len(blocks) > 0 {
-		fmt.Println("proc instr: ", "shardId:", block.ShardId(), "number:", block.NumberU64(), " txs:", len(block.Results()))
-
-		//	f.WriteString(str)
-		for _, instruction := range block.Results() {
-
-			if instruction.TxType == core.TT_COMMON {
-
-				tx := w.eth.TxPool().Get(instruction.TxHash)
-				w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
-				shardBase := block.Coinbase()
-				logs, err := w.masterCommitTransaction(tx, coinbase, &shardBase, &gasUsed)
-				switch err {
-				case core.ErrGasLimitReached:
-					// Pop the current out-of-gas transaction without shifting in the next from the account
-					log.Trace("Gas limit exceeded for current block", "sender")
-
-				case core.ErrNonceTooLow:
-					// New head notification data race between the transaction pool and miner, shift
-					log.Trace("Skipping transaction with low nonce", "sender", "nonce", tx.Nonce())
-
-				case core.ErrNonceTooHigh:
-					// Reorg notification data race between the transaction pool and miner, skip account =
-					log.Trace("Skipping account with hight nonce", "sender", "nonce", tx.Nonce())
-
-				case nil:
-					// Everything ok, collect the logs and shift in the next transaction from the same account
-					coalescedLogs = append(coalescedLogs, logs...)
-					w.current.tcount++
-
-				default:
-					// Strange error, discard the transaction and get the next in line (note, the
-					// nonce-too-high clause will prevent us from executing in vain).
-					log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
-
-				}
-				txs_proc++
-			}
-
+	// Shard blocks are applied exactly as the processor of an importing node
+	// would, so that a failing block is left out instead of invalidating ours
+	processor := core.NewStateProcessor(w.config, w.chain, w.engine, w.eth.TxPool())
+	shards := make([]*types.ShardBlockInfo, 0, len(w.current.shards))
+	for i, block := range blocks {
+		if block == nil || reflect.ValueOf(block).IsNil() {
+			continue
 		}
-
+		if rawdb.ReadInvalidShardBlock(w.eth.ChainDb(), block.Hash()) != (common.Hash{}) {
+			log.Debug("Skipping invalid shard block", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash())
+			continue
+		}
+		snap := w.current.state.Snapshot()
+		used := gasUsed
+		receipts, rejected, logs, _, err := processor.MasterProcessShardBlock(block, w.current.state, vm.Config{}, w.current.header.GasLimit(), &used)
+		if err != nil {
+			log.Debug("Shard block failed, skipped", "shard", block.ShardId(), "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+			w.current.state.RevertToSnapshot(snap)
+			continue
+		}
+		gasUsed = used
+		shards = append(shards, w.current.shards[i])
+		w.current.receipts = append(w.current.receipts, receipts...)
+		w.current.rejected = append(w.current.rejected, rejected...)
+		w.current.tcount += len(receipts)
+		coalescedLogs = append(coalescedLogs, logs...)
+		txs_proc += len(block.Results())
 	}
+	w.current.shards = shards
 	w.current.header.SetGasUsed(gasUsed)
+	w.current.header.ToHeader().SetBloomRejected(types.CreateRejectBloom(w.current.rejected))
 	if !w.isRunning() && len(coalescedLogs) > 0 {
 		// We don't push the pendingLogsEvent while we are mining. The reason is that
 		// when we are mining, the worker will regenerate a mining block every 3 seconds.
@@ -1215,26 +1179,6 @@ func (w *worker) masterProcessShards(blocks types.BlockIntfs, coinbase common.Ad
 	return false
 }
 
-func (w *worker) masterCommitTransaction(tx *types.Transaction, coinbase common.Address, shardBase *common.Address, gasUsed *uint64) ([]*types.Log, error) {
-
-	snap := w.current.state.Snapshot()
-	if w.current.gasPool == nil {
-		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit())
-	}
-
-	receipt, _, err := core.ApplyTransaction(w.config, w.chain, &coinbase, w.current.gasPool, shardBase, w.current.state, w.current.header, tx, gasUsed, vm.Config{})
-	if err != nil {
-		w.current.state.RevertToSnapshot(snap)
-		return nil, err
-	}
-	w.current.txs = append(w.current.txs, tx)
-	w.current.receipts = append(w.current.receipts, receipt)
-	/*	str := fmt.Sprintf("%v,%v\r\n",tx.Hash(),*receipt)
-		f.WriteString(str)
-	*/
-	return receipt.Logs, nil
-}
-
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(interval func(), update bool, start time.Time) (types.BlockIntf, error) {
@@ -306,9 +306,9 @@ func testSingleTransaction(t *testing.T, chainConfig *params.ChainConfig, engine
 		DistributeTxs(len_accounts, master, sender, shards)
 		/*
 			master.backend.txPool.AddLocals([]*types.Transaction{tx2,tx3})
-			shard2 := master.backend.chain.TxShardByHash(tx2.Hash())
-			shard3 := master.backend.chain.TxShardByHash(tx3.Hash())
-			//shard4 := master.backend.chain.TxShardByHash(tx4.Hash())
+			shard2, _ := master.backend.chain.TxShard(master.backend.chain.CurrentMasterHeader(), tx2)
+			shard3, _ := master.backend.chain.TxShard(master.backend.chain.CurrentMasterHeader(), tx3)
+			//shard4, _ := master.backend.chain.TxShard(master.backend.chain.CurrentMasterHeader(), tx4)
 			shards[shard2].backend.txPool.AddLocals([]*types.Transaction{tx2})
 			shards[shard3].backend.txPool.AddLocals([]*types.Transaction{tx3})
 
@@ -371,7 +371,7 @@ func DistributeTxs(len_accounts int, master *TestWorker, sender []Account, shard
 			for j := 0; j < len_accounts; j++ {
 				tx := sender[i].txs[j]
 
-				shard := master.backend.chain.TxShardByHash(tx.Hash())
+				shard, _ := master.backend.chain.TxShard(master.backend.chain.CurrentMasterHeader(), tx)
 				if shardTxs[shard] == nil {
 					shardTxs[shard] = []*types.Transaction{}
 				}
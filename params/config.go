@@ -371,6 +371,13 @@ func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatEr
 	return err
 }
 
+// NewShardCompatError returns the error raised if the genesis block of a shard
+// chain changed after the given master block included the first block of that
+// shard.
+func NewShardCompatError(shardId uint16, included uint64) *ConfigCompatError {
+	return newCompatError(fmt.Sprintf("shard %d genesis", shardId), new(big.Int).SetUint64(included), nil)
+}
+
 func (err *ConfigCompatError) Error() string {
 	return fmt.Sprintf("mismatching %s in database (have %d, want %d, rewindto %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindTo)
 }
@@ -85,6 +85,15 @@ const (
 	Bn256ScalarMulGas       uint64 = 40000  // Gas needed for an elliptic curve scalar multiplication
 	Bn256PairingBaseGas     uint64 = 100000 // Base price for an elliptic curve pairing check
 	Bn256PairingPerPointGas uint64 = 80000  // Per-point price for an elliptic curve pairing check
+
+	// Shard layout
+
+	ShardEpochLength      uint64 = 1024 // Number of master blocks between two changes of the shard layout
+	ShardTransitionLength uint64 = 64   // Number of master blocks after a layout change during which the old shard of a transaction still accepts it
+	ShardSplitLoad        uint64 = 80   // Load of a shard, in percent of its gas limit, above which it is split
+	ShardMergeLoad        uint64 = 30   // Combined load of a leaf shard and its parent, in percent, below which they are merged
+	MaxShardExp           uint16 = 8    // Maximum number of routing key bits, bounded by the 256 bits of ShardEnabled
+	ShardTxConfirmations  uint64 = 12   // Number of master blocks on top of the one referencing a shard block before its transactions are final
 )
 
 var (
@@ -0,0 +1,136 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package qchain
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/event"
+	"github.com/EDXFund/MasterChain/log"
+)
+
+// SubscribeShardHeadEvent registers a subscription of ShardChainHeadEvent, fired
+// whenever the master chain confirms a new head of a shard chain.
+func (scp *ShardChainPool) SubscribeShardHeadEvent(ch chan<- core.ShardChainHeadEvent) event.Subscription {
+	return scp.scope.Track(scp.shardHeadFeed.Subscribe(ch))
+}
+
+// writeCanonical makes the confirmed shard block the head of the canonical chain
+// of its shard, writing the canonical hashes and total difficulties of all its
+// ancestors not yet marked canonical and dropping the ones beyond it.
+func (scp *ShardChainPool) writeCanonical(shardId uint16, hash common.Hash, number uint64) bool {
+	if rawdb.ReadCanonicalHash(scp.db, shardId, 0) == (common.Hash{}) {
+		if genesis := scp.bc.GenesisOfShard(shardId); genesis == nil || reflect.ValueOf(genesis).IsNil() {
+			log.Warn("Failed to commit shard genesis", "shard", shardId)
+			return false
+		}
+	}
+	// Gather the headers up to the last canonical ancestor, newest first
+	var headers []types.HeaderIntf
+	for h, n := hash, number; rawdb.ReadCanonicalHash(scp.db, shardId, n) != h; n-- {
+		header := rawdb.ReadHeader(scp.db, h, n)
+		if n == 0 || header == nil || reflect.ValueOf(header).IsNil() {
+			log.Warn("Unrooted confirmed shard chain", "shard", shardId, "number", n, "hash", h)
+			return false
+		}
+		headers = append(headers, header)
+		h = header.ParentHash()
+	}
+	batch := scp.db.NewBatch()
+	if len(headers) > 0 {
+		oldest := headers[len(headers)-1]
+		td := rawdb.ReadTd(scp.db, shardId, oldest.ParentHash(), oldest.NumberU64()-1)
+		if td == nil {
+			log.Warn("Missing shard total difficulty", "shard", shardId, "number", oldest.NumberU64()-1, "hash", oldest.ParentHash())
+			return false
+		}
+		for i := len(headers) - 1; i >= 0; i-- {
+			header := headers[i]
+			td = new(big.Int).Add(td, header.Difficulty())
+			rawdb.WriteTd(batch, shardId, header.Hash(), header.NumberU64(), td)
+			rawdb.WriteCanonicalHash(batch, shardId, header.Hash(), header.NumberU64())
+		}
+	}
+	for n := number + 1; rawdb.ReadCanonicalHash(scp.db, shardId, n) != (common.Hash{}); n++ {
+		rawdb.DeleteCanonicalHash(batch, shardId, n)
+	}
+	rawdb.WriteHeadHeaderHash(batch, shardId, hash)
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write canonical shard chain", "shard", shardId, "err", err)
+		return false
+	}
+	return true
+}
+
+// shardIndexerChain exposes the canonical chain of a single shard, as confirmed
+// by the master chain, to a chain indexer.
+type shardIndexerChain struct {
+	pool    *ShardChainPool
+	shardId uint16
+}
+
+// IndexerChain returns the canonical chain of a shard in the form a chain indexer
+// processes it.
+func (scp *ShardChainPool) IndexerChain(shardId uint16) core.ChainIndexerChain {
+	return &shardIndexerChain{pool: scp, shardId: shardId}
+}
+
+// CurrentHeader retrieves the last confirmed header of the shard, falling back to
+// its genesis header.
+func (c *shardIndexerChain) CurrentHeader() types.HeaderIntf {
+	db := c.pool.db
+	if hash := rawdb.ReadHeadHeaderHash(db, c.shardId); hash != (common.Hash{}) {
+		if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+			if header := rawdb.ReadHeader(db, hash, *number); header != nil && !reflect.ValueOf(header).IsNil() {
+				return header
+			}
+		}
+	}
+	return rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, c.shardId, 0), 0)
+}
+
+// SubscribeChainHeadEvent subscribes to the confirmed heads of the shard.
+func (c *shardIndexerChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		heads := make(chan core.ShardChainHeadEvent, 10)
+		sub := c.pool.SubscribeShardHeadEvent(heads)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-heads:
+				if ev.Block.ShardId() != c.shardId {
+					continue
+				}
+				select {
+				case ch <- core.ChainHeadEvent{Block: ev.Block}:
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	})
+}
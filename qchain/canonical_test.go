@@ -0,0 +1,104 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package qchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+)
+
+// checkCanonical checks that the canonical chain of a shard is made of the given
+// headers on top of its genesis, headed by the last of them, with the expected
+// total difficulties.
+func checkCanonical(t *testing.T, stage string, db ethdb.Database, shardId uint16, genesis types.HeaderIntf, headers []types.HeaderIntf) {
+	td := new(big.Int).Set(genesis.Difficulty())
+	for i, header := range headers {
+		number := uint64(i + 1)
+		if hash := rawdb.ReadCanonicalHash(db, shardId, number); hash != header.Hash() {
+			t.Errorf("%s: canonical hash #%d mismatch: have %x, want %x", stage, number, hash, header.Hash())
+		}
+		td.Add(td, header.Difficulty())
+		if have := rawdb.ReadTd(db, shardId, header.Hash(), number); have == nil || have.Cmp(td) != 0 {
+			t.Errorf("%s: total difficulty #%d mismatch: have %v, want %v", stage, number, have, td)
+		}
+	}
+	if hash := rawdb.ReadCanonicalHash(db, shardId, uint64(len(headers)+1)); hash != (common.Hash{}) {
+		t.Errorf("%s: canonical hash beyond the head left behind: %x", stage, hash)
+	}
+	if head := rawdb.ReadHeadHeaderHash(db, shardId); head != headers[len(headers)-1].Hash() {
+		t.Errorf("%s: head hash mismatch: have %x, want %x", stage, head, headers[len(headers)-1].Hash())
+	}
+}
+
+// Tests that confirmed shard heads are made canonical along with their missing
+// ancestors, reorging the chain of the shard if needed, and that confirmations
+// which cannot be rooted in the canonical chain leave it untouched.
+func TestWriteCanonical(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		pool    = &ShardChainPool{db: db}
+		shardId = uint16(1)
+		genesis = new(types.SHeader)
+	)
+	genesis.FillBy(&types.SHeaderStruct{ShardId: shardId, Number: new(big.Int), Difficulty: big.NewInt(1), Time: new(big.Int)})
+	rawdb.WriteHeader(db, genesis)
+	rawdb.WriteTd(db, shardId, genesis.Hash(), 0, genesis.Difficulty())
+	rawdb.WriteCanonicalHash(db, shardId, genesis.Hash(), 0)
+
+	chain := makeShardHeaders(shardId, genesis, 5, 1)
+	fork := makeShardHeaders(shardId, chain[1], 2, 1)
+	for _, header := range append(append([]types.HeaderIntf{}, chain...), fork...) {
+		rawdb.WriteHeader(db, header)
+	}
+	// Confirm a head on top of the genesis, then a shorter fork of it
+	if !pool.writeCanonical(shardId, chain[4].Hash(), chain[4].NumberU64()) {
+		t.Fatalf("failed to make chain canonical")
+	}
+	checkCanonical(t, "chain", db, shardId, genesis, chain)
+
+	if !pool.writeCanonical(shardId, fork[1].Hash(), fork[1].NumberU64()) {
+		t.Fatalf("failed to make fork canonical")
+	}
+	reorged := append(append([]types.HeaderIntf{}, chain[:2]...), fork...)
+	checkCanonical(t, "fork", db, shardId, genesis, reorged)
+
+	// Confirming the current head again changes nothing
+	if !pool.writeCanonical(shardId, fork[1].Hash(), fork[1].NumberU64()) {
+		t.Fatalf("failed to reconfirm head")
+	}
+	checkCanonical(t, "reconfirmed", db, shardId, genesis, reorged)
+
+	// A head whose header is missing cannot be confirmed
+	missing := makeShardHeaders(shardId, fork[1], 1, 1)[0]
+	if pool.writeCanonical(shardId, missing.Hash(), missing.NumberU64()) {
+		t.Errorf("head without header made canonical")
+	}
+	checkCanonical(t, "missing header", db, shardId, genesis, reorged)
+
+	// Neither can a fork whose canonical ancestor has no total difficulty
+	rawdb.DeleteTd(db, shardId, chain[1].Hash(), chain[1].NumberU64())
+	if pool.writeCanonical(shardId, chain[3].Hash(), chain[3].NumberU64()) {
+		t.Errorf("head without ancestor total difficulty made canonical")
+	}
+	rawdb.WriteTd(db, shardId, chain[1].Hash(), chain[1].NumberU64(), big.NewInt(3))
+	checkCanonical(t, "missing total difficulty", db, shardId, genesis, reorged)
+}
@@ -27,15 +27,16 @@ import (
 	"github.com/pkg/errors"
 	"math/big"
 	"reflect"
-	"sort"
 	"sync"
 )
 
 type HeaderTree struct {
 	self     types.HeaderIntf
+	td       uint64 // Total difficulty of self, cached when the node is linked
 	children *list.List
 	//for quick search
 	parent *HeaderTree
+	rooted bool // Whether the node belongs to the tree of the confirmed root
 	wg     sync.RWMutex
 	owner  *HeaderTreeManager
 }
@@ -49,6 +50,7 @@ func NewHeaderTree(root types.HeaderIntf, owner *HeaderTreeManager) *HeaderTree
 }
 
 func (t *HeaderTree) Header() types.HeaderIntf { return t.self }
+func (t *HeaderTree) Td() uint64               { return t.td }
 func (t *HeaderTree) Children() *list.List     { return t.children }
 func (t *HeaderTree) Parent() *HeaderTree      { return t.parent }
 func (t *HeaderTree) FindHeader(node types.HeaderIntf, compare func(n1, n2 types.HeaderIntf) bool) *HeaderTree {
@@ -70,86 +72,62 @@ func (t *HeaderTree) findHeader(node types.HeaderIntf, compare func(n1, n2 types
 		return res
 	}
 }
-func (t *HeaderTree) AddHeader(node types.HeaderIntf) bool {
+
+// addChild links node under t, deriving its total difficulty from the one
+// cached on t, and returns the new tree node.
+func (t *HeaderTree) addChild(node types.HeaderIntf) *HeaderTree {
 	t.wg.Lock()
 	defer t.wg.Unlock()
-	return t.addHeader(node)
-}
 
-//insert node , whose parent
-func (t *HeaderTree) addHeader(node types.HeaderIntf) bool {
+	child := NewHeaderTree(node, t.owner)
+	child.link(t)
+	t.children.PushBack(child)
+	return child
+}
 
-	//check for existing node
-	if t.self.Hash() == node.Hash() {
-		return true
-	}
-	//else check and add to its parent
-	parent := t.findHeader(node, func(n1, n2 types.HeaderIntf) bool {
-		return n1.Hash() == n2.ParentHash()
+// link attaches t to parent, recomputing and storing the total difficulties of
+// all the nodes of t against the one cached on parent.
+func (t *HeaderTree) link(parent *HeaderTree) {
+	t.parent = parent
+	t.walk(func(node *HeaderTree) {
+		node.td = node.parent.td + node.self.Difficulty().Uint64()
+		node.rooted = node.parent.rooted
+		rawdb.WriteTd(t.owner.db, node.self.ShardId(), node.self.Hash(), node.self.NumberU64(), new(big.Int).SetUint64(node.td))
 	})
-	if parent != nil {
-
-		exist := false
-		for i := parent.children.Front(); i != nil; i = i.Next() {
-			if i.Value.(*HeaderTree).self.Hash() == node.Hash() {
-				exist = true
-				break
-			}
-		}
-		if !exist {
+}
 
-			rawdb.WriteTd(t.owner.db, node.ShardId(), node.Hash(), node.NumberU64(), big.NewInt(0).Add(big.NewInt(int64(t.owner.GetTd(parent.self))), node.Difficulty()))
-			parent.children.PushBack(&HeaderTree{self: node, children: list.New(), parent: parent, owner: t.owner})
+// detach unlinks t from its parent, making it the root of a tree of its own.
+func (t *HeaderTree) detach() {
+	if t.parent == nil {
+		return
+	}
+	parent := t.parent
+	parent.wg.Lock()
+	for it := parent.children.Front(); it != nil; it = it.Next() {
+		if it.Value.(*HeaderTree) == t {
+			parent.children.Remove(it)
+			break
 		}
-
-		//make a HeaderTree
-		return true
-	} else {
-		return false
 	}
+	parent.wg.Unlock()
+	t.parent = nil
 }
 
-//cut all branch's except root by node ,return a HeaderTree with node as root
-func (t *HeaderTree) ShrinkToBranch(node types.HeaderIntf) *HeaderTree {
-	t.wg.Lock()
-	defer t.wg.Unlock()
-	parent := t.findHeader(node, func(n1, n2 types.HeaderIntf) bool {
-		if n1.Hash() == n2.ParentHash() {
-			return true
-		} else {
-			return false
-		}
-	})
-	if parent != nil {
-		var result *HeaderTree = nil
-		for it := parent.Children().Front(); it != nil; it = it.Next() {
-			if it.Value.(*HeaderTree).self.Hash() == node.Hash() {
-				result = it.Value.(*HeaderTree)
-				parent.Children().Remove(it)
-				break
-			}
-		}
-		return result
-
-	} else {
-		if t.self.Hash() == node.Hash() {
-			return t
-		} else {
-			return nil
-		}
+// walk calls fn on t and all of its descendants, parents before children.
+func (t *HeaderTree) walk(fn func(node *HeaderTree)) {
+	fn(t)
+	for it := t.children.Front(); it != nil; it = it.Next() {
+		it.Value.(*HeaderTree).walk(fn)
 	}
 }
 
 //found max td return (td, the longest tree node)
 func (t *HeaderTree) getMaxTdPath() (uint64, *HeaderTree) {
-	td := t.owner.GetTd(t.self)
-
 	maxTd := uint64(0)
 	var maxHeader *HeaderTree
 	maxHeader = nil
 	for i := t.children.Front(); i != nil; i = i.Next() {
 		curTd, node := i.Value.(*HeaderTree).getMaxTdPath()
-		//fmt.Println("node hash: %V, td: %V",node.self.Hash(),curTd)
 		if curTd > maxTd {
 			maxHeader = node
 			maxTd = curTd
@@ -158,7 +136,7 @@ func (t *HeaderTree) getMaxTdPath() (uint64, *HeaderTree) {
 	if maxHeader != nil {
 		return maxTd, maxHeader
 	} else {
-		return td, t
+		return t.td, t
 	}
 }
 
@@ -167,9 +145,7 @@ func (t *HeaderTree) GetMaxTdPath(node types.HeaderIntf) *HeaderTree {
 	t.wg.Lock()
 	defer t.wg.Unlock()
 	if node != nil {
-		nodeTree := t.findHeader(node, func(n1, n2 types.HeaderIntf) bool {
-			return n1.Hash() == n2.Hash()
-		})
+		nodeTree := t.owner.nodes[node.Hash()]
 		if nodeTree != nil {
 			_, node := nodeTree.getMaxTdPath()
 			return node
@@ -183,32 +159,6 @@ func (t *HeaderTree) GetMaxTdPath(node types.HeaderIntf) *HeaderTree {
 	}
 
 }
-func (t *HeaderTree) MergeTree(newT *HeaderTree) bool {
-	t.wg.Lock()
-	defer t.wg.Unlock()
-	return t.mergeTree(newT)
-}
-func (t *HeaderTree) mergeTree(newT *HeaderTree) bool {
-	parent := t.findHeader(newT.self, func(n1, n2 types.HeaderIntf) bool {
-		return n1.Hash() == n2.ParentHash()
-	})
-	if parent != nil {
-		//check for duplication
-		duplication := false
-		for i := t.children.Front(); i != nil; i = i.Next() {
-			if i.Value.(*HeaderTree).self.Hash() == newT.self.Hash() {
-				duplication = true
-			}
-		}
-		if !duplication {
-			parent.children.PushBack(newT)
-		}
-
-		return !duplication
-	} else {
-		return false
-	}
-}
 
 func (t *HeaderTree) dfIterator(check func(node types.HeaderIntf) bool) bool {
 	if check(t.self) {
@@ -290,10 +240,10 @@ func (t *HeaderTree) remove(node types.HeaderIntf, removeHeader bool) {
 	if target != nil {
 
 		for i := target.children.Front(); i != nil; i = i.Next() {
-			i.Value.(*HeaderTree).Remove(nil, false)
+			t.owner.unindex(i.Value.(*HeaderTree))
 		}
 		target.children.Init()
-		if node != nil && removeHeader {
+		if node != nil && removeHeader && target.parent != nil {
 			ls := target.parent.children
 			for it := ls.Front(); it != nil; it = it.Next() {
 				if it.Value.(*HeaderTree).self.Hash() == node.Hash() {
@@ -301,6 +251,7 @@ func (t *HeaderTree) remove(node types.HeaderIntf, removeHeader bool) {
 					break
 				}
 			}
+			t.owner.unindex(target)
 		}
 	}
 
@@ -323,55 +274,109 @@ func (t *HeaderTree) getCount() int {
 type HeaderTreeManager struct {
 	shardId   uint16
 	trees     map[common.Hash]*HeaderTree
+	nodes     map[common.Hash]*HeaderTree   // Index of the nodes of all trees by header hash
+	orphans   map[common.Hash][]*HeaderTree // Trees waiting for the parent of their root, by parent hash
 	rootHash  common.Hash
+	best      *HeaderTree // Node of the highest total difficulty in the tree at rootHash
 	maxTd     types.HeaderIntf
 	confirmed []types.HeaderIntf
 
 	confirmedHash common.Hash
+	levels        map[uint64]map[common.Hash]struct{} // Hashes of the indexed nodes by number
+	dirty         map[uint64]struct{}                 // Numbers whose nodes changed since the forest was last stored
+	low, high     uint64                              // Range of the numbers holding nodes
 	db            ethdb.Database
 	tdCache       *lru.Cache
 }
 
+// NewHeaderTreeManager creates the manager of the header trees of a shard,
+// rebuilding the forest persisted by a previous run, if any.
 func NewHeaderTreeManager(shardId uint16, database ethdb.Database) *HeaderTreeManager {
 	htm := &HeaderTreeManager{
 		shardId:       shardId,
 		trees:         make(map[common.Hash]*HeaderTree),
+		nodes:         make(map[common.Hash]*HeaderTree),
+		orphans:       make(map[common.Hash][]*HeaderTree),
 		rootHash:      common.Hash{},
 		confirmed:     make([]types.HeaderIntf, 0),
 		confirmedHash: common.Hash{},
+		levels:        make(map[uint64]map[common.Hash]struct{}),
+		dirty:         make(map[uint64]struct{}),
 		db:            database,
 	}
 	htm.tdCache, _ = lru.New(sheaderCacheLimit)
-	confirmedHash, confirmedNumber, maxHash, maxNumber := rawdb.ReadLatestShardInfo(database, shardId)
-	headerToInsert := []types.HeaderIntf{}
-	if maxNumber != 0 {
-
-		hash := maxHash
-		number := maxNumber
-		for (hash != common.Hash{} && number > 0) {
-			headerInfo := rawdb.ReadHeader(database, hash, number)
-			if headerInfo != nil {
-				headerToInsert = append(headerToInsert, headerInfo)
-				if hash == confirmedHash || number == confirmedNumber {
-					break
-				}
-			} else {
-				break
-			}
+	if forest := rawdb.ReadHeaderForest(database, shardId); forest != nil {
+		htm.restore(forest)
+	}
+	return htm
+
+}
 
+// restore rebuilds the header trees of a persisted forest from the headers in the
+// database, dropping the nodes whose headers are gone.
+func (t *HeaderTreeManager) restore(forest *rawdb.HeaderForest) {
+	t.rootHash, t.confirmedHash = forest.Root, forest.Confirmed
+
+	var missing []uint64
+	restored := 0
+	for number := forest.Low; number <= forest.High; number++ {
+		for _, hash := range rawdb.ReadHeaderForestNodes(t.db, t.shardId, number) {
+			header := rawdb.ReadHeader(t.db, hash, number)
+			if header == nil || header.ShardId() != t.shardId {
+				missing = append(missing, number)
+				continue
+			}
+			t.AddNewHead(header)
+			restored++
 		}
 	}
-	sort.Sort(SortHead(headerToInsert))
-
-	htm.AddNewHeads(headerToInsert)
-	return htm
+	// Only the heights which lost nodes differ from the stored forest
+	t.dirty = make(map[uint64]struct{})
+	for _, number := range missing {
+		t.dirty[number] = struct{}{}
+	}
+	t.update()
+	log.Info("Restored shard header trees", "shard", t.shardId, "trees", len(t.trees), "headers", restored)
+}
 
+// persist stores the nodes of the heights changed since the forest was last
+// stored, along with its confirmed root.
+func (t *HeaderTreeManager) persist() {
+	batch := t.db.NewBatch()
+	for number := range t.dirty {
+		level := t.levels[number]
+		if len(level) == 0 {
+			rawdb.DeleteHeaderForestNodes(batch, t.shardId, number)
+			continue
+		}
+		hashes := make([]common.Hash, 0, len(level))
+		for hash := range level {
+			hashes = append(hashes, hash)
+		}
+		rawdb.WriteHeaderForestNodes(batch, t.shardId, number, hashes)
+	}
+	// Shrink the range of heights to the ones still holding nodes
+	for t.low < t.high && t.levels[t.low] == nil {
+		t.low++
+	}
+	for t.high > t.low && t.levels[t.high] == nil {
+		t.high--
+	}
+	rawdb.WriteHeaderForest(batch, t.shardId, &rawdb.HeaderForest{Root: t.rootHash, Confirmed: t.confirmedHash, Low: t.low, High: t.high})
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to persist shard header trees", "shard", t.shardId, "err", err)
+		return
+	}
+	t.dirty = make(map[uint64]struct{})
 }
 
 func (t *HeaderTreeManager) Trees() map[common.Hash]*HeaderTree  { return t.trees }
 func (t *HeaderTreeManager) TreeOf(hash common.Hash) *HeaderTree { return t.trees[hash] }
-func (t *HeaderTreeManager) SetRootHash(hash common.Hash)        { t.rootHash = hash }
+func (t *HeaderTreeManager) SetRootHash(hash common.Hash)        { t.setRoot(hash) }
 func (t *HeaderTreeManager) GetTd(header types.HeaderIntf) uint64 {
+	if node, ok := t.nodes[header.Hash()]; ok {
+		return node.td
+	}
 	td, ok := t.tdCache.Get(header.Hash())
 	if ok {
 		return td.(*big.Int).Uint64()
@@ -396,35 +401,63 @@ func (t *HeaderTreeManager) AddNewHeads(nodes []types.HeaderIntf) []types.Header
 	for _, val := range nodes {
 		t.AddNewHead(val)
 	}
+	return t.update()
+}
 
-	t.confirmed = []types.HeaderIntf{}
+// update recomputes the max td head and the confirmed headers of the forest and
+// persists the changes, returning the confirmed headers.
+func (t *HeaderTreeManager) update() []types.HeaderIntf {
 	//寻找最长链
-	if t.trees[t.rootHash] != nil {
-		node := t.trees[t.rootHash].GetMaxTdPath(nil)
-		t.maxTd = node.self
-		//fmt.Println(" new node,", node.self.Number().Uint64() )
-		if node.self.Number().Uint64()-t.trees[t.rootHash].self.Number().Uint64() > 5 {
-			//	fmt.Println(" new node" )
-			i := 0
-			for node.self != t.trees[t.rootHash].self {
-				node = node.parent
-				i++
-				if i > 5 {
-					t.confirmed = append(t.confirmed, node.self)
-				}
-			}
+	t.refreshBest()
+	if root := t.trees[t.rootHash]; root != nil && t.best != nil {
+		t.maxTd = t.best.self
+		t.confirm(root)
+	} else {
+		t.confirmed = []types.HeaderIntf{}
+	}
+	t.persist()
+
+	return t.confirmed
+}
 
+// confirm collects the ancestors of the max td head down to root which are at
+// least 6 blocks deep, sorted by number. The ones collected for a previous head
+// are kept if the new one descends from them, so that extending the chain only
+// walks the new headers.
+func (t *HeaderTreeManager) confirm(root *HeaderTree) {
+	if t.best.self.NumberU64()-root.self.NumberU64() <= 5 {
+		t.confirmed = []types.HeaderIntf{}
+		return
+	}
+	var (
+		limit = t.best.self.NumberU64() - 6
+		last  common.Hash
+	)
+	if n := len(t.confirmed); n > 0 && t.confirmed[0].Hash() == root.self.Hash() {
+		last = t.confirmed[n-1].Hash()
+	}
+	var (
+		fresh []types.HeaderIntf
+		node  = t.best
+	)
+	for ; node != nil; node = node.parent {
+		if node.self.NumberU64() > limit {
+			continue
 		}
-		if len(t.confirmed) > 0 {
-			rawdb.WriteLatestShardInfo(t.db, t.confirmed[0], t.maxTd)
-		} else {
-			rawdb.WriteLatestShardInfo(t.db, t.trees[t.rootHash].self, t.maxTd)
+		if node.self.Hash() == last {
+			break
+		}
+		fresh = append(fresh, node.self)
+		if node == root {
+			break
 		}
 	}
-
-	sort.Sort(SortHead(t.confirmed))
-
-	return t.confirmed
+	if node == nil || node.self.Hash() != last {
+		t.confirmed = make([]types.HeaderIntf, 0, len(fresh))
+	}
+	for i := len(fresh) - 1; i >= 0; i-- {
+		t.confirmed = append(t.confirmed, fresh[i])
+	}
 }
 
 func (t *HeaderTreeManager) GetMaxTd() (*types.ShardBlockInfo, error) {
@@ -442,18 +475,14 @@ func (t *HeaderTreeManager) GetMaxTd() (*types.ShardBlockInfo, error) {
 
 }
 func (t *HeaderTreeManager) AddNewHead(node types.HeaderIntf) {
-
-	var found *HeaderTree = nil
-	for _, tree := range t.trees {
-		if tree.AddHeader(node) {
-			found = tree
-			break
-		}
-	}
-	if (t.rootHash == common.Hash{}) {
-		t.rootHash = node.Hash()
+	if _, ok := t.nodes[node.Hash()]; ok {
+		return
 	}
-	if found == nil {
+	var added *HeaderTree
+	if parent, ok := t.nodes[node.ParentHash()]; ok {
+		added = parent.addChild(node)
+	} else {
+		added = NewHeaderTree(node, t)
 		if node.NumberU64() == 1 {
 			hash := rawdb.ReadCanonicalHash(t.db, types.ShardMaster, 0)
 			head := rawdb.ReadHeader(t.db, hash, 0)
@@ -462,65 +491,232 @@ func (t *HeaderTreeManager) AddNewHead(node types.HeaderIntf) {
 			}
 
 		}
-		found = NewHeaderTree(node, t)
-		t.trees[node.Hash()] = found
+		added.td = t.GetTd(node)
+		if (t.rootHash == common.Hash{}) {
+			t.rootHash = node.Hash()
+		}
+		added.rooted = node.Hash() == t.rootHash
+		t.addTree(added)
+	}
+	t.index(added)
+	t.track(added)
+
+	//do possible tree merge, the tree of the confirmed root is never merged
+	for _, tree := range t.orphans[node.Hash()] {
+		if tree.self.Hash() == t.rootHash {
+			continue
+		}
+		t.dropTree(tree)
+		added.wg.Lock()
+		tree.link(added)
+		added.children.PushBack(tree)
+		added.wg.Unlock()
+		tree.walk(t.track)
 	}
-	//do possible tree merge
-	for _, value := range t.trees {
-		if value.Header().ParentHash() == node.Hash() {
-			found.MergeTree(value)
+}
+
+// addTree registers tree as the root of a tree of its own.
+func (t *HeaderTreeManager) addTree(tree *HeaderTree) {
+	t.trees[tree.self.Hash()] = tree
+	parent := tree.self.ParentHash()
+	t.orphans[parent] = append(t.orphans[parent], tree)
+}
+
+// dropTree unregisters the root of a tree, leaving its nodes indexed.
+func (t *HeaderTreeManager) dropTree(tree *HeaderTree) {
+	delete(t.trees, tree.self.Hash())
+
+	parent := tree.self.ParentHash()
+	waiting := t.orphans[parent]
+	for i, orphan := range waiting {
+		if orphan == tree {
+			waiting = append(waiting[:i:i], waiting[i+1:]...)
 			break
 		}
 	}
+	if len(waiting) == 0 {
+		delete(t.orphans, parent)
+	} else {
+		t.orphans[parent] = waiting
+	}
+}
+
+// index adds node to the header index, flagging its height as changed.
+func (t *HeaderTreeManager) index(node *HeaderTree) {
+	hash, number := node.self.Hash(), node.self.NumberU64()
+	t.nodes[hash] = node
 
+	if len(t.levels) == 0 {
+		t.low, t.high = number, number
+	} else if number < t.low {
+		t.low = number
+	} else if number > t.high {
+		t.high = number
+	}
+	if t.levels[number] == nil {
+		t.levels[number] = make(map[common.Hash]struct{})
+	}
+	t.levels[number][hash] = struct{}{}
+	t.dirty[number] = struct{}{}
+}
+
+// unindex removes tree and all of its descendants from the header index,
+// flagging their heights as changed.
+func (t *HeaderTreeManager) unindex(tree *HeaderTree) {
+	tree.walk(func(node *HeaderTree) {
+		hash, number := node.self.Hash(), node.self.NumberU64()
+		delete(t.nodes, hash)
+		t.tdCache.Remove(hash)
+		node.rooted = false
+
+		if level := t.levels[number]; level != nil {
+			delete(level, hash)
+			if len(level) == 0 {
+				delete(t.levels, number)
+			}
+		}
+		t.dirty[number] = struct{}{}
+	})
+}
+
+// track makes node the max td head if it belongs to the tree of the confirmed
+// root and beats the current one.
+func (t *HeaderTreeManager) track(node *HeaderTree) {
+	if node.rooted && (t.best == nil || !t.best.rooted || node.td > t.best.td) {
+		t.best = node
+	}
+}
+
+// setRoot moves the root of the forest to the tree at hash, flagging its nodes
+// as the ones the max td head is chosen from.
+func (t *HeaderTreeManager) setRoot(hash common.Hash) {
+	if old := t.trees[t.rootHash]; old != nil && t.rootHash != hash {
+		old.walk(func(node *HeaderTree) { node.rooted = false })
+	}
+	t.rootHash = hash
+
+	if tree := t.trees[hash]; tree != nil && !tree.rooted {
+		tree.walk(func(node *HeaderTree) { node.rooted = true })
+	}
+	t.refreshBest()
+}
+
+// refreshBest keeps the max td head if it is still in the tree of the confirmed
+// root, searching that tree for a new one otherwise.
+func (t *HeaderTreeManager) refreshBest() {
+	if t.best != nil && t.best.rooted {
+		return
+	}
+	t.best = nil
+	if tree := t.trees[t.rootHash]; tree != nil {
+		_, t.best = tree.getMaxTdPath()
+	}
 }
 
 // remove shard block with given hash, do nothing if the block does not exist
 func (t *HeaderTreeManager) RemoveHead(node types.HeaderIntf) {
-	for _, value := range t.trees {
-		value.Remove(node, true)
-	}
+	t.RemoveHeadByHash(node.Hash())
 }
 
 func (t *HeaderTreeManager) RemoveHeadByHash(hash common.Hash) {
-	for _, value := range t.trees {
-		value.RemoveByHash(hash, true)
+	if target, ok := t.nodes[hash]; ok {
+		t.drop(target)
 	}
 }
 
-func (t *HeaderTreeManager) GetPendingCount() int {
-	count := 0
-	for _, val := range t.trees {
-		count += val.GetCount()
+// drop removes target and all of its descendants from the forest, returning the
+// removed headers.
+func (t *HeaderTreeManager) drop(target *HeaderTree) []types.HeaderIntf {
+	var dropped []types.HeaderIntf
+	target.walk(func(node *HeaderTree) {
+		dropped = append(dropped, node.self)
+	})
+	t.unindex(target)
+	if target.parent == nil {
+		t.dropTree(target)
+		if target.self.Hash() == t.rootHash {
+			t.rootHash = common.Hash{}
+		}
+	} else {
+		target.detach()
 	}
-	return count
+	t.refreshBest()
+	return dropped
 }
 
-//cut all node, only tree from node survived
-func (t *HeaderTreeManager) ReduceTo(node types.HeaderIntf) error {
-	invalidHashes := make([]common.Hash, 0, 1)
-	var newTree *HeaderTree = nil
-	for hash, val := range t.trees {
-		if val.self.Number().Uint64() < node.Number().Uint64() {
-			invalidHashes = append(invalidHashes, hash)
-			newHeader := val.ShrinkToBranch(node)
-			if newHeader != nil {
-				newTree = newHeader
-			}
+// Invalidate drops the header with the given hash and all of its descendants,
+// and moves the max td head to the best remaining branch. It returns the
+// dropped headers.
+func (t *HeaderTreeManager) Invalidate(hash common.Hash) []types.HeaderIntf {
+	target, ok := t.nodes[hash]
+	if !ok {
+		return nil
+	}
+	dropped := t.drop(target)
+
+	invalid := make(map[common.Hash]bool)
+	for _, header := range dropped {
+		invalid[header.Hash()] = true
+	}
+	confirmed := make([]types.HeaderIntf, 0, len(t.confirmed))
+	for _, header := range t.confirmed {
+		if !invalid[header.Hash()] {
+			confirmed = append(confirmed, header)
 		}
 	}
+	t.confirmed = confirmed
 
-	for _, val := range invalidHashes {
-		delete(t.trees, val)
+	// Reorg to the best remaining branch
+	t.maxTd = nil
+	if t.best != nil {
+		t.maxTd = t.best.self
 	}
-	if newTree != nil {
-		t.trees[newTree.self.Hash()] = newTree
-		t.rootHash = node.Hash()
-		return nil
-	} else {
-		return nil
+	t.persist()
+	return dropped
+}
+
+func (t *HeaderTreeManager) GetPendingCount() int {
+	return len(t.nodes)
+}
+
+//cut all node, only tree from node survived. Trees and branches which can't
+//descend from node anymore are garbage-collected.
+func (t *HeaderTreeManager) ReduceTo(node types.HeaderIntf) error {
+	newTree := t.nodes[node.Hash()]
+	if newTree != nil && newTree.parent != nil {
+		newTree.detach()
+		t.addTree(newTree)
 	}
+	for _, val := range t.trees {
+		if val == newTree {
+			continue
+		}
+		if val.self.NumberU64() < node.NumberU64() || !t.descendsFrom(val.self, node) {
+			t.unindex(val)
+			t.dropTree(val)
+		}
+	}
+	if newTree == nil {
+		// The confirmed block was never seen, root a new tree at it
+		t.AddNewHead(node)
+	}
+	t.setRoot(node.Hash())
+	return nil
+}
 
+// descendsFrom reports whether header may descend from ancestor, walking the
+// stored headers back to the height of ancestor. Headers with unknown ancestry
+// are assumed to descend from it.
+func (t *HeaderTreeManager) descendsFrom(header types.HeaderIntf, ancestor types.HeaderIntf) bool {
+	hash, number := header.Hash(), header.NumberU64()
+	for number > ancestor.NumberU64() {
+		parent := rawdb.ReadHeader(t.db, header.ParentHash(), number-1)
+		if parent == nil {
+			return true
+		}
+		header, hash, number = parent, parent.Hash(), number-1
+	}
+	return number == ancestor.NumberU64() && hash == ancestor.Hash()
 }
 
 func (t *HeaderTreeManager) SetConfirmed(head types.HeaderIntf) []types.HeaderIntf {
@@ -539,6 +735,7 @@ func (t *HeaderTreeManager) SetConfirmed(head types.HeaderIntf) []types.HeaderIn
 	t.ReduceTo(head)
 
 	t.confirmedHash = head.Hash()
+	t.persist()
 	//发送事件
 	return t.Pending()
 
@@ -0,0 +1,283 @@
+// Copyright 2018 The EDX Authors
+// This file is part of the EDX library.
+//
+// The edx library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The edx library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package qchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/EDXFund/MasterChain/common"
+	"github.com/EDXFund/MasterChain/core/rawdb"
+	"github.com/EDXFund/MasterChain/core/types"
+	"github.com/EDXFund/MasterChain/ethdb"
+)
+
+// makeShardHeaders creates n headers of a shard on top of parent, spread round
+// robin over the given number of forks.
+func makeShardHeaders(shardId uint16, parent types.HeaderIntf, n int, forks int) []types.HeaderIntf {
+	heads := make([]types.HeaderIntf, forks)
+	for i := range heads {
+		heads[i] = parent
+	}
+	headers := make([]types.HeaderIntf, 0, n)
+	for i := 0; i < n; i++ {
+		fork := i % forks
+		header := new(types.SHeader)
+		header.FillBy(&types.SHeaderStruct{
+			ShardId:     shardId,
+			ParentHash:  heads[fork].Hash(),
+			Coinbase:    common.Address{byte(fork)},
+			Number:      new(big.Int).Add(heads[fork].Number(), common.Big1),
+			Difficulty:  big.NewInt(int64(fork + 1)),
+			Time:        big.NewInt(int64(i)),
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		})
+		heads[fork] = header
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// makeTreeRoot creates the first header of a shard, rooting its header trees.
+func makeTreeRoot(shardId uint16) types.HeaderIntf {
+	root := new(types.SHeader)
+	root.FillBy(&types.SHeaderStruct{ShardId: shardId, Difficulty: big.NewInt(1), Number: big.NewInt(1), Time: new(big.Int)})
+	return root
+}
+
+// countingDB is a memory database counting the writes of its batches.
+type countingDB struct {
+	*ethdb.MemDatabase
+	writes int
+}
+
+func (db *countingDB) NewBatch() ethdb.Batch {
+	return &countingBatch{Batch: db.MemDatabase.NewBatch(), db: db}
+}
+
+type countingBatch struct {
+	ethdb.Batch
+	db *countingDB
+}
+
+func (b *countingBatch) Put(key []byte, value []byte) error {
+	b.db.writes++
+	return b.Batch.Put(key, value)
+}
+
+func (b *countingBatch) Delete(key []byte) error {
+	b.db.writes++
+	return b.Batch.Delete(key)
+}
+
+// Tests that updating the header trees only stores the heights that changed,
+// and deletes the ones left empty by confirmations.
+func TestHeaderTreePersistIncremental(t *testing.T) {
+	db := &countingDB{MemDatabase: ethdb.NewMemDatabase()}
+	root := makeTreeRoot(0)
+	headers := makeShardHeaders(0, root, 128, 2)
+
+	htm := NewHeaderTreeManager(0, db)
+	htm.AddNewHeads([]types.HeaderIntf{root})
+	for i, header := range headers {
+		db.writes = 0
+		htm.AddNewHeads([]types.HeaderIntf{header})
+
+		// The height of the header and the forest record
+		if db.writes != 2 {
+			t.Fatalf("header %d: write count mismatch: have %d, want 2", i, db.writes)
+		}
+	}
+	// Confirming a header of the second fork prunes the first fork and the
+	// ancestors of the header, rewriting only the heights they were at
+	confirmed := headers[2*16+1]
+	pruned := map[uint64]bool{root.NumberU64(): true}
+	for i, header := range headers {
+		if i%2 == 0 || header.NumberU64() < confirmed.NumberU64() {
+			pruned[header.NumberU64()] = true
+		}
+	}
+	db.writes = 0
+	htm.SetConfirmed(confirmed)
+
+	if want := len(pruned) + 1; db.writes != want {
+		t.Errorf("confirmation write count mismatch: have %d, want %d", db.writes, want)
+	}
+	for number := uint64(0); number <= headers[len(headers)-1].NumberU64(); number++ {
+		hashes := rawdb.ReadHeaderForestNodes(db, 0, number)
+		switch {
+		case number < confirmed.NumberU64() && len(hashes) != 0:
+			t.Errorf("height %d: pruned nodes left behind: %x", number, hashes)
+		case number >= confirmed.NumberU64() && len(hashes) != 1:
+			t.Errorf("height %d: node count mismatch: have %d, want 1", number, len(hashes))
+		}
+	}
+	forest := rawdb.ReadHeaderForest(db, 0)
+	if forest == nil || forest.Root != confirmed.Hash() || forest.Confirmed != confirmed.Hash() {
+		t.Fatalf("forest root mismatch: have %+v, want %x", forest, confirmed.Hash())
+	}
+	if forest.Low != confirmed.NumberU64() || forest.High != headers[len(headers)-1].NumberU64() {
+		t.Errorf("forest range mismatch: have [%d, %d], want [%d, %d]", forest.Low, forest.High, confirmed.NumberU64(), headers[len(headers)-1].NumberU64())
+	}
+}
+
+// Tests that a restarted manager rebuilds the header trees it persisted, without
+// the nodes it dropped or whose headers are gone.
+func TestHeaderTreeRestore(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	root := makeTreeRoot(0)
+	headers := makeShardHeaders(0, root, 60, 3)
+
+	rawdb.WriteHeader(db, root)
+	for _, header := range headers {
+		rawdb.WriteHeader(db, header)
+	}
+	htm := NewHeaderTreeManager(0, db)
+	htm.AddNewHeads(append([]types.HeaderIntf{root}, headers...))
+
+	// Confirm a header of the heaviest fork and drop its tip
+	var (
+		confirmed = headers[3*5+2]
+		tip       = headers[len(headers)-1]
+		parent    = headers[len(headers)-4]
+	)
+	htm.SetConfirmed(confirmed)
+	htm.RemoveHead(tip)
+	htm.AddNewHeads(nil)
+
+	want, err := htm.GetMaxTd()
+	if err != nil || want.Hash != parent.Hash() {
+		t.Fatalf("max td head mismatch: have %v (%v), want %x", want, err, parent.Hash())
+	}
+	restored := NewHeaderTreeManager(0, db)
+	if restored.rootHash != confirmed.Hash() || restored.confirmedHash != confirmed.Hash() {
+		t.Errorf("restored roots mismatch: have %x/%x, want %x", restored.rootHash, restored.confirmedHash, confirmed.Hash())
+	}
+	if restored.GetPendingCount() != htm.GetPendingCount() {
+		t.Errorf("restored node count mismatch: have %d, want %d", restored.GetPendingCount(), htm.GetPendingCount())
+	}
+	for hash, node := range htm.nodes {
+		if have := restored.nodes[hash]; have == nil || have.td != node.td {
+			t.Errorf("node %x: restored mismatch: have %v, want td %d", hash, have, node.td)
+		}
+	}
+	if have, err := restored.GetMaxTd(); err != nil || have.Hash != want.Hash || have.Td != want.Td {
+		t.Errorf("restored max td head mismatch: have %v (%v), want %v", have, err, want)
+	}
+	// Restore once more, with the header of the head gone from the database
+	rawdb.DeleteHeader(db, types.ShardMaster, parent.Hash(), parent.NumberU64())
+
+	restored = NewHeaderTreeManager(0, db)
+	if restored.GetPendingCount() != htm.GetPendingCount()-1 {
+		t.Errorf("node count without header mismatch: have %d, want %d", restored.GetPendingCount(), htm.GetPendingCount()-1)
+	}
+	if hashes := rawdb.ReadHeaderForestNodes(db, 0, parent.NumberU64()); len(hashes) != 0 {
+		t.Errorf("node without header left behind: %x", hashes)
+	}
+	if forest := rawdb.ReadHeaderForest(db, 0); forest.High != parent.NumberU64()-1 {
+		t.Errorf("forest high mismatch: have %d, want %d", forest.High, parent.NumberU64()-1)
+	}
+}
+
+// Tests that the confirmed headers extended along with the max td head match the
+// ones collected from scratch, across reorgs and invalidations.
+func TestHeaderTreeConfirmed(t *testing.T) {
+	root := makeTreeRoot(0)
+	light := makeShardHeaders(0, root, 20, 1)
+	heavy := makeShardHeaders(0, light[4], 30, 2)
+
+	htm := NewHeaderTreeManager(0, ethdb.NewMemDatabase())
+	htm.AddNewHeads([]types.HeaderIntf{root})
+
+	check := func(stage string) {
+		var want []types.HeaderIntf
+		if best := htm.best; best != nil && best.self.NumberU64() > root.NumberU64()+5 {
+			for node := best; node != nil; node = node.parent {
+				if node.self.NumberU64() <= best.self.NumberU64()-6 {
+					want = append([]types.HeaderIntf{node.self}, want...)
+				}
+			}
+		}
+		if len(htm.confirmed) != len(want) {
+			t.Fatalf("%s: confirmed count mismatch: have %d, want %d", stage, len(htm.confirmed), len(want))
+		}
+		for i := range want {
+			if htm.confirmed[i].Hash() != want[i].Hash() {
+				t.Fatalf("%s: confirmed header %d mismatch: have %x, want %x", stage, i, htm.confirmed[i].Hash(), want[i].Hash())
+			}
+		}
+	}
+	for i, header := range light {
+		htm.AddNewHeads([]types.HeaderIntf{header})
+		check(fmt.Sprintf("light %d", i))
+	}
+	// Reorg onto the heavier fork, branching off below the confirmed headers
+	for i, header := range heavy {
+		htm.AddNewHeads([]types.HeaderIntf{header})
+		check(fmt.Sprintf("heavy %d", i))
+	}
+	// Invalidate the heavy forks and fall back to the light one
+	htm.Invalidate(heavy[1].Hash())
+	htm.Invalidate(heavy[0].Hash())
+	htm.AddNewHeads(nil)
+	check("invalidated")
+
+	if htm.maxTd.Hash() != light[len(light)-1].Hash() {
+		t.Errorf("max td head mismatch: have %x, want %x", htm.maxTd.Hash(), light[len(light)-1].Hash())
+	}
+}
+
+// Benchmarks the insertion of headers into the header trees of a shard already
+// holding a given number of pending headers, including the update of the max td
+// head, of the confirmed headers and of the stored forest. The cost of an
+// insertion should not depend on the number of headers pending.
+func BenchmarkHeaderTreeInsert1K(b *testing.B)       { benchmarkHeaderTreeInsert(b, 1000, 1) }
+func BenchmarkHeaderTreeInsert10K(b *testing.B)      { benchmarkHeaderTreeInsert(b, 10000, 1) }
+func BenchmarkHeaderTreeInsertForks1K(b *testing.B)  { benchmarkHeaderTreeInsert(b, 1000, 16) }
+func BenchmarkHeaderTreeInsertForks10K(b *testing.B) { benchmarkHeaderTreeInsert(b, 10000, 16) }
+
+func benchmarkHeaderTreeInsert(b *testing.B, pending int, forks int) {
+	root := makeTreeRoot(0)
+	headers := makeShardHeaders(0, root, pending+b.N, forks)
+
+	htm := NewHeaderTreeManager(0, ethdb.NewMemDatabase())
+	htm.AddNewHead(root)
+	for _, header := range headers[:pending] {
+		htm.AddNewHead(header)
+	}
+	htm.AddNewHeads(nil)
+
+	b.ResetTimer()
+	for _, header := range headers[pending:] {
+		htm.AddNewHeads([]types.HeaderIntf{header})
+	}
+	b.StopTimer()
+
+	if count := htm.GetPendingCount(); count != pending+b.N+1 {
+		b.Fatalf("pending count mismatch: have %d, want %d", count, pending+b.N+1)
+	}
+	// The fork of the highest difficulty must be the one leading
+	want := headers[len(headers)-1]
+	for i := len(headers) - 1; want.Coinbase() != (common.Address{byte(forks - 1)}); i-- {
+		want = headers[i]
+	}
+	if head, err := htm.GetMaxTd(); err != nil || head.Hash != want.Hash() {
+		b.Fatalf("max td head mismatch: have %v (%v), want %x", head, err, want.Hash())
+	}
+}
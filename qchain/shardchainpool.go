@@ -51,6 +51,9 @@ type ShardChainPool struct {
 	masterBlockCh   chan core.ChainHeadEvent
 	masterBlockSub  event.Subscription
 
+	fraudCh  chan core.FraudProofEvent //shard block proven invalid
+	fraudSub event.Subscription
+
 	quitCh           chan struct{}
 	mu               sync.RWMutex
 	shardHeaderInfos *lru.Cache
@@ -62,6 +65,7 @@ type ShardChainPool struct {
 
 	newShardFeed        event.Feed
 	masterBlockProcFeed event.Feed //new masterblock has arrived
+	shardHeadFeed       event.Feed //master chain confirmed a new shard head
 	scope               event.SubscriptionScope
 }
 
@@ -74,14 +78,20 @@ func NewShardChainPool(bc *core.BlockChain, database ethdb.Database) *ShardChain
 		//shardFeed :=
 		shardCh:       make(chan *core.ChainsShardEvent),
 		masterBlockCh: make(chan core.ChainHeadEvent),
+		fraudCh:       make(chan core.FraudProofEvent),
 		pending:       make(map[uint16]PendingShard),
 		quitCh:        make(chan struct{}),
 	}
 	pool.shardHeaderInfos, _ = lru.New(sheaderCacheLimit)
 	pool.shardHeaders, _ = lru.New(stdCacheLimit)
 	pool.shardBlocks, _ = lru.New(snumberCacheLimit)
+	// Rebuild the unconfirmed shard forks persisted by a previous run
+	for _, shardId := range rawdb.ReadHeaderForestShards(database) {
+		pool.shards[shardId] = NewHeaderTreeManager(shardId, database)
+	}
 	pool.shardSub = bc.SubscribeChainShardsEvent(pool.shardCh)
 	pool.masterBlockSub = bc.SubscribeChainHeadEvent(pool.masterBlockCh)
+	pool.fraudSub = bc.SubscribeFraudProofEvent(pool.fraudCh)
 
 	//defer pool.headSub.Unsubscribe()
 
@@ -91,6 +101,7 @@ func NewShardChainPool(bc *core.BlockChain, database ethdb.Database) *ShardChain
 func (scp *ShardChainPool) Stop() {
 	scp.shardSub.Unsubscribe()
 	scp.masterBlockSub.Unsubscribe()
+	scp.fraudSub.Unsubscribe()
 	close(scp.quitCh)
 	scp.scope.Close()
 
@@ -103,6 +114,8 @@ func (scp *ShardChainPool) loop() {
 			scp.InsertChain(headers.Block)
 		case masterBlock := <-scp.masterBlockCh: //block use chainHeadEvent feed to notify chain head info
 			scp.reset(scp.currenMasterBlock, masterBlock.Block)
+		case ev := <-scp.fraudCh:
+			scp.invalidate(ev.Proof)
 		case <-scp.quitCh:
 			return
 		}
@@ -164,7 +177,10 @@ func (scp *ShardChainPool) GetHeaderByHash(hash common.Hash, shardId uint16) typ
 	if sBlock != nil {
 		return sBlock.Header()
 	}
-
+	// The body of the block may have been pruned, its header is kept
+	if number := rawdb.ReadHeaderNumber(scp.db, hash); number != nil {
+		return rawdb.ReadHeader(scp.db, hash, *number)
+	}
 	return nil
 }
 
@@ -218,9 +234,24 @@ func (scp *ShardChainPool) insertShardChain(blocks []*types.SBlock) error {
 	if !ok {
 		qchain = NewHeaderTreeManager(shardId, scp.db)
 		scp.shards[shardId] = qchain
+
+		shards := make([]uint16, 0, len(scp.shards))
+		for id := range scp.shards {
+			shards = append(shards, id)
+		}
+		rawdb.WriteHeaderForestShards(scp.db, shards)
 	}
 	header := []types.HeaderIntf{}
 	for _, item := range blocks {
+		// Drop blocks proven invalid, and any block built on one
+		if cause := rawdb.ReadInvalidShardBlock(scp.db, item.Hash()); cause != (common.Hash{}) {
+			continue
+		}
+		if cause := rawdb.ReadInvalidShardBlock(scp.db, item.ParentHash()); cause != (common.Hash{}) {
+			log.Debug("Dropping descendant of invalid shard block", "shard", shardId, "number", item.NumberU64(), "hash", item.Hash())
+			rawdb.WriteInvalidShardBlock(scp.db, item.Hash(), cause)
+			continue
+		}
 		scp.shardBlocks.Add(item.Hash(), item)
 		header = append(header, item.Header())
 	}
@@ -241,6 +272,24 @@ func (scp *ShardChainPool) insertShardChain(blocks []*types.SBlock) error {
 	return nil
 }
 
+// invalidate removes the shard block disputed by a fraud proof, along with all
+// of its descendants, from the pool so that it is never packed into a master
+// block.
+func (scp *ShardChainPool) invalidate(proof *types.FraudProof) {
+	scp.mu.Lock()
+	defer scp.mu.Unlock()
+
+	qchain, ok := scp.shards[proof.Block.ShardId()]
+	if !ok {
+		return
+	}
+	cause := proof.Hash()
+	for _, header := range qchain.Invalidate(cause) {
+		rawdb.WriteInvalidShardBlock(scp.db, header.Hash(), cause)
+		scp.shardBlocks.Remove(header.Hash())
+	}
+}
+
 /**
 return all max Tds block info of shard
 */
@@ -258,6 +307,19 @@ func (scp *ShardChainPool) GetMaxTds() map[uint16]types.ShardBlockInfo {
 	return results
 }
 
+// PendingCounts returns the number of headers in the unconfirmed header tree of
+// every shard.
+func (scp *ShardChainPool) PendingCounts() map[uint16]int {
+	scp.mu.RLock()
+	defer scp.mu.RUnlock()
+
+	results := make(map[uint16]int, len(scp.shards))
+	for shardId, shard := range scp.shards {
+		results[shardId] = shard.GetPendingCount()
+	}
+	return results
+}
+
 //miner's worker uses Pending to retrieve shardblockInfos which could be packed into master block
 func (scp *ShardChainPool) Pending() (map[uint16]PendingShard, error) {
 	scp.mu.Lock()
@@ -367,6 +429,7 @@ func (scp *ShardChainPool) reset(oldHead, newHead types.BlockIntf) {
 		scp.insertShardChain(blocks)
 	}
 
+	heads := make([]core.ShardChainHeadEvent, 0, len(mostRecentBlock))
 	for shardId, mostRecent := range mostRecentBlock {
 		qchain, ok := scp.shards[shardId]
 		if !ok {
@@ -375,7 +438,17 @@ func (scp *ShardChainPool) reset(oldHead, newHead types.BlockIntf) {
 			log.Trace(" confirm most recent:", "block number:", mostRecent.NumberU64())
 			qchain.SetConfirmed(mostRecent.Header())
 		}
+		if scp.writeCanonical(shardId, mostRecent.Hash(), mostRecent.NumberU64()) {
+			heads = append(heads, core.ShardChainHeadEvent{Block: mostRecent.ToSBlock()})
+		}
+	}
+	// Shard blocks packed into the master chain are persisted, stop caching them
+	for _, shard := range newHead.ShardBlocks() {
+		scp.shardBlocks.Remove(shard.Hash)
 	}
 	scp.currenMasterBlock = newHead
 	scp.masterBlockProcFeed.Send(core.ChainHeadEvent{Block: newHead})
+	for _, head := range heads {
+		scp.shardHeadFeed.Send(head)
+	}
 }